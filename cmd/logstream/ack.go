@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"logstream/internal/ingestion"
+	"logstream/pkg/models"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ackTimeout bounds how long an acknowledged ingest waits for its entries to be stored
+var ackTimeout = 5 * time.Second
+
+// Per-entry statuses reported by /ingest/batch
+const (
+	statusAccepted = "accepted" // Queued; only reported without ack=true
+	statusStored   = "stored"   // Written to the store
+	statusRejected = "rejected" // Failed validation, don't retry as-is
+	statusFailed   = "failed"   // Not stored (queue full, evicted), safe to retry
+	statusUnknown  = "unknown"  // Queued but not stored within the ack timeout; it may still be, so a retry can duplicate it
+
+	// Stored, but its WAL write failed, so a crash can lose it; a retry would store it twice
+	statusStoredNotDurable = "stored_not_durable"
+)
+
+// entryResult is the outcome of one entry in a batch
+type entryResult struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// wantsAck reports whether the client asked to be answered only once entries are stored
+func wantsAck(r *http.Request) bool {
+	return r.URL.Query().Get("ack") == "true"
+}
+
+// ingestAcked stores an entry through the queue, bounded by the request and ackTimeout
+func ingestAcked(r *http.Request, entry models.LogEntry) error {
+	ctx, cancel := context.WithTimeout(r.Context(), ackTimeout)
+	defer cancel()
+	return ingestor.IngestAcked(ctx, entry)
+}
+
+// ackOutcomeUnknown reports whether an IngestAcked error means the wait ended
+// with the entry still queued, so it may yet be stored
+func ackOutcomeUnknown(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// ackErrorStatus maps an IngestAcked error to an HTTP status code
+func ackErrorStatus(err error) int {
+	if ackOutcomeUnknown(err) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusServiceUnavailable
+}
+
+// handleIngestBatch ingests an array of entries and reports a result per entry.
+// With ack=true it answers only after every accepted entry is stored.
+func handleIngestBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, err := decodeEntries(r)
+	if err != nil {
+		ingestor.RecordRejected(models.SourceHTTP, ingestion.DropParseFailure, nil, err.Error())
+		http.Error(w, "Invalid body, expected an array of log entries: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ack := wantsAck(r)
+	results := make([]entryResult, len(entries))
+	var wg sync.WaitGroup
+
+	for i, entry := range entries {
+		entry.Source = models.SourceHTTP
+		results[i] = entryResult{Index: i}
+
+		if err := authorizeEntry(r.Context(), &entry); err != nil {
+			ingestor.RecordRejected(models.SourceHTTP, ingestion.DropUnauthorized, &entry, err.Error())
+			results[i].Status = statusRejected
+			results[i].Error = err.Error()
+			continue
+		}
+		if err := entry.Validate(); err != nil {
+			ingestor.RecordRejected(models.SourceHTTP, ingestion.DropValidation, &entry, err.Error())
+			results[i].Status = statusRejected
+			results[i].Error = err.Error()
+			continue
+		}
+		entry.FillDefaults()
+		results[i].ID = entry.ID
+
+		if !ack {
+			if ingestor.Ingest(entry) {
+				results[i].Status = statusAccepted
+			} else {
+				results[i].Status = statusFailed
+				results[i].Error = ingestion.ErrQueueFull.Error()
+			}
+			continue
+		}
+
+		// Queue every entry before waiting so the batch is stored in parallel
+		wg.Add(1)
+		go func(result *entryResult, entry models.LogEntry) {
+			defer wg.Done()
+			if err := ingestAcked(r, entry); err != nil {
+				switch {
+				case errors.Is(err, ingestion.ErrNotDurable):
+					result.Status = statusStoredNotDurable
+				case ackOutcomeUnknown(err):
+					result.Status = statusUnknown
+				default:
+					result.Status = statusFailed
+				}
+				result.Error = err.Error()
+				return
+			}
+			result.Status = statusStored
+		}(&results[i], entry)
+	}
+	wg.Wait()
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"counts":  counts,
+		"results": results,
+	})
+}
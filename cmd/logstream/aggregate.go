@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"logstream/internal/storage"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxHistogramBuckets caps how many intervals one /aggregate request spans
+const maxHistogramBuckets = 10000
+
+// aggregateRequest is a validated /aggregate request
+type aggregateRequest struct {
+	filter   storage.Filter
+	groupBy  string
+	interval time.Duration
+}
+
+// parseAggregate reads the /logs filters, group_by and interval, defaulting
+// to one-minute intervals over the last hour
+func parseAggregate(params url.Values) (aggregateRequest, error) {
+	filter, err := parseFilter(params)
+	if err != nil {
+		return aggregateRequest{}, err
+	}
+	request := aggregateRequest{filter: filter, groupBy: params.Get("group_by"), interval: time.Minute}
+	switch request.groupBy {
+	case "", "level", "service", "node":
+	default:
+		return request, fmt.Errorf("Invalid group_by, expected level, service or node")
+	}
+	if value := params.Get("interval"); value != "" {
+		if request.interval, err = time.ParseDuration(value); err != nil || request.interval < time.Second {
+			return request, fmt.Errorf("Invalid interval, expected a duration of at least 1s, e.g. 1m or 1h")
+		}
+	}
+	if request.filter.End.IsZero() {
+		request.filter.End = time.Now()
+	}
+	if request.filter.Start.IsZero() {
+		request.filter.Start = request.filter.End.Add(-1 * time.Hour)
+	}
+	if request.filter.End.Before(request.filter.Start) {
+		return request, fmt.Errorf("end is before start")
+	}
+	if request.filter.End.Sub(request.filter.Start)/request.interval >= maxHistogramBuckets {
+		return request, fmt.Errorf("The range spans more than %d intervals; use a longer interval", maxHistogramBuckets)
+	}
+	return request, nil
+}
+
+// buckets counts the matching logs per interval, by the store where it can
+// rather than from the logs themselves
+func (request aggregateRequest) buckets(store storage.Store) []storage.HistogramBucket {
+	if histogrammer, ok := store.(storage.Histogrammer); ok {
+		return histogrammer.Histogram(request.filter, request.groupBy, request.interval)
+	}
+	return storage.HistogramOf(store.Find(request.filter), request.groupBy, request.interval)
+}
+
+// handleAggregate returns log counts per time interval and group, e.g.
+// /aggregate?group_by=level&interval=1m&start=...&end=...
+func handleAggregate(w http.ResponseWriter, r *http.Request) {
+	request, err := parseAggregate(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	store, ok := requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"start":    request.filter.Start,
+		"end":      request.filter.End,
+		"interval": request.interval.String(),
+		"group_by": request.groupBy,
+		"buckets":  request.buckets(store),
+	})
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"logstream/internal/alerting"
+	"logstream/internal/storage"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// alertsPrefix is the path of the alert history endpoints
+const alertsPrefix = "/alerts"
+
+// handleAlerts pages through triggered alerts, newest first, e.g.
+// /alerts?since=-12h&rule=Critical+Errors&limit=50&offset=50
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	var since time.Time
+	if value := params.Get("since"); value != "" {
+		var err error
+		if since, err = parseTimeBound(value, time.Now()); err != nil {
+			http.Error(w, "Invalid since, expected RFC 3339, now or a relative time like -12h: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	page, _, err := parsePage(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	alerts := alertMgr.Alerts(since)
+	if alerts == nil {
+		alerts = []alerting.Alert{}
+	}
+	if rule := params.Get("rule"); rule != "" {
+		alerts = slices.DeleteFunc(alerts, func(alert alerting.Alert) bool { return alert.RuleName != rule })
+	}
+	slices.Reverse(alerts)
+
+	total := len(alerts)
+	alerts = alerts[min(page.offset, total):min(total, page.offset+page.limit)]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":       len(alerts),
+		"total":       total,
+		"alerts":      alerts,
+		"next_offset": page.offset + len(alerts),
+		"has_more":    page.offset+len(alerts) < total,
+	})
+}
+
+// handleAlertAction serves /alerts/{id}/ack: POST {"by": "alice"}
+// acknowledges the alert's incident, so it stops notifying until it resolves
+func handleAlertAction(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, alertsPrefix+"/"), "/ack")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		By string `json:"by"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+		http.Error(w, "Invalid body, expected {\"by\": \"name\"}: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.By = strings.TrimSpace(body.By); body.By == "" {
+		http.Error(w, "Missing by, expected who acknowledges the alert", http.StatusBadRequest)
+		return
+	}
+
+	ack, err := alertMgr.Acknowledge(id, body.By)
+	switch {
+	case errors.Is(err, alerting.ErrAlertNotFound):
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	case errors.Is(err, alerting.ErrIncidentResolved):
+		http.Error(w, "Alert's incident already resolved", http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "acknowledged": ack})
+}
+
+// silenceRequest is the body of POST /alerts/silences. start defaults to now,
+// and the silence lasts until end or for duration.
+type silenceRequest struct {
+	Rule      string `json:"rule"`
+	Service   string `json:"service"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	Duration  string `json:"duration"`
+	CreatedBy string `json:"created_by"`
+	Comment   string `json:"comment"`
+}
+
+// listedSilence is a silence as GET /alerts/silences shows it
+type listedSilence struct {
+	alerting.Silence
+	Active bool `json:"active"`
+}
+
+// handleSilences lists silences that haven't ended (GET) or adds one (POST)
+func handleSilences(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		now := time.Now()
+		silences := make([]listedSilence, 0)
+		for _, silence := range alertMgr.Silences() {
+			silences = append(silences, listedSilence{Silence: silence, Active: silence.Active(now)})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"count": len(silences), "silences": silences})
+	case http.MethodPost:
+		requireAdmin(addSilence)(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// addSilence decodes, checks and adds a silence from the body
+func addSilence(w http.ResponseWriter, r *http.Request) {
+	var request silenceRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&request); err != nil {
+		http.Error(w, "Invalid body, expected a silence: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Rule == "" && request.Service == "" {
+		http.Error(w, "Missing rule or service, expected at least one to match alerts by", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	silence := alerting.Silence{
+		Rule:      request.Rule,
+		Service:   request.Service,
+		Start:     now,
+		CreatedBy: request.CreatedBy,
+		Comment:   request.Comment,
+	}
+	if request.Start != "" {
+		start, err := parseTimeBound(request.Start, now)
+		if err != nil {
+			http.Error(w, "Invalid start, expected RFC 3339, now or a relative time like -15m: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		silence.Start = start
+	}
+	switch {
+	case request.End != "" && request.Duration != "":
+		http.Error(w, "Expected end or duration, not both", http.StatusBadRequest)
+		return
+	case request.End != "":
+		end, err := time.Parse(time.RFC3339, request.End)
+		if err != nil {
+			http.Error(w, "Invalid end, expected RFC 3339: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		silence.End = end
+	case request.Duration != "":
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, "Invalid duration, expected a positive duration, e.g. 2h", http.StatusBadRequest)
+			return
+		}
+		silence.End = silence.Start.Add(duration)
+	default:
+		http.Error(w, "Missing end or duration, expected when the silence ends", http.StatusBadRequest)
+		return
+	}
+	if !silence.End.After(silence.Start) || !silence.End.After(now) {
+		http.Error(w, "Invalid end, expected it after start and in the future", http.StatusBadRequest)
+		return
+	}
+
+	silence = alertMgr.AddSilence(silence)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", alertsPrefix+"/silences/"+silence.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(silence)
+}
+
+// handleSilence serves /alerts/silences/{id}: DELETE ends the silence early
+func handleSilence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !alertMgr.RemoveSilence(strings.TrimPrefix(r.URL.Path, alertsPrefix+"/silences/")) {
+		http.Error(w, "Silence not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxDryRunHours bounds how far back a dry run replays logs
+const maxDryRunHours = 168
+
+// dryRunRequest is the body of POST /alerts/rules/test: a rule as written in
+// an -alert-rules file and the hours of stored logs to replay it over
+type dryRunRequest struct {
+	Rule  alerting.RuleConfig `json:"rule"`
+	Hours int                 `json:"hours"`
+}
+
+// ruleFilter narrows down the logs a dry run reads to those the rule could
+// count: its levels, service and pattern, and the equality matchers of its
+// condition. DryRun checks the whole rule on each.
+func ruleFilter(rule alerting.AlertRule, start, end time.Time) (storage.Filter, error) {
+	filter := storage.Filter{
+		Level:    rule.Level,
+		MinLevel: rule.MinLevel,
+		Service:  rule.Service,
+		Message:  rule.Pattern, // Ignores case, so it keeps every log the pattern matches
+		Start:    start,
+		End:      end,
+	}
+	if rule.Condition == "" {
+		return filter, nil
+	}
+	condition, err := alerting.ParseCondition(rule.Condition)
+	if err != nil {
+		return filter, err
+	}
+	if filter.Level == "" && filter.MinLevel == "" {
+		filter.Level, _ = condition.Equal("level")
+	}
+	if filter.Service == "" {
+		filter.Service, _ = condition.Equal("service")
+	}
+	filter.ID, _ = condition.Equal("id")
+	filter.Node, _ = condition.Equal("node")
+	filter.Metadata, filter.MetadataOptions = condition.MetadataEqual()
+	return filter, nil
+}
+
+// handleRuleTest replays the stored logs of the past hours (24 by default)
+// through a prospective rule and reports when it would have fired, e.g.
+// POST /alerts/rules/test {"rule": {"level": "ERROR", "threshold": 20, "window": "5m"}, "hours": 48}
+func handleRuleTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	request := dryRunRequest{Hours: 24}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		http.Error(w, "Invalid body, expected {\"rule\": {...}, \"hours\": 24}: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Hours < 1 || request.Hours > maxDryRunHours {
+		http.Error(w, fmt.Sprintf("Invalid hours, expected 1 to %d", maxDryRunHours), http.StatusBadRequest)
+		return
+	}
+	if request.Rule.Name == "" {
+		request.Rule.Name = "Dry Run"
+	}
+	rule, err := request.Rule.Build()
+	if err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rule.ResolveAfter == 0 {
+		rule.ResolveAfter = defaultResolveAfter
+	}
+
+	end := time.Now()
+	start := end.Add(-time.Duration(request.Hours) * time.Hour)
+	filter, err := ruleFilter(rule, start, end)
+	if err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	logs, partial := findGuarded(r.Context(), store, filter)
+	alerts, err := alerting.DryRun(rule, logs, start, end)
+	if err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fired := 0
+	incidents := 0
+	for _, alert := range alerts {
+		if alert.Status == alerting.StatusFiring {
+			fired++
+			if alert.Incident == alert.ID {
+				incidents++
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rule":      rule.Name,
+		"start":     start,
+		"end":       end,
+		"logs":      len(logs),
+		"partial":   partial,
+		"fired":     fired,
+		"incidents": incidents,
+		"alerts":    alerts,
+	})
+}
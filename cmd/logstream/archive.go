@@ -0,0 +1,61 @@
+package main
+
+import (
+	"logstream/internal/archive"
+	"logstream/internal/storage"
+	"path/filepath"
+	"time"
+)
+
+// archiveStopTimeout is how long shutdown waits for queued batches to upload
+const archiveStopTimeout = 30 * time.Second
+
+// archiver uploads logs evicted from the memory store (nil when disabled)
+var archiver *archive.Archiver
+
+// startArchiver uploads the memory store's evicted batches to the bucket in
+// rawURL, spilling those it can't upload in time to dataDir
+func startArchiver(memoryStore *storage.MemoryStore, rawURL, endpoint, region, dataDir string) (func() error, error) {
+	uploader, prefix, err := bucketUploader(rawURL, endpoint, region)
+	if err != nil {
+		return nil, err
+	}
+
+	archiver = archive.NewArchiver(archive.Config{Prefix: prefix, SpillDir: filepath.Join(dataDir, "archive-spill")}, uploader)
+	archiver.Start()
+	memoryStore.SetEvictionHandler(archiver.Archive)
+
+	return func() error {
+		return archiver.Stop(archiveStopTimeout)
+	}, nil
+}
+
+// bucketUploader creates an uploader for the s3:// or gs:// bucket in rawURL
+// and returns it with the URL's key prefix. Credentials come from the AWS
+// SDK's default chain (HMAC keys as AWS_* variables for GCS).
+func bucketUploader(rawURL, endpoint, region string) (*archive.S3Uploader, string, error) {
+	config, prefix, err := archive.ParseURL(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if endpoint != "" {
+		config.Endpoint = endpoint
+	}
+	if region != "" {
+		config.Region = region
+	}
+	uploader, err := archive.NewS3Uploader(config)
+	if err != nil {
+		return nil, "", err
+	}
+	return uploader, prefix, nil
+}
+
+// archiveStats returns the archiving counters, or nil when archiving is disabled
+func archiveStats() *archive.Stats {
+	if archiver == nil {
+		return nil
+	}
+	stats := archiver.Stats()
+	return &stats
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"logstream/pkg/models"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// correlationKeys are the metadata keys /correlate takes as parameters
+var correlationKeys = []string{"request_id", "trace_id", "correlation_id"}
+
+// correlatedService is how one service took part in a correlated request
+type correlatedService struct {
+	Service string    `json:"service"`
+	Count   int       `json:"count"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+}
+
+// parseCorrelation reads the identifier to correlate on: one of
+// correlationKeys, or any metadata key as key=...&value=...
+func parseCorrelation(params url.Values) (key, value string, err error) {
+	for _, name := range correlationKeys {
+		if params.Has(name) {
+			if key != "" {
+				return "", "", fmt.Errorf("Expected one of %s, not several", strings.Join(correlationKeys, ", "))
+			}
+			key, value = name, params.Get(name)
+		}
+	}
+	if params.Has("key") {
+		if key != "" {
+			return "", "", fmt.Errorf("Expected key and value or one of %s, not both", strings.Join(correlationKeys, ", "))
+		}
+		key, value = strings.TrimPrefix(params.Get("key"), "metadata."), params.Get("value")
+	}
+	if key == "" || value == "" {
+		return "", "", fmt.Errorf("Missing identifier, expected one of %s, or key and value", strings.Join(correlationKeys, ", "))
+	}
+	return key, value, nil
+}
+
+// handleCorrelate returns every log sharing a request or trace ID, across
+// services and oldest first, e.g. /correlate?request_id=abc123
+func handleCorrelate(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	key, value, err := parseCorrelation(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The other /logs filters narrow it down; the identifier is a metadata
+	// filter, answered from the index when the key is in -memory-index-metadata
+	filterParams := url.Values{}
+	for name, values := range params {
+		if !slices.Contains(correlationKeys, name) && name != "key" && name != "value" && name != "limit" {
+			filterParams[name] = values
+		}
+	}
+	filterParams.Set("metadata."+key, value)
+	filter, err := parseFilter(filterParams)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultPageSize
+	if value := params.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxPageSize {
+			http.Error(w, "Invalid limit, expected 1-"+strconv.Itoa(maxPageSize), http.StatusBadRequest)
+			return
+		}
+	}
+	store, ok := requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	logs, partial := findGuarded(r.Context(), store, filter)
+	slices.SortStableFunc(logs, func(a, b models.LogEntry) int { return a.Timestamp.Compare(b.Timestamp) })
+
+	// Services in the order the request reached them
+	services := make([]correlatedService, 0)
+	index := make(map[string]int)
+	for _, entry := range logs {
+		i, ok := index[entry.Service]
+		if !ok {
+			i = len(services)
+			index[entry.Service] = i
+			services = append(services, correlatedService{Service: entry.Service, First: entry.Timestamp})
+		}
+		services[i].Count++
+		services[i].Last = entry.Timestamp
+	}
+
+	response := map[string]interface{}{
+		"key":      key,
+		"value":    value,
+		"total":    len(logs),
+		"services": services,
+		"logs":     logs[:min(len(logs), limit)],
+		"partial":  partial,
+	}
+	if len(logs) > 0 {
+		start, end := logs[0].Timestamp, logs[len(logs)-1].Timestamp
+		response["start"] = start
+		response["end"] = end
+		response["duration"] = end.Sub(start).String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
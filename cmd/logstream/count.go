@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"logstream/internal/storage"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// parseCountOnly reads count_only, which asks a query endpoint for the number
+// of matches alone
+func parseCountOnly(params url.Values) (bool, error) {
+	value := params.Get("count_only")
+	if value == "" {
+		return false, nil
+	}
+	countOnly, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("Invalid count_only, expected true or false")
+	}
+	return countOnly, nil
+}
+
+// countGuarded counts the logs the filter matches within queryTimeout, from
+// the store's indexes where it can. No entries are returned, so
+// maxQueryResults doesn't apply.
+func countGuarded(ctx context.Context, store storage.Store, filter storage.Filter) (int, bool) {
+	if queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+	}
+	return storage.CountMatches(ctx, store, filter)
+}
+
+// writeCount answers a count_only request
+func writeCount(w http.ResponseWriter, count int, partial bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":   count,
+		"partial": partial,
+	})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"logstream/internal/ingestion"
+	"logstream/internal/sources"
+	"logstream/pkg/models"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Limits for CSV imports
+const (
+	maxCSVUpload       = 512 << 20 // Bytes per uploaded file
+	maxCSVJobs         = 50        // Finished jobs kept for status queries
+	maxCSVErrorSamples = 20        // Row errors kept per job
+)
+
+// csvJobStatus is the progress of a CSV import as reported by /ingest/csv/jobs
+type csvJobStatus struct {
+	ID         string     `json:"id"`
+	File       string     `json:"file"`
+	Status     string     `json:"status"` // running, done or failed
+	TotalBytes int64      `json:"total_bytes"`
+	BytesRead  int64      `json:"bytes_read"`
+	Rows       uint64     `json:"rows"`
+	Ingested   uint64     `json:"ingested"`
+	Rejected   uint64     `json:"rejected"`
+	Progress   float64    `json:"progress"` // 0-1, by bytes read
+	Errors     []string   `json:"errors,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// csvJob tracks one background CSV import
+type csvJob struct {
+	status    csvJobStatus // Guarded by mu, apart from the counters below
+	bytesRead int64
+	rows      uint64
+	ingested  uint64
+	rejected  uint64
+	mu        sync.Mutex
+}
+
+// csvJobs holds running and recently finished imports
+var csvJobs = struct {
+	jobs map[string]*csvJob
+	mu   sync.Mutex
+}{jobs: make(map[string]*csvJob)}
+
+// countingReader counts bytes read so far for progress reporting
+type countingReader struct {
+	reader io.Reader
+	count  *int64
+}
+
+func (cr countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	atomic.AddInt64(cr.count, int64(n))
+	return n, err
+}
+
+// handleCSVUpload accepts a multipart CSV upload and imports it in the background
+func handleCSVUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCSVUpload)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Expected a multipart upload with a \"file\" field: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	mapping := sources.DefaultCSVMapping()
+	for field, target := range map[string]*string{
+		"timestamp_column": &mapping.Timestamp,
+		"level_column":     &mapping.Level,
+		"message_column":   &mapping.Message,
+		"service_column":   &mapping.Service,
+		"timestamp_format": &mapping.TimestampFormat,
+		"service":          &mapping.DefaultService,
+		"level":            &mapping.DefaultLevel,
+	} {
+		if value := r.FormValue(field); value != "" {
+			*target = value
+		}
+	}
+
+	// The upload only lives as long as the request, so keep a copy for the job
+	tmp, err := os.CreateTemp("", "logstream-csv-*")
+	if err != nil {
+		http.Error(w, "Failed to buffer upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	size, err := io.Copy(tmp, file)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		http.Error(w, "Failed to buffer upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the header up front so a bad mapping fails the request, not the job
+	job := &csvJob{
+		status: csvJobStatus{
+			ID:         uuid.New().String(),
+			File:       header.Filename,
+			Status:     "running",
+			TotalBytes: size,
+			StartedAt:  time.Now(),
+		},
+	}
+	reader, err := sources.NewCSVReader(countingReader{reader: tmp, count: &job.bytesRead}, mapping)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		http.Error(w, "Invalid CSV: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	addCSVJob(job)
+	go runCSVJob(r.Context(), job, reader, tmp)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":     "import started",
+		"job_id":     job.status.ID,
+		"status_url": "/ingest/csv/jobs?id=" + job.status.ID,
+	})
+}
+
+// runCSVJob ingests every row of an uploaded CSV. Imports are historical data,
+// so rows are stored like backfilled entries without alert evaluation.
+func runCSVJob(requestCtx context.Context, job *csvJob, reader *sources.CSVReader, tmp *os.File) {
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Keep the principal for service binding, but not the request's cancellation
+	ctx := context.WithoutCancel(requestCtx)
+
+	var failure error
+	for {
+		entry, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		atomic.AddUint64(&job.rows, 1)
+
+		if err == nil {
+			if err = authorizeEntry(ctx, &entry); err != nil {
+				err = fmt.Errorf("line %d: %w", reader.Line(), err)
+				ingestor.RecordRejected(models.SourceCSV, ingestion.DropUnauthorized, &entry, err.Error())
+			} else if err = entry.Validate(); err != nil {
+				err = fmt.Errorf("line %d: %w", reader.Line(), err)
+				ingestor.RecordRejected(models.SourceCSV, ingestion.DropValidation, &entry, err.Error())
+			}
+		} else {
+			ingestor.RecordRejected(models.SourceCSV, ingestion.DropParseFailure, nil, err.Error())
+		}
+
+		if err != nil {
+			atomic.AddUint64(&job.rejected, 1)
+			job.addError(err)
+
+			// A broken CSV structure means the rest of the file can't be trusted
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				failure = err
+				break
+			}
+			continue
+		}
+
+		entry.FillDefaults()
+		if err := ingestor.Backfill(entry); err != nil {
+			atomic.AddUint64(&job.rejected, 1)
+			job.addError(fmt.Errorf("line %d: %w", reader.Line(), err))
+			continue
+		}
+		atomic.AddUint64(&job.ingested, 1)
+	}
+
+	job.mu.Lock()
+	now := time.Now()
+	job.status.FinishedAt = &now
+	job.status.Status = "done"
+	if failure != nil {
+		job.status.Status = "failed"
+	}
+	job.mu.Unlock()
+
+	status := job.snapshot()
+	fmt.Printf("📄 CSV import %s (%s) %s: %d rows, %d ingested, %d rejected\n",
+		status.ID, status.File, status.Status, status.Rows, status.Ingested, status.Rejected)
+}
+
+// addError keeps the first few row errors for the status endpoint
+func (job *csvJob) addError(err error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if len(job.status.Errors) < maxCSVErrorSamples {
+		job.status.Errors = append(job.status.Errors, err.Error())
+	}
+}
+
+// snapshot copies the job's progress for reporting
+func (job *csvJob) snapshot() csvJobStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	snapshot := job.status
+	snapshot.BytesRead = atomic.LoadInt64(&job.bytesRead)
+	snapshot.Rows = atomic.LoadUint64(&job.rows)
+	snapshot.Ingested = atomic.LoadUint64(&job.ingested)
+	snapshot.Rejected = atomic.LoadUint64(&job.rejected)
+	snapshot.Errors = append([]string(nil), job.status.Errors...)
+
+	if snapshot.TotalBytes > 0 {
+		snapshot.Progress = float64(snapshot.BytesRead) / float64(snapshot.TotalBytes)
+	}
+	if snapshot.Status != "running" {
+		snapshot.Progress = 1
+	}
+	return snapshot
+}
+
+// addCSVJob registers a job, forgetting the oldest finished ones beyond maxCSVJobs
+func addCSVJob(job *csvJob) {
+	csvJobs.mu.Lock()
+	defer csvJobs.mu.Unlock()
+
+	csvJobs.jobs[job.status.ID] = job
+	if len(csvJobs.jobs) <= maxCSVJobs {
+		return
+	}
+
+	finished := make([]csvJobStatus, 0, len(csvJobs.jobs))
+	for _, existing := range csvJobs.jobs {
+		if status := existing.snapshot(); status.Status != "running" {
+			finished = append(finished, status)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].StartedAt.Before(finished[j].StartedAt)
+	})
+	for i := 0; i < len(finished) && len(csvJobs.jobs) > maxCSVJobs; i++ {
+		delete(csvJobs.jobs, finished[i].ID)
+	}
+}
+
+// handleCSVJobs reports the progress of one import (?id=) or of all of them
+func handleCSVJobs(w http.ResponseWriter, r *http.Request) {
+	csvJobs.mu.Lock()
+	job, found := csvJobs.jobs[r.URL.Query().Get("id")]
+	statuses := make([]csvJobStatus, 0, len(csvJobs.jobs))
+	for _, existing := range csvJobs.jobs {
+		statuses = append(statuses, existing.snapshot())
+	}
+	csvJobs.mu.Unlock()
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		if !found {
+			http.Error(w, "Unknown job", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job.snapshot())
+		return
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].StartedAt.After(statuses[j].StartedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count": len(statuses),
+		"jobs":  statuses,
+	})
+}
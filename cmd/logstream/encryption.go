@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"logstream/internal/storage"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// keyCommandTimeout bounds how long -encryption-key-command may take
+const keyCommandTimeout = 30 * time.Second
+
+// loadKeyring parses the encryption keys from keys, or from the output of
+// command, e.g. one that fetches them from a KMS or secret manager. It
+// returns nil when neither is set.
+func loadKeyring(keys string, command string) (*storage.Keyring, error) {
+	if keys != "" && command != "" {
+		return nil, fmt.Errorf("set -encryption-keys or -encryption-key-command, not both")
+	}
+	if command != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), keyCommandTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("-encryption-key-command: %w", err)
+		}
+		keys = strings.TrimSpace(string(output))
+	}
+	if keys == "" {
+		return nil, nil
+	}
+	return storage.ParseKeyring(keys)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"logstream/internal/ingestion"
+	"logstream/internal/sources"
+	"logstream/pkg/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// esVersion is the Elasticsearch version reported to bulk clients such as Filebeat
+const esVersion = "8.11.0"
+
+// esBulkPrefix is where the Elasticsearch-compatible API is mounted
+const esBulkPrefix = "/es"
+
+// handleElasticsearch serves the subset of the Elasticsearch API that shippers
+// need: the version probe on the root and the _bulk endpoint
+func handleElasticsearch(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, esBulkPrefix), "/")
+
+	switch {
+	case path == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":         "logstream",
+			"cluster_name": "logstream",
+			"version": map[string]interface{}{
+				"number":                             esVersion,
+				"build_flavor":                       "default",
+				"minimum_wire_compatibility_version": "7.17.0",
+			},
+			"tagline": "You Know, for Search",
+		})
+	case path == "_bulk":
+		activeOnly(requireIngest(handleBulk))(w, r)
+	case strings.HasSuffix(path, "/_bulk") && !strings.Contains(strings.TrimSuffix(path, "/_bulk"), "/"):
+		activeOnly(requireIngest(handleBulk))(w, r)
+	default:
+		esError(w, http.StatusNotFound, "illegal_argument_exception", "LogStream only supports the _bulk API")
+	}
+}
+
+// handleBulk ingests an Elasticsearch _bulk NDJSON body and answers in the bulk response format
+func handleBulk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		esError(w, http.StatusMethodNotAllowed, "illegal_argument_exception", "Method not allowed")
+		return
+	}
+	start := time.Now()
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxIngestBody)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			esError(w, http.StatusBadRequest, "parse_exception", err.Error())
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	// /es/<index>/_bulk sets the default index
+	defaultIndex := strings.TrimSuffix(strings.Trim(strings.TrimPrefix(r.URL.Path, esBulkPrefix), "/"), "_bulk")
+	items, err := sources.ReadBulk(body, strings.Trim(defaultIndex, "/"))
+	if err != nil {
+		ingestor.RecordRejected(models.SourceBulk, ingestion.DropParseFailure, nil, err.Error())
+		esError(w, http.StatusBadRequest, "illegal_argument_exception", err.Error())
+		return
+	}
+
+	results := make([]map[string]interface{}, len(items))
+	failed := false
+	for i, item := range items {
+		status, errType, reason := ingestBulkItem(r, &item)
+		id := item.Entry.ID
+		if id == "" {
+			id = item.ID
+		}
+		result := map[string]interface{}{
+			"_index": item.Index,
+			"_id":    id,
+			"status": status,
+		}
+		if errType != "" {
+			failed = true
+			result["error"] = map[string]string{"type": errType, "reason": reason}
+		} else {
+			result["result"] = "created"
+		}
+		results[i] = map[string]interface{}{item.Action: result}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"took":   time.Since(start).Milliseconds(),
+		"errors": failed,
+		"items":  results,
+	})
+}
+
+// ingestBulkItem ingests one bulk document, returning its status and any
+// Elasticsearch error type. A full queue answers 429 so shippers retry the item.
+func ingestBulkItem(r *http.Request, item *sources.BulkItem) (int, string, string) {
+	if item.Action != "index" && item.Action != "create" {
+		return http.StatusBadRequest, "illegal_argument_exception", item.Err.Error()
+	}
+	if item.Err != nil {
+		ingestor.RecordRejected(models.SourceBulk, ingestion.DropParseFailure, nil, item.Err.Error())
+		return http.StatusBadRequest, "mapper_parsing_exception", item.Err.Error()
+	}
+
+	entry := &item.Entry
+	if err := authorizeEntry(r.Context(), entry); err != nil {
+		ingestor.RecordRejected(models.SourceBulk, ingestion.DropUnauthorized, entry, err.Error())
+		return http.StatusForbidden, "security_exception", err.Error()
+	}
+	if err := entry.Validate(); err != nil {
+		ingestor.RecordRejected(models.SourceBulk, ingestion.DropValidation, entry, err.Error())
+		return http.StatusBadRequest, "mapper_parsing_exception", err.Error()
+	}
+
+	entry.FillDefaults()
+	if !ingestor.Ingest(*entry) {
+		return http.StatusTooManyRequests, "es_rejected_execution_exception", "ingestion queue full"
+	}
+	return http.StatusCreated, "", ""
+}
+
+// esError writes an error in the Elasticsearch response format
+func esError(w http.ResponseWriter, status int, errType, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{
+			"type":   errType,
+			"reason": reason,
+		},
+		"status": status,
+	})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"logstream/internal/query"
+	"logstream/internal/storage"
+	"logstream/pkg/models"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseFilter reads id, level or min_level, service, node, a message substring or
+// message_regex pattern and a start/end from a URL query
+func parseFilter(params url.Values) (storage.Filter, error) {
+	filter := storage.Filter{
+		ID:      params.Get("id"),
+		Level:   params.Get("level"),
+		Service: params.Get("service"),
+		Node:    params.Get("node"),
+		Message: params.Get("message"),
+	}
+	if minLevel := params.Get("min_level"); minLevel != "" {
+		filter.MinLevel = strings.ToUpper(minLevel)
+		if _, ok := models.LevelSeverity(filter.MinLevel); !ok {
+			return filter, fmt.Errorf("invalid min_level, expected one of %s", strings.Join(models.Levels, ", "))
+		}
+	}
+	if pattern := params.Get("message_regex"); pattern != "" {
+		re, err := query.CompileRegex(pattern)
+		if err != nil {
+			return filter, fmt.Errorf("invalid message_regex: %v", err)
+		}
+		filter.MessageRegex = re
+	}
+	filter.Metadata, filter.MetadataOptions = query.ParseMetadataFilters(params)
+	now := time.Now()
+	for name, bound := range map[string]*time.Time{"start": &filter.Start, "end": &filter.End} {
+		if value := params.Get(name); value != "" {
+			t, err := parseTimeBound(value, now)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s, expected RFC 3339, now or a relative time like -15m: %v", name, err)
+			}
+			*bound = t
+		}
+	}
+	if !filter.Start.IsZero() && !filter.End.IsZero() && filter.End.Before(filter.Start) {
+		return filter, fmt.Errorf("invalid range: end %s is before start %s", filter.End.Format(time.RFC3339), filter.Start.Format(time.RFC3339))
+	}
+	return filter, nil
+}
+
+// parseTimeBound reads an RFC 3339 time, "now", or a time relative to now
+// such as -15m, now-2h or -7d (Go durations, plus d for days)
+func parseTimeBound(value string, now time.Time) (time.Time, error) {
+	if value == "now" {
+		return now, nil
+	}
+	relative, ok := strings.CutPrefix(value, "now")
+	if ok || strings.HasPrefix(value, "-") {
+		if !strings.HasPrefix(relative, "-") {
+			return time.Time{}, fmt.Errorf("a relative time starts with -, e.g. -15m")
+		}
+		var ago time.Duration
+		if days, ok := strings.CutSuffix(relative[1:], "d"); ok {
+			n, err := strconv.Atoi(days)
+			if err != nil || n < 0 {
+				return time.Time{}, fmt.Errorf("invalid number of days %q", days)
+			}
+			ago = time.Duration(n) * 24 * time.Hour
+		} else {
+			var err error
+			if ago, err = time.ParseDuration(relative[1:]); err != nil {
+				return time.Time{}, err
+			}
+		}
+		return now.Add(-ago), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// entryMatcher returns a check for the q parameter, applied per entry while iterating
+func entryMatcher(params url.Values) func(models.LogEntry) bool {
+	tokens := query.Tokenize(params.Get("q"))
+	return func(entry models.LogEntry) bool {
+		return len(tokens) == 0 || query.MatchesText(entry.Message, tokens)
+	}
+}
+
+// handlePagedLogs serves /logs?limit=N&cursor=...&offset=N from the memory
+// store, returning one page and the cursor to continue from, which also picks
+// up logs stored later
+func handlePagedLogs(w http.ResponseWriter, r *http.Request, memoryStore *storage.MemoryStore, page pageRequest) {
+	params := r.URL.Query()
+	filter, err := parseFilter(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	matches := entryMatcher(params)
+	flatten := params.Get("flatten") == "true"
+
+	logs := make([]models.LogEntry, 0)
+	skipped := 0
+	next, err := memoryStore.IterateFrom(page.cursor, filter, func(entry models.LogEntry) bool {
+		if !matches(entry) {
+			return true
+		}
+		if skipped < page.offset {
+			skipped++
+			return true
+		}
+		logs = append(logs, entry)
+		return len(logs) < page.limit
+	})
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	// Look for one more match past the page, which the next page starts with
+	hasMore := false
+	if len(logs) == page.limit {
+		memoryStore.IterateFrom(next, filter, func(entry models.LogEntry) bool {
+			hasMore = matches(entry)
+			return !hasMore
+		})
+	}
+	if flatten {
+		logs = query.FlattenEntries(logs)
+	}
+
+	writePage(w, logs, hasMore, page, map[string]interface{}{"next_cursor": next})
+}
+
+// exportColumns are the CSV columns of /export: those a CSV import maps by
+// default first, then the rest, with the metadata as a JSON object
+var exportColumns = []string{"timestamp", "level", "service", "message", "id", "node", "source", "namespace", "metadata"}
+
+// exportPageSize is how many logs /export reads from a store at a time
+const exportPageSize = 1000
+
+// handleExport streams every log matching the /logs filters as a CSV or
+// NDJSON download, oldest first, e.g. /export?format=csv&level=ERROR. The
+// memory store can continue from a /logs cursor; other stores are read a page
+// at a time or a page at a time, so no backend's query limit cuts it short.
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	format := params.Get("format")
+	switch format {
+	case "":
+		format = "ndjson"
+	case "csv", "ndjson":
+	default:
+		http.Error(w, "Invalid format, expected csv or ndjson", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseFilter(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	store, ok := requestStore(w, r)
+	if !ok {
+		return
+	}
+	memoryStore, isMemory := store.(*storage.MemoryStore)
+	cursor := params.Get("cursor")
+	if cursor != "" {
+		if !isMemory {
+			http.Error(w, "Cursors are only supported with -storage memory", http.StatusBadRequest)
+			return
+		}
+		if !storage.ValidCursor(cursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	matches := entryMatcher(params)
+
+	filename := fmt.Sprintf("logstream-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	writer := bufio.NewWriterSize(w, 64*1024)
+	defer writer.Flush()
+
+	var write func(models.LogEntry) error
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		csvWriter := csv.NewWriter(writer)
+		csvWriter.Write(exportColumns)
+		defer csvWriter.Flush()
+		write = func(entry models.LogEntry) error {
+			var metadata []byte
+			if len(entry.Metadata) > 0 {
+				metadata, _ = json.Marshal(entry.Metadata)
+			}
+			return csvWriter.Write([]string{
+				entry.Timestamp.Format(time.RFC3339Nano), entry.Level, entry.Service, entry.Message,
+				entry.ID, entry.Node, entry.Source, entry.Namespace, string(metadata),
+			})
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(writer)
+		write = func(entry models.LogEntry) error {
+			return encoder.Encode(entry)
+		}
+	}
+
+	// Stop once the client has gone away
+	emit := func(entry models.LogEntry) bool {
+		return !matches(entry) || write(entry) == nil
+	}
+	if isMemory {
+		memoryStore.IterateFrom(cursor, filter, emit)
+		return
+	}
+	if iterator, ok := store.(storage.Iterator); ok {
+		iterator.Iterate(filter, func(entry models.LogEntry) bool {
+			return r.Context().Err() == nil && emit(entry)
+		})
+		return
+	}
+	exportPages(r.Context(), store, filter, emit)
+}
+
+// exportPages passes every log the filter matches to emit, oldest first, for
+// stores that sort what they find by time, reading exportPageSize at a time from the timestamp of the last one passed
+// on, and skipping the IDs already passed on at that timestamp
+func exportPages(ctx context.Context, store storage.Store, filter storage.Filter, emit func(models.LogEntry) bool) {
+	var last time.Time
+	seen := make(map[string]bool) // IDs passed on at last
+	limit := exportPageSize
+	for ctx.Err() == nil {
+		page := filter
+		if !last.IsZero() {
+			page.Start = last
+		}
+		logs, partial := storage.FindLimited(ctx, store, page, limit)
+		sort.SliceStable(logs, func(i, j int) bool { return logs[i].Timestamp.Before(logs[j].Timestamp) })
+		progressed := false
+		for _, entry := range logs {
+			if entry.Timestamp.Equal(last) && seen[entry.ID] {
+				continue
+			}
+			if !emit(entry) {
+				return
+			}
+			progressed = true
+			if !entry.Timestamp.Equal(last) {
+				last = entry.Timestamp
+				clear(seen)
+			}
+			seen[entry.ID] = true
+		}
+		if !partial || len(logs) == 0 {
+			return
+		}
+		if !progressed {
+			// The whole page shares the last timestamp; read more of it
+			limit *= 2
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"logstream/internal/query"
+	"logstream/internal/storage"
+	"logstream/pkg/models"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPercentiles are reported by /aggregate/field unless percentiles is given
+var defaultPercentiles = []float64{50, 90, 95, 99}
+
+// fieldStatsRequest is a validated /aggregate/field request
+type fieldStatsRequest struct {
+	aggregateRequest
+	field       string
+	bucketed    bool // Whether an interval was given
+	percentiles []float64
+}
+
+// fieldStats summarizes the values of a numeric metadata field in one group
+type fieldStats struct {
+	Start       *time.Time         `json:"start,omitempty"`
+	Group       string             `json:"group,omitempty"`
+	Count       int                `json:"count"`
+	Sum         float64            `json:"sum"`
+	Min         float64            `json:"min"`
+	Max         float64            `json:"max"`
+	Avg         float64            `json:"avg"`
+	Percentiles map[string]float64 `json:"percentiles"`
+}
+
+// parseFieldStats reads field and percentiles along with the /aggregate
+// parameters; without an interval the whole range is one bucket
+func parseFieldStats(params url.Values) (fieldStatsRequest, error) {
+	bucketed := params.Get("interval") != ""
+	if !bucketed {
+		// One interval spanning any range, so no limit on it applies
+		params = maps.Clone(params)
+		params.Set("interval", time.Duration(math.MaxInt64).String())
+	}
+	aggregate, err := parseAggregate(params)
+	if err != nil {
+		return fieldStatsRequest{}, err
+	}
+	request := fieldStatsRequest{
+		aggregateRequest: aggregate,
+		field:            strings.TrimPrefix(params.Get("field"), "metadata."),
+		bucketed:         bucketed,
+		percentiles:      defaultPercentiles,
+	}
+	if request.field == "" {
+		return request, fmt.Errorf("Missing field, the metadata key to aggregate, e.g. duration_ms")
+	}
+	if value := params.Get("percentiles"); value != "" {
+		request.percentiles = nil
+		for _, part := range strings.Split(value, ",") {
+			p, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil || p < 0 || p > 100 {
+				return request, fmt.Errorf("Invalid percentiles, expected comma-separated numbers from 0 to 100, e.g. 50,90,99")
+			}
+			request.percentiles = append(request.percentiles, p)
+		}
+	}
+	return request, nil
+}
+
+// summarize groups the numeric values of the field by interval and group,
+// returning the groups in time then group order and how many logs lacked a value
+func (request fieldStatsRequest) summarize(logs []models.LogEntry) (groups []fieldStats, skipped int) {
+	type key struct {
+		start time.Time
+		group string
+	}
+	values := make(map[key][]float64)
+	opts := query.MetadataOptions{Flatten: true}
+	for _, entry := range logs {
+		raw, ok := query.LookupMetadata(entry.Metadata, request.field, opts)
+		if !ok {
+			skipped++
+			continue
+		}
+		value, ok := query.ToFloat(raw, true)
+		if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+			skipped++
+			continue
+		}
+		var k key
+		if request.bucketed {
+			// Aligned to the Unix epoch, like /aggregate
+			epoch := time.Unix(0, 0).UTC()
+			k.start = epoch.Add(entry.Timestamp.Sub(epoch).Truncate(request.interval))
+		}
+		switch request.groupBy {
+		case "level":
+			k.group = entry.Level
+		case "service":
+			k.group = entry.Service
+		case "node":
+			k.group = entry.Node
+		}
+		values[k] = append(values[k], value)
+	}
+
+	keys := make([]key, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b key) int {
+		if c := a.start.Compare(b.start); c != 0 {
+			return c
+		}
+		return strings.Compare(a.group, b.group)
+	})
+	for _, k := range keys {
+		sorted := values[k]
+		slices.Sort(sorted)
+		stats := fieldStats{
+			Group:       k.group,
+			Count:       len(sorted),
+			Min:         sorted[0],
+			Max:         sorted[len(sorted)-1],
+			Percentiles: make(map[string]float64, len(request.percentiles)),
+		}
+		if request.bucketed {
+			start := k.start
+			stats.Start = &start
+		}
+		for _, value := range sorted {
+			stats.Sum += value
+		}
+		stats.Avg = stats.Sum / float64(len(sorted))
+		for _, p := range request.percentiles {
+			stats.Percentiles["p"+strconv.FormatFloat(p, 'f', -1, 64)] = percentile(sorted, p)
+		}
+		groups = append(groups, stats)
+	}
+	return groups, skipped
+}
+
+// storedStats converts the statistics a store computed
+func (request fieldStatsRequest) storedStats(stats []storage.FieldStats) []fieldStats {
+	groups := make([]fieldStats, 0, len(stats))
+	for _, stat := range stats {
+		group := fieldStats{
+			Group:       stat.Group,
+			Count:       stat.Count,
+			Sum:         stat.Sum,
+			Min:         stat.Min,
+			Max:         stat.Max,
+			Avg:         stat.Sum / float64(stat.Count),
+			Percentiles: make(map[string]float64, len(request.percentiles)),
+		}
+		if request.bucketed {
+			start := stat.Start
+			group.Start = &start
+		}
+		for i, p := range request.percentiles {
+			if i < len(stat.Percentiles) {
+				group.Percentiles["p"+strconv.FormatFloat(p, 'f', -1, 64)] = stat.Percentiles[i]
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// percentile interpolates the p-th percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// handleFieldStats returns min/max/avg and percentiles of a numeric metadata
+// field across the matching logs, e.g.
+// /aggregate/field?field=duration_ms&group_by=service&interval=5m
+func handleFieldStats(w http.ResponseWriter, r *http.Request) {
+	request, err := parseFieldStats(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	store, ok := requestStore(w, r)
+	if !ok {
+		return
+	}
+	var groups []fieldStats
+	var skipped int
+	var partial bool
+	summarizer, computed := store.(storage.FieldSummarizer)
+	if computed {
+		var stats []storage.FieldStats
+		fieldQuery := storage.FieldQuery{Field: request.field, GroupBy: request.groupBy, Percentiles: request.percentiles}
+		if request.bucketed {
+			fieldQuery.Interval = request.interval
+		}
+		if stats, skipped, partial, computed = summarizer.SummarizeField(r.Context(), request.filter, fieldQuery); computed {
+			groups = request.storedStats(stats)
+		}
+	}
+	if !computed {
+		var logs []models.LogEntry
+		logs, partial = findGuarded(r.Context(), store, request.filter)
+		groups, skipped = request.summarize(logs)
+	}
+	if groups == nil {
+		groups = []fieldStats{}
+	}
+
+	response := map[string]interface{}{
+		"field":    request.field,
+		"start":    request.filter.Start,
+		"end":      request.filter.End,
+		"group_by": request.groupBy,
+		"groups":   groups,
+		"skipped":  skipped,
+		"partial":  partial,
+	}
+	if request.bucketed {
+		response["interval"] = request.interval.String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
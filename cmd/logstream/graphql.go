@@ -0,0 +1,554 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"logstream/internal/alerting"
+	"logstream/internal/ingestion"
+	"logstream/internal/query"
+	"logstream/internal/storage"
+	"logstream/pkg/models"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits of /graphql
+const (
+	maxGraphQLRequest  = 1 << 20
+	defaultGraphQLLogs = 100
+)
+
+// graphqlStoreKey holds the store of a /graphql request's namespace in its context
+type graphqlStoreKey struct{}
+
+// graphqlRequest is a GraphQL request body
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// filterArgs are the /logs filters as GraphQL arguments, and the query
+// parameters they stand for
+var filterArgs = map[string]string{
+	"id":           "id",
+	"level":        "level",
+	"minLevel":     "min_level",
+	"service":      "service",
+	"node":         "node",
+	"message":      "message",
+	"messageRegex": "message_regex",
+	"start":        "start",
+	"end":          "end",
+	"q":            "q",
+}
+
+// jsonType is a scalar holding any JSON value, such as metadata
+var jsonType = graphql.NewScalar(graphql.ScalarConfig{
+	Name:         "JSON",
+	Description:  "Any JSON value",
+	Serialize:    func(value interface{}) interface{} { return value },
+	ParseValue:   func(value interface{}) interface{} { return value },
+	ParseLiteral: jsonLiteral,
+})
+
+// jsonLiteral converts a value written in a query to its JSON equivalent
+func jsonLiteral(value ast.Value) interface{} {
+	switch value := value.(type) {
+	case *ast.StringValue:
+		return value.Value
+	case *ast.BooleanValue:
+		return value.Value
+	case *ast.EnumValue:
+		return value.Value
+	case *ast.IntValue:
+		n, _ := strconv.ParseInt(value.Value, 10, 64)
+		return int(n)
+	case *ast.FloatValue:
+		f, _ := strconv.ParseFloat(value.Value, 64)
+		return f
+	case *ast.ListValue:
+		items := make([]interface{}, len(value.Values))
+		for i, item := range value.Values {
+			items[i] = jsonLiteral(item)
+		}
+		return items
+	case *ast.ObjectValue:
+		object := make(map[string]interface{}, len(value.Fields))
+		for _, field := range value.Fields {
+			object[field.Name.Value] = jsonLiteral(field.Value)
+		}
+		return object
+	}
+	return nil
+}
+
+// withFilterArgs adds the filter arguments, and metadata, to a field's own
+func withFilterArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	for name := range filterArgs {
+		args[name] = &graphql.ArgumentConfig{Type: graphql.String}
+	}
+	args["metadata"] = &graphql.ArgumentConfig{Type: jsonType}
+	return args
+}
+
+// graphqlParams turns a field's arguments into the query parameters of the
+// equivalent REST request: the filters, metadata: {key: value} as
+// metadata.key=value, and the extra arguments named in rest
+func graphqlParams(p graphql.ResolveParams, rest map[string]string) (url.Values, error) {
+	params := url.Values{}
+	for _, names := range []map[string]string{filterArgs, rest} {
+		for arg, param := range names {
+			switch value := p.Args[arg].(type) {
+			case nil:
+			case string:
+				params.Set(param, value)
+			case int:
+				params.Set(param, strconv.Itoa(value))
+			default:
+				return nil, fmt.Errorf("argument %q must be a string", arg)
+			}
+		}
+	}
+	switch metadata := p.Args["metadata"].(type) {
+	case nil:
+	case map[string]interface{}:
+		for key, value := range metadata {
+			params.Set("metadata."+key, fmt.Sprint(value))
+		}
+	default:
+		return nil, fmt.Errorf("argument \"metadata\" must be an object")
+	}
+	return params, nil
+}
+
+// intArg returns an Int argument, or fallback if it is null
+func intArg(p graphql.ResolveParams, name string, fallback int) int {
+	if value, ok := p.Args[name].(int); ok {
+		return value
+	}
+	return fallback
+}
+
+// stringArg returns a String argument, or "" if it is null
+func stringArg(p graphql.ResolveParams, name string) string {
+	value, _ := p.Args[name].(string)
+	return value
+}
+
+// graphqlStore returns the store a resolver reads from
+func graphqlStore(p graphql.ResolveParams) storage.Store {
+	return p.Context.Value(graphqlStoreKey{}).(storage.Store)
+}
+
+// scalarField resolves a field of the given type from its object's Go value
+func scalarField[T any](typ graphql.Output, get func(T) interface{}) *graphql.Field {
+	return &graphql.Field{Type: typ, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(T)), nil
+	}}
+}
+
+// graphqlTime formats a time as JSON does
+func graphqlTime(t time.Time) interface{} {
+	return t.Format(time.RFC3339Nano)
+}
+
+// graphqlSchema is the schema /graphql serves
+var graphqlSchema = newGraphQLSchema()
+
+// newGraphQLSchema builds the /graphql schema over the store, ingestion statistics and alerts
+func newGraphQLSchema() graphql.Schema {
+	logType := graphql.NewObject(graphql.ObjectConfig{Name: "Log", Fields: graphql.Fields{
+		"id":        scalarField(graphql.String, func(e models.LogEntry) interface{} { return e.ID }),
+		"timestamp": scalarField(graphql.String, func(e models.LogEntry) interface{} { return graphqlTime(e.Timestamp) }),
+		"level":     scalarField(graphql.String, func(e models.LogEntry) interface{} { return e.Level }),
+		"message":   scalarField(graphql.String, func(e models.LogEntry) interface{} { return e.Message }),
+		"service":   scalarField(graphql.String, func(e models.LogEntry) interface{} { return e.Service }),
+		"node":      scalarField(graphql.String, func(e models.LogEntry) interface{} { return e.Node }),
+		"source":    scalarField(graphql.String, func(e models.LogEntry) interface{} { return e.Source }),
+		"namespace": scalarField(graphql.String, func(e models.LogEntry) interface{} { return e.Namespace }),
+		"metadata": {
+			// The whole object, or with key the value of one (dotted keys reach into nested objects)
+			Type: jsonType,
+			Args: graphql.FieldConfigArgument{"key": {Type: graphql.String}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				entry := p.Source.(models.LogEntry)
+				key := stringArg(p, "key")
+				if key == "" {
+					return entry.Metadata, nil
+				}
+				value, _ := query.LookupMetadata(entry.Metadata, key, query.MetadataOptions{Flatten: true})
+				return value, nil
+			},
+		},
+	}})
+
+	logPageType := graphql.NewObject(graphql.ObjectConfig{Name: "LogPage", Fields: graphql.Fields{
+		"total":   scalarField(graphql.Int, func(page logPage) interface{} { return page.total }),
+		"partial": scalarField(graphql.Boolean, func(page logPage) interface{} { return page.partial }),
+		"logs":    scalarField(graphql.NewList(logType), func(page logPage) interface{} { return page.logs }),
+	}})
+
+	countType := graphql.NewObject(graphql.ObjectConfig{Name: "Count", Fields: graphql.Fields{
+		"value": scalarField(graphql.String, func(c topValue) interface{} { return c.Value }),
+		"count": scalarField(graphql.Int, func(c topValue) interface{} { return c.Count }),
+	}})
+
+	bucketType := graphql.NewObject(graphql.ObjectConfig{Name: "Bucket", Fields: graphql.Fields{
+		"start": scalarField(graphql.String, func(b storage.HistogramBucket) interface{} { return graphqlTime(b.Start) }),
+		"total": scalarField(graphql.Int, func(b storage.HistogramBucket) interface{} { return b.Total }),
+		"counts": scalarField(graphql.NewList(countType), func(b storage.HistogramBucket) interface{} {
+			return sortedCounts(b.Counts)
+		}),
+	}})
+
+	topType := graphql.NewObject(graphql.ObjectConfig{Name: "TopResult", Fields: graphql.Fields{
+		"start":  scalarField(graphql.String, func(t topResult) interface{} { return graphqlTime(t.request.filter.Start) }),
+		"end":    scalarField(graphql.String, func(t topResult) interface{} { return graphqlTime(t.request.filter.End) }),
+		"total":  scalarField(graphql.Int, func(t topResult) interface{} { return t.total }),
+		"values": scalarField(graphql.NewList(countType), func(t topResult) interface{} { return t.top }),
+	}})
+
+	breakdownType := graphql.NewObject(graphql.ObjectConfig{Name: "Breakdown", Fields: graphql.Fields{
+		"name":      scalarField(graphql.String, func(b namedBreakdown) interface{} { return b.name }),
+		"received":  scalarField(graphql.Int, func(b namedBreakdown) interface{} { return b.Received }),
+		"processed": scalarField(graphql.Int, func(b namedBreakdown) interface{} { return b.Processed }),
+		"dropped":   scalarField(graphql.Int, func(b namedBreakdown) interface{} { return b.Dropped }),
+		"rejected":  scalarField(graphql.Int, func(b namedBreakdown) interface{} { return b.Rejected }),
+		"errorRate": scalarField(graphql.Float, func(b namedBreakdown) interface{} { return b.ErrorRate }),
+	}})
+
+	statsType := graphql.NewObject(graphql.ObjectConfig{Name: "Stats", Fields: graphql.Fields{
+		"totalProcessed": scalarField(graphql.Int, func(s graphqlStats) interface{} { return s.TotalProcessed }),
+		"totalDropped":   scalarField(graphql.Int, func(s graphqlStats) interface{} { return s.TotalDropped }),
+		"walFailures":    scalarField(graphql.Int, func(s graphqlStats) interface{} { return s.WALFailures }),
+		"uptimeSeconds":  scalarField(graphql.Int, func(s graphqlStats) interface{} { return int(time.Since(s.StartTime).Seconds()) }),
+		"logsInStorage":  scalarField(graphql.Int, func(s graphqlStats) interface{} { return s.store.Count() }),
+		"storedByLevel": scalarField(graphql.NewList(countType), func(s graphqlStats) interface{} {
+			return sortedCounts(storedByLevel(s.store))
+		}),
+		"bySource": scalarField(graphql.NewList(breakdownType), func(s graphqlStats) interface{} {
+			return sortedBreakdowns(s.BySource)
+		}),
+		"byService": scalarField(graphql.NewList(breakdownType), func(s graphqlStats) interface{} {
+			return sortedBreakdowns(s.ByService)
+		}),
+	}})
+
+	alertType := graphql.NewObject(graphql.ObjectConfig{Name: "Alert", Fields: graphql.Fields{
+		"ruleName":  scalarField(graphql.String, func(a alerting.Alert) interface{} { return a.RuleName }),
+		"message":   scalarField(graphql.String, func(a alerting.Alert) interface{} { return a.Message }),
+		"count":     scalarField(graphql.Int, func(a alerting.Alert) interface{} { return a.Count }),
+		"timestamp": scalarField(graphql.String, func(a alerting.Alert) interface{} { return graphqlTime(a.Timestamp) }),
+		"status":    scalarField(graphql.String, func(a alerting.Alert) interface{} { return a.Status }),
+		"service":   scalarField(graphql.String, func(a alerting.Alert) interface{} { return a.Service }),
+		"id":        scalarField(graphql.String, func(a alerting.Alert) interface{} { return a.ID }),
+		"incident":  scalarField(graphql.String, func(a alerting.Alert) interface{} { return a.Incident }),
+		"acknowledgedBy": scalarField(graphql.String, func(a alerting.Alert) interface{} {
+			if a.Acknowledged == nil {
+				return nil
+			}
+			return a.Acknowledged.By
+		}),
+	}})
+
+	alertRuleType := graphql.NewObject(graphql.ObjectConfig{Name: "AlertRule", Fields: graphql.Fields{
+		"name":         scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.Name }),
+		"level":        scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.Level }),
+		"minLevel":     scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.MinLevel }),
+		"service":      scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.Service }),
+		"threshold":    scalarField(graphql.Int, func(r alerting.AlertRule) interface{} { return r.Threshold }),
+		"window":       scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.Window.String() }),
+		"pattern":      scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.Pattern }),
+		"cooldown":     scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.ReFireInterval().String() }),
+		"resolveAfter": scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.ResolveAfter.String() }),
+		"factor":       scalarField(graphql.Float, func(r alerting.AlertRule) interface{} { return r.Factor }),
+		"baseline":     scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.Baseline.String() }),
+		"absent":       scalarField(graphql.Boolean, func(r alerting.AlertRule) interface{} { return r.Absent }),
+		"deviations":   scalarField(graphql.Float, func(r alerting.AlertRule) interface{} { return r.Deviations }),
+		"slot":         scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.Slot.String() }),
+		"season":       scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.Season.String() }),
+		"condition":    scalarField(graphql.String, func(r alerting.AlertRule) interface{} { return r.Condition }),
+		"activeHours": scalarField(graphql.String, func(r alerting.AlertRule) interface{} {
+			if r.Schedule == nil {
+				return ""
+			}
+			return r.Schedule.String()
+		}),
+	}})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: graphql.Fields{
+		"logs": {
+			Type: logPageType,
+			Args: withFilterArgs(graphql.FieldConfigArgument{
+				"query":  {Type: graphql.String},
+				"sort":   {Type: graphql.String},
+				"order":  {Type: graphql.String},
+				"limit":  {Type: graphql.Int, DefaultValue: defaultGraphQLLogs},
+				"offset": {Type: graphql.Int, DefaultValue: 0},
+			}),
+			Resolve: resolveLogs,
+		},
+		"log": {
+			Type: logType,
+			Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.String)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id := stringArg(p, "id")
+				if id == "" {
+					return nil, fmt.Errorf("log needs an id")
+				}
+				if entry, ok := graphqlStore(p).GetByID(id); ok {
+					return entry, nil
+				}
+				return nil, nil
+			},
+		},
+		"aggregate": {
+			Type: graphql.NewList(bucketType),
+			Args: withFilterArgs(graphql.FieldConfigArgument{
+				"groupBy":  {Type: graphql.String},
+				"interval": {Type: graphql.String, DefaultValue: "1m"},
+			}),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				params, err := graphqlParams(p, map[string]string{"groupBy": "group_by", "interval": "interval"})
+				if err != nil {
+					return nil, err
+				}
+				request, err := parseAggregate(params)
+				if err != nil {
+					return nil, err
+				}
+				return request.buckets(graphqlStore(p)), nil
+			},
+		},
+		"top": {
+			Type: topType,
+			Args: withFilterArgs(graphql.FieldConfigArgument{
+				"by":     {Type: graphql.NewNonNull(graphql.String)},
+				"window": {Type: graphql.String, DefaultValue: "15m"},
+				"n":      {Type: graphql.Int, DefaultValue: 10},
+			}),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				params, err := graphqlParams(p, map[string]string{"by": "by", "window": "window", "n": "n"})
+				if err != nil {
+					return nil, err
+				}
+				request, err := parseTop(params)
+				if err != nil {
+					return nil, err
+				}
+				total, top := request.values(graphqlStore(p))
+				return topResult{request: request, total: total, top: top}, nil
+			},
+		},
+		"stats": {
+			Type: statsType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphqlStats{Stats: ingestor.GetStats(), store: graphqlStore(p)}, nil
+			},
+		},
+		"alerts": {
+			Type: graphql.NewList(alertType),
+			Args: graphql.FieldConfigArgument{"since": {Type: graphql.String}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				var since time.Time
+				if value := stringArg(p, "since"); value != "" {
+					var err error
+					if since, err = parseTimeBound(value, time.Now()); err != nil {
+						return nil, fmt.Errorf("invalid since: %v", err)
+					}
+				}
+				alerts := alertMgr.Alerts(since)
+				if alerts == nil {
+					alerts = []alerting.Alert{}
+				}
+				return alerts, nil
+			},
+		},
+		"alertRules": {
+			Type: graphql.NewList(alertRuleType),
+			Args: graphql.FieldConfigArgument{"minLevel": {Type: graphql.String}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				minLevel := stringArg(p, "minLevel")
+				rules := alertMgr.Rules()
+				if minLevel == "" {
+					return rules, nil
+				}
+				// Rules watching levels at least as severe as minLevel
+				levels := models.LevelsAtLeast(strings.ToUpper(minLevel))
+				if levels == nil {
+					return nil, fmt.Errorf("invalid minLevel, expected one of %s", strings.Join(models.Levels, ", "))
+				}
+				watching := make([]alerting.AlertRule, 0, len(rules))
+				for _, rule := range rules {
+					if slices.Contains(levels, rule.Level) || slices.Contains(levels, rule.MinLevel) {
+						watching = append(watching, rule)
+					}
+				}
+				return watching, nil
+			},
+		},
+	}})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		panic(fmt.Sprintf("invalid GraphQL schema: %v", err))
+	}
+	return schema
+}
+
+// logPage is the result of the logs query
+type logPage struct {
+	total   int
+	logs    []models.LogEntry
+	partial bool
+}
+
+// topResult is the result of the top query
+type topResult struct {
+	request topRequest
+	total   int
+	top     []topValue
+}
+
+// graphqlStats is the ingestion statistics and the store the stats query reports on
+type graphqlStats struct {
+	ingestion.Stats
+	store storage.Store
+}
+
+// namedBreakdown is a source's or service's ingestion counters
+type namedBreakdown struct {
+	name string
+	ingestion.BreakdownStats
+}
+
+// resolveLogs answers the logs query like /logs: the filters, message words
+// in q and a query language expression select the logs, the last hour
+// without any, which are sorted (by timestamp by default) and paged
+func resolveLogs(p graphql.ResolveParams) (interface{}, error) {
+	params, err := graphqlParams(p, map[string]string{"sort": "sort", "order": "order"})
+	if err != nil {
+		return nil, err
+	}
+	filter, err := parseFilter(params)
+	if err != nil {
+		return nil, err
+	}
+	order, _, err := query.ParseSort(params)
+	if err != nil {
+		return nil, err
+	}
+	limit := intArg(p, "limit", defaultGraphQLLogs)
+	if limit <= 0 || limit > maxPageSize {
+		return nil, fmt.Errorf("invalid limit, expected 1-%d", maxPageSize)
+	}
+	offset := intArg(p, "offset", 0)
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid offset, expected a non-negative number")
+	}
+	expression := stringArg(p, "query")
+	var q *query.Query
+	if expression != "" {
+		if q, err = query.Parse(expression); err != nil {
+			return nil, fmt.Errorf("invalid query: %v", err)
+		}
+		if q.Count {
+			return nil, fmt.Errorf("invalid query: use aggregate to count")
+		}
+	}
+
+	if filter.Empty() {
+		filter.End = time.Now()
+		filter.Start = filter.End.Add(-1 * time.Hour)
+	}
+	logs, partial := findGuarded(p.Context, graphqlStore(p), filter)
+	logs = query.FilterByText(logs, params.Get("q"))
+	if q != nil {
+		logs = queryMatches(logs, q)
+	}
+	order.Apply(logs)
+	page := pageRequest{limit: limit, offset: offset}
+	return logPage{total: len(logs), logs: page.slice(logs), partial: partial}, nil
+}
+
+// sortedCounts lists counts by value
+func sortedCounts(counts map[string]int) []topValue {
+	values := make([]topValue, 0, len(counts))
+	for value, count := range counts {
+		values = append(values, topValue{Value: value, Count: count})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Value < values[j].Value })
+	return values
+}
+
+// sortedBreakdowns lists ingestion counters by name
+func sortedBreakdowns(breakdowns map[string]ingestion.BreakdownStats) []namedBreakdown {
+	named := make([]namedBreakdown, 0, len(breakdowns))
+	for name, stats := range breakdowns {
+		named = append(named, namedBreakdown{name: name, BreakdownStats: stats})
+	}
+	sort.Slice(named, func(i, j int) bool { return named[i].name < named[j].name })
+	return named
+}
+
+// handleGraphQL runs GraphQL queries POSTed as JSON ({"query", "variables",
+// "operationName"}) or as application/graphql, or sent with GET ?query=.
+// ?namespace= picks the namespace they read.
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var request graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		request.Query = params.Get("query")
+		request.OperationName = params.Get("operationName")
+		if variables := params.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				http.Error(w, "Invalid variables: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGraphQLRequest))
+		if err != nil {
+			http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+			request.Query = string(body)
+		} else if err := json.Unmarshal(body, &request); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	store, ok := requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	response := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        context.WithValue(r.Context(), graphqlStoreKey{}, store),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if response.Data == nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"logstream/internal/ingestion"
+	"logstream/internal/query"
+	"logstream/internal/storage"
+	"logstream/internal/tail"
+	"logstream/pkg/models"
+	"logstream/pkg/models/logpb"
+	"net"
+	"net/url"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // Accept gzip-compressed calls
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcShutdownTimeout bounds how long shutdown waits for calls in flight
+const grpcShutdownTimeout = 10 * time.Second
+
+// logQueryServer implements the logstream.v1.LogQuery service in
+// pkg/models/logpb/log_query.proto
+type logQueryServer struct {
+	logpb.UnimplementedLogQueryServer
+	stopping <-chan struct{} // Closed on shutdown, ending tails
+}
+
+// serveGRPC serves the LogQuery service on addr without TLS, and returns a
+// func that ends tails and stops the server once other calls finish
+func serveGRPC(addr string) (func() error, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	stopping := make(chan struct{})
+	server := grpc.NewServer()
+	logpb.RegisterLogQueryServer(server, &logQueryServer{stopping: stopping})
+	go server.Serve(listener)
+
+	stop := func() error {
+		close(stopping)
+		done := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(grpcShutdownTimeout):
+			server.Stop()
+		}
+		return nil
+	}
+	return stop, nil
+}
+
+// grpcFilter is a LogFilter as /logs query parameters
+type grpcFilter struct {
+	params    url.Values
+	namespace string
+}
+
+// decodeGRPCFilter converts a LogFilter message
+func decodeGRPCFilter(message *logpb.LogFilter) grpcFilter {
+	filter := grpcFilter{params: url.Values{}, namespace: message.GetNamespace()}
+	for param, value := range map[string]string{
+		"id":            message.GetId(),
+		"level":         message.GetLevel(),
+		"service":       message.GetService(),
+		"node":          message.GetNode(),
+		"message":       message.GetMessage(),
+		"message_regex": message.GetMessageRegex(),
+		"q":             message.GetQ(),
+		"min_level":     message.GetMinLevel(),
+	} {
+		if value != "" {
+			filter.params.Set(param, value)
+		}
+	}
+	if message.GetStart() != nil {
+		filter.params.Set("start", message.GetStart().AsTime().Format(time.RFC3339Nano))
+	}
+	if message.GetEnd() != nil {
+		filter.params.Set("end", message.GetEnd().AsTime().Format(time.RFC3339Nano))
+	}
+	for key, value := range message.GetMetadata() {
+		filter.params.Set("metadata."+key, value)
+	}
+	return filter
+}
+
+// protoEntry converts a stored log to a LogEntry message
+func protoEntry(entry models.LogEntry) (*logpb.LogEntry, error) {
+	message := &logpb.LogEntry{
+		Id:        entry.ID,
+		Level:     entry.Level,
+		Message:   entry.Message,
+		Service:   entry.Service,
+		Namespace: entry.Namespace,
+		Node:      entry.Node,
+		Source:    entry.Source,
+	}
+	if !entry.Timestamp.IsZero() {
+		message.Timestamp = timestamppb.New(entry.Timestamp)
+	}
+	if len(entry.Metadata) > 0 {
+		metadata, err := structpb.NewStruct(entry.Metadata)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "log %s metadata: %v", entry.ID, err)
+		}
+		message.Metadata = metadata
+	}
+	return message, nil
+}
+
+// grpcStore returns the store of a filter's namespace
+func grpcStore(filter grpcFilter) (storage.Store, error) {
+	scoped, err := namespaceStore(filter.namespace)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "%v", err)
+	}
+	return scoped, nil
+}
+
+// GetLogs answers like /logs: the filter selects the logs, the last hour if
+// it is empty, which are sorted if asked and paged
+func (s *logQueryServer) GetLogs(ctx context.Context, request *logpb.GetLogsRequest) (*logpb.GetLogsResponse, error) {
+	decoded := decodeGRPCFilter(request.GetFilter())
+	filter, err := parseFilter(decoded.params)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	limit, offset := int(request.GetLimit()), int(request.GetOffset())
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit < 0 || limit > maxPageSize || offset < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid limit or offset, expected a limit of 1-%d and a non-negative offset", maxPageSize)
+	}
+	sortParams := url.Values{}
+	if request.GetSort() != "" {
+		sortParams.Set("sort", request.GetSort())
+	}
+	if request.GetDescending() {
+		sortParams.Set("order", "desc")
+	}
+	order, sorted, err := query.ParseSort(sortParams)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	store, err := grpcStore(decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []models.LogEntry
+	var partial bool
+	text := decoded.params.Get("q")
+	if memoryStore, ok := store.(*storage.MemoryStore); ok && text != "" && memoryStore.FullText() {
+		logs = matching(memoryStore.Search(text), filter)
+	} else {
+		if filter.Empty() {
+			// The last hour by default, like /logs
+			filter.End = time.Now()
+			filter.Start = filter.End.Add(-1 * time.Hour)
+		}
+		logs, partial = findGuarded(ctx, store, filter)
+	}
+	logs = query.FilterByText(logs, text)
+	if sorted {
+		order.Apply(logs)
+	}
+	page := pageRequest{limit: limit, offset: offset}
+
+	response := &logpb.GetLogsResponse{Total: int64(len(logs)), Partial: partial}
+	for _, entry := range page.slice(logs) {
+		message, err := protoEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		response.Logs = append(response.Logs, message)
+	}
+	return response, nil
+}
+
+// Tail streams matching logs as they are stored, like /tail, first
+// replaying those after the request's cursor
+func (s *logQueryServer) Tail(request *logpb.TailRequest, stream grpc.ServerStreamingServer[logpb.TailEvent]) error {
+	decoded := decodeGRPCFilter(request.GetFilter())
+	filter, err := parseFilter(decoded.params)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if _, err := grpcStore(decoded); err != nil {
+		return err
+	}
+	if namespaces != nil {
+		filter.Namespace = decoded.namespace
+		if filter.Namespace == "" {
+			filter.Namespace = storage.DefaultNamespace
+		}
+	}
+	matches := entryMatcher(decoded.params)
+
+	sub, replay, gap, err := tails.Subscribe(request.GetCursor(), func(entry models.LogEntry) bool {
+		return filter.Matches(entry) && matches(entry)
+	})
+	switch {
+	case errors.Is(err, tail.ErrTooManyTails):
+		return status.Errorf(codes.ResourceExhausted, "%v", err)
+	case err != nil:
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	defer tails.Unsubscribe(sub)
+
+	if gap {
+		if err := stream.Send(&logpb.TailEvent{Gap: true}); err != nil {
+			return err
+		}
+	}
+	for _, event := range replay {
+		if err := sendTailEvent(stream, event); err != nil {
+			return err
+		}
+	}
+	ctx := stream.Context()
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return status.Errorf(codes.Aborted, "the tail fell too far behind; resume from the last cursor")
+			}
+			if err := sendTailEvent(stream, event); err != nil {
+				return err
+			}
+		case <-s.stopping:
+			return status.Errorf(codes.Unavailable, "the server is shutting down; resume from the last cursor")
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// sendTailEvent sends a stored log as a TailEvent message
+func sendTailEvent(stream grpc.ServerStreamingServer[logpb.TailEvent], event tail.Event) error {
+	entry, err := protoEntry(event.Entry)
+	if err != nil {
+		return err
+	}
+	return stream.Send(&logpb.TailEvent{Cursor: event.Cursor, Entry: entry})
+}
+
+// GetStats answers like /stats
+func (s *logQueryServer) GetStats(ctx context.Context, request *logpb.GetStatsRequest) (*logpb.Stats, error) {
+	scoped, err := grpcStore(grpcFilter{namespace: request.GetNamespace()})
+	if err != nil {
+		return nil, err
+	}
+	stats := ingestor.GetStats()
+
+	response := &logpb.Stats{
+		TotalProcessed: stats.TotalProcessed,
+		TotalDropped:   stats.TotalDropped,
+		WalFailures:    stats.WALFailures,
+		UptimeSeconds:  int64(time.Since(stats.StartTime).Seconds()),
+		LogsInStorage:  int64(scoped.Count()),
+		StoredByLevel:  make(map[string]int64),
+		BySource:       protoBreakdown(stats.BySource),
+		ByService:      protoBreakdown(stats.ByService),
+	}
+	for level, count := range storedByLevel(scoped) {
+		response.StoredByLevel[level] = int64(count)
+	}
+	return response, nil
+}
+
+// protoBreakdown converts per-source or per-service ingest counters
+func protoBreakdown(breakdown map[string]ingestion.BreakdownStats) map[string]*logpb.IngestStats {
+	result := make(map[string]*logpb.IngestStats, len(breakdown))
+	for name, counters := range breakdown {
+		result[name] = &logpb.IngestStats{
+			Received:  counters.Received,
+			Processed: counters.Processed,
+			Dropped:   counters.Dropped,
+			Rejected:  counters.Rejected,
+			ErrorRate: counters.ErrorRate,
+		}
+	}
+	return result
+}
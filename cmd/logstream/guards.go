@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"logstream/internal/storage"
+	"logstream/pkg/models"
+	"time"
+)
+
+// Query guards, set by -query-timeout and -query-max-results, so one huge
+// query can't hold the store's locks or memory for long
+var (
+	queryTimeout    = 30 * time.Second
+	maxQueryResults = 100000
+)
+
+// findGuarded returns the logs the filter matches within the query guards,
+// oldest first, and whether some were left out because there were more than
+// maxQueryResults or the deadline passed. The deadline is the earlier of
+// queryTimeout and ctx's.
+func findGuarded(ctx context.Context, store storage.Store, filter storage.Filter) ([]models.LogEntry, bool) {
+	if queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+	}
+	return storage.FindLimited(ctx, store, filter, maxQueryResults)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// errNameTaken is returned when creating an item under a taken name
+var errNameTaken = errors.New("an item with this name already exists")
+
+// jsonFileStore keeps named items, such as saved queries and watches, and
+// when it has a path mirrors them to a JSON file holding them as an array
+// sorted by name
+type jsonFileStore[T any] struct {
+	mu    sync.RWMutex
+	items map[string]T
+	path  string
+	name  func(T) string
+}
+
+// newJSONFileStore creates an empty store keyed by name, without a file
+func newJSONFileStore[T any](name func(T) string) *jsonFileStore[T] {
+	return &jsonFileStore[T]{items: make(map[string]T), name: name}
+}
+
+// load keeps the store in the file at path, loading the items already in it
+// through decode, which gets the file's contents
+func (s *jsonFileStore[T]) load(path string, decode func(data []byte) ([]T, error)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	items, err := decode(data)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, item := range items {
+		s.items[s.name(item)] = item
+	}
+	return len(items), nil
+}
+
+// list returns the items by name
+func (s *jsonFileStore[T]) list() []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sorted()
+}
+
+// sorted returns the items by name (caller holds the lock)
+func (s *jsonFileStore[T]) sorted() []T {
+	items := make([]T, 0, len(s.items))
+	for _, item := range s.items {
+		items = append(items, item)
+	}
+	slices.SortFunc(items, func(a, b T) int { return strings.Compare(s.name(a), s.name(b)) })
+	return items
+}
+
+// get returns an item by name
+func (s *jsonFileStore[T]) get(name string) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	item, ok := s.items[name]
+	return item, ok
+}
+
+// put saves the item prepare returns under name, given the one it replaces
+// if any, unless create is set and the name is taken; it reports whether the
+// item is new
+func (s *jsonFileStore[T]) put(name string, create bool, prepare func(existing T, exists bool) (T, error)) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, exists := s.items[name]
+	if exists && create {
+		return false, errNameTaken
+	}
+	item, err := prepare(existing, exists)
+	if err != nil {
+		return false, err
+	}
+	s.items[name] = item
+	if err := s.persist(); err != nil {
+		if exists {
+			s.items[name] = existing
+		} else {
+			delete(s.items, name)
+		}
+		return false, err
+	}
+	return !exists, nil
+}
+
+// remove deletes an item, reporting whether it existed
+func (s *jsonFileStore[T]) remove(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.items[name]
+	if !ok {
+		return false, nil
+	}
+	delete(s.items, name)
+	if err := s.persist(); err != nil {
+		s.items[name] = existing
+		return false, err
+	}
+	return true, nil
+}
+
+// each calls fn with every item under the read lock
+func (s *jsonFileStore[T]) each(fn func(T)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, item := range s.items {
+		fn(item)
+	}
+}
+
+// persist rewrites the file, if any, through a temp file so a crash never
+// leaves it half-written (caller holds the lock)
+func (s *jsonFileStore[T]) persist() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"logstream/internal/storage"
+	"logstream/pkg/models"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Limits of /logs/{id}/context
+const (
+	defaultContextSize   = 20
+	maxContextSize       = 1000
+	defaultContextWindow = 24 * time.Hour // How far from the entry logs are looked for
+)
+
+// contextRequest is a validated /logs/{id}/context request
+type contextRequest struct {
+	before, after int
+	sameService   bool
+	window        time.Duration
+}
+
+// parseContext reads before, after, same_service and window
+func parseContext(params url.Values) (contextRequest, error) {
+	request := contextRequest{before: defaultContextSize, after: defaultContextSize, window: defaultContextWindow}
+	for name, n := range map[string]*int{"before": &request.before, "after": &request.after} {
+		if value := params.Get(name); value != "" {
+			var err error
+			if *n, err = strconv.Atoi(value); err != nil || *n < 0 || *n > maxContextSize {
+				return request, fmt.Errorf("Invalid %s, expected 0-%d", name, maxContextSize)
+			}
+		}
+	}
+	if value := params.Get("same_service"); value != "" {
+		var err error
+		if request.sameService, err = strconv.ParseBool(value); err != nil {
+			return request, fmt.Errorf("Invalid same_service, expected true or false")
+		}
+	}
+	if value := params.Get("window"); value != "" {
+		var err error
+		if request.window, err = time.ParseDuration(value); err != nil || request.window < time.Second {
+			return request, fmt.Errorf("Invalid window, expected a duration of at least 1s, e.g. 1h")
+		}
+	}
+	return request, nil
+}
+
+// around returns up to before logs leading up to entry and after logs
+// following it, both oldest first. Each side is one query bounded by its
+// count: the newest logs until the entry and the oldest ones from it on, so
+// the result doesn't depend on how many logs the window holds.
+func (request contextRequest) around(ctx context.Context, store storage.Store, entry models.LogEntry) (before, after []models.LogEntry) {
+	var filter storage.Filter
+	if request.sameService {
+		filter.Service = entry.Service
+	}
+
+	// Logs sharing the entry's timestamp are on either side of it in the
+	// order they were stored
+	tied := filter
+	tied.Start, tied.End = entry.Timestamp, entry.Timestamp
+	logs, _ := findGuarded(ctx, store, tied)
+	index := slices.IndexFunc(logs, func(log models.LogEntry) bool { return log.ID == entry.ID })
+	if index < 0 {
+		// Deleted or evicted since it was looked up
+		return nil, nil
+	}
+	before, after = logs[:index], logs[index+1:]
+
+	if n := request.before - len(before); n > 0 {
+		earlier := filter
+		earlier.Start, earlier.End = entry.Timestamp.Add(-request.window), entry.Timestamp.Add(-time.Nanosecond)
+		before = append(storage.FindNewest(store, earlier, n), before...)
+	}
+	if n := request.after - len(after); n > 0 {
+		later := filter
+		later.Start, later.End = entry.Timestamp.Add(time.Nanosecond), entry.Timestamp.Add(request.window)
+		logs, _ := storage.FindLimited(ctx, store, later, n)
+		after = append(after, logs...)
+	}
+	// Stores return logs in the order they were stored, which late arrivals break
+	byTime := func(a, b models.LogEntry) int { return a.Timestamp.Compare(b.Timestamp) }
+	slices.SortStableFunc(before, byTime)
+	slices.SortStableFunc(after, byTime)
+	return before[max(0, len(before)-request.before):], after[:min(len(after), request.after)]
+}
+
+// handleLogContext returns the logs around one, e.g.
+// /logs/{id}/context?before=20&after=20&same_service=true
+func handleLogContext(w http.ResponseWriter, r *http.Request, id string) {
+	request, err := parseContext(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	store, ok := requestStore(w, r)
+	if !ok {
+		return
+	}
+	entry, ok := store.GetByID(id)
+	if !ok {
+		http.Error(w, "Log not found", http.StatusNotFound)
+		return
+	}
+	before, after := request.around(r.Context(), store, entry)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entry":  entry,
+		"before": append([]models.LogEntry{}, before...),
+		"after":  append([]models.LogEntry{}, after...),
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"logstream/internal/storage"
+	"net/http"
+)
+
+// namespaces routes logs to per-namespace stores (nil unless -namespaces is set)
+var namespaces *storage.NamespacedStore
+
+// requestNamespace returns the namespace a request names with ?namespace=, or the default one
+func requestNamespace(r *http.Request) string {
+	if name := r.URL.Query().Get("namespace"); name != "" {
+		return name
+	}
+	return storage.DefaultNamespace
+}
+
+// requestStore returns the store a request reads: with -namespaces, the one
+// of its ?namespace= (the default namespace if absent), so queries never mix
+// namespaces; otherwise the whole store. It writes a 404 for an unknown namespace.
+func requestStore(w http.ResponseWriter, r *http.Request) (storage.Store, bool) {
+	scoped, err := namespaceStore(r.URL.Query().Get("namespace"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return scoped, true
+}
+
+// namespaceStore returns the store of a namespace ("" for the default one)
+// with -namespaces, otherwise the whole store, which only answers for the
+// default namespace
+func namespaceStore(name string) (storage.Store, error) {
+	if namespaces == nil {
+		if name != "" && name != storage.DefaultNamespace {
+			return nil, errors.New("Namespaces are not enabled (-namespaces)")
+		}
+		return store, nil
+	}
+	if name == "" {
+		name = storage.DefaultNamespace
+	}
+	return namespaces.Namespace(name)
+}
+
+// namespaceStats returns each namespace's log count, or nil without -namespaces
+func namespaceStats() map[string]interface{} {
+	if namespaces == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"logs":    namespaces.Counts(),
+		"unknown": namespaces.Unknown(),
+	}
+}
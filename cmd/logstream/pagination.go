@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"logstream/pkg/models"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Page sizes for paged queries
+const (
+	defaultPageSize = 1000
+	maxPageSize     = 10000 // Caps ?limit=
+	defaultRecent   = 100   // Logs /logs/recent returns without ?n=
+	maxRecent       = 10000 // Caps /logs/recent?n=
+)
+
+// pageRequest is the part of a result a query asks for
+type pageRequest struct {
+	limit  int    // Most logs per page
+	offset int    // Matches to skip first
+	cursor string // Where a memory store iteration resumes
+}
+
+// parsePage reads ?limit=, ?offset= and ?cursor=. paged is false when none is
+// set, for endpoints that then answer with the whole result.
+func parsePage(params url.Values) (page pageRequest, paged bool, err error) {
+	page = pageRequest{limit: defaultPageSize, cursor: params.Get("cursor")}
+	if value := params.Get("limit"); value != "" {
+		if page.limit, err = strconv.Atoi(value); err != nil || page.limit <= 0 || page.limit > maxPageSize {
+			return page, true, fmt.Errorf("Invalid limit, expected 1-%d", maxPageSize)
+		}
+	}
+	if value := params.Get("offset"); value != "" {
+		if page.offset, err = strconv.Atoi(value); err != nil || page.offset < 0 {
+			return page, true, fmt.Errorf("Invalid offset, expected a non-negative number")
+		}
+	}
+	return page, params.Has("limit") || params.Has("offset") || params.Has("cursor"), nil
+}
+
+// slice returns the page of a complete result
+func (page pageRequest) slice(logs []models.LogEntry) []models.LogEntry {
+	if page.offset >= len(logs) {
+		return []models.LogEntry{}
+	}
+	return logs[page.offset:min(len(logs), page.offset+page.limit)]
+}
+
+// writePage responds with one page of logs, adding the offset of the next
+// page, whether there is one (callers ask the store for one log more than
+// the page holds to know), and any extra fields, e.g. next_cursor or total
+func writePage(w http.ResponseWriter, logs []models.LogEntry, hasMore bool, page pageRequest, extra map[string]interface{}) {
+	response := map[string]interface{}{
+		"count":       len(logs),
+		"logs":        logs,
+		"next_offset": page.offset + len(logs),
+		"has_more":    hasMore,
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"logstream/internal/archive"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exporter writes closed time partitions to Parquet files (nil when disabled)
+var exporter *archive.Exporter
+
+// startParquetExport exports the store's closed partitions to target, a local
+// directory or an s3:// or gs:// URL using the -archive-* settings. Progress
+// is kept in stateDir so a restart resumes after the last exported partition.
+func startParquetExport(target, endpoint, region, stateDir string, config archive.ExportConfig) (func() error, error) {
+	var uploader archive.Uploader
+	if strings.HasPrefix(target, "s3://") || strings.HasPrefix(target, "gs://") {
+		s3, prefix, err := bucketUploader(target, endpoint, region)
+		if err != nil {
+			return nil, err
+		}
+		uploader = s3
+		config.Prefix = prefix
+	} else {
+		uploader = archive.NewDirUploader(target)
+	}
+
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil, err
+	}
+	config.StatePath = filepath.Join(stateDir, "parquet-export.state")
+
+	var err error
+	exporter, err = archive.NewExporter(config, store.GetByTimeRange, uploader)
+	if err != nil {
+		return nil, err
+	}
+	exporter.Start()
+	return exporter.Stop, nil
+}
+
+// exportStats returns the Parquet export counters, or nil when exporting is disabled
+func exportStats() *archive.ExportStats {
+	if exporter == nil {
+		return nil
+	}
+	stats := exporter.Stats()
+	return &stats
+}
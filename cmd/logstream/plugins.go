@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"logstream/internal/ingestion"
+	"logstream/pkg/models"
+	"logstream/pkg/source"
+	"strings"
+
+	// Input plugins linked into the binary; add a blank import for each extra source package
+	_ "logstream/internal/sources"
+)
+
+// sourceBuffer is how many entries a plugin can emit ahead of the ingestor
+const sourceBuffer = 1000
+
+// sourceSpecs collects repeated -source flags
+type sourceSpecs []string
+
+func (s *sourceSpecs) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *sourceSpecs) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// startSource creates the plugin named in spec and feeds its entries to the ingestor
+func startSource(spec string) (stop func() error, err error) {
+	name, config, err := source.ParseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := source.New(name, config)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(chan models.LogEntry, sourceBuffer)
+	if err := src.Start(entries); err != nil {
+		return nil, fmt.Errorf("source %s: %w", name, err)
+	}
+	pumped := make(chan struct{})
+	go func() {
+		defer close(pumped)
+		pumpSource(name, entries)
+	}()
+
+	fmt.Printf("🔌 Started %s source\n", name)
+	return func() error {
+		// The source sends nothing after Stop, so what it buffered can be drained
+		src.Stop()
+		close(entries)
+		<-pumped
+		return nil
+	}, nil
+}
+
+// pumpSource validates plugin entries and hands them to the ingestor
+func pumpSource(name string, entries <-chan models.LogEntry) {
+	for entry := range entries {
+		if entry.Source == "" {
+			entry.Source = name
+		}
+		if err := entry.Validate(); err != nil {
+			ingestor.RecordRejected(entry.Source, ingestion.DropValidation, &entry, err.Error())
+			continue
+		}
+		entry.FillDefaults()
+		ingestor.Ingest(entry)
+	}
+}
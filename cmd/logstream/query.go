@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"logstream/internal/query"
+	"logstream/pkg/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// handleQuery runs a query language expression from ?q=, e.g.
+// /query?q=service="payments" level>=ERROR |= "timeout" | count by (minute),
+// over an optional RFC 3339 start/end range
+func handleQuery(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q, err := query.Parse(params.Get("q"))
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseFilter(url.Values{"start": params["start"], "end": params["end"]})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultPageSize
+	if value := params.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxPageSize {
+			http.Error(w, "Invalid limit, expected 1-"+strconv.Itoa(maxPageSize), http.StatusBadRequest)
+			return
+		}
+	}
+	countOnly, err := parseCountOnly(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	store, ok := requestStore(w, r)
+	if !ok {
+		return
+	}
+
+	// Equality matchers narrow down what is read; the query checks the rest
+	filter.ID, _ = q.Equal("id")
+	filter.Level, _ = q.Equal("level")
+	filter.Service, _ = q.Equal("service")
+	filter.Node, _ = q.Equal("node")
+	filter.Metadata, filter.MetadataOptions = q.MetadataEqual()
+	if filter.Empty() {
+		// The last hour by default, like /logs
+		filter.End = time.Now()
+		filter.Start = filter.End.Add(-1 * time.Hour)
+	}
+	logs, partial := findGuarded(r.Context(), store, filter)
+	logs = queryMatches(logs, q)
+	if countOnly {
+		writeCount(w, len(logs), partial)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if q.Count {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"total":   len(logs),
+			"series":  q.Aggregate(logs),
+			"partial": partial,
+		})
+		return
+	}
+	total := len(logs)
+	if len(logs) > limit {
+		// The newest matches
+		logs = logs[len(logs)-limit:]
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":   len(logs),
+		"total":   total,
+		"logs":    logs,
+		"partial": partial,
+	})
+}
+
+// queryMatches returns the logs the query matches
+func queryMatches(logs []models.LogEntry, q *query.Query) []models.LogEntry {
+	kept := logs[:0]
+	for _, entry := range logs {
+		if q.Matches(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"logstream/internal/ingestion"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// defaultRateWindow is the window /rate averages over unless window is given
+const defaultRateWindow = time.Minute
+
+// rateGroup is the ingest rate of one service or level, broken down by the other
+type rateGroup struct {
+	Value     string             `json:"value"`
+	Count     uint64             `json:"count"`
+	Rate      float64            `json:"rate"`
+	ByLevel   map[string]float64 `json:"by_level,omitempty"`
+	ByService map[string]float64 `json:"by_service,omitempty"`
+}
+
+// handleRate returns logs/sec processed over the last window, by level and
+// service, e.g. /rate?group_by=service&window=1m
+func handleRate(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	window := defaultRateWindow
+	if value := params.Get("window"); value != "" {
+		var err error
+		if window, err = time.ParseDuration(value); err != nil || window < time.Second || window > ingestion.MaxRateWindow {
+			http.Error(w, fmt.Sprintf("Invalid window, expected a duration from 1s to %s, e.g. 1m", ingestion.MaxRateWindow), http.StatusBadRequest)
+			return
+		}
+	}
+	window = window.Truncate(time.Second)
+	groupBy := params.Get("group_by")
+	if groupBy != "" && groupBy != "service" && groupBy != "level" {
+		http.Error(w, "Invalid group_by, expected service or level", http.StatusBadRequest)
+		return
+	}
+
+	seconds := window.Seconds()
+	var total uint64
+	byLevel := make(map[string]float64)
+	byService := make(map[string]float64)
+	groups := make(map[string]*rateGroup)
+	for key, count := range ingestor.Rates(window) {
+		rate := float64(count) / seconds
+		total += count
+		byLevel[key.Level] += rate
+		byService[key.Service] += rate
+
+		value, other := key.Service, key.Level
+		if groupBy == "level" {
+			value, other = key.Level, key.Service
+		}
+		group, ok := groups[value]
+		if !ok {
+			group = &rateGroup{Value: value}
+			if groupBy == "level" {
+				group.ByService = make(map[string]float64)
+			} else {
+				group.ByLevel = make(map[string]float64)
+			}
+			groups[value] = group
+		}
+		group.Count += count
+		group.Rate += rate
+		if groupBy == "level" {
+			group.ByService[other] += rate
+		} else {
+			group.ByLevel[other] += rate
+		}
+	}
+
+	response := map[string]interface{}{
+		"window":     window.String(),
+		"count":      total,
+		"rate":       float64(total) / seconds,
+		"by_level":   byLevel,
+		"by_service": byService,
+	}
+	if groupBy != "" {
+		// Busiest first
+		sorted := make([]rateGroup, 0, len(groups))
+		for _, group := range groups {
+			sorted = append(sorted, *group)
+		}
+		slices.SortFunc(sorted, func(a, b rateGroup) int {
+			if c := cmp.Compare(b.Count, a.Count); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.Value, b.Value)
+		})
+		response["group_by"] = groupBy
+		response["groups"] = sorted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"logstream/internal/alerting"
+	"logstream/internal/replication"
+	"logstream/pkg/models"
+	"net/http"
+)
+
+// replicator ships entries and alerts to the standby and handles failover
+var replicator *replication.Node
+
+// activeOnly redirects writes to the active node while this node is a standby
+func activeOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if replicator.IsActive() || replicator.PeerURL() == "" {
+			next(w, r)
+			return
+		}
+
+		// 307 keeps the method and body so clients simply retry against the active node
+		http.Redirect(w, r, replicator.PeerURL()+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	}
+}
+
+// handleHealth reports liveness and the node's role for peers and load balancers
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "ok",
+		"role":   string(replicator.Role()),
+	})
+}
+
+// handleReplicationEntries stores a batch of entries shipped by the active node
+func handleReplicationEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var entries []models.LogEntry
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Run replicated entries through the normal pipeline so indexes and alert windows stay warm
+	accepted := 0
+	for _, entry := range entries {
+		if ingestor.IngestForwarded(entry) {
+			accepted++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"accepted": accepted,
+		"dropped":  len(entries) - accepted,
+	})
+}
+
+// handleReplicationAlerts records alerts that fired on the active node
+func handleReplicationAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var alerts []alerting.Alert
+	if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	for _, alert := range alerts {
+		if err := alertMgr.RecordAlert(alert); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to record alert: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handlePromote switches this node to active
+func handlePromote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	replicator.Promote()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(replicator.GetStats())
+}
+
+// handleDemote switches this node to standby (called by a newly promoted peer)
+func handleDemote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	replicator.Demote()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(replicator.GetStats())
+}
+
+// handleReplicationStatus returns the node's role and replication counters
+func handleReplicationStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(replicator.GetStats())
+}
+
+// onRoleChange keeps alert delivery in line with the node's role
+func onRoleChange(role replication.Role) {
+	alertMgr.SetSuppressed(role == replication.RoleStandby)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// savedQueriesPrefix is the path of the saved query endpoints
+const savedQueriesPrefix = "/queries"
+
+// savedQueryName is what a saved query may be called, so it fits in a path
+var savedQueryName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,100}$`)
+
+// savedQueryEndpoints are the query endpoints a saved query can run against
+var savedQueryEndpoints = map[string]http.HandlerFunc{
+	"/logs":            handleGetLogs,
+	"/query":           handleQuery,
+	"/aggregate":       handleAggregate,
+	"/aggregate/field": handleFieldStats,
+	"/top":             handleTop,
+	"/export":          handleExport,
+}
+
+// savedQuery is a named set of query parameters, e.g. the filters and a
+// relative start like -1h, run against one of savedQueryEndpoints
+type savedQuery struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Endpoint    string            `json:"endpoint"`
+	Params      map[string]string `json:"params"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// savedQueryStore keeps the saved queries, in a JSON file when one is set
+type savedQueryStore struct {
+	*jsonFileStore[savedQuery]
+}
+
+// savedQueries holds the queries served under /queries
+var savedQueries = savedQueryStore{newJSONFileStore(func(saved savedQuery) string { return saved.Name })}
+
+// loadSavedQueries keeps saved queries in the file at path, loading those
+// already in it
+func loadSavedQueries(path string) (int, error) {
+	return savedQueries.load(path, func(data []byte) ([]savedQuery, error) {
+		var queries []savedQuery
+		err := json.Unmarshal(data, &queries)
+		return queries, err
+	})
+}
+
+// put saves a query, replacing one of the same name unless create is set,
+// and reports whether it was new
+func (s savedQueryStore) put(saved savedQuery, create bool) (bool, error) {
+	return s.jsonFileStore.put(saved.Name, create, func(existing savedQuery, exists bool) (savedQuery, error) {
+		now := time.Now().UTC()
+		saved.CreatedAt, saved.UpdatedAt = now, now
+		if exists {
+			saved.CreatedAt = existing.CreatedAt
+		}
+		return saved, nil
+	})
+}
+
+// validate checks a saved query's name, endpoint and parameters, defaulting
+// the endpoint to /logs
+func (saved *savedQuery) validate() error {
+	if !savedQueryName.MatchString(saved.Name) {
+		return fmt.Errorf("Invalid name, expected 1-100 letters, digits, '_', '.' or '-'")
+	}
+	if saved.Endpoint == "" {
+		saved.Endpoint = "/logs"
+	}
+	if _, ok := savedQueryEndpoints[saved.Endpoint]; !ok {
+		endpoints := slices.Sorted(maps.Keys(savedQueryEndpoints))
+		return fmt.Errorf("Invalid endpoint, expected one of %s", strings.Join(endpoints, ", "))
+	}
+	if saved.Params == nil {
+		saved.Params = make(map[string]string)
+	}
+	// Catch bad filters now rather than when an on-call engineer runs it
+	if _, err := parseFilter(saved.values(nil)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// values returns the saved parameters, overridden by those of the run request
+func (saved savedQuery) values(overrides url.Values) url.Values {
+	values := url.Values{}
+	for key, value := range saved.Params {
+		values.Set(key, value)
+	}
+	for key, value := range overrides {
+		values[key] = value
+	}
+	return values
+}
+
+// handleSavedQueries lists saved queries (GET) or saves a new one (POST)
+func handleSavedQueries(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"queries": savedQueries.list()})
+	case http.MethodPost:
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			saveQuery(w, r, "", true)
+		})(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSavedQuery serves /queries/{name}: GET returns the query, PUT
+// creates or replaces it and DELETE removes it. /queries/{name}/run runs it,
+// with the request's parameters overriding the saved ones.
+func handleSavedQuery(w http.ResponseWriter, r *http.Request) {
+	name, run := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, savedQueriesPrefix+"/"), "/run")
+	if run {
+		runSavedQuery(w, r, name)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		saved, ok := savedQueries.get(name)
+		if !ok {
+			http.Error(w, "Saved query not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(saved)
+	case http.MethodPut:
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			saveQuery(w, r, name, false)
+		})(w, r)
+	case http.MethodDelete:
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			removed, err := savedQueries.remove(name)
+			if err != nil {
+				http.Error(w, "Failed to save queries: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !removed {
+				http.Error(w, "Saved query not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// saveQuery decodes and saves a query from the body; name, when set, is the
+// one in the path and wins over the body's
+func saveQuery(w http.ResponseWriter, r *http.Request, name string, create bool) {
+	var saved savedQuery
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&saved); err != nil {
+		http.Error(w, "Invalid body, expected a saved query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if name != "" {
+		saved.Name = name
+	}
+	if err := saved.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := savedQueries.put(saved, create)
+	switch {
+	case errors.Is(err, errNameTaken):
+		http.Error(w, "Saved query already exists; PUT /queries/"+saved.Name+" to replace it", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to save queries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	saved, _ = savedQueries.get(saved.Name)
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(saved)
+}
+
+// runSavedQuery answers as the saved query's endpoint would with its parameters
+func runSavedQuery(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	saved, ok := savedQueries.get(name)
+	if !ok {
+		http.Error(w, "Saved query not found", http.StatusNotFound)
+		return
+	}
+
+	run := r.Clone(r.Context())
+	run.URL.Path = saved.Endpoint
+	run.URL.RawQuery = saved.values(r.URL.Query()).Encode()
+	run.RequestURI = run.URL.RequestURI()
+	savedQueryEndpoints[saved.Endpoint](w, run)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"logstream/pkg/models"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// simulateMaxQueueUsage rejects new simulations when the ingest queue is fuller than this
+var simulateMaxQueueUsage = 0.5
+
+// simulation tracks the currently running simulation so it can be stopped
+var simulation struct {
+	cancel context.CancelFunc
+	mu     sync.Mutex
+}
+
+// handleSimulate generates high-volume test traffic
+func handleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Don't pile test traffic onto an instance that is already struggling
+	if usage := ingestor.QueueUsage(); usage > simulateMaxQueueUsage {
+		http.Error(w, fmt.Sprintf("Ingestion queue is %.0f%% full, refusing to simulate", usage*100), http.StatusServiceUnavailable)
+		return
+	}
+
+	simulation.mu.Lock()
+	if simulation.cancel != nil {
+		simulation.mu.Unlock()
+		http.Error(w, "Simulation already running", http.StatusConflict)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	simulation.cancel = cancel
+	simulation.mu.Unlock()
+
+	go func() {
+		simulateTraffic(ctx, 10000) // Generate 10k logs
+
+		simulation.mu.Lock()
+		simulation.cancel = nil
+		simulation.mu.Unlock()
+		cancel()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "simulation started",
+		"logs":   "10000",
+	})
+}
+
+// handleSimulateStop cancels the running simulation
+func handleSimulateStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	simulation.mu.Lock()
+	cancel := simulation.cancel
+	simulation.mu.Unlock()
+
+	if cancel == nil {
+		http.Error(w, "No simulation running", http.StatusNotFound)
+		return
+	}
+	cancel()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "simulation stopping",
+	})
+}
+
+// simulateTraffic generates realistic log traffic until count is reached or ctx is canceled
+func simulateTraffic(ctx context.Context, count int) {
+	fmt.Printf("🔥 Simulating %d logs...\n", count)
+
+	services := []string{"auth-service", "payment-service", "user-service", "api-gateway", "database"}
+	levels := []string{models.LevelInfo, models.LevelWarning, models.LevelError, models.LevelCritical}
+	messages := []string{
+		"Request processed successfully",
+		"Connection timeout",
+		"Database query failed",
+		"Invalid authentication token",
+		"Service unavailable",
+		"Rate limit exceeded",
+		"Memory usage high",
+	}
+
+	startTime := time.Now()
+
+	sent := 0
+	for ; sent < count; sent++ {
+		if ctx.Err() != nil {
+			fmt.Printf("🛑 Simulation stopped after %d logs\n", sent)
+			return
+		}
+
+		entry := models.LogEntry{
+			ID:        uuid.New().String(),
+			Timestamp: time.Now(),
+			Level:     levels[rand.Intn(len(levels))],
+			Message:   messages[rand.Intn(len(messages))],
+			Service:   services[rand.Intn(len(services))],
+			Source:    models.SourceSimulate,
+			Metadata: map[string]interface{}{
+				"user_id":    rand.Intn(1000),
+				"request_id": uuid.New().String(),
+			},
+		}
+
+		ingestor.Ingest(entry)
+
+		// Simulate realistic timing
+		if sent%100 == 0 {
+			time.Sleep(1 * time.Millisecond)
+		}
+	}
+
+	elapsed := time.Since(startTime)
+	throughput := float64(count) / elapsed.Seconds()
+
+	fmt.Printf("✅ Simulation complete! Ingested %d logs in %.2fs (%.0f logs/sec)\n", count, elapsed.Seconds(), throughput)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"logstream/internal/storage"
+	"net/http"
+	"os"
+	"time"
+)
+
+// restoreSnapshot loads a snapshot file written by POST /admin/snapshot into the memory store
+func restoreSnapshot(memoryStore *storage.MemoryStore, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	restored, err := memoryStore.Restore(file)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("📦 Restored %d logs from snapshot %s\n", restored, path)
+	return nil
+}
+
+// handleSnapshot streams a snapshot of the memory store, for -restore on another start or instance
+func handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	store, ok := requestStore(w, r)
+	if !ok {
+		return
+	}
+	memoryStore, ok := store.(*storage.MemoryStore)
+	if !ok {
+		http.Error(w, "Snapshots are only supported with -storage memory; with tiered storage, back up -data-dir after a clean shutdown", http.StatusNotImplemented)
+		return
+	}
+
+	filename := fmt.Sprintf("logstream-%s.snap", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if _, err := memoryStore.Snapshot(w); err != nil {
+		// Headers are gone; a truncated body fails Restore's decoding
+		fmt.Printf("⚠️  Snapshot failed: %v\n", err)
+	}
+}
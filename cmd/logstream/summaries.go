@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"logstream/internal/storage"
+	"net/http"
+)
+
+// handleSummaries returns the per-minute counts of logs compacted by
+// -memory-compact-after, filtered by service, level and RFC3339 start/end
+func handleSummaries(w http.ResponseWriter, r *http.Request) {
+	store, ok := requestStore(w, r)
+	if !ok {
+		return
+	}
+	memoryStore, ok := store.(*storage.MemoryStore)
+	if !ok {
+		http.Error(w, "Summaries are only supported with -storage memory", http.StatusNotImplemented)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	summaries := memoryStore.Summaries(filter)
+	if summaries == nil {
+		summaries = []storage.Summary{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":     len(summaries),
+		"summaries": summaries,
+	})
+}
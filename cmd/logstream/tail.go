@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"logstream/internal/tail"
+	"logstream/pkg/models"
+	"net/http"
+	"time"
+)
+
+// tails streams stored entries to /tail clients
+var tails *tail.Hub
+
+// tailHeartbeat is how often an idle tail gets a comment, so proxies keep the
+// connection open and clients notice a dead one
+const tailHeartbeat = 15 * time.Second
+
+// tailMatcher reads a tail's filters: those of /logs, ?pattern= as a
+// message regex and ?q= message words. With -namespaces it is limited to the
+// request's namespace.
+func tailMatcher(r *http.Request) (func(models.LogEntry) bool, error) {
+	params := r.URL.Query()
+	if pattern := params.Get("pattern"); pattern != "" && !params.Has("message_regex") {
+		params.Set("message_regex", pattern)
+	}
+	filter, err := parseFilter(params)
+	if err != nil {
+		return nil, err
+	}
+	if namespaces != nil {
+		filter.Namespace = requestNamespace(r)
+	}
+	matches := entryMatcher(params)
+	return func(entry models.LogEntry) bool {
+		return filter.Matches(entry) && matches(entry)
+	}, nil
+}
+
+// handleTail streams matching logs as server-sent events as they are stored.
+// Each event's id is a cursor: a client reconnecting with it in Last-Event-ID
+// (or ?cursor=) first gets the logs it missed, as far as they are still held.
+func handleTail(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	if _, ok := requestStore(w, r); !ok {
+		return
+	}
+	match, err := tailMatcher(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	streamTail(w, r, flusher, match)
+}
+
+// streamTail streams the logs match selects as server-sent events until the
+// client goes away, first replaying those since the request's cursor
+func streamTail(w http.ResponseWriter, r *http.Request, flusher http.Flusher, match func(models.LogEntry) bool) {
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("cursor")
+	}
+
+	sub, replay, gap, err := tails.Subscribe(cursor, match)
+	switch {
+	case errors.Is(err, tail.ErrTooManyTails):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer tails.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from buffering the stream
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if gap {
+		// Some logs since the cursor can't be replayed
+		fmt.Fprint(w, "event: gap\ndata: {}\n\n")
+	}
+	for _, event := range replay {
+		if writeTailEvent(w, event) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				// Fell too far behind; the client reconnects from its last cursor
+				return
+			}
+			if writeTailEvent(w, event) != nil {
+				return
+			}
+			// Send whatever else is already queued along with it
+			for queued := len(sub.Events); queued > 0; queued-- {
+				if writeTailEvent(w, <-sub.Events) != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeTailEvent writes a log as an SSE event with its cursor as the id
+func writeTailEvent(w http.ResponseWriter, event tail.Event) error {
+	data, err := json.Marshal(event.Entry)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: log\ndata: %s\n\n", event.Cursor, data)
+	return err
+}
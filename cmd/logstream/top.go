@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"logstream/internal/query"
+	"logstream/internal/storage"
+	"logstream/pkg/models"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of /top
+const (
+	defaultTopWindow = 15 * time.Minute
+	defaultTopN      = 10
+	maxTopN          = 1000
+)
+
+// topValue is one value of a /top result and how many logs have it
+type topValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// topRequest is a validated /top request
+type topRequest struct {
+	filter      storage.Filter
+	by          string
+	metadataKey string // Set when by is metadata.<key>
+	n           int
+}
+
+// parseTop reads the /logs filters, by, window and n. The window ends at
+// end, now by default, unless start is given too.
+func parseTop(params url.Values) (topRequest, error) {
+	filter, err := parseFilter(params)
+	if err != nil {
+		return topRequest{}, err
+	}
+	request := topRequest{filter: filter, by: params.Get("by"), n: defaultTopN}
+	metadataKey, byMetadata := strings.CutPrefix(request.by, "metadata.")
+	switch {
+	case request.by == "service", request.by == "level", request.by == "node", request.by == "message":
+	case byMetadata && metadataKey != "":
+		request.metadataKey = metadataKey
+	default:
+		return request, fmt.Errorf("Invalid by, expected service, level, node, message or metadata.<key>")
+	}
+	window := defaultTopWindow
+	if value := params.Get("window"); value != "" {
+		if window, err = time.ParseDuration(value); err != nil || window < time.Second {
+			return request, fmt.Errorf("Invalid window, expected a duration of at least 1s, e.g. 15m")
+		}
+	}
+	if value := params.Get("n"); value != "" {
+		if request.n, err = strconv.Atoi(value); err != nil || request.n <= 0 || request.n > maxTopN {
+			return request, fmt.Errorf("Invalid n, expected 1-%d", maxTopN)
+		}
+	}
+
+	if request.filter.End.IsZero() {
+		request.filter.End = time.Now()
+	}
+	if request.filter.Start.IsZero() {
+		request.filter.Start = request.filter.End.Add(-window)
+	}
+	return request, nil
+}
+
+// values counts the logs per value, returning the total and the top n, most first
+func (request topRequest) values(store storage.Store) (total int, top []topValue) {
+	counts := make(map[string]int)
+	histogrammer, indexed := store.(storage.Histogrammer)
+	if indexed && request.metadataKey == "" && request.by != "message" {
+		// Counted from the indexes, in at most two intervals
+		interval := request.filter.End.Sub(request.filter.Start).Truncate(time.Second) + time.Second
+		for _, bucket := range histogrammer.Histogram(request.filter, request.by, interval) {
+			for value, count := range bucket.Counts {
+				counts[value] += count
+			}
+		}
+	} else {
+		options := query.MetadataOptions{Flatten: true}
+		count := func(entry models.LogEntry) bool {
+			switch request.by {
+			case "service":
+				counts[entry.Service]++
+			case "level":
+				counts[entry.Level]++
+			case "node":
+				counts[entry.Node]++
+			case "message":
+				counts[entry.Message]++
+			default:
+				if value, ok := query.LookupMetadata(entry.Metadata, request.metadataKey, options); ok {
+					counts[fmt.Sprint(value)]++
+				}
+			}
+			return true
+		}
+		if iterator, ok := store.(storage.Iterator); ok {
+			// Streamed, so no query limit cuts the counts short
+			iterator.Iterate(request.filter, count)
+		} else {
+			for _, entry := range store.Find(request.filter) {
+				count(entry)
+			}
+		}
+	}
+
+	top = make([]topValue, 0, len(counts))
+	for value, count := range counts {
+		total += count
+		top = append(top, topValue{Value: value, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Value < top[j].Value
+	})
+	if len(top) > request.n {
+		top = top[:request.n]
+	}
+	return total, top
+}
+
+// handleTop returns the services, levels, nodes, messages or metadata values
+// with the most matching logs in a window, e.g.
+// /top?by=service&level=ERROR&window=15m&n=10
+func handleTop(w http.ResponseWriter, r *http.Request) {
+	request, err := parseTop(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	store, ok := requestStore(w, r)
+	if !ok {
+		return
+	}
+	total, top := request.values(store)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"by":    request.by,
+		"start": request.filter.Start,
+		"end":   request.filter.End,
+		"total": total,
+		"top":   top,
+	})
+}
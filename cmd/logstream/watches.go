@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"logstream/internal/alerting"
+	"logstream/internal/storage"
+	"logstream/pkg/models"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// watchesPrefix is the path of the watch endpoints
+const watchesPrefix = "/watches"
+
+// Webhook delivery: matches wait in a queue of watchQueueSize, dropped when
+// it is full, for one of watchWorkers posting them, retrying failures as in
+// watchRetry for up to watchDeliveryTimeout
+const (
+	watchQueueSize       = 1000
+	watchWorkers         = 4
+	watchDeliveryTimeout = time.Minute
+)
+
+// watchRetry is how a watch's webhook delivery is retried
+var watchRetry = alerting.RetryConfig{Timeout: 5 * time.Second, Retries: 3, Backoff: time.Second}
+
+// watch is a standing query: /logs filters that push every newly stored log
+// they match to a webhook, and to clients of /watches/{name}/events
+type watch struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Params      map[string]string `json:"params"`
+	Webhook     string            `json:"webhook,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// watchStatus is a watch with what it matched and delivered since it was
+// last saved or the server started
+type watchStatus struct {
+	watch
+	Matched   uint64     `json:"matched"`
+	Delivered uint64     `json:"delivered"`
+	Failed    uint64     `json:"failed"`
+	Dropped   uint64     `json:"dropped"`
+	LastMatch *time.Time `json:"last_match,omitempty"`
+}
+
+// activeWatch is a watch with its compiled filters and counters
+type activeWatch struct {
+	watch
+	match     func(models.LogEntry) bool
+	matched   atomic.Uint64
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+	lastMatch atomic.Int64 // Unix nanoseconds; 0 if it never matched
+}
+
+// status returns the watch and its counters
+func (active *activeWatch) status() watchStatus {
+	status := watchStatus{
+		watch:     active.watch,
+		Matched:   active.matched.Load(),
+		Delivered: active.delivered.Load(),
+		Failed:    active.failed.Load(),
+		Dropped:   active.dropped.Load(),
+	}
+	if nanos := active.lastMatch.Load(); nanos != 0 {
+		last := time.Unix(0, nanos).UTC()
+		status.LastMatch = &last
+	}
+	return status
+}
+
+// watchDelivery is a match on its way to its watch's webhook
+type watchDelivery struct {
+	watch *activeWatch
+	entry models.LogEntry
+}
+
+// watchStore keeps the watches, in a JSON file when one is set, and delivers
+// their matches
+type watchStore struct {
+	*jsonFileStore[*activeWatch] // Saved as their watch fields, the only exported ones
+	deliveries                   chan watchDelivery
+	client                       *http.Client
+}
+
+// watches holds the watches served under /watches
+var watches = &watchStore{
+	jsonFileStore: newJSONFileStore(func(active *activeWatch) string { return active.Name }),
+	deliveries:    make(chan watchDelivery, watchQueueSize),
+	client:        &http.Client{},
+}
+
+// loadWatches keeps watches in the file at path, loading those already in
+// it. Call it once namespaces are set up, as they scope the watches.
+func loadWatches(path string) (int, error) {
+	return watches.load(path, func(data []byte) ([]*activeWatch, error) {
+		var saved []watch
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, err
+		}
+		compiled := make([]*activeWatch, 0, len(saved))
+		for _, w := range saved {
+			active, err := w.compile()
+			if err != nil {
+				return nil, fmt.Errorf("watch %s: %w", w.Name, err)
+			}
+			compiled = append(compiled, active)
+		}
+		return compiled, nil
+	})
+}
+
+// start runs the webhook delivery workers
+func (s *watchStore) start() {
+	for i := 0; i < watchWorkers; i++ {
+		go s.deliver()
+	}
+}
+
+// statuses returns the watches and their counters by name
+func (s *watchStore) statuses() []watchStatus {
+	list := make([]watchStatus, 0)
+	for _, active := range s.list() {
+		list = append(list, active.status())
+	}
+	return list
+}
+
+// put saves a watch, replacing one of the same name unless create is set,
+// and reports whether it was new
+func (s *watchStore) put(w watch, create bool) (bool, error) {
+	return s.jsonFileStore.put(w.Name, create, func(existing *activeWatch, exists bool) (*activeWatch, error) {
+		now := time.Now().UTC()
+		w.CreatedAt, w.UpdatedAt = now, now
+		if exists {
+			w.CreatedAt = existing.CreatedAt
+		}
+		return w.compile()
+	})
+}
+
+// publish checks a stored entry against every watch, queueing webhook
+// deliveries without blocking ingestion
+func (s *watchStore) publish(entry models.LogEntry) {
+	s.each(func(active *activeWatch) {
+		if !active.match(entry) {
+			return
+		}
+		active.matched.Add(1)
+		active.lastMatch.Store(time.Now().UnixNano())
+		// A standby stays quiet; the active node notifies
+		if active.Webhook == "" || !replicator.IsActive() {
+			return
+		}
+		select {
+		case s.deliveries <- watchDelivery{watch: active, entry: entry}:
+		default:
+			active.dropped.Add(1)
+		}
+	})
+}
+
+// deliver posts queued matches to their webhooks
+func (s *watchStore) deliver() {
+	for delivery := range s.deliveries {
+		active := delivery.watch
+		if err := s.post(active, delivery.entry); err != nil {
+			active.failed.Add(1)
+			fmt.Printf("⚠️  Watch %s webhook failed: %v\n", active.Name, err)
+			continue
+		}
+		active.delivered.Add(1)
+	}
+}
+
+// post sends one match to a watch's webhook, retrying like alert webhooks
+func (s *watchStore) post(active *activeWatch, entry models.LogEntry) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"watch":    active.Name,
+		"entry":    entry,
+		"location": logLocation(entry.ID, entry.Namespace),
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), watchDeliveryTimeout)
+	defer cancel()
+	_, err = alerting.PostJSON(ctx, s.client, watchRetry, active.Webhook, body, nil)
+	return err
+}
+
+// validate checks a watch's name and webhook; compile checks its filters
+func (w *watch) validate() error {
+	if !savedQueryName.MatchString(w.Name) {
+		return fmt.Errorf("Invalid name, expected 1-100 letters, digits, '_', '.' or '-'")
+	}
+	if w.Webhook != "" {
+		u, err := url.Parse(w.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid webhook, expected an http or https URL")
+		}
+	}
+	if w.Params == nil {
+		w.Params = make(map[string]string)
+	}
+	return nil
+}
+
+// compile reads the watch's /logs filters, which must narrow it down and
+// can't have a time range, as it only sees logs as they are stored. With
+// -namespaces it watches its namespace parameter's namespace, or the default one.
+func (w watch) compile() (*activeWatch, error) {
+	params := url.Values{}
+	for key, value := range w.Params {
+		params.Set(key, value)
+	}
+	filter, err := parseFilter(params)
+	if err != nil {
+		return nil, err
+	}
+	if !filter.Start.IsZero() || !filter.End.IsZero() {
+		return nil, fmt.Errorf("Invalid params, a watch sees logs as they are stored and takes no start or end")
+	}
+	if filter.Empty() && params.Get("q") == "" {
+		return nil, fmt.Errorf("Invalid params, expected at least one filter, e.g. {\"metadata.user_id\": \"829\"}")
+	}
+	if namespace := params.Get("namespace"); namespace != "" && !models.ValidNamespace(namespace) {
+		return nil, fmt.Errorf("Invalid namespace, expected up to 64 lowercase letters, digits, - or _")
+	}
+	if namespaces != nil {
+		filter.Namespace = storage.DefaultNamespace
+		if namespace := params.Get("namespace"); namespace != "" {
+			filter.Namespace = namespace
+		}
+	}
+	matches := entryMatcher(params)
+	return &activeWatch{
+		watch: w,
+		match: func(entry models.LogEntry) bool {
+			return filter.Matches(entry) && matches(entry)
+		},
+	}, nil
+}
+
+// handleWatches lists watches (GET) or creates a new one (POST)
+func handleWatches(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"watches": watches.statuses()})
+	case http.MethodPost:
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			saveWatch(w, r, "", true)
+		})(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWatch serves /watches/{name}: GET returns the watch and its counters,
+// PUT creates or replaces it and DELETE removes it. /watches/{name}/events
+// streams its matches as server-sent events, like /tail.
+func handleWatch(w http.ResponseWriter, r *http.Request) {
+	name, events := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, watchesPrefix+"/"), "/events")
+	if events {
+		streamWatch(w, r, name)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		active, ok := watches.get(name)
+		if !ok {
+			http.Error(w, "Watch not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(active.status())
+	case http.MethodPut:
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			saveWatch(w, r, name, false)
+		})(w, r)
+	case http.MethodDelete:
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			removed, err := watches.remove(name)
+			if err != nil {
+				http.Error(w, "Failed to save watches: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !removed {
+				http.Error(w, "Watch not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// saveWatch decodes and saves a watch from the body; name, when set, is the
+// one in the path and wins over the body's
+func saveWatch(w http.ResponseWriter, r *http.Request, name string, create bool) {
+	var saved watch
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&saved); err != nil {
+		http.Error(w, "Invalid body, expected a watch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if name != "" {
+		saved.Name = name
+	}
+	if err := saved.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := saved.compile(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	created, err := watches.put(saved, create)
+	switch {
+	case errors.Is(err, errNameTaken):
+		http.Error(w, "Watch already exists; PUT /watches/"+saved.Name+" to replace it", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to save watches: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	active, _ := watches.get(saved.Name)
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(active.status())
+}
+
+// streamWatch streams a watch's matches as they are stored, with the filters
+// it has when the client connects
+func streamWatch(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	active, ok := watches.get(name)
+	if !ok {
+		http.Error(w, "Watch not found", http.StatusNotFound)
+		return
+	}
+	streamTail(w, r, flusher, active.match)
+}
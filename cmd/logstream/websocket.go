@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"logstream/internal/query"
+	"logstream/internal/storage"
+	"logstream/internal/tail"
+	"logstream/internal/websocket"
+	"logstream/pkg/models"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits of /ws connections
+const (
+	maxWSMessage       = 64 * 1024
+	maxWSSubscriptions = 32
+	wsPingInterval     = 30 * time.Second
+	wsDropReport       = time.Second // How often new drops are reported
+)
+
+// wsRequest is a message from a /ws client
+type wsRequest struct {
+	Type  string `json:"type"` // subscribe, unsubscribe or stats
+	ID    string `json:"id"`
+	Query string `json:"query"`
+}
+
+// wsMessage is a message to a /ws client
+type wsMessage struct {
+	Type          string                `json:"type"`
+	ID            string                `json:"id,omitempty"`
+	Entry         *models.LogEntry      `json:"entry,omitempty"`
+	Dropped       uint64                `json:"dropped,omitempty"`
+	Total         uint64                `json:"total,omitempty"`
+	Subscriptions []wsSubscriptionStats `json:"subscriptions,omitempty"`
+	Error         string                `json:"error,omitempty"`
+}
+
+// wsSubscriptionStats reports how a subscription keeps up
+type wsSubscriptionStats struct {
+	ID        string `json:"id"`
+	Query     string `json:"query"`
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"`
+	Lag       int    `json:"lag"` // Matching logs queued but not yet sent
+}
+
+// wsSubscription is one filter a /ws client subscribed to
+type wsSubscription struct {
+	id        string
+	query     string
+	sub       *tail.Subscription
+	delivered atomic.Uint64
+	reported  uint64 // Drops already reported to the client
+}
+
+// wsSession is one /ws connection and its subscriptions
+type wsSession struct {
+	conn      *websocket.Conn
+	namespace string
+	mu        sync.Mutex
+	subs      map[string]*wsSubscription
+}
+
+// handleWebSocket upgrades to a WebSocket over which a client subscribes to
+// query language expressions and receives matching logs as they are stored.
+// A subscription that falls behind drops logs rather than holding up the
+// others, and the client is told how many.
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestStore(w, r); !ok {
+		return
+	}
+	conn, err := websocket.Upgrade(w, r, maxWSMessage)
+	if err != nil {
+		return
+	}
+	conn.SetIdleTimeout(2 * wsPingInterval)
+	session := &wsSession{conn: conn, subs: make(map[string]*wsSubscription)}
+	if namespaces != nil {
+		session.namespace = requestNamespace(r)
+	}
+	defer session.close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go session.keepAlive(done)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var request wsRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			session.send(wsMessage{Type: "error", Error: "Invalid message: " + err.Error()})
+			continue
+		}
+		switch request.Type {
+		case "subscribe":
+			session.subscribe(request)
+		case "unsubscribe":
+			session.unsubscribe(request.ID)
+		case "stats":
+			session.send(wsMessage{Type: "stats", Subscriptions: session.stats()})
+		default:
+			session.send(wsMessage{Type: "error", ID: request.ID, Error: fmt.Sprintf("Unknown message type %q, expected subscribe, unsubscribe or stats", request.Type)})
+		}
+	}
+}
+
+// subscribe starts delivering the logs a query matches under the request's id
+func (s *wsSession) subscribe(request wsRequest) {
+	if request.ID == "" {
+		s.send(wsMessage{Type: "error", Error: "A subscription needs an id"})
+		return
+	}
+	matches := func(models.LogEntry) bool { return true }
+	if request.Query != "" {
+		q, err := query.Parse(request.Query)
+		if err != nil {
+			s.send(wsMessage{Type: "error", ID: request.ID, Error: "Invalid query: " + err.Error()})
+			return
+		}
+		if q.Count {
+			s.send(wsMessage{Type: "error", ID: request.ID, Error: "Invalid query: subscriptions can't count"})
+			return
+		}
+		matches = q.Matches
+	}
+	scope := storage.Filter{Namespace: s.namespace}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[request.ID]; ok {
+		s.send(wsMessage{Type: "error", ID: request.ID, Error: "Already subscribed with this id"})
+		return
+	}
+	if len(s.subs) >= maxWSSubscriptions {
+		s.send(wsMessage{Type: "error", ID: request.ID, Error: fmt.Sprintf("At most %d subscriptions per connection", maxWSSubscriptions)})
+		return
+	}
+	sub, err := tails.Watch(func(entry models.LogEntry) bool {
+		return scope.Matches(entry) && matches(entry)
+	})
+	if err != nil {
+		s.send(wsMessage{Type: "error", ID: request.ID, Error: err.Error()})
+		return
+	}
+	subscription := &wsSubscription{id: request.ID, query: request.Query, sub: sub}
+	s.subs[request.ID] = subscription
+	s.send(wsMessage{Type: "subscribed", ID: request.ID})
+	go s.deliver(subscription)
+}
+
+// deliver sends a subscription's logs until it ends
+func (s *wsSession) deliver(subscription *wsSubscription) {
+	for event := range subscription.sub.Events {
+		if s.send(wsMessage{Type: "log", ID: subscription.id, Entry: &event.Entry}) != nil {
+			// The read loop fails too and cleans up
+			s.conn.Close()
+			return
+		}
+		subscription.delivered.Add(1)
+	}
+}
+
+// unsubscribe ends a subscription
+func (s *wsSession) unsubscribe(id string) {
+	s.mu.Lock()
+	subscription, ok := s.subs[id]
+	delete(s.subs, id)
+	s.mu.Unlock()
+
+	if !ok {
+		s.send(wsMessage{Type: "error", ID: id, Error: "Not subscribed with this id"})
+		return
+	}
+	tails.Unsubscribe(subscription.sub)
+	s.send(wsMessage{Type: "unsubscribed", ID: id})
+}
+
+// stats reports each subscription's counters, ordered by id
+func (s *wsSession) stats() []wsSubscriptionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]wsSubscriptionStats, 0, len(s.subs))
+	for _, subscription := range s.subs {
+		stats = append(stats, wsSubscriptionStats{
+			ID:        subscription.id,
+			Query:     subscription.query,
+			Delivered: subscription.delivered.Load(),
+			Dropped:   subscription.sub.Dropped(),
+			Lag:       len(subscription.sub.Events),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats
+}
+
+// keepAlive pings the client and reports logs dropped since the last report
+// until done is closed
+func (s *wsSession) keepAlive(done <-chan struct{}) {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	report := time.NewTicker(wsDropReport)
+	defer report.Stop()
+	for {
+		select {
+		case <-ping.C:
+			if s.conn.Ping() != nil {
+				s.conn.Close()
+				return
+			}
+		case <-report.C:
+			s.mu.Lock()
+			var drops []wsMessage
+			for _, subscription := range s.subs {
+				if dropped := subscription.sub.Dropped(); dropped > subscription.reported {
+					drops = append(drops, wsMessage{Type: "dropped", ID: subscription.id, Dropped: dropped - subscription.reported, Total: dropped})
+					subscription.reported = dropped
+				}
+			}
+			s.mu.Unlock()
+			for _, message := range drops {
+				s.send(message)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// send writes a message to the client
+func (s *wsSession) send(message wsMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return s.conn.WriteText(data)
+}
+
+// close ends the session's subscriptions and closes its connection
+func (s *wsSession) close() {
+	s.mu.Lock()
+	for id, subscription := range s.subs {
+		tails.Unsubscribe(subscription.sub)
+		delete(s.subs, id)
+	}
+	s.mu.Unlock()
+	s.conn.Close()
+}
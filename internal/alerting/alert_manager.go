@@ -1,43 +1,215 @@
 package alerting
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"logstream/internal/query"
 	"logstream/pkg/models"
+	"math"
+	"slices"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // AlertRule defines conditions that trigger an alert
 type AlertRule struct {
-	Name      string
-	Level     string        // Log level to monitor (ERROR, CRITICAL)
-	Threshold int           // Number of occurrences
-	Window    time.Duration // Time window to check
-	Pattern   string        // Optional: keyword to match in message
+	Name         string
+	Level        string        // Log level to monitor (ERROR, CRITICAL)
+	MinLevel     string        // Optional: monitor this level and more severe ones instead
+	Service      string        // Optional: only count logs of this service
+	Threshold    int           // Number of occurrences
+	Window       time.Duration // Time window to check
+	Pattern      string        // Optional: keyword to match in message
+	Cooldown     time.Duration // Optional: how often to re-fire while the condition holds (DefaultCooldown if zero)
+	ResolveAfter time.Duration // Optional: how long the condition must stay clear before resolving
+	Factor       float64       // Optional: makes it a spike rule, firing at Factor times the Baseline average
+	Baseline     time.Duration // Spike rules: how far back before the window the average is taken over
+	Absent       bool          // Optional: makes it an absence rule, firing when no matching logs arrive in the window
+	Deviations   float64       // Optional: makes it an anomaly rule, firing when the count in the window is this many standard deviations from what is usual at this time
+	Slot         time.Duration // Anomaly rules: part of the season each baseline covers (DefaultAnomalySlot if zero)
+	Season       time.Duration // Anomaly rules: period volume repeats over (DefaultAnomalySeason if zero)
+	Condition    string        // Optional: /query field matchers logs must also satisfy, e.g. metadata.status_code>=500
+	Channels     []string      // Optional: names of the notifiers its alerts go to, instead of all of them
+	Schedule     *Schedule     // Optional: when its alerts notify; outside it they are only recorded
+
+	condition *query.Query   // Condition, parsed by AddRule
+	counter   *windowCounter // Matching logs per second, created by AddRule
+	volume    *volumeModel   // Anomaly rules: the learned baselines, created by AddRule
+}
+
+// DefaultCooldown is how often a rule whose condition keeps holding re-fires,
+// unless it sets its own Cooldown
+const DefaultCooldown = 5 * time.Minute
+
+// ReFireInterval is how often the rule re-fires while its condition holds
+func (rule AlertRule) ReFireInterval() time.Duration {
+	if rule.Cooldown > 0 {
+		return rule.Cooldown
+	}
+	return DefaultCooldown
+}
+
+// Levels describes the levels a rule monitors, e.g. ERROR or ERROR+
+func (rule AlertRule) Levels() string {
+	if rule.MinLevel != "" {
+		return rule.MinLevel + "+"
+	}
+	return rule.Level
+}
+
+// matchesLevel reports whether a log at level counts toward the rule
+func (rule AlertRule) matchesLevel(level string) bool {
+	if rule.Level == "" && rule.MinLevel == "" {
+		// Absence rules may watch for logs of any level
+		return true
+	}
+	if rule.MinLevel == "" {
+		return level == rule.Level
+	}
+	return slices.Contains(models.LevelsAtLeast(rule.MinLevel), level)
 }
 
 // Alert represents a triggered alert
 type Alert struct {
-	RuleName  string
-	Message   string
-	Count     int
-	Timestamp time.Time
+	ID        string    `json:"id,omitempty"`
+	RuleName  string    `json:"rule_name"`
+	Message   string    `json:"message"`
+	Count     int       `json:"count"`
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level,omitempty"`    // Levels the rule counts, e.g. ERROR+
+	Service   string    `json:"service,omitempty"`  // Service the rule is scoped to, if any
+	Window    string    `json:"window,omitempty"`   // The rule's window, e.g. 1m0s
+	Samples   []Sample  `json:"samples,omitempty"`  // The newest logs counted, oldest first
+	Status    string    `json:"status,omitempty"`   // StatusFiring, or StatusResolved once the rule's condition clears
+	Baseline  *float64  `json:"baseline,omitempty"` // Spike rules: the average count per window before this one; anomaly rules: the usual count per window at this time
+
+	Incident     string          `json:"incident,omitempty"`     // ID of the incident's first alert; a rule's alerts share it until it resolves
+	Acknowledged *Acknowledgment `json:"acknowledged,omitempty"` // Set once someone acknowledges the incident
+	Silenced     string          `json:"silenced,omitempty"`     // ID of the silence that kept it from notifying
+	OffHours     bool            `json:"off_hours,omitempty"`    // Fired outside the rule's active hours, so it didn't notify
+
+	Group   string  `json:"group,omitempty"`  // Grouped notifications: the fields their alerts share, e.g. service=payment-api
+	Grouped []Alert `json:"alerts,omitempty"` // Grouped notifications: the alerts, oldest first
+}
+
+// Acknowledgment records who took on an incident
+type Acknowledgment struct {
+	By string    `json:"by"`
+	At time.Time `json:"at"`
+}
+
+// Acknowledgment errors
+var (
+	ErrAlertNotFound    = errors.New("alert not found")
+	ErrIncidentResolved = errors.New("incident already resolved")
+)
+
+// incident is a rule's run of alerts from first firing until it resolves
+type incident struct {
+	id           string          // ID of its first alert
+	lastFired    time.Time       // When it last fired, for the rule's cooldown
+	clearedSince time.Time       // When it dropped under the threshold, zero while over
+	ack          *Acknowledgment // Who acknowledged it, if anyone
+}
+
+// Alert statuses
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// resolveInterval is how often firing rules are checked for having cleared
+const resolveInterval = time.Second
+
+// maxAlertSamples is how many of the logs behind an alert it carries
+const maxAlertSamples = 5
+
+// Sample is one of the logs that triggered an alert
+type Sample struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+	Service   string    `json:"service,omitempty"`
+	Message   string    `json:"message"`
 }
 
 // AlertManager monitors logs and triggers alerts
 type AlertManager struct {
-	rules         []AlertRule
-	alertChannel  chan Alert
-	recentLogs    []logEntry
-	mu            sync.Mutex
-	alertCallback func(Alert)
+	rules             []AlertRule
+	alertChannel      chan Alert
+	resolutions       []Alert       // Resolutions alertChannel had no room for, which are never dropped
+	wake              chan struct{} // Tells processAlerts there are resolutions waiting
+	stopped           bool          // Set by Stop; later alerts are dropped
+	shutdown          chan struct{} // Stops watchResolutions
+	processing        sync.WaitGroup
+	mu                sync.Mutex
+	alertCallback     func(Alert)
+	notifiers         []Notifier
+	firing            map[string]*incident // Open incident of each rule whose condition holds
+	startedAt         time.Time            // Spike rules wait for a full baseline from here
+	silences          []Silence
+	silencesToSave    []Silence // Snapshot for saveSilences
+	silenceGeneration uint64    // Counts changes to the silences, so saves apply in order
+	history           *AlertHistory
+	drift             *DriftDetector
+	anomaly           *AnomalyDetector
+	suppressed        bool
+	dryRun            *[]Alert // Collects the alerts instead of delivering them, for DryRun
+	grouping          *GroupConfig
+	groups            map[groupKey]*pendingGroup // Alerts waiting to be sent as a group
+	outbox            map[outboxKey][]Alert      // Alerts waiting for their notifier, in order
+}
+
+// outboxKey identifies a queue of alerts a notifier is sent one at a time
+type outboxKey struct {
+	notifier int    // Index in the manager's notifiers
+	queue    string // The rule name; with grouping, one queue per notifier
 }
 
 // logEntry stores minimal info for alert checking
 type logEntry struct {
+	id        string
 	timestamp time.Time
 	level     string
+	service   string
 	message   string
+	node      string
+	source    string
+	namespace string
+	metadata  map[string]interface{} // For rules' conditions
+}
+
+// newLogEntry keeps what alert checking needs of a log
+func newLogEntry(log models.LogEntry) logEntry {
+	return logEntry{
+		id:        log.ID,
+		timestamp: log.Timestamp,
+		level:     log.Level,
+		service:   log.Service,
+		message:   log.Message,
+		node:      log.Node,
+		source:    log.Source,
+		namespace: log.Namespace,
+		metadata:  log.Metadata,
+	}
+}
+
+// logEntry returns the log as a models.LogEntry, for matching conditions
+func (log logEntry) logEntry() models.LogEntry {
+	return models.LogEntry{
+		ID:        log.id,
+		Timestamp: log.timestamp,
+		Level:     log.level,
+		Message:   log.message,
+		Service:   log.service,
+		Node:      log.node,
+		Source:    log.source,
+		Metadata:  log.metadata,
+		Namespace: log.namespace,
+	}
 }
 
 // NewAlertManager creates a new alert manager
@@ -45,21 +217,168 @@ func NewAlertManager(callback func(Alert)) *AlertManager {
 	return &AlertManager{
 		rules:         make([]AlertRule, 0),
 		alertChannel:  make(chan Alert, 100),
-		recentLogs:    make([]logEntry, 0, 1000),
+		wake:          make(chan struct{}, 1),
+		shutdown:      make(chan struct{}),
 		alertCallback: callback,
+		firing:        make(map[string]*incident),
+		outbox:        make(map[outboxKey][]Alert),
+		startedAt:     time.Now(),
 	}
 }
 
-// AddRule adds a new alert rule
-func (am *AlertManager) AddRule(rule AlertRule) {
+// AddRule adds a new alert rule, failing if its condition doesn't parse or
+// an anomaly rule's season doesn't divide into slots of at least its window
+func (am *AlertManager) AddRule(rule AlertRule) error {
+	if rule.Condition != "" {
+		condition, err := ParseCondition(rule.Condition)
+		if err != nil {
+			return err
+		}
+		rule.condition = condition
+	}
+	rule.counter = newWindowCounter(rule.Window, rule.Baseline, am.startedAt)
+	if rule.anomaly() {
+		if rule.Slot == 0 {
+			rule.Slot = DefaultAnomalySlot
+		}
+		if rule.Season == 0 {
+			rule.Season = DefaultAnomalySeason
+		}
+		if err := validateSeason(rule.Window, rule.Slot, rule.Season); err != nil {
+			return err
+		}
+		rule.volume = newVolumeModel(rule.Window, rule.Slot, rule.Season, rule.Deviations, am.startedAt)
+	}
+
 	am.mu.Lock()
 	defer am.mu.Unlock()
 	am.rules = append(am.rules, rule)
+	return nil
+}
+
+// ParseCondition parses a rule's condition: /query field matchers and line
+// filters, without a count
+func ParseCondition(text string) (*query.Query, error) {
+	condition, err := query.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition: %v", err)
+	}
+	if condition.Count {
+		return nil, errors.New("invalid condition: a condition can't count")
+	}
+	return condition, nil
+}
+
+// Rules returns a copy of the alert rules
+func (am *AlertManager) Rules() []AlertRule {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	return append([]AlertRule(nil), am.rules...)
+}
+
+// Alerts returns the alerts in the history triggered at or after since (nil without a history)
+func (am *AlertManager) Alerts(since time.Time) []Alert {
+	am.mu.Lock()
+	history := am.history
+	am.mu.Unlock()
+
+	if history == nil {
+		return nil
+	}
+	return history.List(since)
+}
+
+// AddNotifier delivers alerts through notifier as well as the callback: those
+// of rules naming it in their Channels, or naming none. Register notifiers
+// before Start.
+func (am *AlertManager) AddNotifier(notifier Notifier) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.notifiers = append(am.notifiers, notifier)
+}
+
+// SetHistory records every triggered alert into the given history, and
+// restores the silences saved with it
+func (am *AlertManager) SetHistory(history *AlertHistory) error {
+	silences, err := history.LoadSilences(time.Now())
+	if err != nil {
+		return fmt.Errorf("loading silences: %w", err)
+	}
+
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.history = history
+	am.silences = append(am.silences, silences...)
+	return nil
+}
+
+// EnableDriftDetection starts tracking each service's level distribution
+func (am *AlertManager) EnableDriftDetection(config DriftConfig) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.drift = NewDriftDetector(config)
+}
+
+// EnableAnomalyDetection starts learning each service's per-level volume
+func (am *AlertManager) EnableAnomalyDetection(config AnomalyConfig) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.anomaly = NewAnomalyDetector(config)
+}
+
+// AnomalyScores returns per-service, per-level volume anomaly scores (nil if
+// anomaly detection is disabled)
+func (am *AlertManager) AnomalyScores() []AnomalyScore {
+	am.mu.Lock()
+	anomaly := am.anomaly
+	am.mu.Unlock()
+
+	if anomaly == nil {
+		return nil
+	}
+	return anomaly.Scores()
+}
+
+// DriftScores returns per-service drift scores (nil if drift detection is disabled)
+func (am *AlertManager) DriftScores() []DriftScore {
+	am.mu.Lock()
+	drift := am.drift
+	am.mu.Unlock()
+
+	if drift == nil {
+		return nil
+	}
+	return drift.Scores()
+}
+
+// SetSuppressed stops (or resumes) recording and notifying triggered alerts.
+// A standby node keeps evaluating rules so its windows are warm but stays quiet.
+func (am *AlertManager) SetSuppressed(suppressed bool) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.suppressed = suppressed
+}
+
+// RecordAlert writes an alert triggered elsewhere (e.g. on the active node) to the history
+func (am *AlertManager) RecordAlert(alert Alert) error {
+	am.mu.Lock()
+	history := am.history
+	am.mu.Unlock()
+
+	if history == nil {
+		return nil
+	}
+	return history.Record(alert)
 }
 
 // Start begins monitoring for alerts
 func (am *AlertManager) Start() {
-	go am.processAlerts()
+	am.processing.Add(1)
+	go func() {
+		defer am.processing.Done()
+		am.processAlerts()
+	}()
+	go am.watchResolutions()
 }
 
 // ProcessLog checks a new log against all rules (called by ingestor)
@@ -67,90 +386,473 @@ func (am *AlertManager) ProcessLog(log models.LogEntry) {
 	am.mu.Lock()
 	defer am.mu.Unlock()
 
-	// Add to recent logs for window-based checking
-	am.recentLogs = append(am.recentLogs, logEntry{
-		timestamp: log.Timestamp,
-		level:     log.Level,
-		message:   log.Message,
-	})
+	am.countLog(newLogEntry(log), time.Now())
 
-	// Clean old logs outside the largest window
-	maxWindow := am.getMaxWindow()
-	cutoff := time.Now().Add(-maxWindow)
-	am.recentLogs = am.cleanOldLogs(am.recentLogs, cutoff)
+	// Track the service's level mix for slow-burn regressions
+	if am.drift != nil {
+		for _, alert := range am.drift.Observe(log) {
+			am.emit(alert)
+		}
+	}
 
-	// Check each rule
+	// And its volume per level, for deviations from what's usual at this hour
+	if am.anomaly != nil {
+		am.anomaly.Observe(log)
+	}
+}
+
+// countLog counts a log toward each rule it matches, then checks the rule; a
+// rule fires when it goes over its threshold and then once per cooldown while
+// it stays over (caller holds the lock)
+func (am *AlertManager) countLog(entry logEntry, now time.Time) {
 	for _, rule := range am.rules {
-		if am.shouldTriggerAlert(rule) {
-			alert := Alert{
-				RuleName:  rule.Name,
-				Message:   fmt.Sprintf("Alert: %s triggered! %d %s logs in last %v", rule.Name, rule.Threshold, rule.Level, rule.Window),
-				Count:     rule.Threshold,
-				Timestamp: time.Now(),
-			}
+		if !rule.matches(entry) {
+			continue
+		}
+		rule.counter.add(entry, now)
+		if rule.anomaly() {
+			rule.volume.roll(now)
+			rule.volume.current++
+		}
+		if !rule.Absent {
+			am.check(rule, now)
+		}
+	}
+}
 
-			// Non-blocking send to alert channel
-			select {
-			case am.alertChannel <- alert:
-			default:
-				// Channel full, skip this alert
-			}
+// watchResolutions resolves firing rules once their condition clears, which
+// happens as logs age out of the window rather than as new ones arrive, and
+// likewise fires absence rules and anomaly rules' drops, and resolves drift
+func (am *AlertManager) watchResolutions() {
+	ticker := time.NewTicker(resolveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-am.shutdown:
+			return
+		}
+		am.mu.Lock()
+		now := time.Now()
+		am.checkAbsences(now)
+		am.resolveCleared(now)
+		am.mu.Unlock()
+		am.rollDetectors()
+	}
+}
+
+// check fires a rule whose condition holds, unless it already fired within
+// its cooldown (caller holds the lock)
+func (am *AlertManager) check(rule AlertRule, now time.Time) {
+	open, ok := am.firing[rule.Name]
+	if ok && now.Sub(open.lastFired) < rule.ReFireInterval() {
+		return
+	}
+	count, baseline, holds := am.evaluate(rule, now)
+	if !holds {
+		return
+	}
+	message := fmt.Sprintf("Alert: %s triggered! %d %s in last %v", rule.Name, count, rule.scope(), rule.Window)
+	switch {
+	case rule.Absent:
+		message = fmt.Sprintf("Alert: %s triggered! No %s in last %v", rule.Name, rule.scope(), rule.Window)
+	case rule.anomaly():
+		score, _, _ := rule.volume.score(count, now)
+		direction := "above"
+		if score < 0 {
+			direction = "below"
 		}
+		message += fmt.Sprintf(", %.1f standard deviations %s the usual %.1f", math.Abs(score), direction, *baseline)
+	case baseline != nil:
+		message += fmt.Sprintf(", up from an average of %.1f per %v over the preceding %v", *baseline, rule.Window, rule.Baseline)
+	}
+	alert := Alert{
+		ID:        uuid.New().String(),
+		RuleName:  rule.Name,
+		Message:   message,
+		Count:     count,
+		Baseline:  baseline,
+		Timestamp: now,
+		Level:     rule.Levels(),
+		Service:   rule.Service,
+		Window:    rule.Window.String(),
+		Samples:   rule.counter.recentSamples(now),
+		Status:    StatusFiring,
+	}
+	if !ok {
+		open = &incident{id: alert.ID}
+		am.firing[rule.Name] = open
 	}
+	open.lastFired = now
+	alert.Incident = open.id
+	alert.Acknowledged = open.ack
+
+	am.emit(alert)
 }
 
-// shouldTriggerAlert checks if a rule's conditions are met
-func (am *AlertManager) shouldTriggerAlert(rule AlertRule) bool {
-	now := time.Now()
-	windowStart := now.Add(-rule.Window)
+// checkAbsences fires absence rules, and anomaly rules whose count dropped,
+// which no arriving log can trigger (caller holds the lock)
+func (am *AlertManager) checkAbsences(now time.Time) {
+	for _, rule := range am.rules {
+		if rule.Absent || rule.anomaly() {
+			am.check(rule, now)
+		}
+	}
+}
 
-	count := 0
-	for _, log := range am.recentLogs {
-		// Check if log is within time window
-		if log.timestamp.After(windowStart) {
-			// Check level match
-			if log.level == rule.Level {
-				// Check pattern match if specified
-				if rule.Pattern == "" || containsPattern(log.message, rule.Pattern) {
-					count++
-				}
-			}
+// rollDetectors closes the drift windows once they end, so drift resolves
+// even when no logs arrive
+func (am *AlertManager) rollDetectors() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	if am.drift != nil {
+		for _, alert := range am.drift.Roll() {
+			am.emit(alert)
+		}
+	}
+}
+
+// resolveCleared emits a resolution for every firing rule that has stayed
+// under its threshold for its ResolveAfter (caller holds the lock)
+func (am *AlertManager) resolveCleared(now time.Time) {
+	for _, rule := range am.rules {
+		open, ok := am.firing[rule.Name]
+		if !ok {
+			continue
+		}
+		count, baseline, holds := am.evaluate(rule, now)
+		if holds {
+			open.clearedSince = time.Time{}
+			continue
+		}
+		if open.clearedSince.IsZero() {
+			open.clearedSince = now
+		}
+		if now.Sub(open.clearedSince) < rule.ResolveAfter {
+			continue
+		}
+		delete(am.firing, rule.Name)
+		message := fmt.Sprintf("Resolved: %s is back under %d %s in %v", rule.Name, rule.Threshold, rule.scope(), rule.Window)
+		if rule.spike() {
+			message = fmt.Sprintf("Resolved: %s is back under %gx the average %s in %v", rule.Name, rule.Factor, rule.scope(), rule.Window)
+		}
+		if rule.anomaly() {
+			message = fmt.Sprintf("Resolved: %s is back within %g standard deviations of the usual %s in %v", rule.Name, rule.Deviations, rule.scope(), rule.Window)
+		}
+		if rule.Absent {
+			message = fmt.Sprintf("Resolved: %s is receiving %s again", rule.Name, rule.scope())
+		}
+		am.emit(Alert{
+			ID:        uuid.New().String(),
+			RuleName:  rule.Name,
+			Message:   message,
+			Count:     count,
+			Baseline:  baseline,
+			Timestamp: now,
+			Level:     rule.Levels(),
+			Service:   rule.Service,
+			Window:    rule.Window.String(),
+			Status:    StatusResolved,
+
+			Incident:     open.id,
+			Acknowledged: open.ack,
+		})
+	}
+}
+
+// Acknowledge records who acknowledged the open incident an alert belongs
+// to, so it stops notifying until it resolves. Acknowledging it again keeps
+// the first acknowledgment.
+func (am *AlertManager) Acknowledge(id, by string) (*Acknowledgment, error) {
+	am.mu.Lock()
+	if am.history == nil {
+		am.mu.Unlock()
+		return nil, ErrAlertNotFound
+	}
+	alert, ok := am.history.Get(id)
+	if !ok {
+		am.mu.Unlock()
+		return nil, ErrAlertNotFound
+	}
+	open, ok := am.firing[alert.RuleName]
+	if alert.Incident == "" || !ok || open.id != alert.Incident {
+		am.mu.Unlock()
+		return nil, ErrIncidentResolved
+	}
+	first := open.ack == nil
+	if first {
+		open.ack = &Acknowledgment{By: by, At: time.Now()}
+	}
+	ack, history := open.ack, am.history
+	am.mu.Unlock()
+
+	// Recorded outside the lock so writing the file doesn't hold up ingestion
+	if first {
+		if err := history.Acknowledge(alert.Incident, *ack); err != nil {
+			fmt.Printf("⚠️  Failed to record alert acknowledgment: %v\n", err)
+		}
+	}
+	return ack, nil
+}
+
+// emit queues an alert for delivery without blocking ingestion. A firing
+// alert is skipped when the queue is full, but a resolution waits aside, as
+// its incident is no longer open to resolve it again (caller holds the lock).
+func (am *AlertManager) emit(alert Alert) {
+	if am.dryRun != nil {
+		*am.dryRun = append(*am.dryRun, alert)
+		return
+	}
+	if am.stopped {
+		return
+	}
+	if alert.Status == StatusResolved && len(am.resolutions) > 0 {
+		// Behind the resolutions already waiting, in order
+		am.holdResolution(alert)
+		return
+	}
+	select {
+	case am.alertChannel <- alert:
+	default:
+		if alert.Status == StatusResolved {
+			am.holdResolution(alert)
 		}
+		// Channel full, skip this alert
+	}
+}
+
+// holdResolution keeps a resolution for processAlerts (caller holds the lock)
+func (am *AlertManager) holdResolution(alert Alert) {
+	am.resolutions = append(am.resolutions, alert)
+	select {
+	case am.wake <- struct{}{}:
+	default:
+	}
+}
+
+// evaluate counts the logs in a rule's window and reports whether its
+// condition holds: the count reaching the threshold and, for a spike rule,
+// Factor times the baseline, the average count per window before it. An
+// absence rule's holds when the count is zero, and an anomaly rule's when the
+// count is Deviations standard deviations from its baseline for the time.
+func (am *AlertManager) evaluate(rule AlertRule, now time.Time) (count int, baseline *float64, holds bool) {
+	count = rule.counter.count(now)
+	if rule.Absent {
+		// Nothing came in a whole window the manager was watching for
+		return count, nil, count == 0 && now.Sub(am.startedAt) >= rule.Window
+	}
+	if rule.anomaly() {
+		rule.volume.roll(now)
+		score, expected, scored := rule.volume.score(count, now)
+		// A drop only shows once the manager has watched a whole window
+		return count, &expected, scored && (score >= rule.Deviations ||
+			score <= -rule.Deviations && now.Sub(am.startedAt) >= rule.Window)
+	}
+	if !rule.spike() {
+		return count, nil, count >= rule.Threshold
 	}
+	if now.Sub(am.startedAt) < rule.Window+rule.Baseline {
+		// Too early to tell a spike from there being no history yet
+		return count, nil, false
+	}
+	average := float64(rule.counter.baselineCount(now)) * rule.Window.Seconds() / rule.Baseline.Seconds()
+	return count, &average, count >= rule.Threshold && float64(count) >= rule.Factor*average
+}
 
-	return count >= rule.Threshold
+// matches checks a log against the rule's level and, if set, service,
+// pattern and condition
+func (rule AlertRule) matches(log logEntry) bool {
+	return rule.matchesLevel(log.level) &&
+		(rule.Service == "" || log.service == rule.Service) &&
+		(rule.Pattern == "" || containsPattern(log.message, rule.Pattern)) &&
+		(rule.condition == nil || rule.condition.Matches(log.logEntry()))
 }
 
-// processAlerts handles triggered alerts
+// spike reports whether the rule fires on a rise over its baseline rather
+// than on its threshold alone
+func (rule AlertRule) spike() bool {
+	return rule.Factor > 0
+}
+
+// anomaly reports whether the rule fires on a deviation from the volume it
+// learned for the time of day (or week) rather than on a threshold
+func (rule AlertRule) anomaly() bool {
+	return rule.Deviations > 0
+}
+
+// validateSeason checks an anomaly rule's season divides into slots of at
+// least its window
+func validateSeason(window, slot, season time.Duration) error {
+	if slot < window || season < slot || season%slot != 0 {
+		return fmt.Errorf("invalid slot %v or season %v, expected window <= slot <= season, with the season a multiple of the slot", slot, season)
+	}
+	return nil
+}
+
+// scope describes the logs a rule counts, e.g. "ERROR logs from payments"
+// or `logs from worker matching "heartbeat"`
+func (rule AlertRule) scope() string {
+	logs := "logs"
+	if levels := rule.Levels(); levels != "" {
+		logs = levels + " logs"
+	}
+	if rule.Service != "" {
+		logs += " from " + rule.Service
+	}
+	if rule.Pattern != "" {
+		logs += fmt.Sprintf(" matching %q", rule.Pattern)
+	}
+	if rule.Condition != "" {
+		logs += " where " + rule.Condition
+	}
+	return logs
+}
+
+// processAlerts handles triggered alerts, and the resolutions held aside
+// while their queue was full, until Stop closes the queue
 func (am *AlertManager) processAlerts() {
-	for alert := range am.alertChannel {
-		if am.alertCallback != nil {
-			// Call the callback within 500ms target
-			go am.alertCallback(alert)
+	for {
+		select {
+		case alert, ok := <-am.alertChannel:
+			if !ok {
+				am.handleHeld()
+				return
+			}
+			am.handle(alert)
+		case <-am.wake:
 		}
+		am.handleHeld()
+	}
+}
+
+// handleHeld handles the resolutions held aside
+func (am *AlertManager) handleHeld() {
+	am.mu.Lock()
+	held := am.resolutions
+	am.resolutions = nil
+	am.mu.Unlock()
+	for _, alert := range held {
+		am.handle(alert)
 	}
 }
 
-// getMaxWindow returns the largest time window from all rules
-func (am *AlertManager) getMaxWindow() time.Duration {
-	max := time.Minute
+// handle records an alert and notifies its rule's channels
+func (am *AlertManager) handle(alert Alert) {
+	am.mu.Lock()
+	history := am.history
+	suppressed := am.suppressed
+	pruned := false
+	if alert.Status == StatusFiring {
+		alert.Silenced, pruned = am.silencedBy(alert)
+	}
+	rule := am.rule(alert.RuleName)
+	if alert.Status == StatusFiring && rule.Schedule != nil && !rule.Schedule.Active(alert.Timestamp) {
+		alert.OffHours = true
+	}
+	am.mu.Unlock()
+
+	if pruned {
+		am.saveSilences()
+	}
+
+	if suppressed {
+		return
+	}
+
+	if history != nil {
+		if err := history.Record(alert); err != nil {
+			fmt.Printf("⚠️  Failed to record alert history: %v\n", err)
+		}
+	}
+
+	if am.alertCallback != nil {
+		// Call the callback within 500ms target
+		go am.alertCallback(alert)
+	}
+	if alert.Acknowledged != nil && alert.Status == StatusFiring {
+		// Someone is on it; only its resolution is sent
+		return
+	}
+	if alert.Silenced != "" || alert.OffHours {
+		return
+	}
+	for i, notifier := range am.notifiers {
+		if len(rule.Channels) == 0 || slices.Contains(rule.Channels, notifier.Name()) {
+			am.deliver(i, alert)
+		}
+	}
+}
+
+// rule returns the rule an alert belongs to, or the zero rule for drift
+// alerts, which notify every channel at any hour (caller holds the lock)
+func (am *AlertManager) rule(name string) AlertRule {
 	for _, rule := range am.rules {
-		if rule.Window > max {
-			max = rule.Window
+		if rule.Name == name {
+			return rule
 		}
 	}
-	return max
+	return AlertRule{}
 }
 
-// cleanOldLogs removes logs older than cutoff
-func (am *AlertManager) cleanOldLogs(logs []logEntry, cutoff time.Time) []logEntry {
-	result := make([]logEntry, 0, len(logs))
-	for _, log := range logs {
-		if log.timestamp.After(cutoff) {
-			result = append(result, log)
+// ValidateChannels reports rules naming channels no notifier goes by
+func (am *AlertManager) ValidateChannels() error {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	var errs []error
+	for _, rule := range am.rules {
+		for _, channel := range rule.Channels {
+			if !slices.ContainsFunc(am.notifiers, func(n Notifier) bool { return n.Name() == channel }) {
+				errs = append(errs, fmt.Errorf("rule %q: unknown channel %q", rule.Name, channel))
+			}
 		}
 	}
-	return result
+	return errors.Join(errs...)
+}
+
+// send queues an alert for the notifier at index i. While a queue has alerts
+// one goroutine sends them in order, so a rule's resolution never overtakes
+// the alert that fired it (caller holds the lock).
+func (am *AlertManager) send(i int, alert Alert) {
+	key := outboxKey{notifier: i, queue: alert.RuleName}
+	if am.grouping != nil {
+		// A group mixes rules, so the notifier's alerts all share one queue
+		key.queue = ""
+	}
+	queued, sending := am.outbox[key]
+	am.outbox[key] = append(queued, alert)
+	if !sending {
+		go am.drain(key)
+	}
+}
+
+// drain sends the alerts of a queue until it is empty
+func (am *AlertManager) drain(key outboxKey) {
+	for {
+		am.mu.Lock()
+		queued := am.outbox[key]
+		if len(queued) == 0 {
+			delete(am.outbox, key)
+			am.mu.Unlock()
+			return
+		}
+		alert := queued[0]
+		am.outbox[key] = queued[1:]
+		notifier := am.notifiers[key.notifier]
+		am.mu.Unlock()
+
+		notify(notifier, alert)
+	}
+}
+
+// notify delivers an alert through one notifier, reporting failures
+func notify(notifier Notifier, alert Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if err := notifier.Notify(ctx, alert); err != nil {
+		fmt.Printf("⚠️  Failed to send alert %s via %s: %v\n", alert.RuleName, notifier.Name(), err)
+	}
 }
 
 // containsPattern checks if message contains pattern (simple substring match)
@@ -168,7 +870,18 @@ func contains(s, substr string) bool {
 	return false
 }
 
-// Stop closes the alert channel
+// Stop stops watching for resolutions and waits until the alerts already
+// queued are recorded; alerts triggered afterwards are dropped
 func (am *AlertManager) Stop() {
+	am.mu.Lock()
+	if am.stopped {
+		am.mu.Unlock()
+		return
+	}
+	am.stopped = true
+	close(am.shutdown)
 	close(am.alertChannel)
+	am.mu.Unlock()
+
+	am.processing.Wait()
 }
@@ -0,0 +1,434 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier keeps the alerts it is sent
+type recordingNotifier struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (n *recordingNotifier) Name() string { return "recording" }
+
+func (n *recordingNotifier) Notify(ctx context.Context, alert Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func (n *recordingNotifier) resolved() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	count := 0
+	for _, alert := range n.alerts {
+		if alert.Status == StatusResolved {
+			count++
+		}
+	}
+	return count
+}
+
+func TestEmitKeepsResolutionsWhenQueueIsFull(t *testing.T) {
+	am := NewAlertManager(nil)
+	notifier := &recordingNotifier{}
+	am.AddNotifier(notifier)
+
+	am.mu.Lock()
+	for i := 0; i < cap(am.alertChannel)+10; i++ {
+		am.emit(Alert{RuleName: "noisy", Status: StatusFiring})
+	}
+	am.emit(Alert{RuleName: "a", Status: StatusResolved})
+	am.emit(Alert{RuleName: "b", Status: StatusResolved})
+	held := len(am.resolutions)
+	am.mu.Unlock()
+	if held != 2 {
+		t.Fatalf("held %d resolutions with the queue full, want 2", held)
+	}
+
+	go am.processAlerts()
+	defer am.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for notifier.resolved() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("delivered %d resolutions, want 2", notifier.resolved())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPrunedSilencesAreSaved(t *testing.T) {
+	history, err := NewAlertHistory(filepath.Join(t.TempDir(), "alerts.jsonl"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+	am := NewAlertManager(nil)
+	if err := am.SetHistory(history); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	kept := am.AddSilence(Silence{Rule: "kept", Start: now, End: now.Add(time.Hour)})
+	am.AddSilence(Silence{Rule: "ended", Start: now.Add(-time.Hour), End: now.Add(-time.Minute)})
+
+	if silences := am.Silences(); len(silences) != 1 || silences[0].ID != kept.ID {
+		t.Fatalf("Silences = %+v, want only the one that hasn't ended", silences)
+	}
+	data, err := os.ReadFile(history.silencesPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []Silence
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].ID != kept.ID {
+		t.Errorf("saved %+v, want the ended silence pruned from the file too", saved)
+	}
+}
+
+// waitFor waits until the notifier has been sent count alerts and returns them
+func (n *recordingNotifier) waitFor(t *testing.T, count int) []Alert {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n.mu.Lock()
+		alerts := slices.Clone(n.alerts)
+		n.mu.Unlock()
+		if len(alerts) >= count {
+			return alerts
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("notified %d alerts, want %d", len(alerts), count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// queued takes the alerts emitted so far off the manager's queue
+func queued(am *AlertManager) []Alert {
+	var alerts []Alert
+	for {
+		select {
+		case alert := <-am.alertChannel:
+			alerts = append(alerts, alert)
+		default:
+			return alerts
+		}
+	}
+}
+
+// logAt counts one matching log at now toward the manager's rules
+func logAt(am *AlertManager, now time.Time) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.countLog(logEntry{level: "ERROR", timestamp: now, message: "boom"}, now)
+}
+
+func TestCooldown(t *testing.T) {
+	tests := []struct {
+		cooldown time.Duration
+		logs     []time.Duration // Offsets from the start, two logs each
+		want     []int           // Offsets of logs at which the rule fires
+	}{
+		{cooldown: 10 * time.Minute, logs: []time.Duration{0, time.Second, 9 * time.Minute, 10*time.Minute + time.Second}, want: []int{0, 3}},
+		{cooldown: 0, logs: []time.Duration{0, 4 * time.Minute, 5 * time.Minute}, want: []int{0, 2}},
+		{cooldown: time.Second, logs: []time.Duration{0, time.Second, 2 * time.Second}, want: []int{0, 1, 2}},
+	}
+	for _, test := range tests {
+		am := NewAlertManager(nil)
+		if err := am.AddRule(AlertRule{Name: "errors", Level: "ERROR", Threshold: 2, Window: time.Minute, Cooldown: test.cooldown}); err != nil {
+			t.Fatal(err)
+		}
+		var fired []int
+		var incidents []string
+		for i, offset := range test.logs {
+			now := am.startedAt.Add(offset)
+			logAt(am, now)
+			logAt(am, now)
+			for _, alert := range queued(am) {
+				fired = append(fired, i)
+				incidents = append(incidents, alert.Incident)
+			}
+		}
+		if !slices.Equal(fired, test.want) {
+			t.Errorf("cooldown %v: fired at logs %v, want %v", test.cooldown, fired, test.want)
+		}
+		// Re-firing while the condition holds continues the incident
+		if len(incidents) > 0 && slices.ContainsFunc(incidents, func(id string) bool { return id != incidents[0] }) {
+			t.Errorf("cooldown %v: incidents %v, want one", test.cooldown, incidents)
+		}
+	}
+}
+
+// resolveAt checks the manager's firing rules for having cleared at now
+func resolveAt(am *AlertManager, now time.Time) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.resolveCleared(now)
+}
+
+func TestResolveAfter(t *testing.T) {
+	tests := []struct {
+		resolveAfter time.Duration
+		checks       []time.Duration // Offsets from the start the rule is checked at
+		want         int             // Index of the check that resolves it, -1 for none
+	}{
+		// The logs leave the one minute window after 60s
+		{resolveAfter: 0, checks: []time.Duration{30 * time.Second, 61 * time.Second}, want: 1},
+		{resolveAfter: 30 * time.Second, checks: []time.Duration{61 * time.Second, 90 * time.Second, 91 * time.Second}, want: 2},
+		{resolveAfter: time.Hour, checks: []time.Duration{61 * time.Second, 30 * time.Minute}, want: -1},
+	}
+	for _, test := range tests {
+		am := NewAlertManager(nil)
+		if err := am.AddRule(AlertRule{Name: "errors", Level: "ERROR", Threshold: 2, Window: time.Minute, ResolveAfter: test.resolveAfter}); err != nil {
+			t.Fatal(err)
+		}
+		logAt(am, am.startedAt)
+		logAt(am, am.startedAt)
+		fired := queued(am)
+
+		resolved := -1
+		for i, offset := range test.checks {
+			resolveAt(am, am.startedAt.Add(offset))
+			for _, alert := range queued(am) {
+				if alert.Status != StatusResolved || alert.Incident != fired[0].Incident {
+					t.Errorf("resolve after %v: emitted %+v, want the incident's resolution", test.resolveAfter, alert)
+				}
+				resolved = i
+			}
+		}
+		if resolved != test.want {
+			t.Errorf("resolve after %v: resolved at check %d, want %d", test.resolveAfter, resolved, test.want)
+		}
+	}
+}
+
+func TestResolveAfterRestartsWhenTheConditionReturns(t *testing.T) {
+	am := NewAlertManager(nil)
+	if err := am.AddRule(AlertRule{Name: "errors", Level: "ERROR", Threshold: 2, Window: time.Minute, ResolveAfter: 30 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	at := func(seconds int) time.Time { return am.startedAt.Add(time.Duration(seconds) * time.Second) }
+	logAt(am, at(0))
+	logAt(am, at(0))
+	resolveAt(am, at(61)) // Clear from here
+
+	// Back over the threshold within the cooldown: no new alert, but the clock restarts
+	logAt(am, at(70))
+	logAt(am, at(70))
+	resolveAt(am, at(75))
+	resolveAt(am, at(131)) // Clear again
+	resolveAt(am, at(160))
+	if alerts := queued(am); len(alerts) != 1 {
+		t.Fatalf("emitted %d alerts before the condition stayed clear, want only the first firing", len(alerts))
+	}
+	resolveAt(am, at(161))
+	if alerts := queued(am); len(alerts) != 1 || alerts[0].Status != StatusResolved {
+		t.Errorf("emitted %+v, want the resolution", alerts)
+	}
+}
+
+// newTestManager returns a manager recording into a history in a temp dir and
+// notifying the returned notifier, with rules but not started
+func newTestManager(t *testing.T, rules ...AlertRule) (*AlertManager, *AlertHistory, *recordingNotifier) {
+	t.Helper()
+	history, err := NewAlertHistory(filepath.Join(t.TempDir(), "alerts.jsonl"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { history.Close() })
+	am := NewAlertManager(nil)
+	if err := am.SetHistory(history); err != nil {
+		t.Fatal(err)
+	}
+	notifier := &recordingNotifier{}
+	am.AddNotifier(notifier)
+	for _, rule := range rules {
+		if err := am.AddRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return am, history, notifier
+}
+
+// handleQueued handles the alerts emitted so far, as processAlerts would
+func handleQueued(am *AlertManager) []Alert {
+	alerts := queued(am)
+	for _, alert := range alerts {
+		am.handle(alert)
+	}
+	return alerts
+}
+
+func TestAcknowledgedIncidentsOnlyNotifyTheirResolution(t *testing.T) {
+	am, history, notifier := newTestManager(t, AlertRule{Name: "errors", Level: "ERROR", Threshold: 1, Window: time.Minute, Cooldown: time.Second})
+	at := func(seconds int) time.Time { return am.startedAt.Add(time.Duration(seconds) * time.Second) }
+
+	logAt(am, at(0))
+	first := handleQueued(am)[0]
+	notifier.waitFor(t, 1)
+
+	if _, err := am.Acknowledge("no such alert", "alice"); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("Acknowledge of an unknown alert = %v, want ErrAlertNotFound", err)
+	}
+	ack, err := am.Acknowledge(first.ID, "alice")
+	if err != nil || ack.By != "alice" {
+		t.Fatalf("Acknowledge = %+v, %v, want alice's", ack, err)
+	}
+	if again, err := am.Acknowledge(first.ID, "bob"); err != nil || again.By != "alice" {
+		t.Errorf("Acknowledge again = %+v, %v, want alice's kept", again, err)
+	}
+
+	// Re-firing is recorded, carrying the acknowledgment, but not sent
+	logAt(am, at(2))
+	refired := handleQueued(am)
+	if len(refired) != 1 || refired[0].Acknowledged == nil || refired[0].Acknowledged.By != "alice" {
+		t.Fatalf("re-fired %+v, want one alert acknowledged by alice", refired)
+	}
+	resolveAt(am, at(63))
+	handleQueued(am)
+
+	// The queue is sent in order, so the resolution arriving means the re-firing was skipped
+	var statuses []string
+	for _, alert := range notifier.waitFor(t, 2) {
+		statuses = append(statuses, alert.Status)
+	}
+	if want := []string{StatusFiring, StatusResolved}; !slices.Equal(statuses, want) {
+		t.Errorf("notified %v, want %v", statuses, want)
+	}
+	if recorded := history.List(time.Time{}); len(recorded) != 3 {
+		t.Errorf("recorded %d alerts, want all 3", len(recorded))
+	}
+	if _, err := am.Acknowledge(first.ID, "bob"); !errors.Is(err, ErrIncidentResolved) {
+		t.Errorf("Acknowledge after resolving = %v, want ErrIncidentResolved", err)
+	}
+}
+
+func TestSilenceWindow(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		alert    Alert
+		silenced bool
+	}{
+		{"before it starts", Alert{RuleName: "errors", Status: StatusFiring, Timestamp: now.Add(-2 * time.Minute)}, false},
+		{"while active", Alert{RuleName: "errors", Status: StatusFiring, Timestamp: now}, true},
+		{"another rule", Alert{RuleName: "latency", Status: StatusFiring, Timestamp: now}, false},
+		{"the silenced service", Alert{RuleName: "latency", Service: "payments", Status: StatusFiring, Timestamp: now}, true},
+		{"a service its samples all come from", Alert{RuleName: "latency", Status: StatusFiring, Timestamp: now,
+			Samples: []Sample{{Service: "payments"}, {Service: "payments"}}}, true},
+		{"samples from several services", Alert{RuleName: "latency", Status: StatusFiring, Timestamp: now,
+			Samples: []Sample{{Service: "payments"}, {Service: "search"}}}, false},
+		{"a resolution", Alert{RuleName: "errors", Status: StatusResolved, Timestamp: now}, false},
+		{"once it has ended", Alert{RuleName: "errors", Status: StatusFiring, Timestamp: now.Add(2 * time.Minute)}, false},
+	}
+
+	am, history, notifier := newTestManager(t)
+	am.AddSilence(Silence{Rule: "errors", Start: now.Add(-time.Minute), End: now.Add(time.Minute)})
+	am.AddSilence(Silence{Service: "payments", Start: now.Add(-time.Minute), End: now.Add(time.Minute)})
+	var want []time.Time
+	for _, test := range tests {
+		am.handle(test.alert)
+		recorded := history.List(time.Time{})
+		if silenced := recorded[len(recorded)-1].Silenced != ""; silenced != test.silenced {
+			t.Errorf("%s: silenced %v, want %v", test.name, silenced, test.silenced)
+		}
+		if !test.silenced {
+			want = append(want, test.alert.Timestamp)
+		}
+	}
+	var sent []time.Time
+	for _, alert := range notifier.waitFor(t, len(want)) {
+		sent = append(sent, alert.Timestamp)
+	}
+	slices.SortFunc(sent, time.Time.Compare)
+	slices.SortFunc(want, time.Time.Compare)
+	if !slices.EqualFunc(sent, want, time.Time.Equal) {
+		t.Errorf("notified alerts at %v, want only the ones not silenced, at %v", sent, want)
+	}
+
+	// The last alert came after both silences ended, which pruned them
+	if silences := am.Silences(); len(silences) != 0 {
+		t.Errorf("Silences = %+v after they ended, want none", silences)
+	}
+	restored, err := history.LoadSilences(now)
+	if err != nil || len(restored) != 0 {
+		t.Errorf("LoadSilences = %+v, %v, want the ended silences gone from the file", restored, err)
+	}
+}
+
+// gatedNotifier records alerts like recordingNotifier, but holds up those
+// of one rule until released
+type gatedNotifier struct {
+	recordingNotifier
+	rule    string
+	release chan struct{}
+}
+
+func (n *gatedNotifier) Notify(ctx context.Context, alert Alert) error {
+	if alert.RuleName == n.rule {
+		<-n.release
+	}
+	return n.recordingNotifier.Notify(ctx, alert)
+}
+
+func TestOutboxKeepsEachRulesOrder(t *testing.T) {
+	am := NewAlertManager(nil)
+	notifier := &gatedNotifier{rule: "slow", release: make(chan struct{})}
+	am.AddNotifier(notifier)
+
+	for _, alert := range []Alert{
+		{RuleName: "slow", Status: StatusFiring, Message: "slow fired"},
+		{RuleName: "slow", Status: StatusResolved, Message: "slow resolved"},
+		{RuleName: "fast", Status: StatusFiring, Message: "fast fired"},
+		{RuleName: "fast", Status: StatusResolved, Message: "fast resolved"},
+	} {
+		am.handle(alert)
+	}
+
+	// A notifier stuck on one rule's alert doesn't hold up another rule's
+	var got []string
+	for _, alert := range notifier.waitFor(t, 2) {
+		got = append(got, alert.Message)
+	}
+	if want := []string{"fast fired", "fast resolved"}; !slices.Equal(got, want) {
+		t.Errorf("notified %v while slow was held up, want %v", got, want)
+	}
+
+	// The held rule's resolution waits behind the alert it resolves
+	close(notifier.release)
+	got = nil
+	for _, alert := range notifier.waitFor(t, 4)[2:] {
+		got = append(got, alert.Message)
+	}
+	if want := []string{"slow fired", "slow resolved"}; !slices.Equal(got, want) {
+		t.Errorf("notified %v once released, want %v", got, want)
+	}
+
+	// The queues are let go once drained
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		am.mu.Lock()
+		left := len(am.outbox)
+		am.mu.Unlock()
+		if left == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("outbox still has %d queues once sent", left)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
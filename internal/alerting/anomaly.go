@@ -0,0 +1,269 @@
+package alerting
+
+import (
+	"logstream/pkg/models"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AnomalyConfig controls volume anomaly detection
+type AnomalyConfig struct {
+	Bucket     time.Duration // Length of each counted bucket
+	Slot       time.Duration // Part of the season each baseline covers, e.g. an hour
+	Season     time.Duration // Period volume repeats over, e.g. 24h for daily patterns
+	Smoothing  float64       // Weight of the newest bucket in a baseline (0-1)
+	Threshold  float64       // Standard deviations from the baseline that count as anomalous
+	MinSamples int           // Buckets a baseline needs before it is scored
+}
+
+// AnomalyScore describes how far a service's volume of one level in the
+// current bucket is from the baseline for this time of the season
+type AnomalyScore struct {
+	Service   string  `json:"service"`
+	Level     string  `json:"level"`
+	Count     int     `json:"count"`    // Logs in the current bucket so far
+	Expected  float64 `json:"expected"` // Baseline logs per bucket
+	StdDev    float64 `json:"stddev"`
+	Score     float64 `json:"score"` // Standard deviations above (or below) expected
+	Anomalous bool    `json:"anomalous"`
+	Samples   int     `json:"samples"` // Buckets the baseline learned from
+}
+
+// AnomalyDetector learns each service's per-level volume for every slot of
+// the season and scores how far the current bucket deviates from it. Anomaly
+// rules alert on it (see volumeModel).
+type AnomalyDetector struct {
+	config      AnomalyConfig
+	bucketStart time.Time
+	partial     bool // The current bucket began before the detector did
+	series      map[volumeKey]*volumeSeries
+	mu          sync.Mutex
+}
+
+// volumeKey identifies one service's logs of one level
+type volumeKey struct {
+	service string
+	level   string
+}
+
+// volumeSeries holds a key's count in the current bucket and its baselines
+type volumeSeries struct {
+	current   int
+	baselines []volumeBaseline // One per slot of the season
+}
+
+// volumeBaseline is the smoothed mean and variance of a slot's bucket counts
+type volumeBaseline struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+// NewAnomalyDetector creates an anomaly detector
+func NewAnomalyDetector(config AnomalyConfig) *AnomalyDetector {
+	now := time.Now()
+	return &AnomalyDetector{
+		config:      config,
+		bucketStart: now.Truncate(config.Bucket),
+		partial:     !now.Truncate(config.Bucket).Equal(now),
+		series:      make(map[volumeKey]*volumeSeries),
+	}
+}
+
+// Observe counts a log toward its service's volume of its level
+func (ad *AnomalyDetector) Observe(log models.LogEntry) {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	ad.roll(time.Now())
+	key := volumeKey{log.Service, log.Level}
+	series, exists := ad.series[key]
+	if !exists {
+		series = &volumeSeries{baselines: make([]volumeBaseline, seasonSlots(ad.config.Season, ad.config.Slot))}
+		ad.series[key] = series
+	}
+	series.current++
+}
+
+// Scores returns the current anomaly score of every tracked service and
+// level, furthest from expected first
+func (ad *AnomalyDetector) Scores() []AnomalyScore {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	ad.roll(time.Now())
+	result := make([]AnomalyScore, 0, len(ad.series))
+	for key, series := range ad.series {
+		result = append(result, ad.score(key, series))
+	}
+
+	sort.Slice(result, func(i, j int) bool { return math.Abs(result[i].Score) > math.Abs(result[j].Score) })
+	return result
+}
+
+// roll folds finished buckets into the baselines (caller holds the lock)
+func (ad *AnomalyDetector) roll(now time.Time) {
+	elapsed := now.Sub(ad.bucketStart)
+	if elapsed < ad.config.Bucket {
+		return
+	}
+
+	slot := seasonSlot(ad.bucketStart, ad.config.Season, ad.config.Slot)
+	for _, series := range ad.series {
+		if !ad.partial {
+			// A partial bucket's count would understate the volume
+			series.baselines[slot].learn(series.current, ad.config.Smoothing)
+		}
+		series.current = 0
+	}
+
+	// Buckets nothing was observed in, e.g. while the ticker lagged, count
+	// as empty; at most a season of them
+	missed := min(int(elapsed/ad.config.Bucket)-1, int(ad.config.Season/ad.config.Bucket))
+	for i := 1; i <= missed; i++ {
+		slot := seasonSlot(ad.bucketStart.Add(time.Duration(i)*ad.config.Bucket), ad.config.Season, ad.config.Slot)
+		for _, series := range ad.series {
+			series.baselines[slot].learn(0, ad.config.Smoothing)
+		}
+	}
+
+	ad.bucketStart = now.Truncate(ad.config.Bucket)
+	ad.partial = false
+}
+
+// score compares a key's current bucket with its baseline for this slot.
+// Only a rise counts as anomalous while the bucket is still filling.
+func (ad *AnomalyDetector) score(key volumeKey, series *volumeSeries) AnomalyScore {
+	baseline := series.baselines[seasonSlot(ad.bucketStart, ad.config.Season, ad.config.Slot)]
+	result := AnomalyScore{
+		Service:  key.service,
+		Level:    key.level,
+		Count:    series.current,
+		Expected: baseline.mean,
+		Samples:  baseline.samples,
+	}
+	if baseline.samples < ad.config.MinSamples {
+		return result
+	}
+	result.StdDev = math.Sqrt(baseline.variance)
+	result.Score = baseline.score(series.current)
+	result.Anomalous = result.Score >= ad.config.Threshold
+	return result
+}
+
+// learn folds a finished bucket's count into the baseline
+func (baseline *volumeBaseline) learn(count int, smoothing float64) {
+	x := float64(count)
+	if baseline.samples == 0 {
+		baseline.mean = x
+	} else {
+		// Exponentially weighted mean and variance, weighting the first
+		// buckets equally so the variance isn't understated early on
+		weight := max(smoothing, 1/float64(baseline.samples+1))
+		diff := x - baseline.mean
+		increment := weight * diff
+		baseline.mean += increment
+		baseline.variance = (1 - weight) * (baseline.variance + diff*increment)
+	}
+	baseline.samples++
+}
+
+// score returns how many standard deviations a count is above (or below)
+// the baseline. Counts vary by at least their square root, as for a Poisson
+// process, so a quiet, steady baseline doesn't make every extra log significant.
+func (baseline volumeBaseline) score(count int) float64 {
+	spread := max(math.Sqrt(baseline.variance), math.Sqrt(baseline.mean), 1)
+	return (float64(count) - baseline.mean) / spread
+}
+
+// Anomaly rule defaults
+const (
+	DefaultAnomalySlot   = time.Hour
+	DefaultAnomalySeason = 24 * time.Hour
+	anomalySmoothing     = 0.1
+)
+
+// volumeModel learns an anomaly rule's count per window for each slot of its
+// season, so the count in the last window can be scored against what is
+// usual at this time of day (or week)
+type volumeModel struct {
+	bucket      time.Duration // The rule's window
+	slot        time.Duration
+	season      time.Duration
+	deviations  float64 // Buckets this far from their baseline aren't learned
+	bucketStart time.Time
+	partial     bool // The current bucket began before the rule was added
+	current     int  // Matching logs in the current bucket
+	baselines   []volumeBaseline
+	skipped     []int // Anomalous buckets in a row each baseline hasn't learned
+}
+
+// newVolumeModel creates a rule's model, with its first bucket starting now
+func newVolumeModel(bucket, slot, season time.Duration, deviations float64, now time.Time) *volumeModel {
+	return &volumeModel{
+		bucket:      bucket,
+		slot:        slot,
+		season:      season,
+		deviations:  deviations,
+		bucketStart: now.Truncate(bucket),
+		partial:     !now.Truncate(bucket).Equal(now),
+		baselines:   make([]volumeBaseline, seasonSlots(season, slot)),
+		skipped:     make([]int, seasonSlots(season, slot)),
+	}
+}
+
+// roll folds the buckets that ended by now into the baselines, counting
+// those no log arrived in as empty
+func (vm *volumeModel) roll(now time.Time) {
+	elapsed := now.Sub(vm.bucketStart)
+	if elapsed < vm.bucket {
+		return
+	}
+	if !vm.partial {
+		vm.learn(seasonSlot(vm.bucketStart, vm.season, vm.slot), vm.current)
+	}
+	missed := min(int(elapsed/vm.bucket)-1, int(vm.season/vm.bucket))
+	for i := 1; i <= missed; i++ {
+		vm.learn(seasonSlot(vm.bucketStart.Add(time.Duration(i)*vm.bucket), vm.season, vm.slot), 0)
+	}
+	vm.bucketStart = now.Truncate(vm.bucket)
+	vm.partial = false
+	vm.current = 0
+}
+
+// learn folds a finished bucket into its slot's baseline, unless the bucket
+// is anomalous, so an outage or burst doesn't become the norm while it lasts.
+// One that persists for a whole slot's worth of buckets is learned.
+func (vm *volumeModel) learn(slot, count int) {
+	baseline := &vm.baselines[slot]
+	buckets := max(int(vm.slot/vm.bucket), 1)
+	if baseline.samples >= buckets && math.Abs(baseline.score(count)) >= vm.deviations && vm.skipped[slot] < buckets {
+		vm.skipped[slot]++
+		return
+	}
+	vm.skipped[slot] = 0
+	baseline.learn(count, anomalySmoothing)
+}
+
+// score returns how many standard deviations count is from the baseline of
+// now's slot, and the baseline's mean; ok is false until the slot has
+// learned a slot's worth of buckets
+func (vm *volumeModel) score(count int, now time.Time) (score, expected float64, ok bool) {
+	baseline := vm.baselines[seasonSlot(now, vm.season, vm.slot)]
+	if baseline.samples < max(int(vm.slot/vm.bucket), 1) {
+		return 0, baseline.mean, false
+	}
+	return baseline.score(count), baseline.mean, true
+}
+
+// seasonSlots returns how many baselines a season has
+func seasonSlots(season, slot time.Duration) int {
+	return int(season / slot)
+}
+
+// seasonSlot returns which of the season's baselines a time falls in, in UTC
+func seasonSlot(t time.Time, season, slot time.Duration) int {
+	return int(time.Duration(t.UnixNano())%season/slot) % seasonSlots(season, slot)
+}
@@ -0,0 +1,337 @@
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"logstream/pkg/models"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a version-controlled rule set: the alert rules and the
+// notification channels alerts are sent to
+type Config struct {
+	Rules    []RuleConfig    `json:"rules" yaml:"rules"`
+	Channels []ChannelConfig `json:"channels" yaml:"channels"`
+}
+
+// RuleConfig is an AlertRule as written in a config file
+type RuleConfig struct {
+	Name         string   `json:"name" yaml:"name"`
+	Level        string   `json:"level" yaml:"level"`
+	MinLevel     string   `json:"min_level" yaml:"min_level"`
+	Service      string   `json:"service" yaml:"service"`
+	Threshold    int      `json:"threshold" yaml:"threshold"`
+	Window       string   `json:"window" yaml:"window"` // Go duration, e.g. 1m
+	Pattern      string   `json:"pattern" yaml:"pattern"`
+	Cooldown     string   `json:"cooldown" yaml:"cooldown"`           // Go duration; DefaultCooldown if empty
+	ResolveAfter string   `json:"resolve_after" yaml:"resolve_after"` // Go duration
+	Factor       float64  `json:"factor" yaml:"factor"`               // Spike rules, with baseline
+	Baseline     string   `json:"baseline" yaml:"baseline"`           // Go duration
+	Absent       bool     `json:"absent" yaml:"absent"`               // Fire when no matching logs arrive
+	Deviations   float64  `json:"deviations" yaml:"deviations"`       // Anomaly rules: standard deviations from the usual count
+	Slot         string   `json:"slot" yaml:"slot"`                   // Anomaly rules: Go duration; DefaultAnomalySlot if empty
+	Season       string   `json:"season" yaml:"season"`               // Anomaly rules: Go duration; DefaultAnomalySeason if empty
+	Condition    string   `json:"condition" yaml:"condition"`         // /query matchers, e.g. metadata.region="eu-west-1"
+	Channels     []string `json:"channels" yaml:"channels"`           // Names of the channels notified, all if empty
+	ActiveHours  string   `json:"active_hours" yaml:"active_hours"`   // When it notifies, e.g. Mon-Fri 09:00-18:00; always if empty
+	Timezone     string   `json:"timezone" yaml:"timezone"`           // IANA zone of active_hours, UTC if empty
+}
+
+// ChannelConfig is a notifier as written in a config file. Type picks the
+// fields that apply: urls for webhook; webhook_url, or token and channel,
+// and channels for slack; routing_key for pagerduty; command and
+// max_concurrent for exec; topic_arn for sns; topic and credentials_file for
+// pubsub. Secrets may be given as $VAR or ${VAR} to read them from the
+// environment.
+type ChannelConfig struct {
+	Name            string            `json:"name" yaml:"name"`
+	Type            string            `json:"type" yaml:"type"`
+	URLs            []string          `json:"urls" yaml:"urls"`
+	WebhookURL      string            `json:"webhook_url" yaml:"webhook_url"`
+	Token           string            `json:"token" yaml:"token"`
+	Channel         string            `json:"channel" yaml:"channel"`
+	Channels        map[string]string `json:"channels" yaml:"channels"`
+	RoutingKey      string            `json:"routing_key" yaml:"routing_key"`
+	Command         []string          `json:"command" yaml:"command"`
+	MaxConcurrent   int               `json:"max_concurrent" yaml:"max_concurrent"`
+	TopicARN        string            `json:"topic_arn" yaml:"topic_arn"`
+	Topic           string            `json:"topic" yaml:"topic"`
+	CredentialsFile string            `json:"credentials_file" yaml:"credentials_file"`
+	Timeout         string            `json:"timeout" yaml:"timeout"` // Per attempt, or per run for exec, e.g. 5s
+	Retries         *int              `json:"retries" yaml:"retries"`
+}
+
+// LoadConfig reads a rule set from a YAML file, or JSON if its name ends in
+// .json. Unknown fields are errors, so typos don't silently drop settings.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&config)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(&config); errors.Is(err, io.EOF) {
+			err = nil // An empty file
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// BuildRules validates the rules, reporting every problem found by rule
+func (config *Config) BuildRules() ([]AlertRule, error) {
+	var errs []error
+	rules := make([]AlertRule, 0, len(config.Rules))
+	seen := make(map[string]bool)
+	for i, rc := range config.Rules {
+		rule, problems := rc.build()
+		if rc.Name != "" && seen[rc.Name] {
+			problems = append(problems, "name is used by an earlier rule")
+		}
+		seen[rc.Name] = true
+		if len(problems) > 0 {
+			errs = append(errs, fmt.Errorf("rules[%d] (%q): %s", i, rc.Name, strings.Join(problems, "; ")))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, errors.Join(errs...)
+}
+
+// Build validates a single rule, e.g. one to try out with DryRun, reporting
+// all its problems at once
+func (rc RuleConfig) Build() (AlertRule, error) {
+	rule, problems := rc.build()
+	if len(problems) > 0 {
+		return rule, errors.New(strings.Join(problems, "; "))
+	}
+	return rule, nil
+}
+
+// build turns a rule's config into an AlertRule, listing what is wrong with it
+func (rc RuleConfig) build() (AlertRule, []string) {
+	var problems []string
+	rule := AlertRule{
+		Name:      rc.Name,
+		Level:     strings.ToUpper(rc.Level),
+		MinLevel:  strings.ToUpper(rc.MinLevel),
+		Service:   rc.Service,
+		Threshold: rc.Threshold,
+		Pattern:   rc.Pattern,
+		Absent:    rc.Absent,
+		Condition: rc.Condition,
+		Channels:  rc.Channels,
+	}
+	if rule.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	levels := strings.Join(models.Levels, ", ")
+	switch {
+	case rule.Level == "" && rule.MinLevel == "":
+		if !rule.Absent {
+			problems = append(problems, "expected level or min_level")
+		}
+	case rule.Level != "" && rule.MinLevel != "":
+		problems = append(problems, "expected level or min_level, not both")
+	case rule.Level != "":
+		if _, ok := models.LevelSeverity(rule.Level); !ok {
+			problems = append(problems, fmt.Sprintf("invalid level %q, expected one of %s", rc.Level, levels))
+		}
+	default:
+		if _, ok := models.LevelSeverity(rule.MinLevel); !ok {
+			problems = append(problems, fmt.Sprintf("invalid min_level %q, expected one of %s", rc.MinLevel, levels))
+		}
+	}
+	switch {
+	case rc.Deviations < 0:
+		problems = append(problems, "deviations can't be negative")
+	case rc.Deviations > 0 && (rule.Absent || rule.Threshold != 0 || rc.Factor != 0):
+		problems = append(problems, "an anomaly rule takes no absent, threshold or factor")
+	case rule.Absent && (rule.Threshold != 0 || rc.Factor != 0):
+		problems = append(problems, "an absence rule takes no threshold or factor")
+	case !rule.Absent && rc.Deviations == 0 && rule.Threshold < 1:
+		problems = append(problems, "threshold must be at least 1")
+	}
+	window, err := time.ParseDuration(rc.Window)
+	if err != nil || window <= 0 {
+		problems = append(problems, fmt.Sprintf("invalid window %q, expected a positive duration, e.g. 1m", rc.Window))
+	}
+	rule.Window = window
+	rule.Deviations = rc.Deviations
+	if rc.Deviations == 0 && (rc.Slot != "" || rc.Season != "") {
+		problems = append(problems, "slot and season are only used with deviations")
+	}
+	if rc.Deviations > 0 {
+		rule.Slot, rule.Season = DefaultAnomalySlot, DefaultAnomalySeason
+		if rc.Slot != "" {
+			if rule.Slot, err = time.ParseDuration(rc.Slot); err != nil || rule.Slot <= 0 {
+				problems = append(problems, fmt.Sprintf("invalid slot %q, expected a positive duration, e.g. 1h", rc.Slot))
+			}
+		}
+		if rc.Season != "" {
+			if rule.Season, err = time.ParseDuration(rc.Season); err != nil || rule.Season <= 0 {
+				problems = append(problems, fmt.Sprintf("invalid season %q, expected a positive duration, e.g. 168h", rc.Season))
+			}
+		}
+		if window > 0 && rule.Slot > 0 && rule.Season > 0 {
+			if err := validateSeason(window, rule.Slot, rule.Season); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+	if rc.Cooldown != "" {
+		cooldown, err := time.ParseDuration(rc.Cooldown)
+		if err != nil || cooldown <= 0 {
+			problems = append(problems, fmt.Sprintf("invalid cooldown %q, expected a positive duration, e.g. 10m", rc.Cooldown))
+		}
+		rule.Cooldown = cooldown
+	}
+	if rc.ResolveAfter != "" {
+		resolveAfter, err := time.ParseDuration(rc.ResolveAfter)
+		if err != nil || resolveAfter < 0 {
+			problems = append(problems, fmt.Sprintf("invalid resolve_after %q, expected a duration, e.g. 5m", rc.ResolveAfter))
+		}
+		rule.ResolveAfter = resolveAfter
+	}
+	switch {
+	case rc.Factor < 0:
+		problems = append(problems, "factor can't be negative")
+	case rc.Factor > 0 && rc.Baseline == "":
+		problems = append(problems, "a spike rule's factor needs a baseline")
+	case rc.Factor == 0 && rc.Baseline != "":
+		problems = append(problems, "baseline is only used with a factor")
+	case rc.Factor > 0:
+		baseline, err := time.ParseDuration(rc.Baseline)
+		if err != nil || baseline < window {
+			problems = append(problems, fmt.Sprintf("invalid baseline %q, expected a duration of at least the window, e.g. 30m", rc.Baseline))
+		}
+		rule.Factor = rc.Factor
+		rule.Baseline = baseline
+	}
+	if rc.Condition != "" {
+		if _, err := ParseCondition(rc.Condition); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	switch {
+	case rc.ActiveHours != "":
+		schedule, err := ParseSchedule(rc.ActiveHours, rc.Timezone)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		rule.Schedule = schedule
+	case rc.Timezone != "":
+		problems = append(problems, "timezone is only used with active_hours")
+	}
+	return rule, problems
+}
+
+// BuildNotifiers validates the channels and creates their notifiers,
+// reporting every problem found by channel. source names this node to
+// receivers that ask, e.g. PagerDuty.
+func (config *Config) BuildNotifiers(source string) ([]Notifier, error) {
+	var errs []error
+	notifiers := make([]Notifier, 0, len(config.Channels))
+	seen := make(map[string]bool)
+	for i, cc := range config.Channels {
+		notifier, err := cc.build(source)
+		if cc.Name == "" {
+			err = errors.Join(errors.New("name is required"), err)
+		} else if seen[cc.Name] {
+			err = errors.Join(errors.New("name is used by an earlier channel"), err)
+		}
+		seen[cc.Name] = true
+		if err != nil {
+			errs = append(errs, fmt.Errorf("channels[%d] (%q): %s", i, cc.Name, strings.ReplaceAll(err.Error(), "\n", "; ")))
+			continue
+		}
+		notifiers = append(notifiers, Named(cc.Name, notifier))
+	}
+	return notifiers, errors.Join(errs...)
+}
+
+// build creates a channel's notifier
+func (cc ChannelConfig) build(source string) (Notifier, error) {
+	retry := RetryConfig{Retries: 3}
+	if cc.Timeout != "" {
+		timeout, err := time.ParseDuration(cc.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q, expected a positive duration, e.g. 5s", cc.Timeout)
+		}
+		retry.Timeout = timeout
+	}
+	if cc.Retries != nil {
+		if *cc.Retries < 0 {
+			return nil, errors.New("retries can't be negative")
+		}
+		retry.Retries = *cc.Retries
+	}
+
+	switch cc.Type {
+	case "webhook":
+		if len(cc.URLs) == 0 {
+			return nil, errors.New("a webhook channel needs urls")
+		}
+		urls := make([]string, len(cc.URLs))
+		for i, raw := range cc.URLs {
+			urls[i] = os.ExpandEnv(raw)
+			if u, err := url.Parse(urls[i]); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("invalid urls[%d], expected an http or https URL", i)
+			}
+		}
+		return NewWebhookNotifier(urls, retry), nil
+	case "slack":
+		return NewSlackNotifier(SlackConfig{
+			WebhookURL: os.ExpandEnv(cc.WebhookURL),
+			Token:      os.ExpandEnv(cc.Token),
+			Channel:    cc.Channel,
+			Channels:   cc.Channels,
+			Retry:      retry,
+		})
+	case "pagerduty":
+		return NewPagerDutyNotifier(PagerDutyConfig{
+			RoutingKey: os.ExpandEnv(cc.RoutingKey),
+			Source:     source,
+			Retry:      retry,
+		})
+	case "exec":
+		if cc.MaxConcurrent < 0 {
+			return nil, errors.New("max_concurrent can't be negative")
+		}
+		command := make([]string, len(cc.Command))
+		for i, arg := range cc.Command {
+			command[i] = os.ExpandEnv(arg)
+		}
+		return NewExecNotifier(ExecConfig{
+			Command:       command,
+			Timeout:       retry.Timeout,
+			MaxConcurrent: cc.MaxConcurrent,
+		})
+	case "sns":
+		return NewSNSNotifier(SNSConfig{TopicARN: os.ExpandEnv(cc.TopicARN), Retry: retry})
+	case "pubsub":
+		return NewPubSubNotifier(PubSubConfig{
+			Topic:           os.ExpandEnv(cc.Topic),
+			CredentialsFile: os.ExpandEnv(cc.CredentialsFile),
+			Retry:           retry,
+		})
+	}
+	return nil, fmt.Errorf("invalid type %q, expected webhook, slack, pagerduty, exec, sns or pubsub", cc.Type)
+}
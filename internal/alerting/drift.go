@@ -0,0 +1,247 @@
+package alerting
+
+import (
+	"fmt"
+	"logstream/pkg/models"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DriftRuleName is the rule name of drift alerts
+const DriftRuleName = "Level Distribution Drift"
+
+// DriftConfig controls level-distribution drift detection
+type DriftConfig struct {
+	Window     time.Duration // Length of each observation window
+	Smoothing  float64       // Weight of the newest window in the baseline (0-1)
+	Threshold  float64       // Score at or above which a service counts as drifting (0-1)
+	MinSamples int           // Logs a window needs before it is scored or learned from
+	Alert      bool          // Trigger an alert when a service starts drifting
+}
+
+// DriftScore describes how far a service's current level mix is from its baseline
+type DriftScore struct {
+	Service  string             `json:"service"`
+	Score    float64            `json:"score"`
+	Drifting bool               `json:"drifting"`
+	Samples  int                `json:"samples"`
+	Current  map[string]float64 `json:"current"`
+	Baseline map[string]float64 `json:"baseline"`
+}
+
+// DriftDetector tracks each service's level mix and scores how far the
+// current window deviates from the learned baseline
+type DriftDetector struct {
+	config   DriftConfig
+	services map[string]*levelMix
+	resolved []Alert // Resolutions found by Scores, handed out by the next Roll
+	mu       sync.Mutex
+}
+
+// levelMix holds the level counts of the current window and the learned baseline
+type levelMix struct {
+	windowStart time.Time
+	current     map[string]int
+	total       int
+	baseline    map[string]float64
+	learned     bool   // Baseline has at least one full window
+	incident    string // ID of the drift alert while the service is drifting
+}
+
+// NewDriftDetector creates a drift detector
+func NewDriftDetector(config DriftConfig) *DriftDetector {
+	return &DriftDetector{
+		config:   config,
+		services: make(map[string]*levelMix),
+	}
+}
+
+// Observe records a log and returns the alerts it causes: the resolution of
+// its service's drift if the window it closes was back under the threshold,
+// and a drift alert if the service just started drifting
+func (dd *DriftDetector) Observe(log models.LogEntry) []Alert {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	now := time.Now()
+	mix, exists := dd.services[log.Service]
+	if !exists {
+		mix = &levelMix{
+			windowStart: now,
+			current:     make(map[string]int),
+			baseline:    make(map[string]float64),
+		}
+		dd.services[log.Service] = mix
+	}
+
+	var alerts []Alert
+	if resolved := dd.roll(log.Service, mix, now); resolved != nil {
+		alerts = append(alerts, *resolved)
+	}
+	mix.current[log.Level]++
+	mix.total++
+
+	if !dd.config.Alert || mix.incident != "" {
+		return alerts
+	}
+
+	score := dd.score(log.Service, mix)
+	if !score.Drifting {
+		return alerts
+	}
+	id := uuid.New().String()
+	mix.incident = id
+
+	return append(alerts, Alert{
+		ID:        id,
+		RuleName:  DriftRuleName,
+		Message:   fmt.Sprintf("Alert: level mix of %s drifted from its baseline (score %.2f over %d logs)", log.Service, score.Score, score.Samples),
+		Count:     score.Samples,
+		Timestamp: now,
+		Service:   log.Service,
+		Window:    dd.config.Window.String(),
+		Status:    StatusFiring,
+		Incident:  id,
+	})
+}
+
+// Roll closes the windows that have ended, so drift resolves even for
+// services that stopped logging, and returns the resolutions
+func (dd *DriftDetector) Roll() []Alert {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	now := time.Now()
+	alerts := dd.resolved
+	dd.resolved = nil
+	for service, mix := range dd.services {
+		if resolved := dd.roll(service, mix, now); resolved != nil {
+			alerts = append(alerts, *resolved)
+		}
+	}
+	return alerts
+}
+
+// Scores returns the current drift score of every tracked service, highest first
+func (dd *DriftDetector) Scores() []DriftScore {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	now := time.Now()
+	result := make([]DriftScore, 0, len(dd.services))
+	for service, mix := range dd.services {
+		if resolved := dd.roll(service, mix, now); resolved != nil {
+			dd.resolved = append(dd.resolved, *resolved)
+		}
+		result = append(result, dd.score(service, mix))
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Score > result[j].Score })
+	return result
+}
+
+// roll folds a finished window into the baseline and starts a new one. A
+// drifting service whose finished window scored under the threshold is no
+// longer drifting; the resolution is returned.
+func (dd *DriftDetector) roll(service string, mix *levelMix, now time.Time) *Alert {
+	if now.Sub(mix.windowStart) < dd.config.Window {
+		return nil
+	}
+
+	var resolved *Alert
+	if score := dd.score(service, mix); mix.incident != "" && mix.total >= dd.config.MinSamples && !score.Drifting {
+		resolved = &Alert{
+			ID:        uuid.New().String(),
+			RuleName:  DriftRuleName,
+			Message:   fmt.Sprintf("Resolved: level mix of %s is back near its baseline (score %.2f over %d logs)", service, score.Score, score.Samples),
+			Count:     score.Samples,
+			Timestamp: now,
+			Service:   service,
+			Window:    dd.config.Window.String(),
+			Status:    StatusResolved,
+			Incident:  mix.incident,
+		}
+		mix.incident = ""
+	}
+
+	// Sparse windows are too noisy to learn from
+	if mix.total >= dd.config.MinSamples {
+		current := proportions(mix.current, mix.total)
+		if !mix.learned {
+			mix.baseline = current
+			mix.learned = true
+		} else {
+			for _, level := range levelUnion(mix.baseline, current) {
+				mix.baseline[level] = (1-dd.config.Smoothing)*mix.baseline[level] + dd.config.Smoothing*current[level]
+			}
+		}
+	}
+
+	mix.windowStart = now
+	mix.current = make(map[string]int)
+	mix.total = 0
+	return resolved
+}
+
+// score computes the total variation distance between the current window and the baseline
+func (dd *DriftDetector) score(service string, mix *levelMix) DriftScore {
+	current := proportions(mix.current, mix.total)
+
+	result := DriftScore{
+		Service:  service,
+		Samples:  mix.total,
+		Current:  current,
+		Baseline: copyProportions(mix.baseline),
+	}
+	if !mix.learned || mix.total < dd.config.MinSamples {
+		return result
+	}
+
+	distance := 0.0
+	for _, level := range levelUnion(mix.baseline, current) {
+		distance += math.Abs(current[level] - mix.baseline[level])
+	}
+	result.Score = distance / 2
+	result.Drifting = result.Score >= dd.config.Threshold
+	return result
+}
+
+// proportions converts level counts into fractions of total
+func proportions(counts map[string]int, total int) map[string]float64 {
+	result := make(map[string]float64, len(counts))
+	if total == 0 {
+		return result
+	}
+	for level, count := range counts {
+		result[level] = float64(count) / float64(total)
+	}
+	return result
+}
+
+// copyProportions returns a copy safe to hand out after the lock is released
+func copyProportions(src map[string]float64) map[string]float64 {
+	result := make(map[string]float64, len(src))
+	for level, p := range src {
+		result[level] = p
+	}
+	return result
+}
+
+// levelUnion returns every level present in either distribution
+func levelUnion(a, b map[string]float64) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	levels := make([]string, 0, len(a)+len(b))
+	for _, m := range []map[string]float64{a, b} {
+		for level := range m {
+			if !seen[level] {
+				seen[level] = true
+				levels = append(levels, level)
+			}
+		}
+	}
+	return levels
+}
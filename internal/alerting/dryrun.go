@@ -0,0 +1,39 @@
+package alerting
+
+import (
+	"logstream/pkg/models"
+	"time"
+)
+
+// DryRun replays logs, oldest first, through a rule as if it had been
+// running from start to end, and returns the alerts it would have fired and
+// resolved. Nothing is notified or recorded, so thresholds can be tuned on
+// past traffic before a rule is enabled.
+func DryRun(rule AlertRule, logs []models.LogEntry, start, end time.Time) ([]Alert, error) {
+	alerts := make([]Alert, 0)
+	am := NewAlertManager(nil)
+	am.startedAt = start
+	am.dryRun = &alerts
+	if err := am.AddRule(rule); err != nil {
+		return nil, err
+	}
+
+	// Absences and resolutions are checked every resolveInterval between
+	// logs, as watchResolutions does
+	tick := start.Truncate(resolveInterval).Add(resolveInterval)
+	advance := func(to time.Time) {
+		for ; !tick.After(to); tick = tick.Add(resolveInterval) {
+			am.checkAbsences(tick)
+			am.resolveCleared(tick)
+		}
+	}
+	for _, log := range logs {
+		if log.Timestamp.Before(start) || log.Timestamp.After(end) {
+			continue
+		}
+		advance(log.Timestamp)
+		am.countLog(newLogEntry(log), log.Timestamp)
+	}
+	advance(end)
+	return alerts, nil
+}
@@ -0,0 +1,95 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ExecConfig is the command an ExecNotifier runs and its limits
+type ExecConfig struct {
+	Command       []string      // Program and arguments, run without a shell
+	Timeout       time.Duration // How long a run may take before it is killed
+	MaxConcurrent int           // Runs at once; further alerts wait for one to finish
+}
+
+// ExecNotifier runs a local command for each alert with the alert's JSON on
+// stdin, e.g. a restart script or a ticketing CLI
+type ExecNotifier struct {
+	config ExecConfig
+	slots  chan struct{}
+}
+
+// maxExecOutput is how much of a failed command's output its error quotes
+const maxExecOutput = 1024
+
+// NewExecNotifier creates an exec notifier, defaulting to a 30s timeout and
+// 4 concurrent runs
+func NewExecNotifier(config ExecConfig) (*ExecNotifier, error) {
+	if len(config.Command) == 0 || config.Command[0] == "" {
+		return nil, errors.New("expected a command")
+	}
+	if _, err := exec.LookPath(config.Command[0]); err != nil {
+		return nil, fmt.Errorf("command %q not found", config.Command[0])
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = 4
+	}
+	return &ExecNotifier{config: config, slots: make(chan struct{}, config.MaxConcurrent)}, nil
+}
+
+// Name identifies the notifier
+func (en *ExecNotifier) Name() string {
+	return "exec"
+}
+
+// Notify runs the command with the alert on stdin, waiting for a free slot
+// first. A non-zero exit status is an error quoting the command's output.
+func (en *ExecNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	select {
+	case en.slots <- struct{}{}:
+		defer func() { <-en.slots }()
+	case <-ctx.Done():
+		return fmt.Errorf("exec: %d commands still running: %w", en.config.MaxConcurrent, ctx.Err())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, en.config.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, en.config.Command[0], en.config.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"LOGSTREAM_ALERT_ID="+alert.ID,
+		"LOGSTREAM_ALERT_RULE="+alert.RuleName,
+		"LOGSTREAM_ALERT_STATUS="+alert.Status,
+		"LOGSTREAM_ALERT_SERVICE="+alert.Service,
+	)
+	// Don't wait on output pipes a killed command's children hold open
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %v", en.config.Timeout)
+	}
+	if len(output) > maxExecOutput {
+		output = output[:maxExecOutput]
+	}
+	if text := strings.TrimSpace(string(output)); text != "" {
+		return fmt.Errorf("exec %s: %v: %s", en.config.Command[0], err, text)
+	}
+	return fmt.Errorf("exec %s: %v", en.config.Command[0], err)
+}
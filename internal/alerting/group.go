@@ -0,0 +1,157 @@
+package alerting
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GroupConfig controls alert grouping: alerts sharing the By fields that a
+// notifier is sent within Wait of each other go to it as one notification
+type GroupConfig struct {
+	Wait time.Duration // How long a group collects alerts after its first
+	By   []string      // GroupFields alerts must share, none to group all of them
+}
+
+// GroupFields are the alert fields alerts can be grouped by
+var GroupFields = []string{"service", "level"}
+
+// GroupRuleName is the rule name of a grouped notification
+const GroupRuleName = "Alert Group"
+
+// groupKey identifies the alerts a notifier is sent that are grouped together
+type groupKey struct {
+	notifier int    // Index in the manager's notifiers
+	status   string // Firing and resolved alerts are grouped apart
+	labels   string // The By fields, e.g. service=payment-api
+}
+
+// pendingGroup is a group's alerts waiting for its wait to end
+type pendingGroup struct {
+	alerts []Alert
+	timer  *time.Timer
+}
+
+// EnableGrouping starts grouping alerts' notifications
+func (am *AlertManager) EnableGrouping(config GroupConfig) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.grouping = &config
+	am.groups = make(map[groupKey]*pendingGroup)
+}
+
+// deliver sends an alert to the notifier at index i of the manager's
+// notifiers, or adds it to its group, which is sent once its wait ends. A
+// resolution first sends the pending group holding its rule's firing alert,
+// so it never reaches the notifier before that alert.
+func (am *AlertManager) deliver(i int, alert Alert) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	if am.grouping == nil {
+		am.send(i, alert)
+		return
+	}
+	if alert.Status == StatusResolved {
+		for key, group := range am.groups {
+			if key.notifier == i && key.status == StatusFiring && slices.ContainsFunc(group.alerts, func(a Alert) bool { return a.RuleName == alert.RuleName }) {
+				group.timer.Stop()
+				am.flushGroup(key)
+			}
+		}
+	}
+	key := groupKey{notifier: i, status: alert.Status, labels: am.grouping.labels(alert)}
+	group, ok := am.groups[key]
+	if !ok {
+		group = &pendingGroup{}
+		group.timer = time.AfterFunc(am.grouping.Wait, func() {
+			am.mu.Lock()
+			defer am.mu.Unlock()
+			// The group may have been sent early, and another begun under its key
+			if am.groups[key] == group {
+				am.flushGroup(key)
+			}
+		})
+		am.groups[key] = group
+	}
+	group.alerts = append(group.alerts, alert)
+}
+
+// flushGroup sends a pending group to its notifier (caller holds the lock)
+func (am *AlertManager) flushGroup(key groupKey) {
+	alerts := am.groups[key].alerts
+	delete(am.groups, key)
+
+	if len(alerts) == 1 {
+		am.send(key.notifier, alerts[0])
+		return
+	}
+	am.send(key.notifier, groupAlert(key.labels, alerts))
+}
+
+// labels describes the By fields of an alert, e.g. service=payment-api. An
+// alert of a rule not scoped to a service has the service all its samples
+// come from, if they share one.
+func (config GroupConfig) labels(alert Alert) string {
+	labels := make([]string, 0, len(config.By))
+	for _, field := range config.By {
+		switch field {
+		case "service":
+			labels = append(labels, "service="+alert.source())
+		case "level":
+			labels = append(labels, "level="+alert.Level)
+		}
+	}
+	return strings.Join(labels, ",")
+}
+
+// groupAlert summarises a group's alerts in one, carrying them in Grouped
+func groupAlert(labels string, alerts []Alert) Alert {
+	var rules []string
+	count := 0
+	for _, alert := range alerts {
+		if !slices.Contains(rules, alert.RuleName) {
+			rules = append(rules, alert.RuleName)
+		}
+		count += alert.Count
+	}
+	status := alerts[0].Status
+	scope := ""
+	if labels != "" {
+		scope = " for " + labels
+	}
+	group := Alert{
+		ID:        uuid.New().String(),
+		RuleName:  GroupRuleName,
+		Message:   fmt.Sprintf("%d alerts %s%s: %s", len(alerts), status, scope, strings.Join(rules, ", ")),
+		Count:     count,
+		Timestamp: alerts[0].Timestamp,
+		Status:    status,
+		Group:     labels,
+		Grouped:   alerts,
+	}
+	// Fields all the alerts share are kept
+	if service := alerts[0].source(); !slices.ContainsFunc(alerts, func(a Alert) bool { return a.source() != service }) {
+		group.Service = service
+	}
+	if !slices.ContainsFunc(alerts, func(a Alert) bool { return a.Level != alerts[0].Level }) {
+		group.Level = alerts[0].Level
+	}
+	return group
+}
+
+// source returns the service an alert's logs come from: its rule's service
+// or, for a rule not scoped to one, the service all its samples share
+func (alert Alert) source() string {
+	if alert.Service != "" || len(alert.Samples) == 0 {
+		return alert.Service
+	}
+	service := alert.Samples[0].Service
+	if slices.ContainsFunc(alert.Samples, func(sample Sample) bool { return sample.Service != service }) {
+		return ""
+	}
+	return service
+}
@@ -0,0 +1,302 @@
+package alerting
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AlertHistory keeps triggered alerts for the retention period, on disk so
+// they survive restarts when it has a path
+type AlertHistory struct {
+	alerts    []Alert
+	path      string
+	file      *os.File
+	retention time.Duration
+	mu        sync.RWMutex
+	shutdown  chan struct{}
+
+	silencesSaved uint64 // Generation of the silences last written
+}
+
+// NewAlertHistory opens (or creates) the history file at path and loads
+// every alert still inside the retention window. An empty path keeps the
+// history in memory only.
+func NewAlertHistory(path string, retention time.Duration) (*AlertHistory, error) {
+	h := &AlertHistory{
+		alerts:    make([]Alert, 0),
+		path:      path,
+		retention: retention,
+		shutdown:  make(chan struct{}),
+	}
+	if path == "" {
+		return h, nil
+	}
+
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+
+	// Rewrite the file so expired alerts don't accumulate across restarts
+	if err := h.compact(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Record appends an alert to the history and the backing file
+func (h *AlertHistory) Record(alert Alert) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.alerts = append(h.alerts, alert)
+	if h.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	_, err = h.file.Write(append(data, '\n'))
+	return err
+}
+
+// List returns all retained alerts triggered at or after since
+func (h *AlertHistory) List(since time.Time) []Alert {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	result := make([]Alert, 0)
+	for _, alert := range h.alerts {
+		if !alert.Timestamp.Before(since) {
+			result = append(result, alert)
+		}
+	}
+	return result
+}
+
+// Get returns the retained alert with the given ID
+func (h *AlertHistory) Get(id string) (Alert, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, alert := range h.alerts {
+		if alert.ID == id {
+			return alert, true
+		}
+	}
+	return Alert{}, false
+}
+
+// ackRecord is an acknowledgment appended to the history file; load applies
+// it to the incident's alerts before it, and compact folds it into them
+type ackRecord struct {
+	Incident string `json:"acknowledged_incident"`
+	Acknowledgment
+}
+
+// Acknowledge marks every alert of an incident acknowledged, appending a
+// record of it to the history file
+func (h *AlertHistory) Acknowledge(incident string, ack Acknowledgment) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.acknowledge(incident, ack)
+	if h.file == nil {
+		return nil
+	}
+	data, err := json.Marshal(ackRecord{Incident: incident, Acknowledgment: ack})
+	if err != nil {
+		return err
+	}
+	_, err = h.file.Write(append(data, '\n'))
+	return err
+}
+
+// acknowledge marks the incident's alerts acknowledged (caller holds the lock)
+func (h *AlertHistory) acknowledge(incident string, ack Acknowledgment) {
+	for i := range h.alerts {
+		if h.alerts[i].Incident == incident {
+			h.alerts[i].Acknowledged = &ack
+		}
+	}
+}
+
+// Start begins the background retention sweeper
+func (h *AlertHistory) Start() {
+	go h.sweep()
+}
+
+// sweep drops expired alerts once an hour
+func (h *AlertHistory) sweep() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.mu.Lock()
+			if err := h.compact(); err != nil {
+				// Alerts are still appended to the old file, so nothing is lost
+				fmt.Printf("⚠️  Failed to compact alert history: %v\n", err)
+			}
+			h.mu.Unlock()
+		case <-h.shutdown:
+			return
+		}
+	}
+}
+
+// load reads retained alerts from the history file
+func (h *AlertHistory) load() error {
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cutoff := time.Now().Add(-h.retention)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ack ackRecord
+		if err := json.Unmarshal(scanner.Bytes(), &ack); err == nil && ack.Incident != "" {
+			h.acknowledge(ack.Incident, ack.Acknowledgment)
+			continue
+		}
+		var alert Alert
+		if err := json.Unmarshal(scanner.Bytes(), &alert); err != nil {
+			// Skip a torn final line from an unclean shutdown
+			continue
+		}
+		if alert.Timestamp.After(cutoff) {
+			h.alerts = append(h.alerts, alert)
+		}
+	}
+	return scanner.Err()
+}
+
+// compact drops expired alerts and rewrites the history file (caller holds the lock)
+func (h *AlertHistory) compact() error {
+	cutoff := time.Now().Add(-h.retention)
+	kept := make([]Alert, 0, len(h.alerts))
+	for _, alert := range h.alerts {
+		if alert.Timestamp.After(cutoff) {
+			kept = append(kept, alert)
+		}
+	}
+	h.alerts = kept
+	if h.path == "" {
+		return nil
+	}
+
+	// Write to a temp file and rename so a crash never leaves a half-written history
+	tmpPath := h.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, alert := range h.alerts {
+		if err := enc.Encode(alert); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// Open the new file before renaming it into place, and only then let go
+	// of the old one, so Record always has a file to append to
+	file, err := os.OpenFile(tmpPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, h.path); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if h.file != nil {
+		h.file.Close()
+	}
+	h.file = file
+	return nil
+}
+
+// silencesPath is the file silences are kept in, next to the history file
+func (h *AlertHistory) silencesPath() string {
+	return h.path + ".silences"
+}
+
+// LoadSilences returns the saved silences that haven't ended by now
+func (h *AlertHistory) LoadSilences(now time.Time) ([]Silence, error) {
+	if h.path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(h.silencesPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var silences []Silence
+	if err := json.Unmarshal(data, &silences); err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(silences, func(s Silence) bool { return !now.Before(s.End) }), nil
+}
+
+// SaveSilences rewrites the silences file with the silences of a generation,
+// unless a later one was written already, since saves happen outside the
+// manager's lock and may arrive out of order
+func (h *AlertHistory) SaveSilences(generation uint64, silences []Silence) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.path == "" || generation <= h.silencesSaved {
+		return nil
+	}
+
+	data, err := json.Marshal(silences)
+	if err != nil {
+		return err
+	}
+	// Write to a temp file and rename so a crash never leaves half of them
+	tmpPath := h.silencesPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, h.silencesPath()); err != nil {
+		return err
+	}
+	h.silencesSaved = generation
+	return nil
+}
+
+// Close stops the sweeper and closes the history file
+func (h *AlertHistory) Close() error {
+	close(h.shutdown)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	return h.file.Close()
+}
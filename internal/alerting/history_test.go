@@ -0,0 +1,87 @@
+package alerting
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompactKeepsRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.jsonl")
+	history, err := NewAlertHistory(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+
+	now := time.Now()
+	for _, alert := range []Alert{
+		{ID: "expired", Timestamp: now.Add(-2 * time.Hour)},
+		{ID: "kept", Timestamp: now},
+	} {
+		if err := history.Record(alert); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	history.mu.Lock()
+	err = history.compact()
+	history.mu.Unlock()
+	if err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if err := history.Record(Alert{ID: "after", Timestamp: now}); err != nil {
+		t.Fatalf("Record after compacting: %v", err)
+	}
+
+	reloaded, err := NewAlertHistory(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	var ids []string
+	for _, alert := range reloaded.List(time.Time{}) {
+		ids = append(ids, alert.ID)
+	}
+	if len(ids) != 2 || ids[0] != "kept" || ids[1] != "after" {
+		t.Errorf("reloaded %v, want kept and after", ids)
+	}
+}
+
+func TestFailedCompactKeepsTheOldFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.jsonl")
+	history, err := NewAlertHistory(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+	history.Record(Alert{ID: "before", Timestamp: time.Now()})
+
+	// A directory where the file is renamed to makes the rename fail
+	history.path = filepath.Join(t.TempDir(), "taken")
+	if err := os.MkdirAll(filepath.Join(history.path, "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	history.mu.Lock()
+	err = history.compact()
+	history.mu.Unlock()
+	if err == nil {
+		t.Fatal("compact onto a directory succeeded")
+	}
+	if _, err := os.Stat(history.path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("left the temp file behind: %v", err)
+	}
+
+	// Still appending to the original file
+	if err := history.Record(Alert{ID: "after", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Record after a failed compact: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); !strings.Contains(got, `"id":"before"`) || !strings.Contains(got, `"id":"after"`) {
+		t.Errorf("history file = %s, want both alerts", got)
+	}
+}
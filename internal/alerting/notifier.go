@@ -0,0 +1,132 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Notifier delivers triggered alerts somewhere on-call will see them
+type Notifier interface {
+	// Name identifies the notifier in logs and is the channel rules route
+	// alerts to, e.g. webhook
+	Name() string
+	// Notify delivers one alert, giving up when ctx is done
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Named renames a notifier, e.g. after the channel it was configured as
+func Named(name string, notifier Notifier) Notifier {
+	return namedNotifier{Notifier: notifier, name: name}
+}
+
+// namedNotifier is a notifier under another name
+type namedNotifier struct {
+	Notifier
+	name string
+}
+
+// Name identifies the notifier
+func (n namedNotifier) Name() string {
+	return n.name
+}
+
+// notifyTimeout bounds how long one notifier may take over an alert, retries included
+const notifyTimeout = 2 * time.Minute
+
+// RetryConfig is how an HTTP notifier retries a failed delivery
+type RetryConfig struct {
+	Timeout time.Duration // Per attempt
+	Retries int           // Attempts after the first
+	Backoff time.Duration // Wait before the first retry, doubling after each
+}
+
+// withDefaults fills in unset fields
+func (config RetryConfig) withDefaults() RetryConfig {
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.Retries < 0 {
+		config.Retries = 0
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = time.Second
+	}
+	return config
+}
+
+// maxResponseBody caps how much of a notification response is read
+const maxResponseBody = 64 << 10
+
+// PostJSON POSTs a JSON body to url, retrying network errors, 429s and 5xx
+// responses with exponential backoff until the retries or ctx run out, and
+// returns the body of the successful response. Unset config fields take
+// their defaults.
+func PostJSON(ctx context.Context, client *http.Client, config RetryConfig, url string, body []byte, header http.Header) ([]byte, error) {
+	config = config.withDefaults()
+	backoff := config.Backoff
+	var err error
+	for attempt := 0; attempt <= config.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+			}
+			backoff *= 2
+		}
+		var response []byte
+		var retry bool
+		if response, retry, err = postOnce(ctx, client, config.Timeout, url, body, header); err == nil || !retry {
+			return response, err
+		}
+	}
+	return nil, err
+}
+
+// postOnce makes one delivery attempt and reports whether a failure is worth retrying
+func postOnce(ctx context.Context, client *http.Client, timeout time.Duration, url string, body []byte, header http.Header) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	response, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode >= 300 {
+		return nil, resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return response, err != nil, err
+}
+
+// alertAttributes are the alert fields message brokers carry as attributes,
+// so subscribers can filter on them without parsing the alert; empty fields
+// are left out
+func alertAttributes(alert Alert) map[string]string {
+	attributes := make(map[string]string)
+	for name, value := range map[string]string{
+		"rule":     alert.RuleName,
+		"status":   alert.Status,
+		"service":  alert.Service,
+		"level":    alert.Level,
+		"incident": alert.Incident,
+	} {
+		if value != "" {
+			attributes[name] = value
+		}
+	}
+	return attributes
+}
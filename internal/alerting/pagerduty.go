@@ -0,0 +1,119 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"logstream/pkg/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyConfig is the PagerDuty service a PagerDutyNotifier opens incidents on
+type PagerDutyConfig struct {
+	RoutingKey string // Integration key of an Events API v2 integration
+	Source     string // Where alerts come from, e.g. the node ID
+	URL        string // Events API endpoint; pagerDutyEventsURL if empty
+	Retry      RetryConfig
+}
+
+// PagerDutyNotifier triggers a PagerDuty incident per firing rule and
+// resolves it when the rule's condition clears. The dedup key is derived from
+// the rule name and service, so a rule that keeps firing updates one incident.
+type PagerDutyNotifier struct {
+	config PagerDutyConfig
+	client *http.Client
+}
+
+// NewPagerDutyNotifier creates a notifier sending events with the routing key
+func NewPagerDutyNotifier(config PagerDutyConfig) (*PagerDutyNotifier, error) {
+	if config.RoutingKey == "" {
+		return nil, errors.New("expected a routing key")
+	}
+	if config.URL == "" {
+		config.URL = pagerDutyEventsURL
+	}
+	config.Retry = config.Retry.withDefaults()
+	return &PagerDutyNotifier{config: config, client: &http.Client{}}, nil
+}
+
+// Name identifies the notifier
+func (pn *PagerDutyNotifier) Name() string {
+	return "pagerduty"
+}
+
+// Notify sends a trigger event for a firing alert, or a resolve event. A
+// group's alerts are sent as events of their own, since incidents are
+// deduplicated by rule. Alerts outside an incident, which never resolve,
+// aren't sent.
+func (pn *PagerDutyNotifier) Notify(ctx context.Context, alert Alert) error {
+	if len(alert.Grouped) > 0 {
+		var errs []error
+		for _, grouped := range alert.Grouped {
+			errs = append(errs, pn.Notify(ctx, grouped))
+		}
+		return errors.Join(errs...)
+	}
+	if alert.Incident == "" {
+		return nil
+	}
+	event := map[string]interface{}{
+		"routing_key":  pn.config.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    pagerDutyDedupKey(alert),
+	}
+	if alert.Status == StatusResolved {
+		event["event_action"] = "resolve"
+	} else {
+		details := map[string]interface{}{"count": alert.Count}
+		if alert.Service != "" {
+			details["service"] = alert.Service
+		}
+		if alert.Window != "" {
+			details["window"] = alert.Window
+		}
+		if len(alert.Samples) > 0 {
+			details["samples"] = alert.Samples
+		}
+		event["payload"] = map[string]interface{}{
+			"summary":        alert.Message,
+			"source":         pn.config.Source,
+			"severity":       pagerDutySeverity(alert.Level),
+			"timestamp":      alert.Timestamp.UTC().Format(time.RFC3339Nano),
+			"component":      alert.RuleName,
+			"custom_details": details,
+		}
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = PostJSON(ctx, pn.client, pn.config.Retry, pn.config.URL, body, nil)
+	return err
+}
+
+// pagerDutyDedupKey is the incident key of a rule's alerts. Drift alerts of
+// different services are incidents of their own.
+func pagerDutyDedupKey(alert Alert) string {
+	if alert.Service != "" {
+		return "logstream/" + alert.RuleName + "/" + alert.Service
+	}
+	return "logstream/" + alert.RuleName
+}
+
+// pagerDutySeverity maps an alert's levels, e.g. ERROR+, to a PagerDuty severity
+func pagerDutySeverity(level string) string {
+	switch strings.TrimSuffix(level, "+") {
+	case models.LevelCritical:
+		return "critical"
+	case models.LevelError:
+		return "error"
+	case models.LevelWarning:
+		return "warning"
+	}
+	return "info"
+}
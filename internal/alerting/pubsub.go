@@ -0,0 +1,119 @@
+package alerting
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// pubSubScope is the OAuth scope publishing to Pub/Sub needs
+const pubSubScope = "https://www.googleapis.com/auth/pubsub"
+
+// pubSubTopicPattern matches a topic's full name
+var pubSubTopicPattern = regexp.MustCompile(`^projects/[^/]+/topics/[^/]+$`)
+
+// PubSubConfig is the Google Cloud Pub/Sub topic a PubSubNotifier publishes to
+type PubSubConfig struct {
+	Topic string // projects/<project>/topics/<topic>
+	// Service account key file; Google's application default credentials
+	// (GOOGLE_APPLICATION_CREDENTIALS, gcloud's, the metadata server's) if empty
+	CredentialsFile string
+	URL             string // API endpoint; the emulator at PUBSUB_EMULATOR_HOST, unauthenticated, or Google's if empty
+	Retry           RetryConfig
+}
+
+// PubSubNotifier publishes each alert's JSON to a Pub/Sub topic, with the
+// rule, status, service and level as attributes subscriptions can filter on
+type PubSubNotifier struct {
+	config PubSubConfig
+	tokens oauth2.TokenSource // nil for the emulator
+	client *http.Client
+}
+
+// NewPubSubNotifier creates a notifier publishing to the topic
+func NewPubSubNotifier(config PubSubConfig) (*PubSubNotifier, error) {
+	if !pubSubTopicPattern.MatchString(config.Topic) {
+		return nil, fmt.Errorf("invalid topic %q, expected projects/<project>/topics/<topic>", config.Topic)
+	}
+	client := &http.Client{}
+	notifier := &PubSubNotifier{client: client}
+	if emulator := os.Getenv("PUBSUB_EMULATOR_HOST"); config.URL == "" && emulator != "" {
+		config.URL = "http://" + emulator
+	} else {
+		if config.URL == "" {
+			config.URL = "https://pubsub.googleapis.com"
+		}
+		tokens, err := pubSubTokens(config.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		notifier.tokens = tokens
+	}
+	config.URL = strings.TrimSuffix(config.URL, "/")
+	config.Retry = config.Retry.withDefaults()
+	notifier.config = config
+	return notifier, nil
+}
+
+// Name identifies the notifier
+func (pn *PubSubNotifier) Name() string {
+	return "pubsub"
+}
+
+// Notify publishes the alert
+func (pn *PubSubNotifier) Notify(ctx context.Context, alert Alert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"messages": []map[string]interface{}{{
+			"data":       base64.StdEncoding.EncodeToString(data),
+			"attributes": alertAttributes(alert),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var header http.Header
+	if pn.tokens != nil {
+		token, err := pn.tokens.Token()
+		if err != nil {
+			return fmt.Errorf("pubsub: failed to get an access token: %w", err)
+		}
+		header = http.Header{"Authorization": {token.Type() + " " + token.AccessToken}}
+	}
+	_, err = PostJSON(ctx, pn.client, pn.config.Retry, pn.config.URL+"/v1/"+pn.config.Topic+":publish", body, header)
+	return err
+}
+
+// pubSubTokens returns access tokens for publishing, signed with the service
+// account key file at path, or from the application default credentials if
+// path is empty. Tokens are reused until shortly before they expire.
+func pubSubTokens(path string) (oauth2.TokenSource, error) {
+	if path == "" {
+		tokens, err := google.DefaultTokenSource(context.Background(), pubSubScope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find Google credentials: %v", err)
+		}
+		return tokens, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %v", err)
+	}
+	credentials, err := google.CredentialsFromJSONWithType(context.Background(), data, google.ServiceAccount, pubSubScope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials %s, expected a service account key file: %v", path, err)
+	}
+	return credentials.TokenSource, nil
+}
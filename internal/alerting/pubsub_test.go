@@ -0,0 +1,123 @@
+package alerting
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeServiceAccountKey writes a key file whose tokens come from tokenURL
+func writeServiceAccountKey(t *testing.T, tokenURL string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "alerts@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenURL,
+	})
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPubSubNotifierPublishesWithServiceAccountToken(t *testing.T) {
+	t.Setenv("PUBSUB_EMULATOR_HOST", "")
+
+	tokenRequests := 0
+	var published struct {
+		Messages []struct {
+			Data       string            `json:"data"`
+			Attributes map[string]string `json:"attributes"`
+		} `json:"messages"`
+	}
+	var path, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			r.ParseForm()
+			if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || r.Form.Get("assertion") == "" {
+				http.Error(w, "bad grant", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"access_token":"token-1","token_type":"Bearer","expires_in":3600}`)
+			return
+		}
+		path, authorization = r.URL.Path, r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&published)
+		io.WriteString(w, `{"messageIds":["1"]}`)
+	}))
+	defer server.Close()
+
+	notifier, err := NewPubSubNotifier(PubSubConfig{
+		Topic:           "projects/acme/topics/alerts",
+		CredentialsFile: writeServiceAccountKey(t, server.URL+"/token"),
+		URL:             server.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewPubSubNotifier: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := notifier.Notify(context.Background(), Alert{RuleName: "errors", Status: "firing"}); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+
+	if path != "/v1/projects/acme/topics/alerts:publish" {
+		t.Errorf("published to %s, want /v1/projects/acme/topics/alerts:publish", path)
+	}
+	if authorization != "Bearer token-1" {
+		t.Errorf("Authorization = %q, want Bearer token-1", authorization)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("fetched %d tokens for two alerts, want the first reused", tokenRequests)
+	}
+	if len(published.Messages) != 1 || published.Messages[0].Attributes["rule"] != "errors" {
+		t.Fatalf("published %+v, want one message for rule errors", published.Messages)
+	}
+	data, _ := base64.StdEncoding.DecodeString(published.Messages[0].Data)
+	if !strings.Contains(string(data), `"errors"`) {
+		t.Errorf("message data = %s, want the alert's JSON", data)
+	}
+}
+
+func TestPubSubNotifierRejectsInvalidCredentials(t *testing.T) {
+	t.Setenv("PUBSUB_EMULATOR_HOST", "")
+
+	path := filepath.Join(t.TempDir(), "key.json")
+	os.WriteFile(path, []byte(`{"type":"authorized_user"}`), 0600)
+	tests := []struct {
+		name   string
+		config PubSubConfig
+	}{
+		{"bad topic", PubSubConfig{Topic: "alerts"}},
+		{"missing key file", PubSubConfig{Topic: "projects/acme/topics/alerts", CredentialsFile: path + ".missing"}},
+		{"not a service account", PubSubConfig{Topic: "projects/acme/topics/alerts", CredentialsFile: path}},
+	}
+	for _, test := range tests {
+		if _, err := NewPubSubNotifier(test.config); err == nil {
+			t.Errorf("%s: NewPubSubNotifier succeeded, want an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package alerting
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule is when a rule's alerts notify, e.g. business hours. It is a list
+// of weekday and hour ranges in a time zone, written like
+// "Mon-Fri 09:00-18:00, Sat 10:00-14:00". A range ending before it starts,
+// e.g. "22:00-06:00", runs past midnight into the next day.
+type Schedule struct {
+	ranges   []scheduleRange
+	location *time.Location
+	text     string
+}
+
+// scheduleRange is one weekday and hour range of a schedule
+type scheduleRange struct {
+	days       [7]bool // Indexed by time.Weekday; the days the range starts on
+	start, end int     // Minutes since midnight; end is exclusive and may be 24:00
+}
+
+// weekdays are the day names a schedule accepts, indexed by time.Weekday
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseSchedule parses a schedule in a time zone, UTC if empty
+func ParseSchedule(text, timezone string) (*Schedule, error) {
+	location := time.UTC
+	if timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q, expected an IANA name, e.g. Europe/London", timezone)
+		}
+	}
+	schedule := &Schedule{location: location, text: strings.TrimSpace(text)}
+	for _, part := range strings.Split(text, ",") {
+		r, err := parseScheduleRange(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid active_hours %q, expected ranges like \"Mon-Fri 09:00-18:00\": %v", text, err)
+		}
+		schedule.ranges = append(schedule.ranges, r)
+	}
+	return schedule, nil
+}
+
+// parseScheduleRange parses "[day[-day]] HH:MM-HH:MM"; without days the
+// range applies every day
+func parseScheduleRange(text string) (scheduleRange, error) {
+	var r scheduleRange
+	fields := strings.Fields(text)
+	switch len(fields) {
+	case 1:
+		for i := range r.days {
+			r.days[i] = true
+		}
+	case 2:
+		first, last, _ := strings.Cut(strings.ToLower(fields[0]), "-")
+		if last == "" {
+			last = first
+		}
+		from, to := weekday(first), weekday(last)
+		if from < 0 || to < 0 {
+			return r, fmt.Errorf("unknown day in %q", fields[0])
+		}
+		// Ranges may wrap around the week, e.g. Sat-Sun
+		for day := from; ; day = (day + 1) % 7 {
+			r.days[day] = true
+			if day == to {
+				break
+			}
+		}
+	default:
+		return r, fmt.Errorf("%q isn't a range", text)
+	}
+
+	start, end, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return r, fmt.Errorf("%q isn't an hour range", fields[len(fields)-1])
+	}
+	var err error
+	if r.start, err = parseClock(start); err != nil {
+		return r, err
+	}
+	if r.end, err = parseClock(end); err != nil {
+		return r, err
+	}
+	if r.start == r.end || r.start == 24*60 {
+		return r, fmt.Errorf("%q is empty", fields[len(fields)-1])
+	}
+	return r, nil
+}
+
+// weekday returns the time.Weekday of a day name, abbreviated or in full,
+// or -1
+func weekday(name string) int {
+	for i, day := range weekdays {
+		if name == day || name == strings.ToLower(time.Weekday(i).String()) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseClock parses HH:MM into minutes since midnight, allowing 24:00
+func parseClock(text string) (int, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(text, "%d:%d", &hours, &minutes); err != nil || len(text) != 5 ||
+		hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || hours == 24 && minutes != 0 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", text)
+	}
+	return hours*60 + minutes, nil
+}
+
+// Active reports whether t falls in the schedule
+func (s *Schedule) Active(t time.Time) bool {
+	t = t.In(s.location)
+	day := int(t.Weekday())
+	minute := t.Hour()*60 + t.Minute()
+	for _, r := range s.ranges {
+		if r.start < r.end {
+			if r.days[day] && minute >= r.start && minute < r.end {
+				return true
+			}
+			continue
+		}
+		// Past midnight: the evening of a listed day or the morning after
+		if r.days[day] && minute >= r.start || r.days[(day+6)%7] && minute < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the schedule as written, with its time zone
+func (s *Schedule) String() string {
+	return s.text + " " + s.location.String()
+}
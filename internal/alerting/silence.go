@@ -0,0 +1,129 @@
+package alerting
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Silence mutes notifications of the firing alerts it matches between Start
+// and End, e.g. over a deploy window. Silenced alerts are still recorded, and
+// resolutions are always sent, so incidents opened before it still close.
+type Silence struct {
+	ID        string    `json:"id"`
+	Rule      string    `json:"rule,omitempty"`    // Rule name to match, any if empty
+	Service   string    `json:"service,omitempty"` // Service to match, any if empty
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+// Active reports whether the silence is in effect at t
+func (s Silence) Active(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+// Matches reports whether the silence mutes the alert, whenever it fires.
+// An alert of a rule not scoped to a service matches a service when all the
+// logs it samples come from it.
+func (s Silence) Matches(alert Alert) bool {
+	if s.Rule != "" && s.Rule != alert.RuleName {
+		return false
+	}
+	return s.Service == "" || s.Service == alert.source()
+}
+
+// AddSilence starts muting the alerts a silence matches over its window,
+// assigning it an ID
+func (am *AlertManager) AddSilence(silence Silence) Silence {
+	am.mu.Lock()
+	silence.ID = uuid.New().String()
+	am.silences = append(am.silences, silence)
+	am.silencesChanged()
+	am.mu.Unlock()
+
+	am.saveSilences()
+	return silence
+}
+
+// Silences returns the silences that haven't ended, soonest starting first
+func (am *AlertManager) Silences() []Silence {
+	am.mu.Lock()
+	pruned := am.pruneSilences(time.Now())
+	result := slices.Clone(am.silences)
+	am.mu.Unlock()
+
+	if pruned {
+		am.saveSilences()
+	}
+	slices.SortStableFunc(result, func(a, b Silence) int { return a.Start.Compare(b.Start) })
+	return result
+}
+
+// RemoveSilence ends a silence early, reporting whether it existed
+func (am *AlertManager) RemoveSilence(id string) bool {
+	am.mu.Lock()
+	n := len(am.silences)
+	am.silences = slices.DeleteFunc(am.silences, func(s Silence) bool { return s.ID == id })
+	removed := len(am.silences) < n
+	if removed {
+		am.silencesChanged()
+	}
+	am.mu.Unlock()
+
+	if removed {
+		am.saveSilences()
+	}
+	return removed
+}
+
+// silencesChanged takes a snapshot of the silences for saveSilences (caller
+// holds the lock)
+func (am *AlertManager) silencesChanged() {
+	am.silenceGeneration++
+	am.silencesToSave = slices.Clone(am.silences)
+}
+
+// saveSilences writes the latest snapshot of the silences to the history, so
+// they survive restarts; the file is written without holding the lock
+func (am *AlertManager) saveSilences() {
+	am.mu.Lock()
+	history, generation, silences := am.history, am.silenceGeneration, am.silencesToSave
+	am.mu.Unlock()
+
+	if history == nil {
+		return
+	}
+	if err := history.SaveSilences(generation, silences); err != nil {
+		fmt.Printf("⚠️  Failed to save silences: %v\n", err)
+	}
+}
+
+// silencedBy returns the ID of an active silence muting the alert, if any,
+// and whether ended silences were pruned, so the caller saves them once it
+// releases the lock (caller holds the lock)
+func (am *AlertManager) silencedBy(alert Alert) (string, bool) {
+	pruned := am.pruneSilences(alert.Timestamp)
+	for _, silence := range am.silences {
+		if silence.Active(alert.Timestamp) && silence.Matches(alert) {
+			return silence.ID, pruned
+		}
+	}
+	return "", pruned
+}
+
+// pruneSilences drops silences that ended before now, reporting whether any
+// did; the snapshot for saveSilences is updated so they don't outlive a restart
+// in the file (caller holds the lock)
+func (am *AlertManager) pruneSilences(now time.Time) bool {
+	n := len(am.silences)
+	am.silences = slices.DeleteFunc(am.silences, func(s Silence) bool { return !now.Before(s.End) })
+	if len(am.silences) == n {
+		return false
+	}
+	am.silencesChanged()
+	return true
+}
@@ -0,0 +1,218 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// slackPostMessageURL is the Web API method bot tokens post through
+const slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+// SlackConfig is where a SlackNotifier posts: an incoming webhook, or a bot
+// token and channel. Channels routes a rule's alerts to its own channel.
+type SlackConfig struct {
+	WebhookURL string            // Incoming webhook URL
+	Token      string            // Bot token (xoxb-...), used instead of the webhook
+	Channel    string            // Channel bot token messages go to, e.g. #alerts
+	Channels   map[string]string // Rule name to channel, overriding Channel
+	Retry      RetryConfig
+}
+
+// SlackNotifier posts alerts to Slack as formatted messages with their counts,
+// window and sample log lines
+type SlackNotifier struct {
+	config SlackConfig
+	url    string
+	client *http.Client
+}
+
+// NewSlackNotifier creates a notifier posting with a bot token if one is
+// set, otherwise to the incoming webhook
+func NewSlackNotifier(config SlackConfig) (*SlackNotifier, error) {
+	url := config.WebhookURL
+	if config.Token != "" {
+		if config.Channel == "" {
+			return nil, errors.New("a bot token needs a default channel")
+		}
+		url = slackPostMessageURL
+	}
+	if url == "" {
+		return nil, errors.New("expected an incoming webhook URL or a bot token")
+	}
+	config.Retry = config.Retry.withDefaults()
+	return &SlackNotifier{config: config, url: url, client: &http.Client{}}, nil
+}
+
+// Name identifies the notifier
+func (sn *SlackNotifier) Name() string {
+	return "slack"
+}
+
+// Notify posts the alert to the rule's channel, or the default one. A group
+// whose rules are routed to different channels is split between them.
+func (sn *SlackNotifier) Notify(ctx context.Context, alert Alert) error {
+	if len(alert.Grouped) == 0 {
+		return sn.post(ctx, alert, sn.channel(alert.RuleName))
+	}
+	var channels []string
+	byChannel := make(map[string][]Alert)
+	for _, grouped := range alert.Grouped {
+		channel := sn.channel(grouped.RuleName)
+		if _, ok := byChannel[channel]; !ok {
+			channels = append(channels, channel)
+		}
+		byChannel[channel] = append(byChannel[channel], grouped)
+	}
+	if len(channels) == 1 {
+		return sn.post(ctx, alert, channels[0])
+	}
+	var errs []error
+	for _, channel := range channels {
+		alerts := byChannel[channel]
+		if len(alerts) == 1 {
+			errs = append(errs, sn.post(ctx, alerts[0], channel))
+		} else {
+			errs = append(errs, sn.post(ctx, groupAlert(alert.Group, alerts), channel))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// channel returns the channel a rule's alerts are posted to
+func (sn *SlackNotifier) channel(rule string) string {
+	if routed, ok := sn.config.Channels[rule]; ok {
+		return routed
+	}
+	return sn.config.Channel
+}
+
+// post posts an alert to a channel, or the webhook's own if empty
+func (sn *SlackNotifier) post(ctx context.Context, alert Alert, channel string) error {
+	message := slackMessage(alert)
+	if channel != "" {
+		// Incoming webhooks post to their own channel, except legacy ones
+		message["channel"] = channel
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	var header http.Header
+	if sn.config.Token != "" {
+		header = http.Header{"Authorization": {"Bearer " + sn.config.Token}}
+	}
+	response, err := PostJSON(ctx, sn.client, sn.config.Retry, sn.url, body, header)
+	if err != nil || sn.config.Token == "" {
+		return err
+	}
+	// The Web API answers 200 with ok=false when it rejects a message
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(response, &result); err != nil {
+		return fmt.Errorf("slack: unreadable response: %w", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("slack: %s", result.Error)
+	}
+	return nil
+}
+
+// maxSampleLength is how much of a sample's message a Slack message shows,
+// keeping it under Slack's 3000 character limit per block
+const maxSampleLength = 300
+
+// A Slack message lists up to maxGroupedLines of a group's alerts, each cut
+// to maxGroupedLineLength, in a section of at most maxSectionLength
+const (
+	maxGroupedLines       = 15
+	maxGroupedLineLength  = 180
+	maxSectionLength      = 3000
+	groupedOverflowLength = 40 // Room kept for the "…and N more" line
+)
+
+// truncate cuts s to at most n bytes, on a rune boundary, marking the cut
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
+
+// slackEscaper escapes the characters Slack's markup gives meaning to
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackMessage formats an alert as Block Kit blocks, with plain text for
+// notifications
+func slackMessage(alert Alert) map[string]interface{} {
+	fields := []map[string]string{
+		{"type": "mrkdwn", "text": fmt.Sprintf("*Count*\n%d", alert.Count)},
+	}
+	if alert.Level != "" {
+		fields = append(fields, map[string]string{"type": "mrkdwn", "text": "*Level*\n" + slackEscaper.Replace(alert.Level)})
+	}
+	if alert.Service != "" {
+		fields = append(fields, map[string]string{"type": "mrkdwn", "text": "*Service*\n" + slackEscaper.Replace(alert.Service)})
+	}
+	if alert.Window != "" {
+		fields = append(fields, map[string]string{"type": "mrkdwn", "text": "*Window*\n" + alert.Window})
+	}
+	icon := "🚨 "
+	if alert.Status == StatusResolved {
+		icon = "✅ "
+	}
+	text := slackEscaper.Replace(alert.Message)
+	if len(text) > maxSectionLength {
+		// Escaping at most quintuples a byte
+		text = slackEscaper.Replace(truncate(alert.Message, maxSectionLength/6))
+	}
+	blocks := []map[string]interface{}{
+		{"type": "header", "text": map[string]string{"type": "plain_text", "text": icon + alert.RuleName}},
+		{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}, "fields": fields},
+	}
+	if len(alert.Grouped) > 0 {
+		var lines strings.Builder
+		for i, grouped := range alert.Grouped {
+			line := "• *" + slackEscaper.Replace(truncate(grouped.RuleName, maxGroupedLineLength/3)) + "*: " +
+				slackEscaper.Replace(truncate(grouped.Message, maxGroupedLineLength)) + "\n"
+			if i == maxGroupedLines || lines.Len()+len(line) > maxSectionLength-groupedOverflowLength {
+				fmt.Fprintf(&lines, "…and %d more\n", len(alert.Grouped)-i)
+				break
+			}
+			lines.WriteString(line)
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": lines.String()},
+		})
+	}
+	if len(alert.Samples) > 0 {
+		var lines strings.Builder
+		for _, sample := range alert.Samples {
+			message := truncate(sample.Message, maxSampleLength)
+			fmt.Fprintf(&lines, "%s %s %s: %s\n", sample.Timestamp.UTC().Format("15:04:05"), sample.Level, sample.Service, message)
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": "```" + slackEscaper.Replace(strings.ReplaceAll(lines.String(), "```", "'''")) + "```"},
+		})
+	}
+	blocks = append(blocks, map[string]interface{}{
+		"type":     "context",
+		"elements": []map[string]string{{"type": "mrkdwn", "text": "Triggered " + alert.Timestamp.UTC().Format("2006-01-02 15:04:05 UTC")}},
+	})
+	return map[string]interface{}{
+		"text":   slackEscaper.Replace(alert.Message),
+		"blocks": blocks,
+	}
+}
@@ -0,0 +1,92 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// SNSConfig is the AWS SNS topic an SNSNotifier publishes to. Credentials
+// come from the SDK's default chain: the AWS_* environment variables, the
+// shared config files, or the instance's or task's role.
+type SNSConfig struct {
+	TopicARN string // e.g. arn:aws:sns:eu-west-1:123456789012:logstream-alerts
+	URL      string // SNS endpoint; AWS_ENDPOINT_URL_SNS, AWS_ENDPOINT_URL or the region's if empty
+	Retry    RetryConfig
+}
+
+// SNSNotifier publishes each alert's JSON to an SNS topic, with the rule,
+// status, service and level as message attributes subscriptions can filter on
+type SNSNotifier struct {
+	config SNSConfig
+	client *sns.Client
+}
+
+// NewSNSNotifier creates a notifier publishing to the topic, in the topic's region
+func NewSNSNotifier(config SNSConfig) (*SNSNotifier, error) {
+	parts := strings.Split(config.TopicARN, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" || parts[3] == "" || parts[5] == "" {
+		return nil, fmt.Errorf("invalid topic ARN %q, expected arn:aws:sns:<region>:<account>:<topic>", config.TopicARN)
+	}
+	config.Retry = config.Retry.withDefaults()
+
+	retries := config.Retry.Retries
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(),
+		awsconfig.WithRegion(parts[3]),
+		awsconfig.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(config.Retry.Timeout)),
+		awsconfig.WithRetryer(func() aws.Retryer {
+			return retry.NewStandard(func(o *retry.StandardOptions) { o.MaxAttempts = retries + 1 })
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %v", err)
+	}
+	if config.URL == "" {
+		config.URL = os.Getenv("AWS_ENDPOINT_URL_SNS")
+	}
+	client := sns.NewFromConfig(cfg, func(o *sns.Options) {
+		if config.URL != "" {
+			o.BaseEndpoint = aws.String(config.URL)
+		}
+	})
+	return &SNSNotifier{config: config, client: client}, nil
+}
+
+// Name identifies the notifier
+func (sn *SNSNotifier) Name() string {
+	return "sns"
+}
+
+// Notify publishes the alert. On a FIFO topic, a rule's alerts keep their
+// order and a redelivered alert is deduplicated by its ID.
+func (sn *SNSNotifier) Notify(ctx context.Context, alert Alert) error {
+	message, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	input := &sns.PublishInput{
+		TopicArn:          aws.String(sn.config.TopicARN),
+		Message:           aws.String(string(message)),
+		MessageAttributes: make(map[string]types.MessageAttributeValue),
+	}
+	if strings.HasSuffix(sn.config.TopicARN, ".fifo") {
+		input.MessageGroupId = aws.String(alert.RuleName)
+		input.MessageDeduplicationId = aws.String(alert.ID)
+	}
+	for name, value := range alertAttributes(alert) {
+		input.MessageAttributes[name] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+	_, err = sn.client.Publish(ctx, input)
+	return err
+}
@@ -0,0 +1,50 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// WebhookNotifier POSTs each alert as JSON to every configured URL
+type WebhookNotifier struct {
+	urls   []string
+	retry  RetryConfig
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier for the given URLs
+func NewWebhookNotifier(urls []string, retry RetryConfig) *WebhookNotifier {
+	return &WebhookNotifier{
+		urls:   urls,
+		retry:  retry.withDefaults(),
+		client: &http.Client{},
+	}
+}
+
+// Name identifies the notifier
+func (wn *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// Notify posts the alert to every URL at once, returning their errors joined
+func (wn *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(wn.urls))
+	var wg sync.WaitGroup
+	for i, url := range wn.urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = PostJSON(ctx, wn.client, wn.retry, url, body, nil)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,98 @@
+package alerting
+
+import (
+	"math"
+	"time"
+)
+
+// windowCounter counts a rule's matching logs per second over its window
+// and, for spike rules, the baseline before it. Running totals keep adding a
+// log and reading a count independent of how many logs there are.
+type windowCounter struct {
+	buckets []int      // Per-second counts, indexed by Unix second modulo their number
+	window  int64      // Seconds in the rule's window
+	head    int64      // Newest second the buckets cover
+	recent  int        // Logs in the window: the newest window seconds
+	total   int        // Logs in every bucket
+	samples []logEntry // Newest matching logs, oldest first
+}
+
+// newWindowCounter creates a counter covering a window and the baseline
+// before it, counting from start
+func newWindowCounter(window, baseline time.Duration, start time.Time) *windowCounter {
+	seconds := max(int64(math.Ceil(window.Seconds())), 1)
+	size := seconds + int64(math.Ceil(baseline.Seconds()))
+	return &windowCounter{
+		buckets: make([]int, size),
+		window:  seconds,
+		head:    start.Unix(),
+		samples: make([]logEntry, 0, maxAlertSamples),
+	}
+}
+
+// add counts a log at its timestamp, or now if that is in the future. Logs
+// older than the buckets aren't counted.
+func (wc *windowCounter) add(log logEntry, now time.Time) {
+	wc.advance(now.Unix())
+	second := min(log.timestamp.Unix(), wc.head)
+	size := int64(len(wc.buckets))
+	if second <= wc.head-size {
+		return
+	}
+	wc.buckets[second%size]++
+	wc.total++
+	if second > wc.head-wc.window {
+		wc.recent++
+	}
+
+	if len(wc.samples) == maxAlertSamples {
+		wc.samples = append(wc.samples[:0], wc.samples[1:]...)
+	}
+	wc.samples = append(wc.samples, log)
+}
+
+// count returns the logs in the window ending now
+func (wc *windowCounter) count(now time.Time) int {
+	wc.advance(now.Unix())
+	return wc.recent
+}
+
+// baselineCount returns the logs in the baseline before the window ending now
+func (wc *windowCounter) baselineCount(now time.Time) int {
+	wc.advance(now.Unix())
+	return wc.total - wc.recent
+}
+
+// recentSamples returns the newest matching logs still in the window ending now
+func (wc *windowCounter) recentSamples(now time.Time) []Sample {
+	start := now.Add(-time.Duration(wc.window) * time.Second)
+	samples := make([]Sample, 0, len(wc.samples))
+	for _, log := range wc.samples {
+		if log.timestamp.After(start) {
+			samples = append(samples, Sample{ID: log.id, Timestamp: log.timestamp, Level: log.level, Service: log.service, Message: log.message})
+		}
+	}
+	return samples
+}
+
+// advance moves the newest second up to now, taking the seconds that leave
+// the window out of recent and reusing the buckets of those that leave the
+// baseline
+func (wc *windowCounter) advance(now int64) {
+	if now <= wc.head {
+		return
+	}
+	size := int64(len(wc.buckets))
+	if now-wc.head >= size {
+		clear(wc.buckets)
+		wc.recent, wc.total, wc.head = 0, 0, now
+		return
+	}
+	for second := wc.head + 1; second <= now; second++ {
+		wc.recent -= wc.buckets[(second-wc.window)%size]
+		i := second % size
+		wc.total -= wc.buckets[i]
+		wc.buckets[i] = 0
+	}
+	wc.head = now
+}
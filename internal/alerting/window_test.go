@@ -0,0 +1,73 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowCounter(t *testing.T) {
+	at := func(second int64) time.Time { return time.Unix(second, 0) }
+	// A 10s window, covering 1001-1010 at 1010, after a 20s baseline
+	wc := newWindowCounter(10*time.Second, 20*time.Second, at(1000))
+
+	steps := []struct {
+		name         string
+		log          *int64 // Timestamp of a log added at now, if any
+		now          int64
+		wantCount    int
+		wantBaseline int
+	}{
+		{name: "first log", log: ptr(int64(1000)), now: 1000, wantCount: 1},
+		{name: "second log", log: ptr(int64(1005)), now: 1005, wantCount: 2},
+		{name: "first leaves the window", now: 1010, wantCount: 1, wantBaseline: 1},
+		{name: "both in the baseline", now: 1015, wantCount: 0, wantBaseline: 2},
+		{name: "first leaves the baseline", now: 1030, wantCount: 0, wantBaseline: 1},
+		{name: "late log in the baseline", log: ptr(int64(1012)), now: 1030, wantCount: 0, wantBaseline: 2},
+		{name: "log older than the baseline", log: ptr(int64(1000)), now: 1030, wantCount: 0, wantBaseline: 2},
+		{name: "future log counts now", log: ptr(int64(2000)), now: 1030, wantCount: 1, wantBaseline: 2},
+		{name: "everything ages out", now: 5000, wantCount: 0, wantBaseline: 0},
+	}
+	for _, step := range steps {
+		if step.log != nil {
+			wc.add(logEntry{timestamp: at(*step.log)}, at(step.now))
+		}
+		if got := wc.count(at(step.now)); got != step.wantCount {
+			t.Errorf("%s: count = %d, want %d", step.name, got, step.wantCount)
+		}
+		if got := wc.baselineCount(at(step.now)); got != step.wantBaseline {
+			t.Errorf("%s: baseline = %d, want %d", step.name, got, step.wantBaseline)
+		}
+	}
+}
+
+func TestWindowCounterSamples(t *testing.T) {
+	start := time.Unix(1000, 0)
+	wc := newWindowCounter(time.Minute, 0, start)
+	for i := 0; i < maxAlertSamples+2; i++ {
+		now := start.Add(time.Duration(i) * 10 * time.Second)
+		wc.add(logEntry{id: string(rune('a' + i)), timestamp: now}, now)
+	}
+
+	// The newest maxAlertSamples are kept, and only those still in the window returned
+	tests := []struct {
+		now  time.Time
+		want string
+	}{
+		{start.Add(60 * time.Second), "cdefg"},
+		{start.Add(95 * time.Second), "efg"},
+		{start.Add(time.Hour), ""},
+	}
+	for _, test := range tests {
+		got := ""
+		for _, sample := range wc.recentSamples(test.now) {
+			got += sample.ID
+		}
+		if got != test.want {
+			t.Errorf("recentSamples(+%v) = %q, want %q", test.now.Sub(start), got, test.want)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,308 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"logstream/pkg/models"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/gzip"
+)
+
+// Uploader stores an object in a bucket
+type Uploader interface {
+	Upload(ctx context.Context, key string, body []byte, contentType string) error
+}
+
+// Config controls the archiver
+type Config struct {
+	Prefix     string        // Key prefix inside the bucket, e.g. "logstream/"
+	QueueSize  int           // Evicted batches waiting for upload
+	MaxBackoff time.Duration // Longest wait between retries of a failed upload
+	SpillDir   string        // Where batches go when the queue is full or uploads are cut short by Stop; uploaded by the next Start (dropped if empty)
+}
+
+// spillInterval is how often spilled batches are retried
+const spillInterval = time.Minute
+
+// Stats reports archiving progress
+type Stats struct {
+	Batches  uint64 `json:"batches"`
+	Entries  uint64 `json:"entries"`
+	Bytes    uint64 `json:"bytes"`
+	Failures uint64 `json:"failures"` // Upload attempts that failed and were retried
+	Dropped  uint64 `json:"dropped"`  // Entries lost because the upload queue was full and they couldn't be spilled
+	Spilled  uint64 `json:"spilled"`  // Entries written to SpillDir to upload later
+	Pending  int    `json:"pending"`
+}
+
+// Archiver uploads evicted logs as gzipped NDJSON objects named after the
+// time range they cover, so old logs leave RAM without ceasing to exist
+type Archiver struct {
+	config   Config
+	uploader Uploader
+	queue    chan []models.LogEntry
+	stats    Stats
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+	shutdown chan struct{}
+}
+
+// NewArchiver creates an archiver that uploads through uploader
+func NewArchiver(config Config, uploader Uploader) *Archiver {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 16
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = time.Minute
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Archiver{
+		config:   config,
+		uploader: uploader,
+		queue:    make(chan []models.LogEntry, config.QueueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Start begins the background uploader
+func (a *Archiver) Start() {
+	a.wg.Add(1)
+	go a.run()
+}
+
+// Archive queues a batch for upload without blocking. It is meant to be the
+// store's eviction handler. When the queue is full, the batch is spilled to
+// disk rather than holding up eviction.
+func (a *Archiver) Archive(entries []models.LogEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	select {
+	case a.queue <- entries:
+	default:
+		if err := a.spill(entries); err != nil {
+			dropped := atomic.AddUint64(&a.stats.Dropped, uint64(len(entries)))
+			fmt.Printf("⚠️  Archive queue full, dropped %d evicted logs (%d so far): %v\n", len(entries), dropped, err)
+		}
+	}
+}
+
+// run uploads queued batches until Stop, then drains what is left. Spilled
+// batches, including an earlier run's, are uploaded at start and every
+// spillInterval.
+func (a *Archiver) run() {
+	defer a.wg.Done()
+	a.uploadSpilled()
+	ticker := time.NewTicker(spillInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case entries := <-a.queue:
+			a.upload(entries)
+		case <-ticker.C:
+			a.uploadSpilled()
+		case <-a.shutdown:
+			for {
+				select {
+				case entries := <-a.queue:
+					a.upload(entries)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// upload encodes a batch and uploads it, spilling it if Stop cuts the upload short
+func (a *Archiver) upload(entries []models.LogEntry) {
+	body, err := encode(entries)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to encode archive batch: %v\n", err)
+		return
+	}
+	key := a.objectKey(entries)
+	if a.send(key, body, len(entries)) {
+		return
+	}
+	if err := a.spillEncoded(key, body, len(entries)); err != nil {
+		fmt.Printf("⚠️  Gave up archiving %d logs (%s) on shutdown: %v\n", len(entries), key, err)
+	}
+}
+
+// send uploads an encoded batch, retrying with backoff until it is stored or
+// the archiver stops
+func (a *Archiver) send(key string, body []byte, entries int) bool {
+	backoff := time.Second
+	for a.ctx.Err() == nil {
+		ctx, cancel := context.WithTimeout(a.ctx, 2*time.Minute)
+		err := a.uploader.Upload(ctx, key, body, "application/x-ndjson")
+		cancel()
+		if err == nil {
+			atomic.AddUint64(&a.stats.Batches, 1)
+			atomic.AddUint64(&a.stats.Entries, uint64(entries))
+			atomic.AddUint64(&a.stats.Bytes, uint64(len(body)))
+			return true
+		}
+
+		failures := atomic.AddUint64(&a.stats.Failures, 1)
+		fmt.Printf("⚠️  Archive upload of %s failed (%d so far), retrying in %v: %v\n", key, failures, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-a.ctx.Done():
+		}
+		backoff *= 2
+		if backoff > a.config.MaxBackoff {
+			backoff = a.config.MaxBackoff
+		}
+	}
+	return false
+}
+
+// spill writes a batch to SpillDir for a later run to upload
+func (a *Archiver) spill(entries []models.LogEntry) error {
+	body, err := encode(entries)
+	if err != nil {
+		return err
+	}
+	return a.spillEncoded(a.objectKey(entries), body, len(entries))
+}
+
+// spillEncoded writes an encoded batch to SpillDir as <entries>_<escaped key>
+func (a *Archiver) spillEncoded(key string, body []byte, entries int) error {
+	if a.config.SpillDir == "" {
+		return fmt.Errorf("no spill directory")
+	}
+	if err := os.MkdirAll(a.config.SpillDir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(a.config.SpillDir, strconv.Itoa(entries)+"_"+url.PathEscape(key))
+	// Written under a temporary name so a crash can't leave half a batch to upload
+	if err := os.WriteFile(name+".tmp", body, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	atomic.AddUint64(&a.stats.Spilled, uint64(entries))
+	return nil
+}
+
+// uploadSpilled uploads the batches in SpillDir, removing each once stored
+func (a *Archiver) uploadSpilled() {
+	if a.config.SpillDir == "" {
+		return
+	}
+	files, err := os.ReadDir(a.config.SpillDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("⚠️  Failed to read archive spill directory: %v\n", err)
+		}
+		return
+	}
+	for _, file := range files {
+		countPart, escapedKey, ok := strings.Cut(file.Name(), "_")
+		entries, countErr := strconv.Atoi(countPart)
+		key, keyErr := url.PathUnescape(escapedKey)
+		if !ok || countErr != nil || keyErr != nil || strings.HasSuffix(file.Name(), ".tmp") {
+			continue
+		}
+		path := filepath.Join(a.config.SpillDir, file.Name())
+		body, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("⚠️  Failed to read spilled archive batch %s: %v\n", file.Name(), err)
+			continue
+		}
+		if !a.send(key, body, entries) {
+			return // Stopping; it stays spilled
+		}
+		if err := os.Remove(path); err != nil {
+			fmt.Printf("⚠️  Failed to remove uploaded archive batch %s: %v\n", file.Name(), err)
+		}
+	}
+}
+
+// objectKey names a batch after its day and time range, e.g.
+// prefix/2024/01/15/20240115T100000Z_20240115T101500Z_<id>.ndjson.gz
+func (a *Archiver) objectKey(entries []models.LogEntry) string {
+	first, last := entries[0].Timestamp, entries[0].Timestamp
+	for _, entry := range entries[1:] {
+		if entry.Timestamp.Before(first) {
+			first = entry.Timestamp
+		}
+		if entry.Timestamp.After(last) {
+			last = entry.Timestamp
+		}
+	}
+	first, last = first.UTC(), last.UTC()
+
+	prefix := a.config.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return fmt.Sprintf("%s%s/%s_%s_%s.ndjson.gz", prefix, first.Format("2006/01/02"),
+		first.Format("20060102T150405Z"), last.Format("20060102T150405Z"), uuid.New().String()[:8])
+}
+
+// encode writes entries as gzipped newline-delimited JSON
+func encode(entries []models.LogEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(zw)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Stats returns the archiving counters
+func (a *Archiver) Stats() Stats {
+	return Stats{
+		Batches:  atomic.LoadUint64(&a.stats.Batches),
+		Entries:  atomic.LoadUint64(&a.stats.Entries),
+		Bytes:    atomic.LoadUint64(&a.stats.Bytes),
+		Failures: atomic.LoadUint64(&a.stats.Failures),
+		Dropped:  atomic.LoadUint64(&a.stats.Dropped),
+		Spilled:  atomic.LoadUint64(&a.stats.Spilled),
+		Pending:  len(a.queue),
+	}
+}
+
+// Stop uploads the queued batches, giving failing uploads until timeout
+// before spilling what is left
+func (a *Archiver) Stop(timeout time.Duration) error {
+	close(a.shutdown)
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		a.cancel()
+		<-done
+	}
+	a.cancel()
+	return nil
+}
@@ -0,0 +1,250 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"logstream/pkg/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExportConfig controls the Parquet exporter
+type ExportConfig struct {
+	Prefix    string        // Key prefix for the files, e.g. "logstream/"
+	Partition time.Duration // Time span of each file
+	Delay     time.Duration // How long after a partition ends it is exported, so late logs make it in
+	Backfill  time.Duration // How far back the first run starts when there is no state file
+	StatePath string        // File recording the end of the last exported partition, so restarts resume
+}
+
+// ExportStats reports Parquet export progress
+type ExportStats struct {
+	Files        uint64    `json:"files"`
+	Entries      uint64    `json:"entries"`
+	Bytes        uint64    `json:"bytes"`
+	Failures     uint64    `json:"failures"`       // Export attempts that failed and will be retried
+	ExportedUpTo time.Time `json:"exported_up_to"` // End of the last exported partition
+}
+
+// Exporter writes each closed time partition of the store to a Parquet file,
+// so history can be queried with DuckDB, Spark or pandas without the API.
+// Files are laid out Hive-style by day, e.g.
+// prefix/date=2024-01-15/20240115T100000Z_20240115T110000Z.parquet.
+type Exporter struct {
+	config   ExportConfig
+	query    func(start, end time.Time) []models.LogEntry
+	uploader Uploader
+	next     time.Time // Start of the next partition to export
+	stats    ExportStats
+	mu       sync.Mutex // Guards stats.ExportedUpTo
+	wg       sync.WaitGroup
+	shutdown chan struct{}
+}
+
+// NewExporter creates an exporter reading partitions through query, e.g. a
+// store's GetByTimeRange, and writing them through uploader. It resumes
+// after the partition recorded in the state file, if there is one.
+func NewExporter(config ExportConfig, query func(start, end time.Time) []models.LogEntry, uploader Uploader) (*Exporter, error) {
+	if config.Partition <= 0 {
+		config.Partition = time.Hour
+	}
+
+	e := &Exporter{
+		config:   config,
+		query:    query,
+		uploader: uploader,
+		shutdown: make(chan struct{}),
+	}
+	if config.StatePath != "" {
+		state, err := os.ReadFile(config.StatePath)
+		if err == nil {
+			if e.next, err = time.Parse(time.RFC3339, strings.TrimSpace(string(state))); err != nil {
+				return nil, fmt.Errorf("reading export state %s: %w", config.StatePath, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if e.next.IsZero() {
+		e.next = time.Now().UTC().Add(-config.Backfill).Truncate(config.Partition)
+	} else {
+		e.stats.ExportedUpTo = e.next
+	}
+	return e, nil
+}
+
+// Start begins exporting partitions as they close
+func (e *Exporter) Start() {
+	interval := e.config.Partition / 4
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		e.exportClosed(time.Now())
+		for {
+			select {
+			case now := <-ticker.C:
+				e.exportClosed(now)
+			case <-e.shutdown:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for an export in progress and stops
+func (e *Exporter) Stop() error {
+	close(e.shutdown)
+	e.wg.Wait()
+	return nil
+}
+
+// exportClosed exports every partition that ended at least Delay before now,
+// oldest first, stopping at the first failure so it is retried next time.
+// The state file is saved after each written file and once caught up, so
+// empty partitions don't each cost a sync.
+func (e *Exporter) exportClosed(now time.Time) {
+	saved := e.next
+	defer func() {
+		if e.next.After(saved) {
+			e.saveState()
+		}
+	}()
+
+	for {
+		end := e.next.Add(e.config.Partition)
+		if end.Add(e.config.Delay).After(now) {
+			return
+		}
+		select {
+		case <-e.shutdown:
+			return
+		default:
+		}
+
+		written, err := e.export(e.next, end)
+		if err != nil {
+			failures := atomic.AddUint64(&e.stats.Failures, 1)
+			fmt.Printf("⚠️  Parquet export of %s failed (%d so far): %v\n", e.next.Format(time.RFC3339), failures, err)
+			return
+		}
+		e.next = end
+		e.mu.Lock()
+		e.stats.ExportedUpTo = end
+		e.mu.Unlock()
+		if written {
+			e.saveState()
+			saved = end
+		}
+	}
+}
+
+// export writes one partition to a file, reporting whether it held any logs
+func (e *Exporter) export(start, end time.Time) (bool, error) {
+	entries := e.query(start, end.Add(-time.Nanosecond))
+	if len(entries) == 0 {
+		return false, nil
+	}
+
+	body, err := EncodeParquet(entries)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := e.uploader.Upload(ctx, e.objectKey(start, end), body, "application/vnd.apache.parquet"); err != nil {
+		return false, err
+	}
+	atomic.AddUint64(&e.stats.Files, 1)
+	atomic.AddUint64(&e.stats.Entries, uint64(len(entries)))
+	atomic.AddUint64(&e.stats.Bytes, uint64(len(body)))
+	return true, nil
+}
+
+// saveState records the start of the next partition to export. A failed save
+// only means a restart exports some partitions again.
+func (e *Exporter) saveState() {
+	if e.config.StatePath == "" {
+		return
+	}
+	if err := writeFileAtomic(e.config.StatePath, []byte(e.next.Format(time.RFC3339)+"\n")); err != nil {
+		fmt.Printf("⚠️  Failed to save Parquet export state: %v\n", err)
+	}
+}
+
+// objectKey names a partition's file after its day and time range
+func (e *Exporter) objectKey(start, end time.Time) string {
+	prefix := e.config.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return fmt.Sprintf("%sdate=%s/%s_%s.parquet", prefix, start.Format("2006-01-02"),
+		start.Format("20060102T150405Z"), end.Format("20060102T150405Z"))
+}
+
+// Stats returns the export counters
+func (e *Exporter) Stats() ExportStats {
+	e.mu.Lock()
+	exportedUpTo := e.stats.ExportedUpTo
+	e.mu.Unlock()
+	return ExportStats{
+		Files:        atomic.LoadUint64(&e.stats.Files),
+		Entries:      atomic.LoadUint64(&e.stats.Entries),
+		Bytes:        atomic.LoadUint64(&e.stats.Bytes),
+		Failures:     atomic.LoadUint64(&e.stats.Failures),
+		ExportedUpTo: exportedUpTo,
+	}
+}
+
+// DirUploader writes objects as files under a local directory, creating
+// subdirectories for keys with slashes
+type DirUploader struct {
+	dir string
+}
+
+// NewDirUploader creates an uploader writing under dir
+func NewDirUploader(dir string) *DirUploader {
+	return &DirUploader{dir: dir}
+}
+
+// Upload writes body to dir/key atomically
+func (u *DirUploader) Upload(ctx context.Context, key string, body []byte, contentType string) error {
+	path := filepath.Join(u.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, body)
+}
+
+// writeFileAtomic replaces path with data through a synced temporary file
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
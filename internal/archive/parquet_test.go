@@ -0,0 +1,127 @@
+package archive
+
+import (
+	"bytes"
+	"logstream/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// readBackRow reads exported files with nullable columns as pointers, so
+// nulls are told apart from empty strings
+type readBackRow struct {
+	ID        string    `parquet:"id"`
+	Timestamp time.Time `parquet:"timestamp,timestamp(microsecond)"`
+	Level     string    `parquet:"level"`
+	Service   string    `parquet:"service"`
+	Message   string    `parquet:"message"`
+	Node      *string   `parquet:"node,optional"`
+	Source    *string   `parquet:"source,optional"`
+	Namespace *string   `parquet:"namespace,optional"`
+	Metadata  *string   `parquet:"metadata,optional"`
+}
+
+func TestEncodeParquetRoundTrip(t *testing.T) {
+	at := time.Date(2026, 10, 17, 9, 30, 0, 123456789, time.FixedZone("CEST", 2*60*60))
+	entries := []models.LogEntry{
+		{ID: "1", Timestamp: at, Level: "ERROR", Service: "api", Message: "boom", Node: "node-a", Source: "http", Namespace: "prod", Metadata: map[string]interface{}{"status": 500}},
+		{ID: "2", Timestamp: at.Add(time.Second), Level: "INFO", Service: "web", Message: "ünïcode ✓"},
+	}
+
+	data, err := EncodeParquet(entries)
+	if err != nil {
+		t.Fatalf("EncodeParquet: %v", err)
+	}
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if file.NumRows() != int64(len(entries)) {
+		t.Fatalf("NumRows = %d, want %d", file.NumRows(), len(entries))
+	}
+
+	for _, column := range file.Metadata().RowGroups[0].Columns {
+		if column.MetaData.Codec != format.Zstd {
+			t.Errorf("%v compressed with %v, want zstd", column.MetaData.PathInSchema, column.MetaData.Codec)
+		}
+	}
+
+	schema := file.Schema()
+	for _, column := range []struct {
+		name     string
+		optional bool
+	}{{"id", false}, {"timestamp", false}, {"message", false}, {"node", true}, {"metadata", true}} {
+		field, ok := schema.Lookup(column.name)
+		if !ok {
+			t.Errorf("schema has no %s column", column.name)
+			continue
+		}
+		if field.Node.Optional() != column.optional {
+			t.Errorf("%s optional = %v, want %v", column.name, field.Node.Optional(), column.optional)
+		}
+	}
+	timestamp, _ := schema.Lookup("timestamp")
+	logical := timestamp.Node.Type().LogicalType()
+	if kind, ok := logical.Value.(*format.TimestampType); !ok || !kind.IsAdjustedToUTC || !isMicros(kind.Unit) {
+		t.Errorf("timestamp logical type = %v, want a UTC microsecond timestamp", logical)
+	}
+	id, _ := schema.Lookup("id")
+	if logical := id.Node.Type().LogicalType(); logical == nil {
+		t.Error("id has no logical type, want a string")
+	} else if _, ok := logical.Value.(*format.StringType); !ok {
+		t.Errorf("id logical type = %v, want a string", logical)
+	}
+
+	rows, err := parquet.Read[readBackRow](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("read %d rows, want 2", len(rows))
+	}
+
+	first := rows[0]
+	if first.ID != "1" || first.Level != "ERROR" || first.Service != "api" || first.Message != "boom" {
+		t.Errorf("first row = %+v", first)
+	}
+	if !first.Timestamp.Equal(at.Truncate(time.Microsecond)) {
+		t.Errorf("timestamp = %v, want %v", first.Timestamp, at.Truncate(time.Microsecond))
+	}
+	if first.Node == nil || *first.Node != "node-a" || first.Source == nil || *first.Source != "http" || first.Namespace == nil || *first.Namespace != "prod" {
+		t.Errorf("first row's optional columns = %v %v %v", first.Node, first.Source, first.Namespace)
+	}
+	if first.Metadata == nil || *first.Metadata != `{"status":500}` {
+		t.Errorf("metadata = %v, want {\"status\":500}", first.Metadata)
+	}
+
+	second := rows[1]
+	if second.Message != "ünïcode ✓" {
+		t.Errorf("message = %q, want ünïcode ✓", second.Message)
+	}
+	if second.Node != nil || second.Source != nil || second.Namespace != nil || second.Metadata != nil {
+		t.Errorf("second row's empty optional columns = %v %v %v %v, want nulls", second.Node, second.Source, second.Namespace, second.Metadata)
+	}
+}
+
+func TestEncodeParquetEmpty(t *testing.T) {
+	data, err := EncodeParquet(nil)
+	if err != nil {
+		t.Fatalf("EncodeParquet: %v", err)
+	}
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if file.NumRows() != 0 {
+		t.Errorf("NumRows = %d, want 0", file.NumRows())
+	}
+}
+
+// isMicros reports whether a time unit is microseconds
+func isMicros(unit format.TimeUnit) bool {
+	_, ok := unit.Value.(*format.MicroSeconds)
+	return ok
+}
@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// gcsEndpoint is Google Cloud Storage's S3 interoperability API
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// S3Config describes an S3-compatible bucket. Google Cloud Storage works
+// through its S3 interoperability API with HMAC keys and region "auto".
+type S3Config struct {
+	Endpoint string // Custom endpoint, e.g. https://storage.googleapis.com or http://localhost:9000 (AWS default if empty)
+	Region   string // Falls back to the SDK's default region, then us-east-1
+	Bucket   string
+}
+
+// S3Uploader puts objects with the AWS SDK, using its default credential
+// chain. Buckets on a custom endpoint are addressed path-style.
+type S3Uploader struct {
+	bucket string
+	client *s3.Client
+}
+
+// NewS3Uploader creates an uploader for the configured bucket
+func NewS3Uploader(config S3Config) (*S3Uploader, error) {
+	options := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(2 * time.Minute)),
+	}
+	if config.Region != "" {
+		options = append(options, awsconfig.WithRegion(config.Region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %v", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(strings.TrimSuffix(config.Endpoint, "/"))
+			o.UsePathStyle = true
+			// Other stores (GCS among them) reject the SDK's default trailing checksums
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+	})
+	return &S3Uploader{bucket: config.Bucket, client: client}, nil
+}
+
+// Upload stores body under key
+func (u *S3Uploader) Upload(ctx context.Context, key string, body []byte, contentType string) error {
+	_, err := u.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(u.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(body),
+		ContentLength: aws.Int64(int64(len(body))),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// ParseURL splits s3://bucket/prefix or gs://bucket/prefix into a bucket
+// config, pointing gs:// at Google Cloud Storage, and the key prefix
+func ParseURL(raw string) (S3Config, string, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return S3Config{}, "", err
+	}
+	if parsed.Host == "" {
+		return S3Config{}, "", fmt.Errorf("archive URL %q has no bucket", raw)
+	}
+
+	config := S3Config{Bucket: parsed.Host}
+	switch parsed.Scheme {
+	case "s3":
+	case "gs":
+		config.Region = "auto"
+		config.Endpoint = gcsEndpoint
+	default:
+		return S3Config{}, "", fmt.Errorf("archive URL %q must start with s3:// or gs://", raw)
+	}
+	return config, strings.TrimPrefix(parsed.Path, "/"), nil
+}
@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		raw      string
+		want     S3Config
+		prefix   string
+		hasError bool
+	}{
+		{raw: "s3://logs/logstream/eu", want: S3Config{Bucket: "logs"}, prefix: "logstream/eu"},
+		{raw: "s3://logs", want: S3Config{Bucket: "logs"}},
+		{raw: "gs://logs/logstream", want: S3Config{Bucket: "logs", Region: "auto", Endpoint: gcsEndpoint}, prefix: "logstream"},
+		{raw: "https://logs/logstream", hasError: true},
+		{raw: "s3:///logstream", hasError: true},
+	}
+	for _, test := range tests {
+		config, prefix, err := ParseURL(test.raw)
+		if test.hasError {
+			if err == nil {
+				t.Errorf("ParseURL(%q) succeeded, want an error", test.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseURL(%q): %v", test.raw, err)
+			continue
+		}
+		if config != test.want || prefix != test.prefix {
+			t.Errorf("ParseURL(%q) = %+v, %q, want %+v, %q", test.raw, config, prefix, test.want, test.prefix)
+		}
+	}
+}
+
+func TestS3UploaderPutsObjectPathStyle(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+
+	var method, path, contentType, authorization, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(data)
+		contentType = r.Header.Get("Content-Type")
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	uploader, err := NewS3Uploader(S3Config{Endpoint: server.URL + "/", Region: "eu-west-1", Bucket: "logs"})
+	if err != nil {
+		t.Fatalf("NewS3Uploader: %v", err)
+	}
+	if err := uploader.Upload(context.Background(), "2026/10/17/batch 1.ndjson.gz", []byte("payload"), "application/x-ndjson"); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	if method != http.MethodPut || path != "/logs/2026/10/17/batch 1.ndjson.gz" {
+		t.Errorf("request = %s %s, want PUT /logs/2026/10/17/batch 1.ndjson.gz", method, path)
+	}
+	if body != "payload" || contentType != "application/x-ndjson" {
+		t.Errorf("object = %q (%s), want %q (application/x-ndjson)", body, contentType, "payload")
+	}
+	if !strings.Contains(authorization, "Credential=test-key/") || !strings.Contains(authorization, "/eu-west-1/s3/") {
+		t.Errorf("Authorization = %q, want a SigV4 signature for test-key in eu-west-1", authorization)
+	}
+}
+
+func TestS3UploaderReportsFailedUpload(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+	}))
+	defer server.Close()
+
+	uploader, err := NewS3Uploader(S3Config{Endpoint: server.URL, Region: "eu-west-1", Bucket: "logs"})
+	if err != nil {
+		t.Fatalf("NewS3Uploader: %v", err)
+	}
+	err = uploader.Upload(context.Background(), "batch.ndjson.gz", []byte("payload"), "application/x-ndjson")
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Fatalf("Upload = %v, want an AccessDenied error", err)
+	}
+}
@@ -0,0 +1,255 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"logstream/pkg/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChainConfig controls the audit chain
+type ChainConfig struct {
+	Key                ed25519.PrivateKey
+	CheckpointPath     string        // File signed checkpoints are appended to; empty keeps them in memory only
+	CheckpointInterval time.Duration // How often a checkpoint of the chain's head is signed
+	// Accept reports whether the store keeps an entry; entries it would drop,
+	// e.g. for an unconfigured namespace, aren't chained. Nil accepts every entry.
+	Accept func(entry models.LogEntry) bool
+}
+
+// Checkpoint is a signed record of the chain's head. Rewriting the chain
+// up to a checkpoint would change the hash it records, which can't be
+// re-signed without the key.
+type Checkpoint struct {
+	Seq       uint64    `json:"seq"`
+	Hash      string    `json:"hash"`
+	Time      time.Time `json:"time"`
+	Signature string    `json:"signature"` // Ed25519 over Seq, Hash and Time, base64
+}
+
+// Chain links every stored entry to the one before it: each entry gets the
+// next sequence number, the previous entry's hash and a SHA-256 hash of
+// itself, so modifying an entry breaks its hash, removing one leaves a gap,
+// and rewriting the rest to match contradicts the signed checkpoints.
+type Chain struct {
+	config       ChainConfig
+	mu           sync.Mutex
+	seq          uint64 // Last sequence number issued
+	resumed      uint64 // Sequence number the chain resumed after on startup
+	head         string // Hash of the entry with seq
+	checkpoints  []Checkpoint
+	checkpointMu sync.Mutex // Guards checkpoints and the checkpoint file
+	wg           sync.WaitGroup
+	shutdown     chan struct{}
+}
+
+// ParseKey decodes an Ed25519 signing key from its 32-byte seed, hex or base64
+func ParseKey(encoded string) (ed25519.PrivateKey, error) {
+	encoded = strings.TrimSpace(encoded)
+	seed, err := hex.DecodeString(encoded)
+	if err != nil {
+		if seed, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("key is neither hex nor base64")
+		}
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("key seed is %d bytes, expected %d", len(seed), ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// NewChain loads the checkpoints saved at CheckpointPath and resumes after
+// the newest of them and the entries scan passes on, e.g. those replayed from
+// the WAL; a nil scan means nothing is stored
+func NewChain(config ChainConfig, scan func(fn func(models.LogEntry) bool)) (*Chain, error) {
+	if config.CheckpointInterval <= 0 {
+		config.CheckpointInterval = time.Minute
+	}
+	c := &Chain{config: config, shutdown: make(chan struct{})}
+
+	if config.CheckpointPath != "" {
+		checkpoints, err := loadCheckpoints(config.CheckpointPath)
+		if err != nil {
+			return nil, err
+		}
+		c.checkpoints = checkpoints
+		if n := len(checkpoints); n > 0 {
+			c.seq, c.head = checkpoints[n-1].Seq, checkpoints[n-1].Hash
+		}
+	}
+	checkpointed := c.seq
+	var storedSeq uint64
+	if scan != nil {
+		scan(func(entry models.LogEntry) bool {
+			if entry.Hash != "" && entry.AuditSeq > storedSeq {
+				storedSeq = entry.AuditSeq
+				if storedSeq > c.seq {
+					c.seq, c.head = entry.AuditSeq, entry.Hash
+				}
+			}
+			return true
+		})
+	}
+	if checkpointed > storedSeq {
+		fmt.Printf("⚠️  Audit chain entries up to %d were checkpointed but only up to %d are stored; expected after restarting a memory store without -wal-dir, reported by verification otherwise\n", checkpointed, storedSeq)
+	}
+	c.resumed = c.seq
+	return c, nil
+}
+
+// loadCheckpoints reads a checkpoint file, one JSON checkpoint per line
+func loadCheckpoints(path string) ([]Checkpoint, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var checkpoints []Checkpoint
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var checkpoint Checkpoint
+		if err := json.Unmarshal(scanner.Bytes(), &checkpoint); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints, scanner.Err()
+}
+
+// Start begins signing checkpoints every CheckpointInterval
+func (c *Chain) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.config.CheckpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.checkpoint()
+			case <-c.shutdown:
+				return
+			}
+		}
+	}()
+}
+
+// Stop signs a last checkpoint and stops
+func (c *Chain) Stop() error {
+	close(c.shutdown)
+	c.wg.Wait()
+	return c.checkpoint()
+}
+
+// Append chains entries in order and calls commit, which writes them ahead
+// and stores them, before the next batch is chained, so the store holds
+// entries in chain order. Any hash or sequence number an entry arrived with
+// is replaced.
+func (c *Chain) Append(entries []models.LogEntry, commit func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range entries {
+		if c.config.Accept != nil && !c.config.Accept(entries[i]) {
+			entries[i].AuditSeq, entries[i].PrevHash, entries[i].Hash = 0, "", ""
+			continue
+		}
+		c.seq++
+		entries[i].AuditSeq = c.seq
+		entries[i].PrevHash = c.head
+		entries[i].Hash = Hash(entries[i])
+		c.head = entries[i].Hash
+	}
+	return commit()
+}
+
+// Hash returns the hex SHA-256 of an entry's JSON encoding without its hash,
+// which covers its sequence number and the previous entry's hash
+func Hash(entry models.LogEntry) string {
+	entry.Hash = ""
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		// Only unencodable metadata gets here; hash what identifies the entry
+		encoded = []byte(fmt.Sprintf("%d\n%s\n%s\n%s", entry.AuditSeq, entry.PrevHash, entry.ID, entry.Message))
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkpoint signs the chain's head and saves it, unless nothing was chained
+// since the last checkpoint
+func (c *Chain) checkpoint() error {
+	c.mu.Lock()
+	seq, head := c.seq, c.head
+	c.mu.Unlock()
+
+	c.checkpointMu.Lock()
+	defer c.checkpointMu.Unlock()
+	if seq == 0 || len(c.checkpoints) > 0 && c.checkpoints[len(c.checkpoints)-1].Seq == seq {
+		return nil
+	}
+
+	checkpoint := Checkpoint{Seq: seq, Hash: head, Time: time.Now().UTC()}
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(c.config.Key, checkpointMessage(checkpoint)))
+	if c.config.CheckpointPath != "" {
+		if err := appendCheckpoint(c.config.CheckpointPath, checkpoint); err != nil {
+			fmt.Printf("⚠️  Failed to save audit checkpoint %d: %v\n", seq, err)
+			return err
+		}
+	}
+	c.checkpoints = append(c.checkpoints, checkpoint)
+	return nil
+}
+
+// checkpointMessage is the byte string a checkpoint's signature covers
+func checkpointMessage(checkpoint Checkpoint) []byte {
+	return []byte(fmt.Sprintf("logstream-audit-checkpoint\n%d\n%s\n%s", checkpoint.Seq, checkpoint.Hash, checkpoint.Time.Format(time.RFC3339Nano)))
+}
+
+// appendCheckpoint appends a checkpoint to the file and syncs it
+func appendCheckpoint(path string, checkpoint Checkpoint) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	line, _ := json.Marshal(checkpoint)
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// PublicKey returns the base64 key checkpoint signatures verify against
+func (c *Chain) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(c.config.Key.Public().(ed25519.PublicKey))
+}
+
+// Head returns the last sequence number issued
+func (c *Chain) Head() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
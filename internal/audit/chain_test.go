@@ -0,0 +1,316 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"logstream/pkg/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSeed is a fixed Ed25519 seed, so signatures are reproducible
+var testSeed = bytes.Repeat([]byte{42}, ed25519.SeedSize)
+
+// newTestChain returns a chain with entries 1 to n appended and a checkpoint
+// signed after entry checkpointAt (none if 0)
+func newTestChain(t *testing.T, config ChainConfig, n, checkpointAt int) (*Chain, []models.LogEntry) {
+	t.Helper()
+	if config.Key == nil {
+		config.Key = ed25519.NewKeyFromSeed(testSeed)
+	}
+	chain, err := NewChain(config, nil)
+	if err != nil {
+		t.Fatalf("NewChain: %v", err)
+	}
+	var stored []models.LogEntry
+	for i := 1; i <= n; i++ {
+		batch := []models.LogEntry{{ID: fmt.Sprintf("e%d", i), Level: "INFO", Service: "api", Message: fmt.Sprintf("message %d", i)}}
+		if err := chain.Append(batch, func() error { stored = append(stored, batch...); return nil }); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+		if i == checkpointAt {
+			if err := chain.checkpoint(); err != nil {
+				t.Fatalf("checkpoint: %v", err)
+			}
+		}
+	}
+	return chain, stored
+}
+
+// scanOf passes entries on in order, as a store's Iterate would
+func scanOf(entries []models.LogEntry) func(fn func(models.LogEntry) bool) {
+	return func(fn func(models.LogEntry) bool) {
+		for _, entry := range entries {
+			if !fn(entry) {
+				return
+			}
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		encoded string
+		text    string // Error text, when parsing fails
+	}{
+		{encoded: hex.EncodeToString(testSeed)},
+		{encoded: " " + base64.StdEncoding.EncodeToString(testSeed) + "\n"},
+		{encoded: hex.EncodeToString(testSeed[:31]), text: "31 bytes, expected 32"},
+		{encoded: base64.StdEncoding.EncodeToString(append(testSeed, 0)), text: "33 bytes, expected 32"},
+		{encoded: "not a key!", text: "neither hex nor base64"},
+	}
+	for _, test := range tests {
+		key, err := ParseKey(test.encoded)
+		if test.text != "" {
+			if err == nil || !strings.Contains(err.Error(), test.text) {
+				t.Errorf("ParseKey(%q) = %v, want an error containing %q", test.encoded, err, test.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseKey(%q): %v", test.encoded, err)
+		} else if !key.Equal(ed25519.NewKeyFromSeed(testSeed)) {
+			t.Errorf("ParseKey(%q) returned a different key", test.encoded)
+		}
+	}
+}
+
+func TestAppendLinksEntries(t *testing.T) {
+	chain, err := NewChain(ChainConfig{
+		Key:    ed25519.NewKeyFromSeed(testSeed),
+		Accept: func(entry models.LogEntry) bool { return entry.Namespace != "dropped" },
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []models.LogEntry{
+		{ID: "a", Message: "first", AuditSeq: 99, Hash: "forged"},
+		{ID: "b", Message: "skipped", Namespace: "dropped", AuditSeq: 7, PrevHash: "x", Hash: "y"},
+		{ID: "c", Message: "second"},
+	}
+	committed := false
+	if err := chain.Append(entries, func() error { committed = true; return nil }); err != nil || !committed {
+		t.Fatalf("Append = %v, committed %v", err, committed)
+	}
+
+	if entries[0].AuditSeq != 1 || entries[0].PrevHash != "" || entries[0].Hash != Hash(entries[0]) {
+		t.Errorf("first entry = seq %d prev %q hash %q, want seq 1 with no previous hash and its own hash", entries[0].AuditSeq, entries[0].PrevHash, entries[0].Hash)
+	}
+	if entries[1].AuditSeq != 0 || entries[1].PrevHash != "" || entries[1].Hash != "" {
+		t.Errorf("unaccepted entry = seq %d prev %q hash %q, want it unchained", entries[1].AuditSeq, entries[1].PrevHash, entries[1].Hash)
+	}
+	if entries[2].AuditSeq != 2 || entries[2].PrevHash != entries[0].Hash || entries[2].Hash != Hash(entries[2]) {
+		t.Errorf("second entry = seq %d prev %q, want seq 2 linked to the first", entries[2].AuditSeq, entries[2].PrevHash)
+	}
+	if chain.Head() != 2 {
+		t.Errorf("Head = %d, want 2", chain.Head())
+	}
+
+	if err := chain.Append([]models.LogEntry{{ID: "d"}}, func() error { return fmt.Errorf("disk full") }); err == nil || err.Error() != "disk full" {
+		t.Errorf("Append = %v, want the commit error", err)
+	}
+}
+
+func TestHashCoversContentAndLinks(t *testing.T) {
+	entry := models.LogEntry{ID: "a", Message: "m", AuditSeq: 1, PrevHash: "p"}
+	hash := Hash(entry)
+	if len(hash) != 64 {
+		t.Fatalf("Hash = %q, want 64 hex digits", hash)
+	}
+	entry.Hash = "ignored"
+	if Hash(entry) != hash {
+		t.Error("Hash depends on the entry's own hash field")
+	}
+	for _, change := range []func(*models.LogEntry){
+		func(e *models.LogEntry) { e.Message = "M" },
+		func(e *models.LogEntry) { e.AuditSeq = 2 },
+		func(e *models.LogEntry) { e.PrevHash = "q" },
+		func(e *models.LogEntry) { e.Metadata = map[string]interface{}{"k": 1} },
+	} {
+		changed := entry
+		change(&changed)
+		if Hash(changed) == hash {
+			t.Errorf("Hash unchanged after changing %+v", changed)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(chain *Chain, stored []models.LogEntry) []models.LogEntry
+		valid   bool
+		problem string // In the first problem's reason
+		seq     uint64 // The first problem's sequence number
+	}{
+		{
+			name:   "intact",
+			tamper: func(_ *Chain, stored []models.LogEntry) []models.LogEntry { return stored },
+			valid:  true,
+		},
+		{
+			name:   "oldest evicted",
+			tamper: func(_ *Chain, stored []models.LogEntry) []models.LogEntry { return stored[2:] },
+			valid:  true,
+		},
+		{
+			name: "entries from before audit mode",
+			tamper: func(_ *Chain, stored []models.LogEntry) []models.LogEntry {
+				return append([]models.LogEntry{{ID: "old", Message: "unchained"}}, stored...)
+			},
+			valid: true,
+		},
+		{
+			name: "modified",
+			tamper: func(_ *Chain, stored []models.LogEntry) []models.LogEntry {
+				stored[2].Message = "nothing happened"
+				return stored
+			},
+			problem: "entry e3 was modified",
+			seq:     3,
+		},
+		{
+			name: "deleted from the middle",
+			tamper: func(_ *Chain, stored []models.LogEntry) []models.LogEntry {
+				return append(stored[:1:1], stored[3:]...)
+			},
+			problem: "entries 2 to 3 are missing",
+			seq:     2,
+		},
+		{
+			name: "newest deleted",
+			tamper: func(_ *Chain, stored []models.LogEntry) []models.LogEntry {
+				return stored[:4]
+			},
+			problem: "entries 5 to 6, the newest, are missing",
+			seq:     5,
+		},
+		{
+			name: "duplicated",
+			tamper: func(_ *Chain, stored []models.LogEntry) []models.LogEntry {
+				return append(stored, stored[5])
+			},
+			problem: "appears more than once",
+			seq:     6,
+		},
+		{
+			name: "replaced and rehashed",
+			tamper: func(_ *Chain, stored []models.LogEntry) []models.LogEntry {
+				stored[4].Message = "forged"
+				stored[4].Hash = Hash(stored[4])
+				return stored
+			},
+			problem: "entry e6 doesn't link to the entry before it",
+			seq:     6,
+		},
+		{
+			name: "rewritten from the start",
+			tamper: func(_ *Chain, stored []models.LogEntry) []models.LogEntry {
+				// Relinking every entry hides the edit from the hashes, but not from the checkpoint
+				stored[0].Message = "forged"
+				prev := ""
+				for i := range stored {
+					stored[i].PrevHash = prev
+					stored[i].Hash = Hash(stored[i])
+					prev = stored[i].Hash
+				}
+				return stored
+			},
+			problem: "chain was rewritten",
+			seq:     3,
+		},
+		{
+			name: "forged checkpoint",
+			tamper: func(chain *Chain, stored []models.LogEntry) []models.LogEntry {
+				chain.checkpoints[0].Hash = stored[1].Hash
+				return stored
+			},
+			problem: "checkpoint signature is invalid",
+			seq:     3,
+		},
+	}
+	for _, test := range tests {
+		chain, stored := newTestChain(t, ChainConfig{}, 6, 3)
+		entries := test.tamper(chain, stored)
+		report := chain.Verify(scanOf(entries))
+
+		if report.Valid != test.valid {
+			t.Errorf("%s: Valid = %v, want %v (problems %+v)", test.name, report.Valid, test.valid, report.Problems)
+			continue
+		}
+		if test.valid {
+			if len(report.Problems) != 0 {
+				t.Errorf("%s: problems %+v, want none", test.name, report.Problems)
+			}
+			continue
+		}
+		if len(report.Problems) == 0 || !strings.Contains(report.Problems[0].Reason, test.problem) || report.Problems[0].Seq != test.seq {
+			t.Errorf("%s: problems %+v, want the first at %d containing %q", test.name, report.Problems, test.seq, test.problem)
+		}
+	}
+}
+
+func TestVerifyReport(t *testing.T) {
+	chain, stored := newTestChain(t, ChainConfig{}, 6, 3)
+	entries := append([]models.LogEntry{{ID: "old"}}, stored[1:]...)
+	report := chain.Verify(scanOf(entries))
+
+	if !report.Valid || report.Entries != 5 || report.Unchained != 1 || report.FirstSeq != 2 || report.LastSeq != 6 || report.HeadSeq != 6 || report.Checkpoints != 1 {
+		t.Errorf("report = %+v, want 5 valid entries from 2 to 6, 1 unchained and 1 checkpoint checked", report)
+	}
+	if report.PublicKey != chain.PublicKey() {
+		t.Errorf("report key %q, want %q", report.PublicKey, chain.PublicKey())
+	}
+}
+
+func TestChainResumesFromCheckpointsAndStoredEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "checkpoints.jsonl")
+	chain, stored := newTestChain(t, ChainConfig{CheckpointPath: path}, 4, 2)
+	if err := chain.Stop(); err != nil { // Signs a last checkpoint at 4
+		t.Fatalf("Stop: %v", err)
+	}
+
+	// Restarted with every entry stored, e.g. replayed from the WAL
+	resumed, err := NewChain(ChainConfig{Key: ed25519.NewKeyFromSeed(testSeed), CheckpointPath: path}, scanOf(stored))
+	if err != nil {
+		t.Fatalf("NewChain: %v", err)
+	}
+	if resumed.Head() != 4 || len(resumed.checkpoints) != 2 {
+		t.Fatalf("resumed at %d with %d checkpoints, want 4 with 2", resumed.Head(), len(resumed.checkpoints))
+	}
+	next := []models.LogEntry{{ID: "e5", Message: "after restart"}}
+	resumed.Append(next, func() error { stored = append(stored, next...); return nil })
+	if next[0].AuditSeq != 5 || next[0].PrevHash != stored[3].Hash {
+		t.Errorf("first entry after restart = seq %d prev %q, want 5 linked to entry 4", next[0].AuditSeq, next[0].PrevHash)
+	}
+	if report := resumed.Verify(scanOf(stored)); !report.Valid || report.Checkpoints != 2 {
+		t.Errorf("report after restart = %+v, want valid with both checkpoints checked", report)
+	}
+
+	// Restarted with the entries lost, e.g. a memory store without a WAL
+	lost, err := NewChain(ChainConfig{Key: ed25519.NewKeyFromSeed(testSeed), CheckpointPath: path}, nil)
+	if err != nil {
+		t.Fatalf("NewChain: %v", err)
+	}
+	if lost.Head() != 4 {
+		t.Errorf("resumed at %d with nothing stored, want 4 from the checkpoint", lost.Head())
+	}
+	newer := []models.LogEntry{{ID: "n1"}}
+	lost.Append(newer, func() error { return nil })
+	if report := lost.Verify(scanOf(newer)); !report.Valid {
+		t.Errorf("report = %+v, want entries lost before the restart to count as evicted", report)
+	}
+}
+
+func TestNewChainRejectsCorruptCheckpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.jsonl")
+	os.WriteFile(path, []byte(`{"seq":1,"hash":"ab"}`+"\n\nnot json\n"), 0644)
+	if _, err := NewChain(ChainConfig{Key: ed25519.NewKeyFromSeed(testSeed), CheckpointPath: path}, nil); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("NewChain = %v, want an error for line 3", err)
+	}
+}
@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"logstream/pkg/models"
+	"sort"
+)
+
+// maxProblems caps the problems a report lists
+const maxProblems = 100
+
+// Problem is one sign of tampering found by Verify
+type Problem struct {
+	Seq    uint64 `json:"seq"`
+	Reason string `json:"reason"`
+}
+
+// Report is the result of verifying the stored entries against the chain
+type Report struct {
+	Valid       bool      `json:"valid"`
+	Entries     int       `json:"entries"`   // Chained entries checked
+	Unchained   int       `json:"unchained"` // Stored entries without a hash, from before audit mode
+	FirstSeq    uint64    `json:"first_seq"` // Oldest stored entry; older ones were evicted
+	LastSeq     uint64    `json:"last_seq"`
+	HeadSeq     uint64    `json:"head_seq"`    // Last sequence number the chain issued
+	Checkpoints int       `json:"checkpoints"` // Checkpoints checked against stored entries
+	Problems    []Problem `json:"problems"`    // The first 100 problems found
+	PublicKey   string    `json:"public_key"`  // Key the checkpoint signatures verify against
+}
+
+// link is what Verify keeps of a chained entry once its hash is checked
+type link struct {
+	seq      uint64
+	id       string
+	hash     string
+	prevHash string
+	modified bool // Its hash doesn't match its content
+}
+
+// Verify checks the entries scan passes on, e.g. every stored log, against
+// the chain: each entry's hash, its link to the previous entry, gaps in the
+// sequence and the signed checkpoints. Entries are hashed as they stream by
+// and only their links kept, so a full scan of a disk store fits in memory.
+// Entries before the oldest stored one count as evicted rather than deleted,
+// since the store evicts by design.
+func (c *Chain) Verify(scan func(fn func(models.LogEntry) bool)) Report {
+	// Read the head before the store, so entries chained meanwhile can't look deleted
+	headSeq := c.Head()
+	c.checkpointMu.Lock()
+	checkpoints := append([]Checkpoint(nil), c.checkpoints...)
+	c.checkpointMu.Unlock()
+
+	report := Report{HeadSeq: headSeq, Problems: []Problem{}, PublicKey: c.PublicKey()}
+	problem := func(seq uint64, format string, args ...interface{}) {
+		if len(report.Problems) < maxProblems {
+			report.Problems = append(report.Problems, Problem{Seq: seq, Reason: fmt.Sprintf(format, args...)})
+		}
+		report.Valid = false
+	}
+	report.Valid = true
+
+	var chained []link
+	scan(func(entry models.LogEntry) bool {
+		if entry.Hash == "" {
+			report.Unchained++
+			return true
+		}
+		chained = append(chained, link{
+			seq:      entry.AuditSeq,
+			id:       entry.ID,
+			hash:     entry.Hash,
+			prevHash: entry.PrevHash,
+			modified: Hash(entry) != entry.Hash,
+		})
+		return true
+	})
+	sort.SliceStable(chained, func(i, j int) bool { return chained[i].seq < chained[j].seq })
+	report.Entries = len(chained)
+
+	bySeq := make(map[uint64]string, len(chained))
+	for i, entry := range chained {
+		if entry.modified {
+			problem(entry.seq, "entry %s was modified: its hash doesn't match its content", entry.id)
+		}
+		if i == 0 {
+			bySeq[entry.seq] = entry.hash
+			continue
+		}
+
+		prev := chained[i-1]
+		switch {
+		case entry.seq == prev.seq:
+			problem(entry.seq, "sequence number appears more than once")
+		case entry.seq > prev.seq+1:
+			problem(prev.seq+1, "entries %d to %d are missing", prev.seq+1, entry.seq-1)
+		case entry.prevHash != prev.hash:
+			problem(entry.seq, "entry %s doesn't link to the entry before it", entry.id)
+		}
+		bySeq[entry.seq] = entry.hash
+	}
+
+	if len(chained) > 0 {
+		report.FirstSeq = chained[0].seq
+		report.LastSeq = chained[len(chained)-1].seq
+	}
+	// Entries chained before a restart may be gone for good, e.g. from a memory store without a WAL
+	if from := max(report.LastSeq, c.resumed) + 1; from <= headSeq {
+		problem(from, "entries %d to %d, the newest, are missing", from, headSeq)
+	}
+
+	publicKey := c.config.Key.Public().(ed25519.PublicKey)
+	tailMissing := false
+	for _, checkpoint := range checkpoints {
+		signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+		if err != nil || !ed25519.Verify(publicKey, checkpointMessage(checkpoint), signature) {
+			problem(checkpoint.Seq, "checkpoint signature is invalid")
+			continue
+		}
+		if len(chained) == 0 || checkpoint.Seq < report.FirstSeq {
+			continue // Evicted
+		}
+		if checkpoint.Seq > report.LastSeq {
+			if checkpoint.Seq <= c.resumed && !tailMissing {
+				// Stored before the restart and checkpointed, but gone since
+				problem(report.LastSeq+1, "entries %d to %d, checkpointed before the restart, are missing", report.LastSeq+1, c.resumed)
+				tailMissing = true
+			}
+			continue
+		}
+		hash, ok := bySeq[checkpoint.Seq]
+		if !ok {
+			continue // Reported missing above
+		}
+		report.Checkpoints++
+		if hash != checkpoint.Hash {
+			problem(checkpoint.Seq, "chain was rewritten: the entry differs from the one checkpointed at %s", checkpoint.Time.Format("2006-01-02T15:04:05Z"))
+		}
+	}
+	return report
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Role is the set of operations a token is allowed to perform
+type Role string
+
+// Role constants
+const (
+	RoleAdmin  Role = "admin"
+	RoleIngest Role = "ingest" // May only ingest entries for its Service
+)
+
+// Principal is the identity a request authenticated as
+type Principal struct {
+	Role    Role
+	Service string // Service an ingest token writes as
+}
+
+// principalKey is the context key for the authenticated Principal
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated principal
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal stored by WithPrincipal, if any
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// Authenticator maps bearer tokens to principals
+type Authenticator struct {
+	tokens map[string]Principal
+	mu     sync.RWMutex
+}
+
+// NewAuthenticator creates an authenticator with no tokens
+func NewAuthenticator() *Authenticator {
+	return &Authenticator{
+		tokens: make(map[string]Principal),
+	}
+}
+
+// AddToken registers a token for the given principal
+func (a *Authenticator) AddToken(token string, principal Principal) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tokens[token] = principal
+}
+
+// LoadServiceTokens adds ingest tokens from a file of "service token" lines.
+// Blank lines and lines starting with # are ignored.
+func (a *Authenticator) LoadServiceTokens(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	loaded := 0
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return loaded, fmt.Errorf("%s:%d: expected \"service token\"", path, lineNo)
+		}
+		a.AddToken(fields[1], Principal{Role: RoleIngest, Service: fields[0]})
+		loaded++
+	}
+	return loaded, scanner.Err()
+}
+
+// HasRole reports whether any token grants the given role
+func (a *Authenticator) HasRole(role Role) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, principal := range a.tokens {
+		if principal.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate resolves the request's bearer token to a principal
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, bool) {
+	return a.Lookup(bearerToken(r))
+}
+
+// Lookup resolves a token presented some other way, e.g. in a relay HELLO, to a principal
+func (a *Authenticator) Lookup(token string) (Principal, bool) {
+	if token == "" {
+		return Principal{}, false
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	// Constant-time compare so tokens can't be guessed byte by byte
+	for known, principal := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			return principal, true
+		}
+	}
+	return Principal{}, false
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
@@ -0,0 +1,57 @@
+package ingestion
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// BreakdownStats are ingestion counters for one input source or service
+type BreakdownStats struct {
+	Received  uint64  `json:"received"`
+	Processed uint64  `json:"processed"`
+	Dropped   uint64  `json:"dropped"`
+	Rejected  uint64  `json:"rejected"`
+	ErrorRate float64 `json:"error_rate"` // (dropped + rejected) / (received + rejected)
+}
+
+// breakdownCounters are the live atomic counters behind BreakdownStats
+type breakdownCounters struct {
+	received  uint64
+	processed uint64
+	dropped   uint64
+	rejected  uint64
+}
+
+// breakdown keeps counters per key (source or service) without a global lock
+type breakdown struct {
+	counters sync.Map // key -> *breakdownCounters
+}
+
+// get returns the counters for key, creating them on first use
+func (b *breakdown) get(key string) *breakdownCounters {
+	if c, ok := b.counters.Load(key); ok {
+		return c.(*breakdownCounters)
+	}
+	c, _ := b.counters.LoadOrStore(key, &breakdownCounters{})
+	return c.(*breakdownCounters)
+}
+
+// snapshot returns the current stats for every key
+func (b *breakdown) snapshot() map[string]BreakdownStats {
+	result := make(map[string]BreakdownStats)
+	b.counters.Range(func(key, value interface{}) bool {
+		c := value.(*breakdownCounters)
+		stats := BreakdownStats{
+			Received:  atomic.LoadUint64(&c.received),
+			Processed: atomic.LoadUint64(&c.processed),
+			Dropped:   atomic.LoadUint64(&c.dropped),
+			Rejected:  atomic.LoadUint64(&c.rejected),
+		}
+		if attempts := stats.Received + stats.Rejected; attempts > 0 {
+			stats.ErrorRate = float64(stats.Dropped+stats.Rejected) / float64(attempts)
+		}
+		result[key.(string)] = stats
+		return true
+	})
+	return result
+}
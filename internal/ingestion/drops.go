@@ -0,0 +1,115 @@
+package ingestion
+
+import (
+	"logstream/pkg/models"
+	"sync"
+	"time"
+)
+
+// DropReason explains why an entry never made it into the store
+type DropReason string
+
+// DropReason constants
+const (
+	DropQueueFull    DropReason = "queue_full"
+	DropValidation   DropReason = "validation"
+	DropQuota        DropReason = "quota"
+	DropParseFailure DropReason = "parse_failure"
+	DropUnauthorized DropReason = "unauthorized"
+)
+
+// maxSampleMessage bounds how much of a dropped message is kept in a sample
+const maxSampleMessage = 256
+
+// DropSample is a structured record of one dropped or rejected entry
+type DropSample struct {
+	Timestamp time.Time  `json:"timestamp"`
+	Reason    DropReason `json:"reason"`
+	Source    string     `json:"source,omitempty"`
+	Detail    string     `json:"detail,omitempty"`
+	ID        string     `json:"id,omitempty"`
+	Level     string     `json:"level,omitempty"`
+	Service   string     `json:"service,omitempty"`
+	Message   string     `json:"message,omitempty"`
+}
+
+// DropTracker counts drops per reason and keeps the most recent samples
+type DropTracker struct {
+	counts  map[DropReason]uint64
+	samples []DropSample // Ring buffer of the latest samples
+	next    int
+	full    bool
+	mu      sync.Mutex
+}
+
+// NewDropTracker creates a tracker keeping up to sampleSize samples
+func NewDropTracker(sampleSize int) *DropTracker {
+	return &DropTracker{
+		counts:  make(map[DropReason]uint64),
+		samples: make([]DropSample, sampleSize),
+	}
+}
+
+// Record counts a drop and samples it; entry may be nil when nothing could be parsed
+func (dt *DropTracker) Record(reason DropReason, source string, entry *models.LogEntry, detail string) {
+	sample := DropSample{
+		Timestamp: time.Now(),
+		Reason:    reason,
+		Source:    source,
+		Detail:    detail,
+	}
+	if entry != nil {
+		sample.ID = entry.ID
+		sample.Level = entry.Level
+		sample.Service = entry.Service
+		sample.Message = entry.Message
+		if len(sample.Message) > maxSampleMessage {
+			sample.Message = sample.Message[:maxSampleMessage] + "..."
+		}
+	}
+
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	dt.counts[reason]++
+	if len(dt.samples) == 0 {
+		return
+	}
+	dt.samples[dt.next] = sample
+	dt.next = (dt.next + 1) % len(dt.samples)
+	if dt.next == 0 {
+		dt.full = true
+	}
+}
+
+// Counts returns the number of drops per reason
+func (dt *DropTracker) Counts() map[DropReason]uint64 {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	result := make(map[DropReason]uint64, len(dt.counts))
+	for reason, count := range dt.counts {
+		result[reason] = count
+	}
+	return result
+}
+
+// Samples returns retained samples, newest first, optionally filtered by reason
+func (dt *DropTracker) Samples(reason DropReason) []DropSample {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	size := dt.next
+	if dt.full {
+		size = len(dt.samples)
+	}
+
+	result := make([]DropSample, 0, size)
+	for i := 1; i <= size; i++ {
+		sample := dt.samples[(dt.next-i+len(dt.samples))%len(dt.samples)]
+		if reason == "" || sample.Reason == reason {
+			result = append(result, sample)
+		}
+	}
+	return result
+}
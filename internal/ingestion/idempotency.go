@@ -0,0 +1,77 @@
+package ingestion
+
+import (
+	"sync"
+	"time"
+)
+
+// IdempotencyCache remembers recently accepted idempotency keys so client
+// retries aren't stored twice. It holds at most capacity keys, forgetting the
+// oldest first, and each key for at most ttl.
+type IdempotencyCache struct {
+	records map[string]idempotencyRecord
+	order   []string // Ring of keys in insertion order
+	next    int
+	ttl     time.Duration
+	mu      sync.Mutex
+}
+
+// idempotencyRecord is the entry ID a key was first accepted with
+type idempotencyRecord struct {
+	id   string
+	at   time.Time
+	slot int // Position in order, to tell a live key from a stale ring slot
+}
+
+// NewIdempotencyCache creates a cache of up to capacity keys kept for ttl
+func NewIdempotencyCache(capacity int, ttl time.Duration) *IdempotencyCache {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &IdempotencyCache{
+		records: make(map[string]idempotencyRecord, capacity),
+		order:   make([]string, capacity),
+		ttl:     ttl,
+	}
+}
+
+// Claim records key as accepted with the given entry ID. If the key was already
+// accepted within the TTL it returns the original ID and true instead.
+func (c *IdempotencyCache) Claim(key, id string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if record, ok := c.records[key]; ok {
+		if now.Sub(record.at) < c.ttl {
+			return record.id, true
+		}
+		delete(c.records, key)
+	}
+
+	// Evict whichever key still owns the slot we are about to reuse
+	if old := c.order[c.next]; old != "" {
+		if record, ok := c.records[old]; ok && record.slot == c.next {
+			delete(c.records, old)
+		}
+	}
+
+	c.order[c.next] = key
+	c.records[key] = idempotencyRecord{id: id, at: now, slot: c.next}
+	c.next = (c.next + 1) % len(c.order)
+	return id, false
+}
+
+// Release forgets a claimed key whose entry was not accepted after all, so a retry can succeed
+func (c *IdempotencyCache) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.records, key)
+}
+
+// Len returns the number of remembered keys
+func (c *IdempotencyCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.records)
+}
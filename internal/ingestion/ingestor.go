@@ -1,22 +1,61 @@
 package ingestion
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"logstream/internal/alerting"
+	"logstream/internal/audit"
 	"logstream/internal/storage"
 	"logstream/pkg/models"
+	"maps"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// Processor transforms an entry on the worker before it is stored
+type Processor interface {
+	Process(entry *models.LogEntry)
+}
+
+// Errors returned by IngestAcked
+var (
+	ErrQueueFull  = errors.New("ingest queue full")
+	ErrEvicted    = errors.New("evicted from full ingest queue")
+	ErrNotDurable = errors.New("stored, but the write-ahead log failed") // Wraps the WAL's error
+	ErrStopped    = errors.New("ingestor stopped")
+)
+
+// queuedEntry is an entry waiting for a worker; done is set when the caller waits for the store
+type queuedEntry struct {
+	entry models.LogEntry
+	done  chan error
+}
+
 // Ingestor handles concurrent log ingestion
 type Ingestor struct {
-	store        *storage.MemoryStore
+	store        storage.Store
+	wal          *storage.WAL
+	chain        *audit.Chain
 	alertManager *alerting.AlertManager
-	logChannel   chan models.LogEntry
+	logChannel   chan queuedEntry
+	evictable    chan queuedEntry // Entries drop-oldest may evict; nil unless a level has that policy
+	slots        chan struct{}    // Holds a token per queued entry, capping both queues together
 	workerCount  int
+	nodeID       string
+	processors   []Processor
+	listeners    []func(models.LogEntry)
 	wg           sync.WaitGroup
 	stats        *Stats
+	bySource     breakdown
+	byService    breakdown
+	rates        rateCounter
+	drops        *DropTracker
+	overflow     OverflowConfig
+	stopMu       sync.RWMutex // Held for reading while queueing, so Stop never closes a queue mid-send
+	stopped      bool
 	shutdown     chan struct{}
 }
 
@@ -24,23 +63,64 @@ type Ingestor struct {
 type Stats struct {
 	TotalProcessed uint64
 	TotalDropped   uint64
+	WALFailures    uint64 // Entries stored in memory that couldn't be written to the WAL
 	StartTime      time.Time
+	BySource       map[string]BreakdownStats // Input source (http, stdin, udp, ...) -> counters
+	ByService      map[string]BreakdownStats // Service -> counters
 }
 
 // NewIngestor creates a new log ingestor
-func NewIngestor(store *storage.MemoryStore, alertMgr *alerting.AlertManager, workerCount int, bufferSize int) *Ingestor {
+func NewIngestor(store storage.Store, alertMgr *alerting.AlertManager, workerCount int, bufferSize int) *Ingestor {
 	return &Ingestor{
 		store:        store,
 		alertManager: alertMgr,
-		logChannel:   make(chan models.LogEntry, bufferSize),
+		logChannel:   make(chan queuedEntry, bufferSize),
+		slots:        make(chan struct{}, bufferSize),
 		workerCount:  workerCount,
 		stats: &Stats{
 			StartTime: time.Now(),
 		},
+		drops:    NewDropTracker(100),
 		shutdown: make(chan struct{}),
 	}
 }
 
+// SetNodeID sets the node ID stamped on every entry this ingestor stores
+func (ing *Ingestor) SetNodeID(nodeID string) {
+	ing.nodeID = nodeID
+}
+
+// SetWAL makes every entry get appended to the write-ahead log before it is stored. Call before Start.
+func (ing *Ingestor) SetWAL(wal *storage.WAL) {
+	ing.wal = wal
+}
+
+// SetAuditChain chains every entry into chain before it is written ahead and
+// stored, in chain order. Call before Start.
+func (ing *Ingestor) SetAuditChain(chain *audit.Chain) {
+	ing.chain = chain
+}
+
+// SetOverflowConfig chooses what happens when the queue is full. Call before Start.
+func (ing *Ingestor) SetOverflowConfig(config OverflowConfig) {
+	ing.overflow = config
+	if config.Default == OverflowDropOldest || slices.Contains(slices.Collect(maps.Values(config.ByLevel)), OverflowDropOldest) {
+		ing.evictable = make(chan queuedEntry, cap(ing.slots))
+	}
+}
+
+// AddProcessor registers a processor run on every entry before it is stored, in registration order.
+// Register processors before Start.
+func (ing *Ingestor) AddProcessor(processor Processor) {
+	ing.processors = append(ing.processors, processor)
+}
+
+// AddListener registers a function called with every stored entry.
+// Listeners run on the worker goroutines so they must not block; register them before Start.
+func (ing *Ingestor) AddListener(listener func(models.LogEntry)) {
+	ing.listeners = append(ing.listeners, listener)
+}
+
 // Start begins the ingestion workers
 func (ing *Ingestor) Start() {
 	for i := 0; i < ing.workerCount; i++ {
@@ -52,42 +132,300 @@ func (ing *Ingestor) Start() {
 	go ing.reportStats()
 }
 
-// Ingest adds a log entry to the processing queue (non-blocking)
+// Ingest adds a log entry to the processing queue. It never blocks unless the
+// overflow policy for the entry's level is "block". The entry is stamped with
+// this node whatever node the client claimed.
 func (ing *Ingestor) Ingest(entry models.LogEntry) bool {
+	entry.Node = ing.nodeID
+	return ing.enqueue(queuedEntry{entry: entry})
+}
+
+// IngestForwarded queues an entry another node already ingested, as replication
+// and relay deliver them, keeping the node it was stamped with there
+func (ing *Ingestor) IngestForwarded(entry models.LogEntry) bool {
+	if entry.Node == "" {
+		entry.Node = ing.nodeID
+	}
+	return ing.enqueue(queuedEntry{entry: entry})
+}
+
+// IngestAcked queues an entry and waits until a worker has stored it, so a nil
+// error means the entry is in the store rather than merely queued
+func (ing *Ingestor) IngestAcked(ctx context.Context, entry models.LogEntry) error {
+	entry.Node = ing.nodeID
+	done := make(chan error, 1)
+	if !ing.enqueue(queuedEntry{entry: entry, done: done}) {
+		if ing.isStopped() {
+			return ErrStopped
+		}
+		return ErrQueueFull
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue applies the overflow policy when the queue is full. Entries whose
+// level has the drop-oldest policy wait in their own queue, so that policy
+// only ever evicts them; with none queued, the incoming entry is refused.
+// Entries arriving after Stop are refused too.
+func (ing *Ingestor) enqueue(item queuedEntry) bool {
+	entry := item.entry
+	atomic.AddUint64(&ing.bySource.get(sourceKey(entry.Source)).received, 1)
+	atomic.AddUint64(&ing.byService.get(entry.Service).received, 1)
+
+	ing.stopMu.RLock()
+	defer ing.stopMu.RUnlock()
+	if ing.stopped {
+		ing.recordDropped(entry, "ingestor stopped")
+		return false
+	}
+
+	policy := ing.overflow.policyFor(entry.Level)
+	queue := ing.logChannel
+	if policy == OverflowDropOldest {
+		queue = ing.evictable
+	}
+
 	select {
-	case ing.logChannel <- entry:
+	case ing.slots <- struct{}{}:
+		queue <- item
 		return true
 	default:
-		// Channel full, drop log and increment counter
-		atomic.AddUint64(&ing.stats.TotalDropped, 1)
-		return false
 	}
+
+	// Queue full: apply the overflow policy for this level
+	switch policy {
+	case OverflowDropOldest:
+		select {
+		case oldest := <-ing.evictable:
+			// The evicted entry's slot goes to the incoming one
+			ing.recordDropped(oldest.entry, "evicted from full queue by drop-oldest policy")
+			if oldest.done != nil {
+				oldest.done <- ErrEvicted
+			}
+			queue <- item
+			return true
+		default:
+		}
+
+	case OverflowBlock:
+		timer := time.NewTimer(ing.overflow.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case ing.slots <- struct{}{}:
+			queue <- item
+			return true
+		case <-timer.C:
+			ing.recordDropped(entry, fmt.Sprintf("ingest queue still full after %v", ing.overflow.BlockTimeout))
+			return false
+		}
+	}
+
+	ing.recordDropped(entry, "ingest queue full")
+	return false
+}
+
+// recordDropped counts an entry lost to a full queue
+func (ing *Ingestor) recordDropped(entry models.LogEntry, detail string) {
+	atomic.AddUint64(&ing.stats.TotalDropped, 1)
+	atomic.AddUint64(&ing.bySource.get(sourceKey(entry.Source)).dropped, 1)
+	atomic.AddUint64(&ing.byService.get(entry.Service).dropped, 1)
+	ing.drops.Record(DropQueueFull, entry.Source, &entry, detail)
+}
+
+// RecordRejected records an entry rejected by a source before it reached the queue (bad input, quota, ...).
+// entry may be nil when nothing could be parsed.
+func (ing *Ingestor) RecordRejected(source string, reason DropReason, entry *models.LogEntry, detail string) {
+	atomic.AddUint64(&ing.bySource.get(sourceKey(source)).rejected, 1)
+	if entry != nil {
+		atomic.AddUint64(&ing.byService.get(entry.Service).rejected, 1)
+	}
+	ing.drops.Record(reason, source, entry, detail)
 }
 
-// worker processes logs from the channel
+// sourceKey names entries whose source wasn't stamped
+func sourceKey(source string) string {
+	if source == "" {
+		return "unknown"
+	}
+	return source
+}
+
+// Drops returns the per-reason drop counters and samples
+func (ing *Ingestor) Drops() *DropTracker {
+	return ing.drops
+}
+
+// workerBatchSize caps how many queued entries a worker stores together
+const workerBatchSize = 64
+
+// worker processes logs from the queues, coalescing whatever is already
+// queued into a batch so the WAL and store locks are taken once per batch.
+// It returns once Stop has closed both queues and they are empty.
 func (ing *Ingestor) worker(id int) {
 	defer ing.wg.Done()
 
-	for {
+	batch := make([]queuedEntry, 0, workerBatchSize)
+	entries := make([]models.LogEntry, 0, workerBatchSize)
+	logChannel, evictable := ing.logChannel, ing.evictable
+	for logChannel != nil || evictable != nil {
+		var item queuedEntry
+		var ok bool
 		select {
-		case log := <-ing.logChannel:
-			// Store the log (fast in-memory operation)
-			ing.store.Store(log)
-
-			// Process for alerts (async, non-blocking)
-			if ing.alertManager != nil {
-				ing.alertManager.ProcessLog(log)
+		case item, ok = <-logChannel:
+			if !ok {
+				logChannel = nil
+				continue
 			}
+		case item, ok = <-evictable:
+			if !ok {
+				evictable = nil
+				continue
+			}
+		}
+		<-ing.slots
+		batch = append(batch[:0], item)
+		ing.drain(&batch)
 
-			// Update stats
-			atomic.AddUint64(&ing.stats.TotalProcessed, 1)
+		entries = entries[:0]
+		for _, item := range batch {
+			entries = append(entries, item.entry)
+		}
+		ing.acknowledge(batch, ing.process(entries, true))
+	}
+}
 
-		case <-ing.shutdown:
+// acknowledge tells the callers waiting on a stored batch how it went, once
+// the WAL, if any, has fsynced it
+func (ing *Ingestor) acknowledge(batch []queuedEntry, err error) {
+	var waiting []chan error
+	for _, item := range batch {
+		if item.done != nil {
+			waiting = append(waiting, item.done)
+		}
+	}
+	if len(waiting) == 0 {
+		return
+	}
+	if err != nil || ing.wal == nil {
+		for _, done := range waiting {
+			done <- err
+		}
+		return
+	}
+	// Wait for the next periodic sync off the worker, so it keeps storing
+	synced := ing.wal.Synced()
+	go func() {
+		err := <-synced
+		if err != nil {
+			err = fmt.Errorf("%w: %v", ErrNotDurable, err)
+		}
+		for _, done := range waiting {
+			done <- err
+		}
+	}()
+}
+
+// drain adds queued entries to the batch until it is full or the queues are
+// empty, never waiting for more
+func (ing *Ingestor) drain(batch *[]queuedEntry) {
+	for len(*batch) < workerBatchSize {
+		var item queuedEntry
+		var ok bool
+		select {
+		case item, ok = <-ing.logChannel:
+		case item, ok = <-ing.evictable:
+		default:
+			return
+		}
+		if !ok {
 			return
 		}
+		<-ing.slots
+		*batch = append(*batch, item)
 	}
 }
 
+// process runs a batch of entries through the pipeline; backfilled entries skip alert evaluation.
+// The error, an ErrNotDurable, reports a failed WAL append; the entries are still stored.
+func (ing *Ingestor) process(logs []models.LogEntry, evaluateAlerts bool) error {
+	for i := range logs {
+		// Only the audit chain sets these
+		logs[i].AuditSeq, logs[i].PrevHash, logs[i].Hash = 0, "", ""
+
+		// Enrich the entry (parse structured messages, ...)
+		for _, processor := range ing.processors {
+			processor.Process(&logs[i])
+		}
+	}
+
+	var walErr error
+	if ing.chain != nil {
+		walErr = ing.chain.Append(logs, func() error { return ing.commit(logs) })
+	} else {
+		walErr = ing.commit(logs)
+	}
+
+	for _, log := range logs {
+		// Process for alerts (async, non-blocking)
+		if evaluateAlerts && ing.alertManager != nil {
+			ing.alertManager.ProcessLog(log)
+		}
+
+		// Notify listeners (replication, live tails, ...)
+		for _, listener := range ing.listeners {
+			listener(log)
+		}
+
+		// Update stats
+		atomic.AddUint64(&ing.stats.TotalProcessed, 1)
+		atomic.AddUint64(&ing.bySource.get(sourceKey(log.Source)).processed, 1)
+		atomic.AddUint64(&ing.byService.get(log.Service).processed, 1)
+	}
+	// Backfilled history isn't live traffic, so it stays out of /rate
+	if evaluateAlerts {
+		ing.rates.addAll(logs, time.Now())
+	}
+	return walErr
+}
+
+// commit writes entries ahead and stores them, reporting a failed WAL append
+func (ing *Ingestor) commit(logs []models.LogEntry) error {
+	// Write ahead so the entries survive a restart
+	var walErr error
+	if ing.wal != nil {
+		if walErr = ing.wal.AppendBatch(logs); walErr != nil {
+			failed := uint64(len(logs))
+			failures := atomic.AddUint64(&ing.stats.WALFailures, failed)
+			// Warn on the first failure and then about once per thousand
+			if failures == failed || (failures-failed)/1000 != failures/1000 {
+				fmt.Printf("⚠️  WAL append failed (%d so far): %v\n", failures, walErr)
+			}
+		}
+	}
+
+	// Store the logs (fast in-memory operation, one lock per shard)
+	ing.store.StoreBatch(logs)
+	if walErr != nil {
+		return fmt.Errorf("%w: %v", ErrNotDurable, walErr)
+	}
+	return nil
+}
+
+// Backfill stores a historical entry synchronously, indexed under its own
+// timestamp and without alert evaluation, so re-imported history can't fire alerts
+func (ing *Ingestor) Backfill(entry models.LogEntry) error {
+	atomic.AddUint64(&ing.bySource.get(sourceKey(entry.Source)).received, 1)
+	atomic.AddUint64(&ing.byService.get(entry.Service).received, 1)
+	entry.Node = ing.nodeID
+	return ing.process([]models.LogEntry{entry}, false)
+}
+
 // reportStats prints throughput statistics every 10 seconds
 func (ing *Ingestor) reportStats() {
 	ticker := time.NewTicker(10 * time.Second)
@@ -129,11 +467,30 @@ func (ing *Ingestor) reportStats() {
 	}
 }
 
-// Stop gracefully shuts down the ingestor
+// Stop refuses further entries and waits for the workers to store what is
+// queued, signalling acked callers as they do. Stop sources before calling it.
 func (ing *Ingestor) Stop() {
-	close(ing.shutdown)
+	ing.stopMu.Lock()
+	if ing.stopped {
+		ing.stopMu.Unlock()
+		return
+	}
+	ing.stopped = true
 	close(ing.logChannel)
+	if ing.evictable != nil {
+		close(ing.evictable)
+	}
+	ing.stopMu.Unlock()
+
 	ing.wg.Wait()
+	close(ing.shutdown)
+}
+
+// isStopped reports whether Stop has been called
+func (ing *Ingestor) isStopped() bool {
+	ing.stopMu.RLock()
+	defer ing.stopMu.RUnlock()
+	return ing.stopped
 }
 
 // GetStats returns current ingestion statistics
@@ -141,6 +498,17 @@ func (ing *Ingestor) GetStats() Stats {
 	return Stats{
 		TotalProcessed: atomic.LoadUint64(&ing.stats.TotalProcessed),
 		TotalDropped:   atomic.LoadUint64(&ing.stats.TotalDropped),
+		WALFailures:    atomic.LoadUint64(&ing.stats.WALFailures),
 		StartTime:      ing.stats.StartTime,
+		BySource:       ing.bySource.snapshot(),
+		ByService:      ing.byService.snapshot(),
+	}
+}
+
+// QueueUsage returns how full the ingestion buffer is, from 0 to 1
+func (ing *Ingestor) QueueUsage() float64 {
+	if cap(ing.slots) == 0 {
+		return 0
 	}
+	return float64(len(ing.slots)) / float64(cap(ing.slots))
 }
@@ -0,0 +1,222 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"logstream/internal/storage"
+	"logstream/pkg/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestIngestor returns an ingestor with one worker, not yet started, so
+// entries stay queued until the test starts it
+func newTestIngestor(t *testing.T, buffer int, config OverflowConfig) (*Ingestor, *storage.MemoryStore) {
+	t.Helper()
+	store := storage.NewMemoryStore(1000)
+	ing := NewIngestor(store, nil, 1, buffer)
+	ing.SetOverflowConfig(config)
+	return ing, store
+}
+
+func entry(level, message string) models.LogEntry {
+	return models.LogEntry{ID: message, Level: level, Message: message, Timestamp: time.Now()}
+}
+
+// storedMessages starts the ingestor, stops it once it has stored what was
+// queued, and returns the stored messages by level, in storage order
+func storedMessages(ing *Ingestor, store *storage.MemoryStore) map[string][]string {
+	ing.Start()
+	ing.Stop()
+	result := make(map[string][]string)
+	for _, log := range store.GetRecent(store.Count()) {
+		result[log.Level] = append(result[log.Level], log.Message)
+	}
+	return result
+}
+
+func TestOverflowRejectNewest(t *testing.T) {
+	ing, store := newTestIngestor(t, 2, OverflowConfig{})
+	for i, message := range []string{"a", "b", "c", "d"} {
+		if got, want := ing.Ingest(entry(models.LevelInfo, message)), i < 2; got != want {
+			t.Errorf("Ingest(%s) = %v, want %v", message, got, want)
+		}
+	}
+
+	stats := ing.GetStats()
+	if stats.TotalDropped != 2 || stats.BySource["unknown"].Dropped != 2 {
+		t.Errorf("dropped %d, %d by source, want 2", stats.TotalDropped, stats.BySource["unknown"].Dropped)
+	}
+	if counts := ing.Drops().Counts(); counts[DropQueueFull] != 2 {
+		t.Errorf("drop counts = %v, want 2 queue_full", counts)
+	}
+	samples := ing.Drops().Samples(DropQueueFull)
+	if len(samples) != 2 || samples[0].Message != "d" || samples[1].Message != "c" {
+		t.Errorf("samples = %+v, want d and c, newest first", samples)
+	}
+
+	if got, want := storedMessages(ing, store), map[string][]string{models.LevelInfo: {"a", "b"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	ing, store := newTestIngestor(t, 3, OverflowConfig{
+		Default: OverflowRejectNewest,
+		ByLevel: map[string]OverflowPolicy{models.LevelInfo: OverflowDropOldest},
+	})
+
+	// An acked entry learns it was evicted
+	evicted := make(chan error, 1)
+	go func() { evicted <- ing.IngestAcked(context.Background(), entry(models.LevelInfo, "i1")) }()
+	for ing.QueueUsage() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	steps := []struct {
+		entry    models.LogEntry
+		accepted bool
+	}{
+		{entry(models.LevelError, "e1"), true},
+		{entry(models.LevelInfo, "i2"), true},
+		{entry(models.LevelInfo, "i3"), true},   // Evicts i1
+		{entry(models.LevelError, "e2"), false}, // ERROR rejects the newest
+		{entry(models.LevelInfo, "i4"), true},   // Evicts i2
+	}
+	for _, step := range steps {
+		if got := ing.Ingest(step.entry); got != step.accepted {
+			t.Errorf("Ingest(%s) = %v, want %v", step.entry.Message, got, step.accepted)
+		}
+	}
+
+	select {
+	case err := <-evicted:
+		if !errors.Is(err, ErrEvicted) {
+			t.Errorf("IngestAcked of the evicted entry = %v, want ErrEvicted", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("IngestAcked of the evicted entry never returned")
+	}
+
+	if dropped := ing.GetStats().TotalDropped; dropped != 3 {
+		t.Errorf("dropped %d, want i1, e2 and i2", dropped)
+	}
+	var order []string
+	for _, sample := range ing.Drops().Samples(DropQueueFull) {
+		order = append(order, sample.Message)
+	}
+	if want := []string{"i2", "e2", "i1"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("drop samples = %v, want %v", order, want)
+	}
+
+	want := map[string][]string{models.LevelError: {"e1"}, models.LevelInfo: {"i3", "i4"}}
+	if got := storedMessages(ing, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+}
+
+func TestOverflowDropOldestOnlyEvictsItsOwnLevel(t *testing.T) {
+	ing, store := newTestIngestor(t, 2, OverflowConfig{
+		Default: OverflowRejectNewest,
+		ByLevel: map[string]OverflowPolicy{models.LevelInfo: OverflowDropOldest},
+	})
+	ing.Ingest(entry(models.LevelError, "e1"))
+	ing.Ingest(entry(models.LevelError, "e2"))
+
+	// Nothing of a drop-oldest level is queued, so the incoming entry goes
+	if ing.Ingest(entry(models.LevelInfo, "i1")) {
+		t.Error("Ingest(i1) evicted an ERROR entry")
+	}
+	want := map[string][]string{models.LevelError: {"e1", "e2"}}
+	if got := storedMessages(ing, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	ing, store := newTestIngestor(t, 1, OverflowConfig{Default: OverflowBlock, BlockTimeout: 50 * time.Millisecond})
+	ing.Ingest(entry(models.LevelInfo, "a"))
+
+	start := time.Now()
+	if ing.Ingest(entry(models.LevelInfo, "b")) {
+		t.Error("Ingest(b) found room in a full queue no one empties")
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("Ingest(b) gave up after %v, want the 50ms block timeout", waited)
+	}
+	if counts := ing.Drops().Counts(); counts[DropQueueFull] != 1 {
+		t.Errorf("drop counts = %v, want 1 queue_full", counts)
+	}
+
+	// Room made while it waits lets the entry in
+	ing.overflow.BlockTimeout = 5 * time.Second
+	time.AfterFunc(20*time.Millisecond, ing.Start)
+	if !ing.Ingest(entry(models.LevelInfo, "c")) {
+		t.Error("Ingest(c) was refused although a worker made room")
+	}
+	ing.Stop()
+	if got, want := store.Count(), 2; got != want {
+		t.Errorf("stored %d entries, want a and c", got)
+	}
+}
+
+func TestStopStoresQueuedEntries(t *testing.T) {
+	ing, store := newTestIngestor(t, 100, OverflowConfig{})
+	results := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		go func() { results <- ing.IngestAcked(context.Background(), entry(models.LevelInfo, "acked")) }()
+		ing.Ingest(entry(models.LevelInfo, "plain"))
+	}
+	for ing.QueueUsage() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ing.Start()
+	ing.Stop()
+	if got := store.Count(); got != 100 {
+		t.Errorf("stored %d entries, want all 100 queued before Stop", got)
+	}
+	for i := 0; i < 50; i++ {
+		select {
+		case err := <-results:
+			if err != nil {
+				t.Errorf("IngestAcked = %v, want nil", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d acked entries were never answered", 50-i)
+		}
+	}
+
+	if ing.Ingest(entry(models.LevelInfo, "late")) {
+		t.Error("Ingest after Stop was accepted")
+	}
+	if err := ing.IngestAcked(context.Background(), entry(models.LevelInfo, "late")); !errors.Is(err, ErrStopped) {
+		t.Errorf("IngestAcked after Stop = %v, want ErrStopped", err)
+	}
+	ing.Stop() // A second Stop is harmless
+}
+
+func TestNodeStamping(t *testing.T) {
+	ing, store := newTestIngestor(t, 10, OverflowConfig{})
+	ing.SetNodeID("node-1")
+
+	claimed := entry(models.LevelInfo, "claimed")
+	claimed.Node = "spoofed"
+	ing.Ingest(claimed)
+	forwarded := entry(models.LevelInfo, "forwarded")
+	forwarded.Node = "node-2"
+	ing.IngestForwarded(forwarded)
+	ing.IngestForwarded(entry(models.LevelInfo, "unstamped"))
+
+	ing.Start()
+	ing.Stop()
+	got := make(map[string]string)
+	for _, log := range store.GetRecent(store.Count()) {
+		got[log.Message] = log.Node
+	}
+	want := map[string]string{"claimed": "node-1", "forwarded": "node-2", "unstamped": "node-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nodes = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package ingestion
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OverflowPolicy decides what happens to an entry when the ingest queue is full
+type OverflowPolicy string
+
+// OverflowPolicy constants
+const (
+	OverflowRejectNewest OverflowPolicy = "reject-newest" // Refuse the incoming entry
+	OverflowDropOldest   OverflowPolicy = "drop-oldest"   // Evict the oldest queued entry to make room
+	OverflowBlock        OverflowPolicy = "block"         // Wait up to BlockTimeout for room
+)
+
+// OverflowConfig selects overflow policies, optionally per level
+type OverflowConfig struct {
+	Default      OverflowPolicy
+	ByLevel      map[string]OverflowPolicy
+	BlockTimeout time.Duration
+}
+
+// policyFor returns the policy that applies to a level
+func (oc OverflowConfig) policyFor(level string) OverflowPolicy {
+	if policy, ok := oc.ByLevel[level]; ok {
+		return policy
+	}
+	if oc.Default == "" {
+		return OverflowRejectNewest
+	}
+	return oc.Default
+}
+
+// ParseOverflowPolicy validates a policy name
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(name); policy {
+	case OverflowRejectNewest, OverflowDropOldest, OverflowBlock:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy %q (expected reject-newest, drop-oldest or block)", name)
+	}
+}
+
+// ParseLevelPolicies parses "ERROR=block,INFO=drop-oldest" into per-level policies
+func ParseLevelPolicies(spec string) (map[string]OverflowPolicy, error) {
+	result := make(map[string]OverflowPolicy)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid level policy %q (expected LEVEL=policy)", item)
+		}
+		policy, err := ParseOverflowPolicy(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		result[strings.ToUpper(strings.TrimSpace(parts[0]))] = policy
+	}
+	return result, nil
+}
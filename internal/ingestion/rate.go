@@ -0,0 +1,76 @@
+package ingestion
+
+import (
+	"logstream/pkg/models"
+	"sync"
+	"time"
+)
+
+// MaxRateWindow is the longest window Rates can count over
+const MaxRateWindow = 15 * time.Minute
+
+// rateSlots is one counter slot per second of MaxRateWindow, plus the
+// current, partial second
+const rateSlots = int(MaxRateWindow/time.Second) + 1
+
+// RateKey is what processed entries are counted by
+type RateKey struct {
+	Level   string
+	Service string
+}
+
+// rateSlot counts the entries processed in one second
+type rateSlot struct {
+	second int64 // Unix second the counts are for
+	counts map[RateKey]uint64
+}
+
+// rateCounter counts processed entries per second in a ring of slots, so the
+// count over any recent window is a sum of at most rateSlots slots
+type rateCounter struct {
+	mu    sync.Mutex
+	slots [rateSlots]rateSlot
+}
+
+// addAll counts a batch of entries processed at now
+func (rc *rateCounter) addAll(logs []models.LogEntry, now time.Time) {
+	second := now.Unix()
+	slot := &rc.slots[second%int64(rateSlots)]
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if slot.second != second || slot.counts == nil {
+		// The slot last counted a second that has left the ring
+		slot.second = second
+		slot.counts = make(map[RateKey]uint64, len(slot.counts))
+	}
+	for _, log := range logs {
+		slot.counts[RateKey{Level: log.Level, Service: log.Service}]++
+	}
+}
+
+// sum counts the entries processed in the whole seconds of window before now
+func (rc *rateCounter) sum(window time.Duration, now time.Time) map[RateKey]uint64 {
+	seconds := int64(min(max(window, time.Second), MaxRateWindow) / time.Second)
+	current := now.Unix()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	totals := make(map[RateKey]uint64)
+	for second := current - seconds; second < current; second++ {
+		slot := &rc.slots[second%int64(rateSlots)]
+		if slot.second != second {
+			continue
+		}
+		for key, count := range slot.counts {
+			totals[key] += count
+		}
+	}
+	return totals
+}
+
+// Rates returns how many entries were processed in the last window (whole
+// seconds, at most MaxRateWindow) per level and service
+func (ing *Ingestor) Rates(window time.Duration) map[RateKey]uint64 {
+	return ing.rates.sum(window, time.Now())
+}
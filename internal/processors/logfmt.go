@@ -0,0 +1,137 @@
+package processors
+
+import (
+	"logstream/pkg/models"
+	"strings"
+)
+
+// minLogfmtPairs is how many key=value pairs a message needs to be treated as logfmt,
+// so prose like "retry=3 failed" isn't mistaken for structured output
+const minLogfmtPairs = 2
+
+// LogfmtProcessor promotes key=value pairs from logfmt messages into Metadata
+type LogfmtProcessor struct {
+	allowlist map[string]bool // Keys to promote; nil promotes every key
+}
+
+// NewLogfmtProcessor creates a processor promoting only the given keys (all keys if none given)
+func NewLogfmtProcessor(allowedKeys []string) *LogfmtProcessor {
+	lp := &LogfmtProcessor{}
+	if len(allowedKeys) > 0 {
+		lp.allowlist = make(map[string]bool, len(allowedKeys))
+		for _, key := range allowedKeys {
+			lp.allowlist[key] = true
+		}
+	}
+	return lp
+}
+
+// Process parses the message and copies allowed pairs into Metadata without
+// overwriting fields the producer already set
+func (lp *LogfmtProcessor) Process(entry *models.LogEntry) {
+	pairs, ok := ParseLogfmt(entry.Message)
+	if !ok || len(pairs) < minLogfmtPairs {
+		return
+	}
+
+	for _, pair := range pairs {
+		if lp.allowlist != nil && !lp.allowlist[pair.Key] {
+			continue
+		}
+		if entry.Metadata == nil {
+			entry.Metadata = make(map[string]interface{})
+		}
+		if _, exists := entry.Metadata[pair.Key]; !exists {
+			entry.Metadata[pair.Key] = pair.Value
+		}
+	}
+}
+
+// LogfmtPair is a single key=value from a logfmt line
+type LogfmtPair struct {
+	Key   string
+	Value string
+}
+
+// ParseLogfmt parses a logfmt line such as `level=info msg="user logged in" user_id=42`.
+// It returns false if the line is not well-formed logfmt.
+func ParseLogfmt(line string) ([]LogfmtPair, bool) {
+	pairs := make([]LogfmtPair, 0)
+	i := 0
+	n := len(line)
+
+	for i < n {
+		// Skip whitespace between pairs
+		for i < n && line[i] == ' ' {
+			i++
+		}
+		if i >= n {
+			break
+		}
+
+		// Key runs until '=' or whitespace
+		start := i
+		for i < n && line[i] != '=' && line[i] != ' ' && line[i] != '"' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return nil, false
+		}
+
+		// Bare words are allowed by some logfmt writers but make prose look structured, so reject them
+		if i >= n || line[i] != '=' {
+			return nil, false
+		}
+		i++
+
+		// Value is either quoted (with escapes) or runs until whitespace
+		if i < n && line[i] == '"' {
+			i++
+			var value strings.Builder
+			closed := false
+			for i < n {
+				c := line[i]
+				if c == '\\' && i+1 < n {
+					value.WriteByte(unescape(line[i+1]))
+					i += 2
+					continue
+				}
+				if c == '"' {
+					closed = true
+					i++
+					break
+				}
+				value.WriteByte(c)
+				i++
+			}
+			if !closed || (i < n && line[i] != ' ') {
+				return nil, false
+			}
+			pairs = append(pairs, LogfmtPair{Key: key, Value: value.String()})
+		} else {
+			start = i
+			for i < n && line[i] != ' ' {
+				if line[i] == '"' || line[i] == '=' {
+					return nil, false
+				}
+				i++
+			}
+			pairs = append(pairs, LogfmtPair{Key: key, Value: line[start:i]})
+		}
+	}
+
+	return pairs, len(pairs) > 0
+}
+
+// unescape maps the character after a backslash to what it stands for
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	default:
+		return c
+	}
+}
@@ -0,0 +1,151 @@
+package processors
+
+import (
+	"logstream/pkg/models"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxStitchedLines caps how many lines are joined into one entry so a source
+// that never emits a start-of-record line can't grow an entry forever
+const maxStitchedLines = 1000
+
+// Stitcher joins continuation lines (stack traces, SQL dumps, ...) onto the
+// preceding start-of-record line before handing the entry on
+type Stitcher struct {
+	start    *regexp.Regexp
+	timeout  time.Duration
+	emit     func(models.LogEntry) bool
+	pending  map[string]*pendingRecord // stream key -> record being assembled
+	mu       sync.Mutex
+	shutdown chan struct{}
+	dropped  atomic.Uint64 // Records flushed by timeout or Flush that emit rejected
+}
+
+// pendingRecord is a record that may still receive continuation lines
+type pendingRecord struct {
+	entry    models.LogEntry
+	lines    []string
+	lastSeen time.Time
+}
+
+// NewStitcher creates a stitcher; lines matching start begin a new record, everything
+// else is appended to the current one. Records are flushed to emit after timeout of inactivity.
+func NewStitcher(start *regexp.Regexp, timeout time.Duration, emit func(models.LogEntry) bool) *Stitcher {
+	return &Stitcher{
+		start:    start,
+		timeout:  timeout,
+		emit:     emit,
+		pending:  make(map[string]*pendingRecord),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Start begins flushing idle records in the background
+func (s *Stitcher) Start() {
+	go s.flushIdle()
+}
+
+// Ingest accepts one line-sized entry. It returns false only when a completed
+// record it flushed was rejected downstream.
+func (s *Stitcher) Ingest(entry models.LogEntry) bool {
+	key := entry.Service + "\x00" + entry.Node
+
+	s.mu.Lock()
+	record, exists := s.pending[key]
+
+	// Continuation line: attach to the record being assembled
+	if exists && !s.start.MatchString(entry.Message) && len(record.lines) < maxStitchedLines {
+		record.lines = append(record.lines, entry.Message)
+		record.lastSeen = time.Now()
+		s.mu.Unlock()
+		return true
+	}
+
+	// Start of a new record: the previous one is complete
+	s.pending[key] = &pendingRecord{
+		entry:    entry,
+		lines:    []string{entry.Message},
+		lastSeen: time.Now(),
+	}
+	s.mu.Unlock()
+
+	if exists {
+		return s.emit(record.complete())
+	}
+	return true
+}
+
+// Flush emits every pending record (e.g. when the input ends)
+func (s *Stitcher) Flush() {
+	s.mu.Lock()
+	records := make([]*pendingRecord, 0, len(s.pending))
+	for key, record := range s.pending {
+		records = append(records, record)
+		delete(s.pending, key)
+	}
+	s.mu.Unlock()
+
+	for _, record := range records {
+		s.emitFlushed(record)
+	}
+}
+
+// flushIdle emits records that haven't received a line within the timeout
+func (s *Stitcher) flushIdle() {
+	ticker := time.NewTicker(s.timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cutoff := time.Now().Add(-s.timeout)
+
+			s.mu.Lock()
+			idle := make([]*pendingRecord, 0)
+			for key, record := range s.pending {
+				if record.lastSeen.Before(cutoff) {
+					idle = append(idle, record)
+					delete(s.pending, key)
+				}
+			}
+			s.mu.Unlock()
+
+			for _, record := range idle {
+				s.emitFlushed(record)
+			}
+		case <-s.shutdown:
+			return
+		}
+	}
+}
+
+// emitFlushed emits a record no caller is waiting on, counting it if it is
+// rejected since nobody else will
+func (s *Stitcher) emitFlushed(record *pendingRecord) {
+	if !s.emit(record.complete()) {
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many records flushed by the timeout or Flush were
+// rejected downstream
+func (s *Stitcher) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// complete joins the collected lines into the record's message
+func (r *pendingRecord) complete() models.LogEntry {
+	entry := r.entry
+	entry.Message = strings.Join(r.lines, "\n")
+	return entry
+}
+
+// Stop stops the idle flusher and emits whatever is still pending
+func (s *Stitcher) Stop() {
+	close(s.shutdown)
+	s.Flush()
+}
@@ -0,0 +1,516 @@
+package query
+
+import (
+	"cmp"
+	"fmt"
+	"logstream/pkg/models"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query is a parsed /query expression: field matchers, then line filters on
+// the message, then optionally a count, e.g.
+//
+//	service="payments" level>=ERROR |= "timeout" | count by (minute)
+type Query struct {
+	Matchers    []Matcher
+	LineFilters []LineFilter
+	Count       bool     // Whether the matches are counted rather than returned
+	By          []string // Labels the count is grouped by
+}
+
+// Matcher compares one field of an entry with a value
+type Matcher struct {
+	Field string // id, level, service, node, source, namespace or metadata.<key>
+	Op    string // =, !=, =~, !~, and >, >=, <, <= for level and metadata numbers
+	Value string
+	re    *regexp.Regexp
+}
+
+// LineFilter checks the message: |= contains, != doesn't contain, |~ matches
+// and !~ doesn't match a regex
+type LineFilter struct {
+	Op   string
+	Text string
+	re   *regexp.Regexp
+}
+
+// queryFields are the fields matchers may name besides metadata.<key>
+var queryFields = map[string]bool{"id": true, "level": true, "service": true, "node": true, "source": true, "namespace": true}
+
+// groupLabels are the labels a count may be grouped by besides metadata.<key>
+var groupLabels = map[string]bool{"level": true, "service": true, "node": true, "source": true, "namespace": true, "minute": true, "hour": true, "day": true}
+
+// queryMetadata is how metadata matchers look up keys: dotted keys reach
+// into nested objects, and numbers match numeric strings
+var queryMetadata = MetadataOptions{Flatten: true, Coerce: true}
+
+// Parse parses a query. Errors give the byte offset of the problem.
+func Parse(text string) (*Query, error) {
+	tokens, err := lex(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	q, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if len(q.Matchers) == 0 && len(q.LineFilters) == 0 && !q.Count {
+		return nil, fmt.Errorf("empty query")
+	}
+	return q, nil
+}
+
+// Matches reports whether an entry satisfies every matcher and line filter
+func (q *Query) Matches(entry models.LogEntry) bool {
+	for _, m := range q.Matchers {
+		if !m.matches(entry) {
+			return false
+		}
+	}
+	for _, f := range q.LineFilters {
+		if !f.matches(entry.Message) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns the value a field must equal, if an = matcher sets one, for
+// narrowing down what is read from storage
+func (q *Query) Equal(field string) (string, bool) {
+	for _, m := range q.Matchers {
+		if m.Field == field && m.Op == "=" {
+			return m.Value, true
+		}
+	}
+	return "", false
+}
+
+// MetadataEqual returns the metadata.<key>= matchers as metadata filters,
+// along with the options they are matched with
+func (q *Query) MetadataEqual() ([]MetadataFilter, MetadataOptions) {
+	var filters []MetadataFilter
+	for _, m := range q.Matchers {
+		if key, ok := strings.CutPrefix(m.Field, metadataParamPrefix); ok && m.Op == "=" {
+			filters = append(filters, MetadataFilter{Key: key, Value: m.Value})
+		}
+	}
+	return filters, queryMetadata
+}
+
+// Series is one group of a count
+type Series struct {
+	Labels map[string]string `json:"labels"`
+	Count  int               `json:"count"`
+}
+
+// Aggregate counts logs by the query's labels, ordered by label values (so
+// time buckets come in time order). A count without labels is one series.
+func (q *Query) Aggregate(logs []models.LogEntry) []Series {
+	groups := make(map[string]*Series)
+	var keys []string
+	for _, entry := range logs {
+		labels := make(map[string]string, len(q.By))
+		values := make([]string, len(q.By))
+		for i, label := range q.By {
+			values[i] = labelValue(entry, label)
+			labels[label] = values[i]
+		}
+		key := strings.Join(values, "\x00")
+		if series, ok := groups[key]; ok {
+			series.Count++
+			continue
+		}
+		groups[key] = &Series{Labels: labels, Count: 1}
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	result := make([]Series, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *groups[key])
+	}
+	return result
+}
+
+// labelValue returns an entry's value for a grouping label
+func labelValue(entry models.LogEntry, label string) string {
+	switch label {
+	case "minute":
+		return entry.Timestamp.UTC().Truncate(time.Minute).Format(time.RFC3339)
+	case "hour":
+		return entry.Timestamp.UTC().Truncate(time.Hour).Format(time.RFC3339)
+	case "day":
+		return entry.Timestamp.UTC().Format("2006-01-02")
+	}
+	value, _ := fieldValue(entry, label)
+	return value
+}
+
+// fieldValue returns a field of an entry as text, and whether it is set
+func fieldValue(entry models.LogEntry, field string) (string, bool) {
+	switch field {
+	case "id":
+		return entry.ID, true
+	case "level":
+		return entry.Level, true
+	case "service":
+		return entry.Service, true
+	case "node":
+		return entry.Node, true
+	case "source":
+		return entry.Source, true
+	case "namespace":
+		return entry.Namespace, true
+	}
+	key := strings.TrimPrefix(field, metadataParamPrefix)
+	value, ok := LookupMetadata(entry.Metadata, key, queryMetadata)
+	if !ok {
+		return "", false
+	}
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	return fmt.Sprint(value), true
+}
+
+// matches applies the matcher to an entry
+func (m Matcher) matches(entry models.LogEntry) bool {
+	if key, ok := strings.CutPrefix(m.Field, metadataParamPrefix); ok && (m.Op == "=" || m.Op == "!=") {
+		found := MatchesMetadata(entry.Metadata, []MetadataFilter{{Key: key, Value: m.Value}}, queryMetadata)
+		return found == (m.Op == "=")
+	}
+
+	value, _ := fieldValue(entry, m.Field)
+	switch m.Op {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.re.MatchString(value)
+	case "!~":
+		return !m.re.MatchString(value)
+	}
+
+	// Metadata comparisons, by number; missing and non-numeric values never match
+	if key, ok := strings.CutPrefix(m.Field, metadataParamPrefix); ok {
+		raw, found := LookupMetadata(entry.Metadata, key, queryMetadata)
+		actual, numeric := ToFloat(raw, true)
+		want, _ := strconv.ParseFloat(m.Value, 64)
+		return found && numeric && compareOrdered(cmp.Compare(actual, want), m.Op)
+	}
+
+	// Level comparisons, by severity
+	rank, _ := models.LevelSeverity(value)
+	want, _ := models.LevelSeverity(m.Value)
+	return compareOrdered(cmp.Compare(rank, want), m.Op)
+}
+
+// compareOrdered applies >, >=, < or <= to the result of a comparison
+func compareOrdered(c int, op string) bool {
+	switch op {
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	default:
+		return c <= 0
+	}
+}
+
+// matches applies the line filter to a message
+func (f LineFilter) matches(message string) bool {
+	switch f.Op {
+	case "|=":
+		return strings.Contains(message, f.Text)
+	case "!=":
+		return !strings.Contains(message, f.Text)
+	case "|~":
+		return MatchesRegex(f.re, message)
+	default:
+		return !MatchesRegex(f.re, message)
+	}
+}
+
+// token kinds
+const (
+	tokenIdent = iota
+	tokenString
+	tokenOp
+	tokenPunct // ( ) , { }
+)
+
+// token is a lexed piece of a query
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+// queryOps are the operators, longest first so "!=" isn't read as "!"
+var queryOps = []string{"|=", "|~", "!=", "!~", "=~", "==", ">=", "<=", "=", ">", "<", "|"}
+
+// lex splits a query into tokens
+func lex(text string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '`':
+			end := i + 1
+			for end < len(text) && text[end] != c {
+				if c == '"' && text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				return nil, fmt.Errorf("at %d: unterminated string", i)
+			}
+			value, err := strconv.Unquote(text[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("at %d: invalid string: %v", i, err)
+			}
+			tokens = append(tokens, token{tokenString, value, i})
+			i = end + 1
+		case strings.ContainsRune("(),{}", rune(c)):
+			tokens = append(tokens, token{tokenPunct, string(c), i})
+			i++
+		case isIdentRune(rune(c)):
+			end := i
+			for end < len(text) && isIdentRune(rune(text[end])) {
+				end++
+			}
+			tokens = append(tokens, token{tokenIdent, text[i:end], i})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range queryOps {
+				if strings.HasPrefix(text[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("at %d: unexpected %q", i, c)
+			}
+			tokens = append(tokens, token{tokenOp, op, i})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// isIdentRune reports whether r may be part of a field name or bare value
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-' || r == ':'
+}
+
+// parser reads a Query from tokens
+type parser struct {
+	tokens []token
+	next   int
+}
+
+// peek returns the next token without consuming it; ok is false at the end
+func (p *parser) peek() (token, bool) {
+	if p.next >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.next], true
+}
+
+// take consumes the next token
+func (p *parser) take() (token, bool) {
+	t, ok := p.peek()
+	if ok {
+		p.next++
+	}
+	return t, ok
+}
+
+// errorf reports a problem at the next token, or the end of the query
+func (p *parser) errorf(format string, args ...interface{}) error {
+	if t, ok := p.peek(); ok {
+		return fmt.Errorf("at %d: %s", t.pos, fmt.Sprintf(format, args...))
+	}
+	return fmt.Errorf("at end of query: %s", fmt.Sprintf(format, args...))
+}
+
+// parse reads the selector, line filters and an optional count stage
+func (p *parser) parse() (*Query, error) {
+	q := &Query{}
+	braced := false
+	if t, ok := p.peek(); ok && t.text == "{" {
+		braced = true
+		p.take()
+	}
+	for {
+		t, ok := p.peek()
+		if !ok {
+			break
+		}
+		switch {
+		case t.kind == tokenPunct && t.text == "}" && braced:
+			p.take()
+			braced = false
+		case t.kind == tokenPunct && t.text == ",":
+			p.take()
+		case t.kind == tokenIdent:
+			if len(q.LineFilters) > 0 {
+				return nil, p.errorf("field matchers go before line filters")
+			}
+			m, err := p.matcher()
+			if err != nil {
+				return nil, err
+			}
+			q.Matchers = append(q.Matchers, m)
+		case t.kind == tokenOp && t.text == "|":
+			p.take()
+			if err := p.stage(q); err != nil {
+				return nil, err
+			}
+			if _, more := p.peek(); more {
+				return nil, p.errorf("nothing may follow | count")
+			}
+			return q, nil
+		case t.kind == tokenOp && (t.text == "|=" || t.text == "!=" || t.text == "|~" || t.text == "!~"):
+			f, err := p.lineFilter()
+			if err != nil {
+				return nil, err
+			}
+			q.LineFilters = append(q.LineFilters, f)
+		default:
+			return nil, p.errorf("unexpected %q", t.text)
+		}
+	}
+	if braced {
+		return nil, p.errorf("missing }")
+	}
+	return q, nil
+}
+
+// matcher reads field op value
+func (p *parser) matcher() (Matcher, error) {
+	field, _ := p.take()
+	if !queryFields[field.text] && !strings.HasPrefix(field.text, metadataParamPrefix) {
+		p.next--
+		return Matcher{}, p.errorf("unknown field %q, expected id, level, service, node, source, namespace or metadata.<key>", field.text)
+	}
+	op, ok := p.take()
+	if !ok || op.kind != tokenOp || op.text == "|" || op.text == "|=" || op.text == "|~" {
+		p.next--
+		return Matcher{}, p.errorf("expected =, !=, =~ or !~ after %s", field.text)
+	}
+	value, ok := p.take()
+	if !ok || (value.kind != tokenString && value.kind != tokenIdent) {
+		p.next--
+		return Matcher{}, p.errorf("expected a value after %s%s", field.text, op.text)
+	}
+
+	m := Matcher{Field: field.text, Op: op.text, Value: value.text}
+	if m.Op == "==" {
+		m.Op = "="
+	}
+	switch op.text {
+	case ">", ">=", "<", "<=":
+		if strings.HasPrefix(field.text, metadataParamPrefix) {
+			if _, err := strconv.ParseFloat(m.Value, 64); err != nil {
+				return m, fmt.Errorf("at %d: %s compares metadata with numbers, not %q", value.pos, op.text, value.text)
+			}
+			break
+		}
+		if field.text != "level" {
+			return m, fmt.Errorf("at %d: %s only compares levels and metadata numbers", op.pos, op.text)
+		}
+		m.Value = strings.ToUpper(m.Value)
+		if _, known := models.LevelSeverity(m.Value); !known {
+			return m, fmt.Errorf("at %d: unknown level %q", value.pos, value.text)
+		}
+	case "=~", "!~":
+		// Like LogQL, field regexes match the whole value
+		re, err := CompileRegex("^(?:" + m.Value + ")$")
+		if err != nil {
+			return m, fmt.Errorf("at %d: invalid regex: %v", value.pos, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// lineFilter reads op "text"
+func (p *parser) lineFilter() (LineFilter, error) {
+	op, _ := p.take()
+	text, ok := p.take()
+	if !ok || text.kind != tokenString {
+		p.next--
+		return LineFilter{}, p.errorf("expected a quoted string after %s", op.text)
+	}
+	f := LineFilter{Op: op.text, Text: text.text}
+	if op.text == "|~" || op.text == "!~" {
+		re, err := CompileRegex(text.text)
+		if err != nil {
+			return f, fmt.Errorf("at %d: invalid regex: %v", text.pos, err)
+		}
+		f.re = re
+	}
+	return f, nil
+}
+
+// stage reads "count" and an optional "by (label, ...)"
+func (p *parser) stage(q *Query) error {
+	if t, ok := p.take(); !ok || t.kind != tokenIdent || t.text != "count" {
+		if ok {
+			p.next--
+		}
+		return p.errorf("expected count after |")
+	}
+	q.Count = true
+
+	if t, ok := p.peek(); !ok || t.text != "by" {
+		return nil
+	}
+	p.take()
+	if t, ok := p.take(); !ok || t.text != "(" {
+		if ok {
+			p.next--
+		}
+		return p.errorf("expected ( after by")
+	}
+	for {
+		label, ok := p.take()
+		if !ok || label.kind != tokenIdent {
+			if ok {
+				p.next--
+			}
+			return p.errorf("expected a label")
+		}
+		if !groupLabels[label.text] && !strings.HasPrefix(label.text, metadataParamPrefix) {
+			return fmt.Errorf("at %d: unknown label %q, expected level, service, node, source, namespace, minute, hour, day or metadata.<key>", label.pos, label.text)
+		}
+		q.By = append(q.By, label.text)
+
+		t, ok := p.take()
+		if !ok {
+			return p.errorf("missing )")
+		}
+		if t.text == ")" {
+			return nil
+		}
+		if t.text != "," {
+			p.next--
+			return p.errorf("expected , or )")
+		}
+	}
+}
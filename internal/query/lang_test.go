@@ -0,0 +1,267 @@
+package query
+
+import (
+	"logstream/pkg/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stripped drops compiled regexes so parsed queries compare by what was written
+func stripped(q *Query) Query {
+	out := *q
+	out.Matchers = append([]Matcher(nil), q.Matchers...)
+	for i := range out.Matchers {
+		out.Matchers[i].re = nil
+	}
+	out.LineFilters = append([]LineFilter(nil), q.LineFilters...)
+	for i := range out.LineFilters {
+		out.LineFilters[i].re = nil
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want Query
+	}{
+		{
+			text: `service="payments"`,
+			want: Query{Matchers: []Matcher{{Field: "service", Op: "=", Value: "payments"}}},
+		},
+		{
+			text: `{service="payments", level>=error} |= "timeout" != "retry" | count by (minute, service)`,
+			want: Query{
+				Matchers:    []Matcher{{Field: "service", Op: "=", Value: "payments"}, {Field: "level", Op: ">=", Value: "ERROR"}},
+				LineFilters: []LineFilter{{Op: "|=", Text: "timeout"}, {Op: "!=", Text: "retry"}},
+				Count:       true,
+				By:          []string{"minute", "service"},
+			},
+		},
+		{
+			text: `node==node-1 source!=udp namespace=~"team-.*" id!~` + "`a|b`",
+			want: Query{Matchers: []Matcher{
+				{Field: "node", Op: "=", Value: "node-1"},
+				{Field: "source", Op: "!=", Value: "udp"},
+				{Field: "namespace", Op: "=~", Value: "team-.*"},
+				{Field: "id", Op: "!~", Value: "a|b"},
+			}},
+		},
+		{
+			text: `metadata.http.status>=500 metadata.user_id="829"`,
+			want: Query{Matchers: []Matcher{
+				{Field: "metadata.http.status", Op: ">=", Value: "500"},
+				{Field: "metadata.user_id", Op: "=", Value: "829"},
+			}},
+		},
+		{
+			text: `|~ "conn(ection)? refused" !~ "\\d+ms"`,
+			want: Query{LineFilters: []LineFilter{{Op: "|~", Text: "conn(ection)? refused"}, {Op: "!~", Text: `\d+ms`}}},
+		},
+		{
+			text: `|= "say \"hi\"\n"`,
+			want: Query{LineFilters: []LineFilter{{Op: "|=", Text: "say \"hi\"\n"}}},
+		},
+		{
+			text: "| count",
+			want: Query{Count: true},
+		},
+		{
+			text: "{} | count by (metadata.region)",
+			want: Query{Count: true, By: []string{"metadata.region"}},
+		},
+	}
+	for _, test := range tests {
+		q, err := Parse(test.text)
+		if err != nil {
+			t.Errorf("Parse(%s): %v", test.text, err)
+			continue
+		}
+		if got := stripped(q); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%s) = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		err  string
+	}{
+		{``, "empty query"},
+		{`{}`, "empty query"},
+		{`service="payments`, "at 8: unterminated string"},
+		{`service="\q"`, "at 8: invalid string"},
+		{`service # "x"`, `at 8: unexpected '#'`},
+		{`host="a"`, `at 0: unknown field "host"`},
+		{`service`, "at 0: expected =, !=, =~ or !~ after service"},
+		{`service |= "x"`, "at 8: expected =, !=, =~ or !~ after service"},
+		{`service=`, "at 7: expected a value after service="},
+		{`service=(`, "at 8: expected a value after service="},
+		{`service>a`, "at 7: > only compares levels and metadata numbers"},
+		{`level>=verbose`, `at 7: unknown level "verbose"`},
+		{`metadata.status>high`, `at 16: > compares metadata with numbers, not "high"`},
+		{`service=~"("`, "at 9: invalid regex"},
+		{`|~ "[z-a]"`, "at 3: invalid regex"},
+		{`|= timeout`, "at 3: expected a quoted string after |="},
+		{`|= "x" service="a"`, "at 7: field matchers go before line filters"},
+		{`{service="a"`, "at end of query: missing }"},
+		{`service="a" }`, `at 12: unexpected "}"`},
+		{`| sum`, "at 2: expected count after |"},
+		{`| count by minute`, "at 11: expected ( after by"},
+		{`| count by ()`, "at 12: expected a label"},
+		{`| count by (host)`, `at 12: unknown label "host"`},
+		{`| count by (level`, "at end of query: missing )"},
+		{`| count by (level service)`, "at 18: expected , or )"},
+		{`| count |= "x"`, "at 8: nothing may follow | count"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.text)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Parse(%s) = %v, want an error containing %q", test.text, err, test.err)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	entry := models.LogEntry{
+		ID:        "7c9e",
+		Level:     models.LevelError,
+		Service:   "payments",
+		Node:      "node-1",
+		Source:    "http",
+		Namespace: "team-a",
+		Message:   "connection refused after 250ms",
+		Metadata: map[string]interface{}{
+			"user_id": float64(829),
+			"region":  "eu-west",
+			"http":    map[string]interface{}{"status": float64(503)},
+			"latency": "12.5",
+		},
+	}
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{`service="payments"`, true},
+		{`service="pay"`, false},
+		{`service!="payments"`, false},
+		{`service=~"pay.*"`, true},
+		{`service=~"pay"`, false}, // Field regexes match the whole value
+		{`service!~"web|api"`, true},
+		{`level>=WARNING`, true},
+		{`level>error`, false},
+		{`level<=ERROR level>INFO`, true},
+		{`level<ERROR`, false},
+		{`node=node-1 source=http namespace=team-a id=7c9e`, true},
+		{`metadata.user_id="829"`, true},
+		{`metadata.user_id=830`, false},
+		{`metadata.user_id!=830`, true},
+		{`metadata.missing!=x`, true},
+		{`metadata.http.status>=500`, true},
+		{`metadata.http.status<500`, false},
+		{`metadata.latency>12`, true}, // Numeric strings compare as numbers
+		{`metadata.region>1`, false},  // Non-numeric values never compare
+		{`metadata.missing<1`, false}, // Nor do missing ones
+		{`metadata.region=~"eu-.*"`, true},
+		{`|= "refused"`, true},
+		{`|= "Refused"`, false},
+		{`!= "refused"`, false},
+		{`|~ "\\d+ms"`, true},
+		{`|~ "^refused"`, false},
+		{`!~ "timeout"`, true},
+		{`service="payments" |= "refused" |= "timeout"`, false},
+	}
+	for _, test := range tests {
+		q, err := Parse(test.text)
+		if err != nil {
+			t.Errorf("Parse(%s): %v", test.text, err)
+			continue
+		}
+		if got := q.Matches(entry); got != test.want {
+			t.Errorf("%s matches = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestEqualAndMetadataEqual(t *testing.T) {
+	q, err := Parse(`service="payments" level!=INFO metadata.region="eu" metadata.code!="1" metadata.n>2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := q.Equal("service"); !ok || value != "payments" {
+		t.Errorf(`Equal("service") = %q, %v, want payments`, value, ok)
+	}
+	if _, ok := q.Equal("level"); ok {
+		t.Error(`Equal("level") found a value, but level is only matched with !=`)
+	}
+	filters, opts := q.MetadataEqual()
+	if !reflect.DeepEqual(filters, []MetadataFilter{{Key: "region", Value: "eu"}}) || opts != queryMetadata {
+		t.Errorf("MetadataEqual = %+v, %+v, want only region=eu", filters, opts)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	at := time.Date(2026, 10, 17, 9, 30, 15, 0, time.UTC)
+	logs := []models.LogEntry{
+		{Service: "web", Level: models.LevelInfo, Timestamp: at.Add(time.Minute)},
+		{Service: "api", Level: models.LevelError, Timestamp: at},
+		{Service: "api", Level: models.LevelError, Timestamp: at.Add(30 * time.Second)},
+		{Service: "api", Level: models.LevelInfo, Timestamp: at, Metadata: map[string]interface{}{"region": "eu"}},
+	}
+	tests := []struct {
+		text string
+		want []Series
+	}{
+		{"| count", []Series{{Labels: map[string]string{}, Count: 4}}},
+		{"| count by (service)", []Series{
+			{Labels: map[string]string{"service": "api"}, Count: 3},
+			{Labels: map[string]string{"service": "web"}, Count: 1},
+		}},
+		{"| count by (minute, level)", []Series{
+			{Labels: map[string]string{"minute": "2026-10-17T09:30:00Z", "level": "ERROR"}, Count: 2},
+			{Labels: map[string]string{"minute": "2026-10-17T09:30:00Z", "level": "INFO"}, Count: 1},
+			{Labels: map[string]string{"minute": "2026-10-17T09:31:00Z", "level": "INFO"}, Count: 1},
+		}},
+		{"| count by (day, hour, metadata.region)", []Series{
+			{Labels: map[string]string{"day": "2026-10-17", "hour": "2026-10-17T09:00:00Z", "metadata.region": ""}, Count: 3},
+			{Labels: map[string]string{"day": "2026-10-17", "hour": "2026-10-17T09:00:00Z", "metadata.region": "eu"}, Count: 1},
+		}},
+	}
+	for _, test := range tests {
+		q, err := Parse(test.text)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", test.text, err)
+		}
+		if got := q.Aggregate(logs); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+
+	q, _ := Parse("| count by (service)")
+	if got := q.Aggregate(nil); got == nil || len(got) != 0 {
+		t.Errorf("Aggregate(nil) = %#v, want no series", got)
+	}
+}
+
+func TestCompileRegexLimits(t *testing.T) {
+	if _, err := CompileRegex("err(or)?s?"); err != nil {
+		t.Errorf("CompileRegex of a plain pattern: %v", err)
+	}
+	tests := []struct {
+		pattern string
+		text    string
+	}{
+		{strings.Repeat("a", maxRegexLength+1), "bytes, at most"},
+		{strings.Repeat("a{1000}", 11), "too complex"},
+		{"(a{1000}){1000}", "invalid repeat count"},
+		{"(", "missing closing )"},
+	}
+	for _, test := range tests {
+		if _, err := CompileRegex(test.pattern); err == nil || !strings.Contains(err.Error(), test.text) {
+			t.Errorf("CompileRegex(%.20s) = %v, want an error containing %q", test.pattern, err, test.text)
+		}
+	}
+}
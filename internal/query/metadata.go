@@ -0,0 +1,189 @@
+package query
+
+import (
+	"encoding/json"
+	"logstream/pkg/models"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metadataParamPrefix marks query parameters that filter on metadata fields
+const metadataParamPrefix = "metadata."
+
+// MetadataOptions controls how metadata is interpreted when filtering
+type MetadataOptions struct {
+	Flatten bool // Match nested objects by dotted key, e.g. "http.status"
+	Coerce  bool // Compare numeric strings and numbers by value
+}
+
+// MetadataFilter matches a single metadata field against a value
+type MetadataFilter struct {
+	Key   string
+	Value string
+}
+
+// ParseMetadataFilters extracts `metadata.<key>=<value>` parameters and the
+// `flatten` / `coerce` options from a URL query
+func ParseMetadataFilters(values url.Values) ([]MetadataFilter, MetadataOptions) {
+	filters := make([]MetadataFilter, 0)
+	for param, vals := range values {
+		if !strings.HasPrefix(param, metadataParamPrefix) || len(vals) == 0 {
+			continue
+		}
+		filters = append(filters, MetadataFilter{
+			Key:   strings.TrimPrefix(param, metadataParamPrefix),
+			Value: vals[0],
+		})
+	}
+
+	// Deterministic order keeps results stable across identical requests
+	sort.Slice(filters, func(i, j int) bool { return filters[i].Key < filters[j].Key })
+
+	opts := MetadataOptions{
+		Flatten: values.Get("flatten") == "true",
+		Coerce:  values.Get("coerce") == "true",
+	}
+	return filters, opts
+}
+
+// FilterByMetadata keeps only entries matching every filter
+func FilterByMetadata(logs []models.LogEntry, filters []MetadataFilter, opts MetadataOptions) []models.LogEntry {
+	if len(filters) == 0 {
+		return logs
+	}
+
+	result := make([]models.LogEntry, 0)
+	for _, log := range logs {
+		if MatchesMetadata(log.Metadata, filters, opts) {
+			result = append(result, log)
+		}
+	}
+	return result
+}
+
+// MatchesMetadata reports whether metadata satisfies every filter
+func MatchesMetadata(metadata map[string]interface{}, filters []MetadataFilter, opts MetadataOptions) bool {
+	for _, filter := range filters {
+		actual, ok := LookupMetadata(metadata, filter.Key, opts)
+		if !ok || !matchValue(actual, filter.Value, opts) {
+			return false
+		}
+	}
+	return true
+}
+
+// LookupMetadata finds a metadata value, following dotted paths when flattening
+func LookupMetadata(metadata map[string]interface{}, key string, opts MetadataOptions) (interface{}, bool) {
+	if value, ok := metadata[key]; ok {
+		return value, true
+	}
+	if !opts.Flatten {
+		return nil, false
+	}
+
+	value, ok := FlattenMetadata(metadata)[key]
+	return value, ok
+}
+
+// FlattenMetadata turns nested objects and arrays into dotted keys,
+// e.g. {"http": {"status": 500}} becomes {"http.status": 500}
+func FlattenMetadata(metadata map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		flattenInto(flat, key, value)
+	}
+	return flat
+}
+
+// flattenInto writes value (recursively) into flat under prefix
+func flattenInto(flat map[string]interface{}, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			flattenInto(flat, prefix+"."+key, nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			flattenInto(flat, prefix+"."+strconv.Itoa(i), nested)
+		}
+	default:
+		flat[prefix] = value
+	}
+}
+
+// matchValue compares a stored metadata value with a filter value from the URL.
+// The filter value is read as a JSON literal when possible so 42 only matches
+// numbers and "true" only matches booleans, unless coercion is enabled.
+func matchValue(actual interface{}, want string, opts MetadataOptions) bool {
+	if opts.Coerce {
+		if actualNum, ok := ToFloat(actual, true); ok {
+			if wantNum, err := strconv.ParseFloat(want, 64); err == nil {
+				return actualNum == wantNum
+			}
+		}
+	}
+
+	switch v := actual.(type) {
+	case string:
+		return v == want
+	case bool:
+		return strconv.FormatBool(v) == want
+	case nil:
+		return want == "null"
+	}
+
+	if actualNum, ok := ToFloat(actual, false); ok {
+		wantNum, err := strconv.ParseFloat(want, 64)
+		return err == nil && actualNum == wantNum
+	}
+
+	// Anything else (nested objects without flattening) compares by its JSON form
+	data, err := json.Marshal(actual)
+	return err == nil && string(data) == want
+}
+
+// ToFloat converts numeric metadata values to float64, optionally parsing numeric strings
+func ToFloat(value interface{}, parseStrings bool) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		if !parseStrings {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// FlattenEntries returns copies of logs with flattened metadata
+func FlattenEntries(logs []models.LogEntry) []models.LogEntry {
+	result := make([]models.LogEntry, len(logs))
+	for i, log := range logs {
+		if log.Metadata != nil {
+			log.Metadata = FlattenMetadata(log.Metadata)
+		}
+		result[i] = log
+	}
+	return result
+}
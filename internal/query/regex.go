@@ -0,0 +1,79 @@
+package query
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sync"
+)
+
+// Limits on ?message_regex= patterns. Go's regexps run in time linear in the
+// input, so bounding the pattern's size bounds the work per message.
+const (
+	maxRegexLength       = 1024  // Bytes of pattern
+	maxRegexInstructions = 10000 // Compiled program size, which repetitions like a{1000} inflate
+	regexCacheSize       = 256   // Compiled patterns kept for repeated queries
+)
+
+// regexCache keeps recently used compiled patterns, least recently used first out
+var regexCache = struct {
+	sync.Mutex
+	order   *list.List // Of *regexCacheEntry, most recently used at the front
+	entries map[string]*list.Element
+}{order: list.New(), entries: make(map[string]*list.Element)}
+
+// regexCacheEntry is a compiled pattern in regexCache
+type regexCacheEntry struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// CompileRegex compiles a message pattern in RE2 syntax, reusing a cached
+// compilation of the same pattern. The error says what is wrong with an
+// invalid or oversized pattern.
+func CompileRegex(pattern string) (*regexp.Regexp, error) {
+	regexCache.Lock()
+	if element, ok := regexCache.entries[pattern]; ok {
+		regexCache.order.MoveToFront(element)
+		regexCache.Unlock()
+		return element.Value.(*regexCacheEntry).re, nil
+	}
+	regexCache.Unlock()
+
+	if len(pattern) > maxRegexLength {
+		return nil, fmt.Errorf("pattern is %d bytes, at most %d are allowed", len(pattern), maxRegexLength)
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, err
+	}
+	if len(prog.Inst) > maxRegexInstructions {
+		return nil, fmt.Errorf("pattern is too complex (%d instructions, at most %d); reduce repetition counts", len(prog.Inst), maxRegexInstructions)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	regexCache.Lock()
+	defer regexCache.Unlock()
+	if _, ok := regexCache.entries[pattern]; !ok {
+		regexCache.entries[pattern] = regexCache.order.PushFront(&regexCacheEntry{pattern: pattern, re: re})
+		if regexCache.order.Len() > regexCacheSize {
+			oldest := regexCache.order.Back()
+			regexCache.order.Remove(oldest)
+			delete(regexCache.entries, oldest.Value.(*regexCacheEntry).pattern)
+		}
+	}
+	return re, nil
+}
+
+// MatchesRegex reports whether a message matches a pattern
+func MatchesRegex(re *regexp.Regexp, message string) bool {
+	return re.MatchString(message)
+}
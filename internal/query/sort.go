@@ -0,0 +1,58 @@
+package query
+
+import (
+	"fmt"
+	"logstream/pkg/models"
+	"net/url"
+	"sort"
+)
+
+// Sort fields for ?sort=
+const (
+	SortTimestamp = "timestamp"
+	SortLevel     = "level"
+)
+
+// Sort is the order a query's results are returned in
+type Sort struct {
+	Field      string // SortTimestamp or SortLevel
+	Descending bool
+}
+
+// ParseSort reads ?sort=timestamp|level and ?order=asc|desc. set is false
+// when neither is given, for results that then stay in storage order.
+func ParseSort(values url.Values) (s Sort, set bool, err error) {
+	s = Sort{Field: SortTimestamp}
+	switch field := values.Get("sort"); field {
+	case "", SortTimestamp:
+	case SortLevel:
+		s.Field = SortLevel
+	default:
+		return s, true, fmt.Errorf("invalid sort %q, expected timestamp or level", field)
+	}
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		s.Descending = true
+	default:
+		return s, true, fmt.Errorf("invalid order %q, expected asc or desc", order)
+	}
+	return s, values.Has("sort") || values.Has("order"), nil
+}
+
+// Apply sorts logs in place. Logs of the same level are ordered by
+// timestamp in the same direction, and equal timestamps keep their order.
+func (s Sort) Apply(logs []models.LogEntry) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		a, b := logs[i], logs[j]
+		if s.Descending {
+			a, b = b, a
+		}
+		if s.Field == SortLevel && a.Level != b.Level {
+			rankA, _ := models.LevelSeverity(a.Level)
+			rankB, _ := models.LevelSeverity(b.Level)
+			return rankA < rankB
+		}
+		return a.Timestamp.Before(b.Timestamp)
+	})
+}
@@ -0,0 +1,54 @@
+package query
+
+import (
+	"logstream/pkg/models"
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits text into lowercase words of letters and digits, each once, in order of first appearance
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := make([]string, 0, len(words))
+	seen := make(map[string]bool, len(words))
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+// MatchesText reports whether a message contains every word of a search
+func MatchesText(message string, tokens []string) bool {
+	words := make(map[string]bool)
+	for _, word := range Tokenize(message) {
+		words[word] = true
+	}
+	for _, token := range tokens {
+		if !words[token] {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterByText keeps only entries whose message contains every word of text
+func FilterByText(logs []models.LogEntry, text string) []models.LogEntry {
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return logs
+	}
+
+	result := make([]models.LogEntry, 0)
+	for _, log := range logs {
+		if MatchesText(log.Message, tokens) {
+			result = append(result, log)
+		}
+	}
+	return result
+}
@@ -0,0 +1,300 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"logstream/pkg/models"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ClientConfig controls a relay sender
+type ClientConfig struct {
+	Addr          string        // Receiver address, e.g. "standby:9090"
+	Token         string        // Token presented in HELLO
+	BatchSize     int           // Max entries per BATCH frame
+	FlushInterval time.Duration // Max time an entry waits before being shipped
+	MaxPending    int           // Unacknowledged entries kept for resume
+}
+
+// ClientStats tracks relay sender progress
+type ClientStats struct {
+	Connected  bool   `json:"connected"`
+	Acked      uint64 `json:"acked"`
+	Pending    int    `json:"pending"`
+	Dropped    uint64 `json:"dropped"`
+	Reconnects uint64 `json:"reconnects"`
+}
+
+// Client ships entries to a relay receiver, resending anything unacknowledged after a reconnect
+type Client struct {
+	config     ClientConfig
+	streamID   string
+	encoder    *zstd.Encoder
+	pending    []sequenced // Unacknowledged entries in sequence order
+	nextSeq    uint64
+	sentUpTo   uint64 // Highest sequence written on the current connection
+	mu         sync.Mutex
+	notify     chan struct{}
+	connected  int32
+	acked      uint64
+	dropped    uint64
+	reconnects uint64
+	shutdown   chan struct{}
+}
+
+// sequenced is an entry with its position in the stream
+type sequenced struct {
+	seq   uint64
+	entry models.LogEntry
+}
+
+// NewClient creates a relay sender with a fresh stream ID
+func NewClient(config ClientConfig) *Client {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1000
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 100 * time.Millisecond
+	}
+	if config.MaxPending <= 0 {
+		config.MaxPending = 100000
+	}
+
+	// EncodeAll on a nil-writer encoder is safe for concurrent use
+	encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+
+	return &Client{
+		config:   config,
+		streamID: uuid.New().String(),
+		encoder:  encoder,
+		pending:  make([]sequenced, 0, config.BatchSize),
+		nextSeq:  1,
+		notify:   make(chan struct{}, 1),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Start begins connecting and shipping in the background
+func (c *Client) Start() {
+	go c.run()
+}
+
+// Send queues an entry for shipping (non-blocking). Returns false if the resume buffer is full.
+func (c *Client) Send(entry models.LogEntry) bool {
+	c.mu.Lock()
+	if len(c.pending) >= c.config.MaxPending {
+		c.mu.Unlock()
+		atomic.AddUint64(&c.dropped, 1)
+		return false
+	}
+	c.pending = append(c.pending, sequenced{seq: c.nextSeq, entry: entry})
+	c.nextSeq++
+	full := len(c.pending) >= c.config.BatchSize
+	c.mu.Unlock()
+
+	if full {
+		select {
+		case c.notify <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// GetStats returns current relay statistics
+func (c *Client) GetStats() ClientStats {
+	c.mu.Lock()
+	pending := len(c.pending)
+	c.mu.Unlock()
+
+	return ClientStats{
+		Connected:  atomic.LoadInt32(&c.connected) == 1,
+		Acked:      atomic.LoadUint64(&c.acked),
+		Pending:    pending,
+		Dropped:    atomic.LoadUint64(&c.dropped),
+		Reconnects: atomic.LoadUint64(&c.reconnects),
+	}
+}
+
+// run keeps a connection open, backing off between failed attempts
+func (c *Client) run() {
+	backoff := 500 * time.Millisecond
+
+	for {
+		err := c.session()
+
+		select {
+		case <-c.shutdown:
+			return
+		default:
+		}
+
+		atomic.AddUint64(&c.reconnects, 1)
+		fmt.Printf("⚠️  Relay link to %s lost: %v (retrying in %v)\n", c.config.Addr, err, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-c.shutdown:
+			return
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// session runs one connection: handshake, then ship batches until an error
+func (c *Client) session() error {
+	conn, err := net.DialTimeout("tcp", c.config.Addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Handshake: learn where the receiver left off
+	if err := writeFrame(conn, frameHello, encodeHello(c.streamID, c.config.Token)); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	frameType, payload, err := readFrame(reader)
+	if err != nil {
+		return err
+	}
+	if frameType == frameError {
+		return fmt.Errorf("receiver rejected hello: %s", payload)
+	}
+	if frameType != frameHelloAck {
+		return fmt.Errorf("unexpected frame %d during handshake", frameType)
+	}
+	lastSeq, err := decodeSeq(payload)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.trimAcked(lastSeq)
+	c.sentUpTo = lastSeq
+	c.mu.Unlock()
+
+	atomic.StoreInt32(&c.connected, 1)
+	defer atomic.StoreInt32(&c.connected, 0)
+
+	// Acks arrive on their own goroutine so writes never wait on the round trip
+	ackErr := make(chan error, 1)
+	go func() {
+		ackErr <- c.readAcks(reader)
+	}()
+
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.notify:
+		case <-ticker.C:
+		case err := <-ackErr:
+			return err
+		case <-c.shutdown:
+			return nil
+		}
+
+		if err := c.shipPending(conn); err != nil {
+			return err
+		}
+	}
+}
+
+// shipPending writes every not-yet-sent entry in BatchSize chunks
+func (c *Client) shipPending(conn net.Conn) error {
+	for {
+		c.mu.Lock()
+		// Sequences in pending are contiguous, so the first unsent entry is found by offset
+		start := 0
+		if len(c.pending) > 0 && c.sentUpTo >= c.pending[0].seq {
+			start = int(c.sentUpTo - c.pending[0].seq + 1)
+		}
+		if start > len(c.pending) {
+			start = len(c.pending)
+		}
+		end := start + c.config.BatchSize
+		if end > len(c.pending) {
+			end = len(c.pending)
+		}
+		batch := make([]sequenced, end-start)
+		copy(batch, c.pending[start:end])
+		c.mu.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, item := range batch {
+			if err := enc.Encode(item.entry); err != nil {
+				return err
+			}
+		}
+		compressed := c.encoder.EncodeAll(buf.Bytes(), nil)
+
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := writeFrame(conn, frameBatch, encodeBatchHeader(batch[0].seq, len(batch), compressed)); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.sentUpTo = batch[len(batch)-1].seq
+		c.mu.Unlock()
+	}
+}
+
+// readAcks drops acknowledged entries from the resume buffer
+func (c *Client) readAcks(reader *bufio.Reader) error {
+	for {
+		frameType, payload, err := readFrame(reader)
+		if err != nil {
+			return err
+		}
+		if frameType == frameError {
+			return fmt.Errorf("receiver error: %s", payload)
+		}
+		if frameType != frameAck {
+			return fmt.Errorf("unexpected frame %d", frameType)
+		}
+
+		seq, err := decodeSeq(payload)
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.trimAcked(seq)
+		c.mu.Unlock()
+	}
+}
+
+// trimAcked removes entries up to and including seq (caller holds the lock)
+func (c *Client) trimAcked(seq uint64) {
+	n := 0
+	for n < len(c.pending) && c.pending[n].seq <= seq {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	atomic.AddUint64(&c.acked, uint64(n))
+	c.pending = append(c.pending[:0], c.pending[n:]...)
+}
+
+// Stop closes the link
+func (c *Client) Stop() {
+	close(c.shutdown)
+}
@@ -0,0 +1,130 @@
+// Package relay implements the binary protocol used on node-to-node links.
+//
+// Every message is a frame:
+//
+//	[4 bytes big-endian length of type+payload][1 byte type][payload]
+//
+// A sender opens a TCP connection and sends HELLO with its stream ID and token.
+// The receiver answers HELLO_ACK with the last sequence it has seen on that
+// stream, so the sender can resume from there after a reconnect. Entries are
+// then shipped in BATCH frames (first sequence, count, zstd-compressed NDJSON)
+// and the receiver replies with an ACK carrying the last sequence it accepted.
+package relay
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Frame types
+const (
+	frameHello    byte = 1
+	frameHelloAck byte = 2
+	frameBatch    byte = 3
+	frameAck      byte = 4
+	frameError    byte = 5
+)
+
+// maxFrameSize guards against corrupt or hostile length prefixes
+const maxFrameSize = 64 * 1024 * 1024
+
+// errFrameTooLarge is returned for frames above maxFrameSize
+var errFrameTooLarge = errors.New("relay: frame too large")
+
+// writeFrame writes a single length-prefixed frame
+func writeFrame(w io.Writer, frameType byte, payload []byte) error {
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[:4], uint32(len(payload)+1))
+	header[4] = frameType
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame reads a single length-prefixed frame
+func readFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	if length == 0 {
+		return 0, nil, fmt.Errorf("relay: empty frame")
+	}
+	if length > maxFrameSize {
+		return 0, nil, errFrameTooLarge
+	}
+
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[4], payload, nil
+}
+
+// encodeHello packs the stream ID and token as two length-prefixed strings
+func encodeHello(streamID, token string) []byte {
+	buf := make([]byte, 0, 4+len(streamID)+len(token))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(streamID)))
+	buf = append(buf, streamID...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(token)))
+	buf = append(buf, token...)
+	return buf
+}
+
+// decodeHello unpacks a HELLO payload
+func decodeHello(payload []byte) (streamID, token string, err error) {
+	streamID, rest, err := readString(payload)
+	if err != nil {
+		return "", "", err
+	}
+	token, _, err = readString(rest)
+	return streamID, token, err
+}
+
+// readString reads a uint16 length-prefixed string
+func readString(buf []byte) (string, []byte, error) {
+	if len(buf) < 2 {
+		return "", nil, fmt.Errorf("relay: truncated hello")
+	}
+	n := int(binary.BigEndian.Uint16(buf))
+	if len(buf) < 2+n {
+		return "", nil, fmt.Errorf("relay: truncated hello")
+	}
+	return string(buf[2 : 2+n]), buf[2+n:], nil
+}
+
+// encodeSeq packs a sequence number (HELLO_ACK and ACK payloads)
+func encodeSeq(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+// decodeSeq unpacks a sequence number
+func decodeSeq(payload []byte) (uint64, error) {
+	if len(payload) != 8 {
+		return 0, fmt.Errorf("relay: bad sequence payload")
+	}
+	return binary.BigEndian.Uint64(payload), nil
+}
+
+// encodeBatchHeader prefixes compressed entries with their first sequence and count
+func encodeBatchHeader(firstSeq uint64, count int, compressed []byte) []byte {
+	buf := make([]byte, 0, 12+len(compressed))
+	buf = binary.BigEndian.AppendUint64(buf, firstSeq)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(count))
+	return append(buf, compressed...)
+}
+
+// decodeBatchHeader splits a BATCH payload
+func decodeBatchHeader(payload []byte) (firstSeq uint64, count int, compressed []byte, err error) {
+	if len(payload) < 12 {
+		return 0, 0, nil, fmt.Errorf("relay: truncated batch")
+	}
+	return binary.BigEndian.Uint64(payload), int(binary.BigEndian.Uint32(payload[8:])), payload[12:], nil
+}
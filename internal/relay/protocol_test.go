@@ -0,0 +1,134 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		frameType byte
+		payload   []byte
+	}{
+		{"hello", frameHello, encodeHello("stream", "token")},
+		{"ack", frameAck, encodeSeq(42)},
+		{"empty payload", frameError, nil},
+		{"binary payload", frameBatch, []byte{0, 1, 2, 0xff}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := writeFrame(&buf, test.frameType, test.payload); err != nil {
+			t.Fatalf("%s: writeFrame: %v", test.name, err)
+		}
+		if length := binary.BigEndian.Uint32(buf.Bytes()); length != uint32(len(test.payload)+1) {
+			t.Errorf("%s: length prefix = %d, want %d", test.name, length, len(test.payload)+1)
+		}
+		frameType, payload, err := readFrame(&buf)
+		if err != nil {
+			t.Fatalf("%s: readFrame: %v", test.name, err)
+		}
+		if frameType != test.frameType || !bytes.Equal(payload, test.payload) {
+			t.Errorf("%s: read type %d payload %x, want type %d payload %x", test.name, frameType, payload, test.frameType, test.payload)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("%s: %d bytes left after the frame", test.name, buf.Len())
+		}
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	tooLarge := binary.BigEndian.AppendUint32(nil, maxFrameSize+1)
+	tests := []struct {
+		name  string
+		input []byte
+		want  error  // Matched with errors.Is when set
+		text  string // Otherwise matched against the message
+	}{
+		{name: "no data", input: nil, want: io.EOF},
+		{name: "short header", input: []byte{0, 0, 0}, want: io.ErrUnexpectedEOF},
+		{name: "zero length", input: []byte{0, 0, 0, 0, frameAck}, text: "empty frame"},
+		{name: "too large", input: append(tooLarge, frameBatch), want: errFrameTooLarge},
+		{name: "truncated payload", input: []byte{0, 0, 0, 9, frameAck, 1, 2}, want: io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		_, _, err := readFrame(bytes.NewReader(test.input))
+		switch {
+		case err == nil:
+			t.Errorf("%s: readFrame succeeded, want an error", test.name)
+		case test.want != nil && !errors.Is(err, test.want):
+			t.Errorf("%s: readFrame = %v, want %v", test.name, err, test.want)
+		case test.text != "" && !strings.Contains(err.Error(), test.text):
+			t.Errorf("%s: readFrame = %v, want %q", test.name, err, test.text)
+		}
+	}
+}
+
+func TestHelloRoundTrip(t *testing.T) {
+	tests := []struct{ streamID, token string }{
+		{"3f2b", "secret"},
+		{"3f2b", ""},
+		{"", ""},
+		{"ü-stream", strings.Repeat("t", 1000)},
+	}
+	for _, test := range tests {
+		streamID, token, err := decodeHello(encodeHello(test.streamID, test.token))
+		if err != nil {
+			t.Fatalf("decodeHello(%q, %q): %v", test.streamID, test.token, err)
+		}
+		if streamID != test.streamID || token != test.token {
+			t.Errorf("decodeHello = %q, %q, want %q, %q", streamID, token, test.streamID, test.token)
+		}
+	}
+}
+
+func TestDecodeHelloTruncated(t *testing.T) {
+	hello := encodeHello("stream", "token")
+	for _, payload := range [][]byte{nil, {0}, hello[:5], hello[:9], hello[:len(hello)-1]} {
+		if _, _, err := decodeHello(payload); err == nil {
+			t.Errorf("decodeHello(%x) succeeded, want an error", payload)
+		}
+	}
+}
+
+func TestSeqRoundTrip(t *testing.T) {
+	for _, seq := range []uint64{0, 1, 1 << 40, ^uint64(0)} {
+		got, err := decodeSeq(encodeSeq(seq))
+		if err != nil || got != seq {
+			t.Errorf("decodeSeq(encodeSeq(%d)) = %d, %v", seq, got, err)
+		}
+	}
+	for _, payload := range [][]byte{nil, make([]byte, 7), make([]byte, 9)} {
+		if _, err := decodeSeq(payload); err == nil {
+			t.Errorf("decodeSeq of %d bytes succeeded, want an error", len(payload))
+		}
+	}
+}
+
+func TestBatchHeaderRoundTrip(t *testing.T) {
+	tests := []struct {
+		firstSeq   uint64
+		count      int
+		compressed []byte
+	}{
+		{1, 1, []byte("data")},
+		{1 << 33, 1000, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+		{7, 0, nil},
+	}
+	for _, test := range tests {
+		firstSeq, count, compressed, err := decodeBatchHeader(encodeBatchHeader(test.firstSeq, test.count, test.compressed))
+		if err != nil {
+			t.Fatalf("decodeBatchHeader: %v", err)
+		}
+		if firstSeq != test.firstSeq || count != test.count || !bytes.Equal(compressed, test.compressed) {
+			t.Errorf("decodeBatchHeader = %d, %d, %x, want %d, %d, %x", firstSeq, count, compressed, test.firstSeq, test.count, test.compressed)
+		}
+	}
+	if _, _, _, err := decodeBatchHeader(make([]byte, 11)); err == nil {
+		t.Error("decodeBatchHeader of 11 bytes succeeded, want an error")
+	}
+}
@@ -0,0 +1,227 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"logstream/internal/auth"
+	"logstream/pkg/models"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ServerStats tracks relay receiver progress
+type ServerStats struct {
+	Connections int    `json:"connections"`
+	Received    uint64 `json:"received"`
+	Duplicates  uint64 `json:"duplicates"`
+	Rejected    uint64 `json:"rejected"`
+}
+
+// maxBatchDecoded caps how large a BATCH may decompress to, so a small
+// frame can't expand into gigabytes
+const maxBatchDecoded = 4 * maxFrameSize
+
+// Server receives relayed entries and hands them to a handler
+type Server struct {
+	addr         string
+	authenticate func(token string) (auth.Principal, bool)
+	handler      func(ctx context.Context, entry models.LogEntry) bool
+	decoder      *zstd.Decoder
+	listener     net.Listener
+	lastSeq      map[string]uint64 // stream ID -> last sequence accepted
+	connections  int
+	mu           sync.Mutex
+	received     uint64
+	duplicates   uint64
+	rejected     uint64
+}
+
+// NewServer creates a relay receiver. authenticate resolves the token a
+// sender presents to the principal its entries are ingested as, which the
+// handler finds in its context (see auth.PrincipalFrom); nil accepts every
+// sender. handler returns false if it couldn't accept an entry.
+func NewServer(addr string, authenticate func(token string) (auth.Principal, bool), handler func(ctx context.Context, entry models.LogEntry) bool) *Server {
+	// DecodeAll on a nil-reader decoder is safe for concurrent use
+	decoder, _ := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxBatchDecoded))
+
+	return &Server{
+		addr:         addr,
+		authenticate: authenticate,
+		handler:      handler,
+		decoder:      decoder,
+		lastSeq:      make(map[string]uint64),
+	}
+}
+
+// Start binds the listener and accepts connections in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	go s.acceptLoop()
+	return nil
+}
+
+// GetStats returns current receiver statistics
+func (s *Server) GetStats() ServerStats {
+	s.mu.Lock()
+	connections := s.connections
+	s.mu.Unlock()
+
+	return ServerStats{
+		Connections: connections,
+		Received:    atomic.LoadUint64(&s.received),
+		Duplicates:  atomic.LoadUint64(&s.duplicates),
+		Rejected:    atomic.LoadUint64(&s.rejected),
+	}
+}
+
+// acceptLoop serves each sender on its own goroutine
+func (s *Server) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			// Listener closed by Stop
+			return
+		}
+		go s.serve(conn)
+	}
+}
+
+// serve runs the handshake and then processes batches until the sender disconnects
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	s.mu.Lock()
+	s.connections++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.connections--
+		s.mu.Unlock()
+	}()
+
+	reader := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	frameType, payload, err := readFrame(reader)
+	if err != nil || frameType != frameHello {
+		return
+	}
+	streamID, token, err := decodeHello(payload)
+	if err != nil {
+		writeFrame(conn, frameError, []byte(err.Error()))
+		return
+	}
+	ctx := context.Background()
+	if s.authenticate != nil {
+		principal, ok := s.authenticate(token)
+		if !ok {
+			writeFrame(conn, frameError, []byte("unauthorized"))
+			return
+		}
+		ctx = auth.WithPrincipal(ctx, principal)
+	}
+
+	s.mu.Lock()
+	lastSeq := s.lastSeq[streamID]
+	s.mu.Unlock()
+
+	if err := writeFrame(conn, frameHelloAck, encodeSeq(lastSeq)); err != nil {
+		return
+	}
+
+	for {
+		// Links can idle for a long time between bursts
+		conn.SetReadDeadline(time.Time{})
+		frameType, payload, err := readFrame(reader)
+		if err != nil {
+			return
+		}
+		if frameType != frameBatch {
+			writeFrame(conn, frameError, []byte(fmt.Sprintf("unexpected frame %d", frameType)))
+			return
+		}
+
+		acked, err := s.processBatch(ctx, streamID, payload)
+		if err != nil {
+			writeFrame(conn, frameError, []byte(err.Error()))
+			return
+		}
+		if err := writeFrame(conn, frameAck, encodeSeq(acked)); err != nil {
+			return
+		}
+	}
+}
+
+// processBatch decodes a batch, skips entries already seen on this stream and
+// returns the last sequence accepted. ctx carries the sender's principal.
+func (s *Server) processBatch(ctx context.Context, streamID string, payload []byte) (uint64, error) {
+	firstSeq, count, compressed, err := decodeBatchHeader(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	raw, err := s.decoder.DecodeAll(compressed, nil)
+	if err != nil {
+		return 0, fmt.Errorf("decompress: %w", err)
+	}
+
+	s.mu.Lock()
+	lastSeq := s.lastSeq[streamID]
+	s.mu.Unlock()
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	for i := 0; i < count; i++ {
+		var entry models.LogEntry
+		if err := dec.Decode(&entry); err != nil {
+			// Keep what was applied, or a resend would store it twice
+			s.mu.Lock()
+			s.lastSeq[streamID] = lastSeq
+			s.mu.Unlock()
+			return lastSeq, fmt.Errorf("decode entry %d: %w", i, err)
+		}
+
+		seq := firstSeq + uint64(i)
+		if seq <= lastSeq {
+			// Resent after a reconnect, already have it
+			atomic.AddUint64(&s.duplicates, 1)
+			continue
+		}
+
+		// A full queue on our side is not the sender's problem to retry, so count and move on
+		if !s.handler(ctx, entry) {
+			atomic.AddUint64(&s.rejected, 1)
+		} else {
+			atomic.AddUint64(&s.received, 1)
+		}
+		lastSeq = seq
+	}
+
+	s.mu.Lock()
+	s.lastSeq[streamID] = lastSeq
+	s.mu.Unlock()
+
+	if dec.More() {
+		return lastSeq, fmt.Errorf("batch holds more than the %d entries its header counts", count)
+	}
+	return lastSeq, nil
+}
+
+// Stop closes the listener
+func (s *Server) Stop() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
@@ -0,0 +1,233 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"logstream/internal/auth"
+	"logstream/pkg/models"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// encodeBatch builds a BATCH payload the way the client does
+func encodeBatch(t *testing.T, firstSeq uint64, count int, ndjson string) []byte {
+	t.Helper()
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encodeBatchHeader(firstSeq, count, encoder.EncodeAll([]byte(ndjson), nil))
+}
+
+// zeros compresses size zero bytes, which zstd shrinks to almost nothing
+func zeros(t *testing.T, size int64) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	encoder, err := zstd.NewWriter(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.CopyN(encoder, zeroReader{}, size); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return compressed.Bytes()
+}
+
+// zeroReader reads zero bytes forever
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// ndjson encodes entries one per line
+func ndjson(entries ...models.LogEntry) string {
+	var lines strings.Builder
+	for _, entry := range entries {
+		data, _ := json.Marshal(entry)
+		lines.Write(data)
+		lines.WriteByte('\n')
+	}
+	return lines.String()
+}
+
+// collector records the entries a server hands over
+type collector struct {
+	mu        sync.Mutex
+	entries   []models.LogEntry
+	accept    bool
+	principal auth.Principal // Of the last entry's sender
+}
+
+func (c *collector) handle(ctx context.Context, entry models.LogEntry) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, entry)
+	c.principal, _ = auth.PrincipalFrom(ctx)
+	return c.accept
+}
+
+func (c *collector) messages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	messages := make([]string, len(c.entries))
+	for i, entry := range c.entries {
+		messages[i] = entry.Message
+	}
+	return messages
+}
+
+func TestProcessBatchSkipsResentEntries(t *testing.T) {
+	handler := &collector{accept: true}
+	server := NewServer("", nil, handler.handle)
+
+	a, b, c := models.LogEntry{Message: "a"}, models.LogEntry{Message: "b"}, models.LogEntry{Message: "c"}
+	acked, err := server.processBatch(context.Background(), "stream", encodeBatch(t, 1, 2, ndjson(a, b)))
+	if err != nil || acked != 2 {
+		t.Fatalf("first batch = %d, %v, want 2, nil", acked, err)
+	}
+	// Resent after a reconnect, overlapping what was already applied
+	acked, err = server.processBatch(context.Background(), "stream", encodeBatch(t, 2, 2, ndjson(b, c)))
+	if err != nil || acked != 3 {
+		t.Fatalf("overlapping batch = %d, %v, want 3, nil", acked, err)
+	}
+	// Another stream has its own sequence
+	if acked, err := server.processBatch(context.Background(), "other", encodeBatch(t, 1, 1, ndjson(a))); err != nil || acked != 1 {
+		t.Fatalf("other stream = %d, %v, want 1, nil", acked, err)
+	}
+
+	if got := strings.Join(handler.messages(), ","); got != "a,b,c,a" {
+		t.Errorf("handled %s, want a,b,c,a", got)
+	}
+	stats := server.GetStats()
+	if stats.Received != 4 || stats.Duplicates != 1 || stats.Rejected != 0 {
+		t.Errorf("stats = %+v, want 4 received, 1 duplicate", stats)
+	}
+}
+
+func TestProcessBatchCountsRejectedEntries(t *testing.T) {
+	server := NewServer("", nil, (&collector{accept: false}).handle)
+
+	acked, err := server.processBatch(context.Background(), "stream", encodeBatch(t, 1, 2, ndjson(models.LogEntry{Message: "a"}, models.LogEntry{Message: "b"})))
+	if err != nil || acked != 2 {
+		t.Fatalf("processBatch = %d, %v, want 2, nil", acked, err)
+	}
+	if stats := server.GetStats(); stats.Rejected != 2 || stats.Received != 0 {
+		t.Errorf("stats = %+v, want 2 rejected", stats)
+	}
+}
+
+func TestProcessBatchErrors(t *testing.T) {
+	valid := ndjson(models.LogEntry{Message: "a"})
+	tests := []struct {
+		name      string
+		payload   []byte
+		wantAcked uint64
+		text      string
+	}{
+		{name: "truncated header", payload: []byte{0, 0, 0}, text: "truncated batch"},
+		{name: "not zstd", payload: encodeBatchHeader(1, 1, []byte("plain text")), text: "decompress"},
+		{name: "fewer entries than counted", payload: encodeBatch(t, 1, 2, valid), wantAcked: 1, text: "decode entry 1"},
+		{name: "corrupt entry", payload: encodeBatch(t, 1, 2, valid+"{not json\n"), wantAcked: 1, text: "decode entry 1"},
+		{name: "more entries than counted", payload: encodeBatch(t, 1, 1, valid+valid), wantAcked: 1, text: "more than the 1 entries"},
+		{name: "decompression bomb", payload: encodeBatchHeader(1, 1, zeros(t, maxBatchDecoded+1)), text: "decompress"},
+	}
+	for _, test := range tests {
+		handler := &collector{accept: true}
+		server := NewServer("", nil, handler.handle)
+		acked, err := server.processBatch(context.Background(), "stream", test.payload)
+		if err == nil || !strings.Contains(err.Error(), test.text) {
+			t.Errorf("%s: processBatch = %v, want an error containing %q", test.name, err, test.text)
+		}
+		if acked != test.wantAcked {
+			t.Errorf("%s: acked %d, want %d", test.name, acked, test.wantAcked)
+		}
+		// What was applied before the error counts as seen, so a resend skips it
+		if _, err := server.processBatch(context.Background(), "stream", encodeBatch(t, 1, 1, valid)); err != nil {
+			t.Fatalf("%s: resend: %v", test.name, err)
+		}
+		if got := len(handler.messages()); uint64(got) != max(test.wantAcked, 1) {
+			t.Errorf("%s: handled %d entries after the resend, want %d", test.name, got, max(test.wantAcked, 1))
+		}
+	}
+}
+
+// startServer runs a relay receiver on a free local port, accepting senders
+// with token as the given service's ingest token
+func startServer(t *testing.T, token string, handler func(context.Context, models.LogEntry) bool) *Server {
+	t.Helper()
+	authenticate := func(presented string) (auth.Principal, bool) {
+		return auth.Principal{Role: auth.RoleIngest, Service: "api"}, presented == token
+	}
+	server := NewServer("127.0.0.1:0", authenticate, handler)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { server.Stop() })
+	return server
+}
+
+func TestServerRejectsWrongToken(t *testing.T) {
+	server := startServer(t, "secret", (&collector{accept: true}).handle)
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := writeFrame(conn, frameHello, encodeHello("stream", "wrong")); err != nil {
+		t.Fatal(err)
+	}
+	frameType, payload, err := readFrame(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatalf("readFrame: %v", err)
+	}
+	if frameType != frameError || string(payload) != "unauthorized" {
+		t.Errorf("reply = %d %q, want an unauthorized error frame", frameType, payload)
+	}
+}
+
+func TestClientShipsToServer(t *testing.T) {
+	handler := &collector{accept: true}
+	server := startServer(t, "secret", handler.handle)
+
+	client := NewClient(ClientConfig{Addr: server.listener.Addr().String(), Token: "secret", FlushInterval: 10 * time.Millisecond})
+	client.Start()
+	defer client.Stop()
+	for _, message := range []string{"a", "b", "c"} {
+		if !client.Send(models.LogEntry{Message: message}) {
+			t.Fatalf("Send(%s) = false", message)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.GetStats().Acked < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("client stats = %+v after 5s, want 3 acked", client.GetStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := strings.Join(handler.messages(), ","); got != "a,b,c" {
+		t.Errorf("server received %s, want a,b,c", got)
+	}
+	if handler.principal.Service != "api" {
+		t.Errorf("handler saw principal %+v, want the token's", handler.principal)
+	}
+	if stats := client.GetStats(); stats.Pending != 0 {
+		t.Errorf("client stats = %+v, want nothing pending", stats)
+	}
+}
@@ -0,0 +1,383 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"logstream/internal/alerting"
+	"logstream/internal/relay"
+	"logstream/pkg/models"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Role is a node's position in an active/standby pair
+type Role string
+
+// Role constants
+const (
+	RoleActive  Role = "active"
+	RoleStandby Role = "standby"
+)
+
+// Replication endpoints served by every node
+const (
+	EntriesPath = "/replication/entries"
+	AlertsPath  = "/replication/alerts"
+	DemotePath  = "/replication/demote"
+	HealthPath  = "/health"
+)
+
+// Config controls replication and failover between a pair of nodes
+type Config struct {
+	Role           Role
+	PeerURL        string        // Base URL of the other node, e.g. http://standby:8080
+	PeerRelayAddr  string        // Peer's relay listener; entries use the binary relay protocol when set
+	Token          string        // Bearer token presented to the peer
+	BatchSize      int           // Entries per replication request
+	FlushInterval  time.Duration // Max time an entry waits before being shipped
+	HealthInterval time.Duration // How often the standby checks the active node
+	FailoverAfter  int           // Consecutive failed checks before auto-promotion (0 disables)
+}
+
+// Stats tracks replication progress
+type Stats struct {
+	Role       Role   `json:"role"`
+	PeerURL    string `json:"peer_url"`
+	Replicated uint64 `json:"replicated"`
+	Failed     uint64 `json:"failed"` // Requests the peer didn't take; entry batches are retried
+	Dropped    uint64 `json:"dropped"`
+
+	Relay *relay.ClientStats `json:"relay,omitempty"`
+}
+
+// Node replicates entries and alerts to its peer while active, and watches the
+// peer's health while standby so it can take over
+type Node struct {
+	config       Config
+	role         Role
+	mu           sync.RWMutex
+	client       *http.Client
+	entryQueue   chan models.LogEntry
+	alertQueue   chan alerting.Alert
+	onRoleChange func(Role)
+	relayClient  *relay.Client
+	replicated   uint64
+	failed       uint64
+	dropped      uint64
+	shutdown     chan struct{}
+}
+
+// NewNode creates a replication node; onRoleChange is called after every promotion or demotion
+func NewNode(config Config, onRoleChange func(Role)) *Node {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 100 * time.Millisecond
+	}
+	if config.HealthInterval <= 0 {
+		config.HealthInterval = 2 * time.Second
+	}
+
+	n := &Node{
+		config:       config,
+		role:         config.Role,
+		client:       &http.Client{Timeout: 5 * time.Second},
+		entryQueue:   make(chan models.LogEntry, 10000),
+		alertQueue:   make(chan alerting.Alert, 100),
+		onRoleChange: onRoleChange,
+		shutdown:     make(chan struct{}),
+	}
+
+	if config.PeerRelayAddr != "" {
+		n.relayClient = relay.NewClient(relay.ClientConfig{
+			Addr:          config.PeerRelayAddr,
+			Token:         config.Token,
+			BatchSize:     config.BatchSize,
+			FlushInterval: config.FlushInterval,
+		})
+	}
+	return n
+}
+
+// Start begins shipping to the peer and health-checking it
+func (n *Node) Start() {
+	if n.relayClient != nil {
+		n.relayClient.Start()
+	} else {
+		go n.shipEntries()
+	}
+	go n.shipAlerts()
+	go n.watchPeer()
+}
+
+// Role returns the node's current role
+func (n *Node) Role() Role {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.role
+}
+
+// IsActive reports whether this node currently accepts writes
+func (n *Node) IsActive() bool {
+	return n.Role() == RoleActive
+}
+
+// PeerURL returns the base URL of the other node
+func (n *Node) PeerURL() string {
+	return n.config.PeerURL
+}
+
+// Promote makes this node active and tells the old active node to step down
+func (n *Node) Promote() {
+	if !n.setRole(RoleActive) {
+		return
+	}
+
+	// Best effort: the old active may be the reason we're promoting
+	go func() {
+		req, err := n.newPeerRequest(DemotePath, nil)
+		if err != nil {
+			return
+		}
+		if resp, err := n.client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+}
+
+// Demote makes this node a standby
+func (n *Node) Demote() {
+	n.setRole(RoleStandby)
+}
+
+// setRole switches roles, returning false if the node already had that role
+func (n *Node) setRole(role Role) bool {
+	n.mu.Lock()
+	if n.role == role {
+		n.mu.Unlock()
+		return false
+	}
+	n.role = role
+	n.mu.Unlock()
+
+	fmt.Printf("🔁 Node is now %s\n", role)
+	if n.onRoleChange != nil {
+		n.onRoleChange(role)
+	}
+	return true
+}
+
+// ReplicateEntry queues a stored entry for the peer (non-blocking)
+func (n *Node) ReplicateEntry(entry models.LogEntry) {
+	if n.config.PeerURL == "" || !n.IsActive() {
+		return
+	}
+
+	if n.relayClient != nil {
+		n.relayClient.Send(entry)
+		return
+	}
+
+	select {
+	case n.entryQueue <- entry:
+	default:
+		// Peer can't keep up, drop and count so the gap is visible
+		atomic.AddUint64(&n.dropped, 1)
+	}
+}
+
+// ReplicateAlert queues a triggered alert for the peer's history (non-blocking)
+func (n *Node) ReplicateAlert(alert alerting.Alert) {
+	if n.config.PeerURL == "" || !n.IsActive() {
+		return
+	}
+
+	select {
+	case n.alertQueue <- alert:
+	default:
+		atomic.AddUint64(&n.dropped, 1)
+	}
+}
+
+// GetStats returns current replication statistics
+func (n *Node) GetStats() Stats {
+	stats := Stats{
+		Role:       n.Role(),
+		PeerURL:    n.config.PeerURL,
+		Replicated: atomic.LoadUint64(&n.replicated),
+		Failed:     atomic.LoadUint64(&n.failed),
+		Dropped:    atomic.LoadUint64(&n.dropped),
+	}
+
+	if n.relayClient != nil {
+		relayStats := n.relayClient.GetStats()
+		stats.Relay = &relayStats
+		stats.Replicated += relayStats.Acked
+		stats.Dropped += relayStats.Dropped
+	}
+	return stats
+}
+
+// shipEntries batches queued entries and posts them to the peer. A batch the
+// peer didn't take is kept and posted again, backing off between attempts like
+// the relay client; meanwhile new entries wait in the queue, and once it is
+// full ReplicateEntry drops them.
+func (n *Node) shipEntries() {
+	ticker := time.NewTicker(n.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.LogEntry, 0, n.config.BatchSize)
+	backoff := 500 * time.Millisecond
+	var retry <-chan time.Time // Set while a failed batch waits to be posted again
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := n.post(EntriesPath, batch); err != nil {
+			atomic.AddUint64(&n.failed, 1)
+			fmt.Printf("⚠️  Replication to %s failed: %v (retrying in %v)\n", n.config.PeerURL, err, backoff)
+			retry = time.After(backoff)
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+			return
+		}
+		atomic.AddUint64(&n.replicated, uint64(len(batch)))
+		batch = batch[:0]
+		backoff = 500 * time.Millisecond
+	}
+
+	for {
+		// A full batch leaves new entries in the queue until it is posted
+		queue := n.entryQueue
+		if len(batch) >= n.config.BatchSize {
+			queue = nil
+		}
+
+		select {
+		case entry := <-queue:
+			batch = append(batch, entry)
+			if len(batch) >= n.config.BatchSize && retry == nil {
+				flush()
+			}
+		case <-ticker.C:
+			if retry == nil {
+				flush()
+			}
+		case <-retry:
+			retry = nil
+			flush()
+		case <-n.shutdown:
+			flush()
+			return
+		}
+	}
+}
+
+// shipAlerts posts triggered alerts to the peer as they happen
+func (n *Node) shipAlerts() {
+	for {
+		select {
+		case alert := <-n.alertQueue:
+			if err := n.post(AlertsPath, []alerting.Alert{alert}); err != nil {
+				atomic.AddUint64(&n.failed, 1)
+			}
+		case <-n.shutdown:
+			return
+		}
+	}
+}
+
+// watchPeer promotes a standby after the active node fails enough consecutive health checks
+func (n *Node) watchPeer() {
+	if n.config.PeerURL == "" || n.config.FailoverAfter <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(n.config.HealthInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ticker.C:
+			if n.IsActive() {
+				failures = 0
+				continue
+			}
+
+			if n.peerHealthy() {
+				failures = 0
+				continue
+			}
+
+			failures++
+			if failures >= n.config.FailoverAfter {
+				fmt.Printf("⚠️  Active node %s failed %d health checks, promoting\n", n.config.PeerURL, failures)
+				n.Promote()
+				failures = 0
+			}
+		case <-n.shutdown:
+			return
+		}
+	}
+}
+
+// peerHealthy checks the peer's health endpoint
+func (n *Node) peerHealthy() bool {
+	resp, err := n.client.Get(n.config.PeerURL + HealthPath)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// post sends a JSON payload to the peer
+func (n *Node) post(path string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := n.newPeerRequest(path, data)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer returned %s", resp.Status)
+	}
+	return nil
+}
+
+// newPeerRequest builds an authenticated POST to the peer
+func (n *Node) newPeerRequest(path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, n.config.PeerURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.config.Token)
+	}
+	return req, nil
+}
+
+// Stop stops shipping and health checks
+func (n *Node) Stop() {
+	close(n.shutdown)
+	if n.relayClient != nil {
+		n.relayClient.Stop()
+	}
+}
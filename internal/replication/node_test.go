@@ -0,0 +1,53 @@
+package replication
+
+import (
+	"encoding/json"
+	"logstream/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFailedBatchIsRetried(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	attempts := 0
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if attempts++; attempts == 1 {
+			http.Error(w, "not yet", http.StatusServiceUnavailable)
+			return
+		}
+		var entries []models.LogEntry
+		json.NewDecoder(r.Body).Decode(&entries)
+		for _, entry := range entries {
+			received = append(received, entry.ID)
+		}
+	}))
+	defer peer.Close()
+
+	node := NewNode(Config{Role: RoleActive, PeerURL: peer.URL, BatchSize: 2}, nil)
+	node.Start()
+	defer node.Stop()
+	for _, id := range []string{"a", "b", "c"} {
+		node.ReplicateEntry(models.LogEntry{ID: id})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for node.GetStats().Replicated < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := node.GetStats()
+	if stats.Replicated != 3 || stats.Failed != 1 {
+		t.Errorf("replicated %d with %d failed requests, want 3 with 1", stats.Replicated, stats.Failed)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"a", "b", "c"}; !slices.Equal(received, want) {
+		t.Errorf("peer received %v, want %v", received, want)
+	}
+}
@@ -0,0 +1,176 @@
+package sources
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"logstream/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVMapping says which CSV columns hold which LogEntry fields; every other
+// column becomes a metadata key
+type CSVMapping struct {
+	Timestamp       string // Column names, matched case-insensitively
+	Level           string
+	Message         string
+	Service         string
+	TimestampFormat string // Go layout, "unix" or "unix_ms" (default RFC3339)
+	DefaultService  string // Service for rows without one
+	DefaultLevel    string // Level for rows without one (default INFO)
+}
+
+// DefaultCSVMapping maps the columns named after the LogEntry fields
+func DefaultCSVMapping() CSVMapping {
+	return CSVMapping{
+		Timestamp:       "timestamp",
+		Level:           "level",
+		Message:         "message",
+		Service:         "service",
+		TimestampFormat: time.RFC3339,
+		DefaultLevel:    models.LevelInfo,
+	}
+}
+
+// CSVReader turns rows of a CSV with a header line into log entries
+type CSVReader struct {
+	reader  *csv.Reader
+	mapping CSVMapping
+	header  []string
+	fields  map[string]int // Mapped field -> column index
+	line    int            // Line of the last row read
+}
+
+// NewCSVReader reads the header line and resolves the mapping against it
+func NewCSVReader(reader io.Reader, mapping CSVMapping) (*CSVReader, error) {
+	cr := &CSVReader{
+		reader:  csv.NewReader(reader),
+		mapping: mapping,
+		fields:  make(map[string]int),
+	}
+	cr.reader.FieldsPerRecord = -1
+	cr.reader.ReuseRecord = true
+
+	header, err := cr.reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	cr.header = make([]string, len(header))
+	for i, column := range header {
+		cr.header[i] = strings.TrimSpace(column)
+	}
+
+	for field, column := range map[string]string{
+		"timestamp": mapping.Timestamp,
+		"level":     mapping.Level,
+		"message":   mapping.Message,
+		"service":   mapping.Service,
+	} {
+		for i, name := range cr.header {
+			if column != "" && strings.EqualFold(name, column) {
+				cr.fields[field] = i
+			}
+		}
+	}
+	if _, ok := cr.fields["message"]; !ok {
+		return nil, fmt.Errorf("message column %q not found in header", mapping.Message)
+	}
+	return cr, nil
+}
+
+// Next returns the entry for the next row, or io.EOF after the last one.
+// A row that can't be mapped returns an error naming its line; reading can continue.
+func (cr *CSVReader) Next() (models.LogEntry, error) {
+	record, err := cr.reader.Read()
+	if err != nil {
+		return models.LogEntry{}, err
+	}
+	line, _ := cr.reader.FieldPos(0)
+	cr.line = line
+
+	entry := models.LogEntry{
+		Level:    cr.mapping.DefaultLevel,
+		Service:  cr.mapping.DefaultService,
+		Source:   models.SourceCSV,
+		Metadata: make(map[string]interface{}),
+	}
+	if entry.Level == "" {
+		entry.Level = models.LevelInfo
+	}
+
+	for i, value := range record {
+		if i >= len(cr.header) {
+			break
+		}
+		value = strings.TrimSpace(value)
+
+		switch i {
+		case cr.column("timestamp"):
+			if value == "" {
+				continue
+			}
+			timestamp, err := parseCSVTimestamp(value, cr.mapping.TimestampFormat)
+			if err != nil {
+				return entry, fmt.Errorf("line %d: %w", line, err)
+			}
+			entry.Timestamp = timestamp
+		case cr.column("level"):
+			if value != "" {
+				entry.Level = strings.ToUpper(value)
+			}
+		case cr.column("message"):
+			entry.Message = value
+		case cr.column("service"):
+			if value != "" {
+				entry.Service = value
+			}
+		default:
+			if value != "" {
+				entry.Metadata[cr.header[i]] = value
+			}
+		}
+	}
+
+	if len(entry.Metadata) == 0 {
+		entry.Metadata = nil
+	}
+	return entry, nil
+}
+
+// Line returns the line number of the row last returned by Next
+func (cr *CSVReader) Line() int {
+	return cr.line
+}
+
+// column returns the index of a mapped field, or -1 when it isn't in the CSV
+func (cr *CSVReader) column(field string) int {
+	if i, ok := cr.fields[field]; ok {
+		return i
+	}
+	return -1
+}
+
+// parseCSVTimestamp parses a timestamp cell in the given format
+func parseCSVTimestamp(value, format string) (time.Time, error) {
+	switch format {
+	case "unix", "unix_ms":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s timestamp %q", format, value)
+		}
+		if format == "unix_ms" {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	case "":
+		format = time.RFC3339
+	}
+
+	timestamp, err := time.Parse(format, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q: %w", value, err)
+	}
+	return timestamp, nil
+}
@@ -0,0 +1,158 @@
+package sources
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"logstream/pkg/models"
+	"strings"
+	"time"
+)
+
+// BulkItem is one action of an Elasticsearch _bulk request
+type BulkItem struct {
+	Action string // index, create, update or delete
+	Index  string
+	ID     string
+	Entry  models.LogEntry // Mapped document, for index and create
+	Err    error           // Why the document couldn't be mapped
+}
+
+// bulkLevels maps common level spellings onto LogStream levels
+var bulkLevels = map[string]string{
+	"TRACE":    models.LevelInfo,
+	"DEBUG":    models.LevelInfo,
+	"INFO":     models.LevelInfo,
+	"NOTICE":   models.LevelInfo,
+	"WARN":     models.LevelWarning,
+	"WARNING":  models.LevelWarning,
+	"ERROR":    models.LevelError,
+	"ERR":      models.LevelError,
+	"CRIT":     models.LevelCritical,
+	"CRITICAL": models.LevelCritical,
+	"FATAL":    models.LevelCritical,
+	"ALERT":    models.LevelCritical,
+	"EMERG":    models.LevelCritical,
+}
+
+// ReadBulk parses the NDJSON body of an Elasticsearch _bulk request. Action lines
+// are followed by a document line except for delete; documents are mapped to entries
+// with ECS field names (@timestamp, message, log.level, service.name) and everything
+// else kept as metadata. defaultIndex applies to actions without an _index.
+func ReadBulk(reader io.Reader, defaultIndex string) ([]BulkItem, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	items := make([]BulkItem, 0)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal([]byte(line), &action); err != nil || len(action) != 1 {
+			return nil, fmt.Errorf("malformed action line %d", len(items)+1)
+		}
+
+		var item BulkItem
+		for name, meta := range action {
+			item = BulkItem{Action: name, Index: meta.Index, ID: meta.ID}
+		}
+		if item.Index == "" {
+			item.Index = defaultIndex
+		}
+
+		if item.Action == "delete" {
+			item.Err = fmt.Errorf("delete is not supported")
+			items = append(items, item)
+			continue
+		}
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("action %q without a document", item.Action)
+		}
+		if item.Action != "index" && item.Action != "create" {
+			item.Err = fmt.Errorf("%s is not supported", item.Action)
+			items = append(items, item)
+			continue
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			item.Err = fmt.Errorf("failed to parse document: %w", err)
+		} else {
+			item.Entry, item.Err = bulkDocToEntry(doc, item)
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
+
+// bulkDocToEntry maps an ECS-style document to a LogEntry
+func bulkDocToEntry(doc map[string]interface{}, item BulkItem) (models.LogEntry, error) {
+	entry := models.LogEntry{
+		ID:     item.ID,
+		Source: models.SourceBulk,
+	}
+
+	if value, ok := takeString(doc, "@timestamp", "timestamp"); ok {
+		timestamp, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return entry, fmt.Errorf("invalid @timestamp %q", value)
+		}
+		entry.Timestamp = timestamp
+	}
+
+	entry.Level = models.LevelInfo
+	if value, ok := takeString(doc, "log.level", "level"); ok {
+		level, known := bulkLevels[strings.ToUpper(value)]
+		if !known {
+			return entry, fmt.Errorf("unknown log level %q", value)
+		}
+		entry.Level = level
+	}
+
+	entry.Message, _ = takeString(doc, "message")
+	entry.Service, _ = takeString(doc, "service.name", "service")
+	if entry.Service == "" {
+		entry.Service = item.Index
+	}
+
+	if len(doc) > 0 {
+		entry.Metadata = doc
+	}
+	return entry, nil
+}
+
+// takeString removes and returns the first string found under the given keys.
+// Dotted keys are looked up both literally and as nested objects; emptied parent
+// objects are removed so they don't linger in metadata.
+func takeString(doc map[string]interface{}, keys ...string) (string, bool) {
+	for _, key := range keys {
+		if value, ok := doc[key].(string); ok {
+			delete(doc, key)
+			return value, true
+		}
+
+		parent, child, nested := strings.Cut(key, ".")
+		if !nested {
+			continue
+		}
+		object, ok := doc[parent].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if value, ok := object[child].(string); ok {
+			delete(object, child)
+			if len(object) == 0 {
+				delete(doc, parent)
+			}
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,123 @@
+package sources
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"logstream/pkg/models"
+	"logstream/pkg/source"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// filePollInterval is how often a followed file is checked for new lines
+const filePollInterval = 500 * time.Millisecond
+
+func init() {
+	source.Register(models.SourceFile, newFileSource)
+}
+
+// FileSource reads newline-delimited JSON or plain-text logs from a file,
+// optionally following it for lines appended later
+type FileSource struct {
+	path     string
+	service  string
+	follow   bool
+	shutdown chan struct{}
+}
+
+// newFileSource builds a FileSource from path=..., service=... and follow=true|false
+func newFileSource(config source.Config) (source.Source, error) {
+	path := config.Get("path", "")
+	if path == "" {
+		return nil, fmt.Errorf("file source: path is required")
+	}
+
+	return &FileSource{
+		path:     path,
+		service:  config.Get("service", strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))),
+		follow:   config.Get("follow", "false") == "true",
+		shutdown: make(chan struct{}),
+	}, nil
+}
+
+// Start opens the file and reads it in the background
+func (fs *FileSource) Start(out chan<- models.LogEntry) error {
+	file, err := os.Open(fs.path)
+	if err != nil {
+		return err
+	}
+	go fs.run(file, out)
+	return nil
+}
+
+// run emits every line, then polls for more when following. A line over
+// maxLineSize is skipped with a warning.
+func (fs *FileSource) run(file *os.File, out chan<- models.LogEntry) {
+	defer file.Close()
+	reader := bufio.NewReaderSize(file, 64*1024)
+
+	var pending []byte
+	tooLong := false
+	for {
+		fragment, err := reader.ReadSlice('\n')
+		if len(pending)+len(fragment) > maxLineSize {
+			tooLong, pending = true, pending[:0]
+		}
+		if !tooLong {
+			pending = append(pending, fragment...)
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == nil {
+			if tooLong {
+				fmt.Printf("⚠️  File source %s skipped a line over %d bytes\n", fs.path, maxLineSize)
+			} else if !fs.emit(string(pending), out) {
+				return
+			}
+			pending, tooLong = pending[:0], false
+			continue
+		}
+
+		// Keep a partial last line until the writer finishes it
+		if err != io.EOF || !fs.follow {
+			if err != io.EOF {
+				fmt.Printf("⚠️  File source %s stopped: %v\n", fs.path, err)
+			}
+			if !tooLong {
+				fs.emit(string(pending), out)
+			}
+			return
+		}
+
+		select {
+		case <-time.After(filePollInterval):
+		case <-fs.shutdown:
+			return
+		}
+	}
+}
+
+// emit parses and sends one line; it returns false once the source is stopped
+func (fs *FileSource) emit(line string, out chan<- models.LogEntry) bool {
+	line = strings.TrimRight(line, " \t\r\n")
+	if strings.TrimSpace(line) == "" {
+		return true
+	}
+
+	select {
+	case out <- parseEntry(line, fs.service, models.SourceFile):
+		return true
+	case <-fs.shutdown:
+		return false
+	}
+}
+
+// Stop ends reading
+func (fs *FileSource) Stop() {
+	close(fs.shutdown)
+}
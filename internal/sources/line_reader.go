@@ -0,0 +1,105 @@
+package sources
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"logstream/pkg/models"
+	"strings"
+	"sync/atomic"
+)
+
+// maxLineSize bounds a single input line (stack traces can be long)
+const maxLineSize = 1024 * 1024
+
+// LineReader ingests newline-delimited logs from a stream such as stdin
+type LineReader struct {
+	reader   io.Reader
+	service  string
+	ingest   func(models.LogEntry) bool
+	accepted uint64
+	dropped  uint64
+}
+
+// NewLineReader creates a reader that stamps entries without a service with the given one
+// and hands each line to ingest (the Ingestor, or a Stitcher in front of it)
+func NewLineReader(reader io.Reader, service string, ingest func(models.LogEntry) bool) *LineReader {
+	return &LineReader{
+		reader:  reader,
+		service: service,
+		ingest:  ingest,
+	}
+}
+
+// Run reads lines until EOF, ingesting each as a JSON LogEntry or a plain-text message.
+// A line over maxLineSize is skipped and counted as dropped.
+func (lr *LineReader) Run() error {
+	reader := bufio.NewReaderSize(lr.reader, 64*1024)
+
+	for {
+		text, tooLong, err := readLine(reader)
+		if tooLong {
+			atomic.AddUint64(&lr.dropped, 1)
+		} else if line := strings.TrimRight(text, " \t\r"); strings.TrimSpace(line) != "" {
+			// Keep leading indentation, it matters for stack trace continuation lines
+			entry := parseEntry(line, lr.service, models.SourceStdin)
+			if lr.ingest(entry) {
+				atomic.AddUint64(&lr.accepted, 1)
+			} else {
+				atomic.AddUint64(&lr.dropped, 1)
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readLine reads the next line without its line ending. A line longer than
+// maxLineSize is read to its end but not kept, and reported as tooLong.
+func readLine(reader *bufio.Reader) (line string, tooLong bool, err error) {
+	var buf []byte
+	for {
+		fragment, isPrefix, err := reader.ReadLine()
+		if len(buf)+len(fragment) > maxLineSize {
+			tooLong, buf = true, nil
+		}
+		if !tooLong {
+			buf = append(buf, fragment...)
+		}
+		if !isPrefix || err != nil {
+			return string(buf), tooLong, err
+		}
+	}
+}
+
+// Counts returns how many lines were accepted and dropped so far
+func (lr *LineReader) Counts() (accepted, dropped uint64) {
+	return atomic.LoadUint64(&lr.accepted), atomic.LoadUint64(&lr.dropped)
+}
+
+// parseEntry decodes a JSON LogEntry or wraps plain text as an INFO message,
+// stamping service on entries that don't carry one
+func parseEntry(data string, service string, source string) models.LogEntry {
+	var entry models.LogEntry
+	if !strings.HasPrefix(strings.TrimSpace(data), "{") || json.Unmarshal([]byte(data), &entry) != nil {
+		entry = models.LogEntry{
+			Level:   models.LevelInfo,
+			Message: data,
+		}
+	}
+
+	if entry.Level == "" {
+		entry.Level = models.LevelInfo
+	}
+	if entry.Service == "" {
+		entry.Service = service
+	}
+	entry.Source = source
+	entry.FillDefaults()
+	return entry
+}
@@ -0,0 +1,90 @@
+package sources
+
+import (
+	"encoding/json"
+	"logstream/internal/ingestion"
+	"logstream/pkg/models"
+	"net"
+	"sync/atomic"
+)
+
+// maxDatagramSize is the largest UDP payload we accept
+const maxDatagramSize = 65535
+
+// UDPListener ingests one JSON-encoded LogEntry per datagram
+type UDPListener struct {
+	addr     string
+	conn     net.PacketConn
+	ingestor *ingestion.Ingestor
+	accepted uint64
+	invalid  uint64
+	dropped  uint64
+}
+
+// NewUDPListener creates a listener for the given address (e.g. ":5514")
+func NewUDPListener(addr string, ingestor *ingestion.Ingestor) *UDPListener {
+	return &UDPListener{
+		addr:     addr,
+		ingestor: ingestor,
+	}
+}
+
+// Start binds the socket and begins reading datagrams
+func (ul *UDPListener) Start() error {
+	conn, err := net.ListenPacket("udp", ul.addr)
+	if err != nil {
+		return err
+	}
+	ul.conn = conn
+
+	go ul.readLoop()
+	return nil
+}
+
+// readLoop decodes datagrams until the socket is closed
+func (ul *UDPListener) readLoop() {
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		n, _, err := ul.conn.ReadFrom(buf)
+		if err != nil {
+			// Socket closed by Stop
+			return
+		}
+
+		// Fire-and-forget producers get no error back, so just count bad packets
+		var entry models.LogEntry
+		err = json.Unmarshal(buf[:n], &entry)
+		entry.Source = models.SourceUDP
+		if err != nil {
+			atomic.AddUint64(&ul.invalid, 1)
+			ul.ingestor.RecordRejected(models.SourceUDP, ingestion.DropParseFailure, nil, err.Error())
+			continue
+		}
+		if err := entry.Validate(); err != nil {
+			atomic.AddUint64(&ul.invalid, 1)
+			ul.ingestor.RecordRejected(models.SourceUDP, ingestion.DropValidation, &entry, err.Error())
+			continue
+		}
+		entry.FillDefaults()
+
+		if ul.ingestor.Ingest(entry) {
+			atomic.AddUint64(&ul.accepted, 1)
+		} else {
+			atomic.AddUint64(&ul.dropped, 1)
+		}
+	}
+}
+
+// Counts returns how many datagrams were accepted, invalid and dropped so far
+func (ul *UDPListener) Counts() (accepted, invalid, dropped uint64) {
+	return atomic.LoadUint64(&ul.accepted), atomic.LoadUint64(&ul.invalid), atomic.LoadUint64(&ul.dropped)
+}
+
+// Stop closes the socket
+func (ul *UDPListener) Stop() error {
+	if ul.conn == nil {
+		return nil
+	}
+	return ul.conn.Close()
+}
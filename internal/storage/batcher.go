@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"logstream/pkg/models"
+	"sync"
+	"time"
+)
+
+// batcher collects stored entries and hands them to flush in batches, once a
+// batch is full or interval has passed. Database backends share it.
+type batcher struct {
+	pending  chan models.LogEntry
+	size     int
+	interval time.Duration
+	flush    func([]models.LogEntry)
+	wg       sync.WaitGroup
+	shutdown chan struct{}
+}
+
+// newBatcher creates a batcher; flush runs on a single goroutine
+func newBatcher(size int, interval time.Duration, flush func([]models.LogEntry)) *batcher {
+	return &batcher{
+		pending:  make(chan models.LogEntry, size*4),
+		size:     size,
+		interval: interval,
+		flush:    flush,
+		shutdown: make(chan struct{}),
+	}
+}
+
+// start begins the flush loop
+func (b *batcher) start() {
+	b.wg.Add(1)
+	go b.run()
+}
+
+// add queues an entry. It blocks while flushing is behind, which pushes back on the ingest queue.
+func (b *batcher) add(entry models.LogEntry) {
+	select {
+	case b.pending <- entry:
+	case <-b.shutdown:
+	}
+}
+
+// run flushes full batches immediately and partial ones every interval
+func (b *batcher) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	batch := make([]models.LogEntry, 0, b.size)
+	for {
+		select {
+		case entry := <-b.pending:
+			batch = append(batch, entry)
+			if len(batch) >= b.size {
+				b.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				b.flush(batch)
+				batch = batch[:0]
+			}
+		case <-b.shutdown:
+			// Drain what was already handed to us
+			for {
+				select {
+				case entry := <-b.pending:
+					batch = append(batch, entry)
+				default:
+					if len(batch) > 0 {
+						b.flush(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// stop flushes everything queued and waits for the flush loop to end
+func (b *batcher) stop() {
+	close(b.shutdown)
+	b.wg.Wait()
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+	"math"
+)
+
+// Bloom filter sizing: 10 bits per ID and 7 probes give about 1% false positives
+const (
+	bloomBitsPerID = 10
+	bloomProbes    = 7
+)
+
+// bloomFilter records which IDs a sealed segment holds, so lookups by ID
+// skip segments that certainly don't hold one
+type bloomFilter struct {
+	bits   []uint64
+	probes uint32
+}
+
+// idHash hashes an ID once; the filter's probes are derived from it
+func idHash(id string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return h.Sum64()
+}
+
+// newBloomFilter builds a filter from the hashes of a segment's IDs
+func newBloomFilter(hashes []uint64) *bloomFilter {
+	words := max(1, (len(hashes)*bloomBitsPerID+63)/64)
+	filter := &bloomFilter{bits: make([]uint64, words), probes: bloomProbes}
+	for _, hash := range hashes {
+		filter.probe(hash, func(word int, mask uint64) bool {
+			filter.bits[word] |= mask
+			return true
+		})
+	}
+	return filter
+}
+
+// probe calls fn with the word and bit of each of the hash's probes, until fn
+// returns false, using double hashing over the two halves of the hash
+func (f *bloomFilter) probe(hash uint64, fn func(word int, mask uint64) bool) bool {
+	size := uint64(len(f.bits)) * 64
+	h1, h2 := hash&math.MaxUint32, hash>>32|1
+	for i := uint64(0); i < uint64(f.probes); i++ {
+		bit := (h1 + i*h2) % size
+		if !fn(int(bit/64), 1<<(bit%64)) {
+			return false
+		}
+	}
+	return true
+}
+
+// mayContain reports whether the segment may hold the ID; false is certain
+func (f *bloomFilter) mayContain(id string) bool {
+	return f.probe(idHash(id), func(word int, mask uint64) bool {
+		return f.bits[word]&mask != 0
+	})
+}
+
+// bloomJSON is how a filter is kept in a segment's index file
+type bloomJSON struct {
+	Probes uint32 `json:"probes"`
+	Bits   string `json:"bits"` // Little-endian words, base64
+}
+
+// MarshalJSON encodes the filter's bits compactly
+func (f *bloomFilter) MarshalJSON() ([]byte, error) {
+	raw := make([]byte, len(f.bits)*8)
+	for i, word := range f.bits {
+		binary.LittleEndian.PutUint64(raw[i*8:], word)
+	}
+	return json.Marshal(bloomJSON{Probes: f.probes, Bits: base64.StdEncoding.EncodeToString(raw)})
+}
+
+// UnmarshalJSON decodes a filter written by MarshalJSON
+func (f *bloomFilter) UnmarshalJSON(data []byte) error {
+	var encoded bloomJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded.Bits)
+	if err != nil {
+		return err
+	}
+	f.probes = encoded.Probes
+	f.bits = make([]uint64, len(raw)/8)
+	for i := range f.bits {
+		f.bits[i] = binary.LittleEndian.Uint64(raw[i*8:])
+	}
+	if len(f.bits) == 0 {
+		// Nothing to probe; treat it as holding everything
+		f.bits, f.probes = []uint64{math.MaxUint64}, 1
+	}
+	return nil
+}
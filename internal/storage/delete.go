@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"bufio"
+	"io"
+	"logstream/pkg/models"
+	"os"
+)
+
+// rewriteLines rewrites a file of JSON-lines entries, encrypted or not,
+// without those the filter matches, calling kept with each remaining entry
+// and its new offset. Lines that don't decode are kept as they are. The file
+// is replaced atomically and left untouched when nothing matches.
+func rewriteLines(path string, filter Filter, keyring *Keyring, kept func(entry models.LogEntry, offset int64)) (int, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	tmpPath := path + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpPath)
+	defer out.Close()
+
+	reader := bufio.NewReaderSize(in, 64*1024)
+	writer := bufio.NewWriterSize(out, 64*1024)
+	lines, offset, err := keyring.readHeader(reader)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		// Kept lines stay encrypted with the data key the header carries
+		header := make([]byte, offset)
+		if _, err := in.ReadAt(header, 0); err != nil {
+			return 0, err
+		}
+		if _, err := writer.Write(header); err != nil {
+			return 0, err
+		}
+	}
+	removed := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var entry models.LogEntry
+		if lines.decode(line, &entry) == nil {
+			if filter.Matches(entry) {
+				removed++
+				continue
+			}
+			if kept != nil {
+				kept(entry, offset)
+			}
+		}
+		if _, err := writer.Write(line); err != nil {
+			return 0, err
+		}
+		offset += int64(len(line))
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if err := writer.Flush(); err != nil {
+		return 0, err
+	}
+	if err := out.Sync(); err != nil {
+		return 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, err
+	}
+	return removed, os.Rename(tmpPath, path)
+}
@@ -0,0 +1,972 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"logstream/pkg/models"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Segment files are named so they sort in write order
+const (
+	diskSegmentPattern = "seg-%020d.log"
+	diskIndexPattern   = "seg-%020d.idx"
+)
+
+// sparseInterval is how many entries apart the sparse index marks are
+const sparseInterval = 256
+
+// DiskConfig controls the disk-backed store
+type DiskConfig struct {
+	Dir          string
+	SegmentBytes int64         // Seal the active segment once it reaches this size
+	Partition    time.Duration // ... or once the clock enters the next partition, e.g. every 10 minutes
+	Retention    time.Duration // Delete segments whose newest entry is older (0 keeps them)
+	MaxBytes     int64         // Delete the oldest segments beyond this total size (0 is unlimited)
+	MaxResults   int           // Most entries a query returns (the newest ones)
+	Mmap         bool          // Read sealed segments through memory maps
+	Keyring      *Keyring      // Encrypts new segments and their indexes (nil writes plaintext)
+}
+
+// diskSegment describes one segment file. Sealed segments persist it as their .idx file.
+type diskSegment struct {
+	Seq      uint64         `json:"seq"`
+	Entries  int            `json:"entries"`
+	Bytes    int64          `json:"bytes"`
+	Created  time.Time      `json:"created"`
+	MinTime  time.Time      `json:"min_time"`
+	MaxTime  time.Time      `json:"max_time"`
+	Ordered  bool           `json:"ordered"` // Timestamps never went backwards, so Sparse is sorted
+	Levels   map[string]int `json:"levels"`
+	Nodes    map[string]int `json:"nodes"`
+	Services map[string]int `json:"services,omitempty"` // Missing from segments sealed before it was added
+	Sparse   []sparseMark   `json:"sparse"`
+	IDs      *bloomFilter   `json:"ids,omitempty"` // Built on sealing; missing from segments sealed before it was added
+	sealed   bool
+	lines    *lineCipher // Decrypts the data file's lines; nil when it is plaintext
+	idHashes []uint64    // Hashes of the IDs written so far, for IDs
+}
+
+// sparseMark points at every sparseInterval-th entry of a segment
+type sparseMark struct {
+	Offset    int64     `json:"offset"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DiskStore keeps logs in time-ordered segment files with sparse indexes,
+// so capacity is bounded by disk rather than memory
+type DiskStore struct {
+	config   DiskConfig
+	segments []*diskSegment // Oldest first; the last one is being written
+	file     *os.File
+	writer   *bufio.Writer
+	count    int
+	mu       sync.Mutex
+	shutdown chan struct{}
+}
+
+// NewDiskStore opens the segments in config.Dir, rebuilding the index of any
+// segment without one, and continues writing the newest segment
+func NewDiskStore(config DiskConfig) (*DiskStore, error) {
+	if config.SegmentBytes <= 0 {
+		config.SegmentBytes = 64 << 20
+	}
+	if config.Partition <= 0 {
+		config.Partition = time.Hour
+	}
+	if config.MaxResults <= 0 {
+		config.MaxResults = 10000
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	ds := &DiskStore{
+		config:   config,
+		shutdown: make(chan struct{}),
+	}
+
+	paths, err := filepath.Glob(filepath.Join(config.Dir, "seg-*.log"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	for i, path := range paths {
+		var seq uint64
+		if _, err := fmt.Sscanf(filepath.Base(path), diskSegmentPattern, &seq); err != nil {
+			continue
+		}
+
+		segment, err := ds.loadSegment(seq, i == len(paths)-1)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+		ds.segments = append(ds.segments, segment)
+		ds.count += segment.Entries
+	}
+
+	if last := len(ds.segments) - 1; last >= 0 && !ds.segments[last].sealed && ds.segments[last].Bytes > 0 &&
+		config.Keyring != nil && ds.segments[last].lines == nil {
+		// Written in plaintext before encryption was turned on; keep it, but encrypt from the next segment
+		ds.segments[last].sealed = true
+		if err := ds.writeIndex(ds.segments[last]); err != nil {
+			return nil, err
+		}
+	}
+	if len(ds.segments) == 0 || ds.segments[len(ds.segments)-1].sealed {
+		next := uint64(1)
+		if len(ds.segments) > 0 {
+			next = ds.segments[len(ds.segments)-1].Seq + 1
+		}
+		ds.segments = append(ds.segments, newDiskSegment(next))
+	}
+	if err := ds.openActive(); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// newDiskSegment creates the metadata for an empty segment
+func newDiskSegment(seq uint64) *diskSegment {
+	return &diskSegment{
+		Seq:      seq,
+		Created:  time.Now(),
+		Ordered:  true,
+		Levels:   make(map[string]int),
+		Nodes:    make(map[string]int),
+		Services: make(map[string]int),
+	}
+}
+
+// loadSegment reads a sealed segment's index, or rebuilds it by scanning the
+// segment when it has none (the segment that was active when we stopped)
+func (ds *DiskStore) loadSegment(seq uint64, last bool) (*diskSegment, error) {
+	if data, err := os.ReadFile(ds.indexPath(seq)); err == nil {
+		if data, err = ds.config.Keyring.openFile(data); err != nil {
+			return nil, fmt.Errorf("index: %w", err)
+		}
+		segment := &diskSegment{}
+		if err := json.Unmarshal(data, segment); err == nil {
+			segment.sealed = true
+			return segment, nil
+		}
+	}
+
+	segment := newDiskSegment(seq)
+	file, err := os.Open(ds.segmentPath(seq))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil {
+		segment.Created = info.ModTime()
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	lines, offset, err := ds.config.Keyring.readHeader(reader)
+	if err == io.EOF {
+		// A header cut short by a crash; start the segment over
+		return segment, os.Truncate(ds.segmentPath(seq), 0)
+	} else if err != nil {
+		return nil, err
+	}
+	segment.lines = lines
+	segment.Bytes = offset
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A line cut short by a crash; drop it so appends start on a clean line
+			if len(line) > 0 {
+				if err := os.Truncate(ds.segmentPath(seq), offset); err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var entry models.LogEntry
+		if lines.decode(line, &entry) == nil {
+			segment.add(entry, offset)
+		}
+		offset += int64(len(line))
+		segment.Bytes = offset
+	}
+
+	// Only the newest segment stays open for writing
+	if !last {
+		segment.sealed = true
+		if err := ds.writeIndex(segment); err != nil {
+			return nil, err
+		}
+	}
+	return segment, nil
+}
+
+// add records an entry written at offset in the segment metadata
+func (seg *diskSegment) add(entry models.LogEntry, offset int64) {
+	if seg.Entries%sparseInterval == 0 {
+		seg.Sparse = append(seg.Sparse, sparseMark{Offset: offset, Timestamp: entry.Timestamp})
+	}
+	if seg.Entries == 0 || entry.Timestamp.Before(seg.MinTime) {
+		seg.MinTime = entry.Timestamp
+	}
+	if entry.Timestamp.Before(seg.MaxTime) {
+		seg.Ordered = false
+	}
+	if entry.Timestamp.After(seg.MaxTime) {
+		seg.MaxTime = entry.Timestamp
+	}
+	seg.Levels[entry.Level]++
+	seg.Nodes[entry.Node]++
+	seg.Services[entry.Service]++
+	seg.idHashes = append(seg.idHashes, idHash(entry.ID))
+	seg.Entries++
+}
+
+// segmentPath returns the path of a segment's data file
+func (ds *DiskStore) segmentPath(seq uint64) string {
+	return filepath.Join(ds.config.Dir, fmt.Sprintf(diskSegmentPattern, seq))
+}
+
+// indexPath returns the path of a sealed segment's index file
+func (ds *DiskStore) indexPath(seq uint64) string {
+	return filepath.Join(ds.config.Dir, fmt.Sprintf(diskIndexPattern, seq))
+}
+
+// writeIndex persists a sealed segment's metadata atomically, building its
+// ID filter from the IDs gathered while it was written
+func (ds *DiskStore) writeIndex(segment *diskSegment) error {
+	if segment.idHashes != nil || segment.IDs == nil {
+		segment.IDs = newBloomFilter(segment.idHashes)
+		segment.idHashes = nil
+	}
+	data, err := json.Marshal(segment)
+	if err != nil {
+		return err
+	}
+	if data, err = ds.config.Keyring.sealFile(data); err != nil {
+		return err
+	}
+	tmp := ds.indexPath(segment.Seq) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ds.indexPath(segment.Seq))
+}
+
+// openActive opens the newest segment for appending, starting it with an
+// encryption header when it is new and a keyring is set. Callers hold mu.
+func (ds *DiskStore) openActive() error {
+	active := ds.segments[len(ds.segments)-1]
+	file, err := os.OpenFile(ds.segmentPath(active.Seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	ds.file = file
+	ds.writer = bufio.NewWriterSize(file, 64*1024)
+
+	if ds.config.Keyring != nil && active.Bytes == 0 {
+		header, lines, err := ds.config.Keyring.newHeader()
+		if err != nil {
+			return err
+		}
+		if _, err := ds.writer.Write(header); err != nil {
+			return err
+		}
+		active.lines = lines
+		active.Bytes = int64(len(header))
+	}
+	return nil
+}
+
+// Store appends an entry to the active segment
+func (ds *DiskStore) Store(entry models.LogEntry) {
+	data, err := encodeDiskEntry(entry)
+	if err != nil {
+		return
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.write(entry, data)
+}
+
+// StoreBatch appends entries to the active segment, encoding them before
+// taking the lock once for the whole batch
+func (ds *DiskStore) StoreBatch(entries []models.LogEntry) {
+	encoded := make([][]byte, len(entries))
+	for i, entry := range entries {
+		encoded[i], _ = encodeDiskEntry(entry)
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for i, entry := range entries {
+		if encoded[i] != nil {
+			ds.write(entry, encoded[i])
+		}
+	}
+}
+
+// encodeDiskEntry encodes an entry as a segment line
+func encodeDiskEntry(entry models.LogEntry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to encode log %s: %v\n", entry.ID, err)
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// write appends an encoded entry, sealing the active segment first when it
+// is full or its partition has ended. Callers hold mu.
+func (ds *DiskStore) write(entry models.LogEntry, data []byte) {
+	if ds.file == nil {
+		return
+	}
+
+	now := time.Now()
+	active := ds.segments[len(ds.segments)-1]
+	if active.Bytes >= ds.config.SegmentBytes || (active.Entries > 0 && !ds.partitionOf(*active).Equal(now.Truncate(ds.config.Partition))) {
+		if err := ds.seal(); err != nil {
+			fmt.Printf("⚠️  Failed to seal segment %d: %v\n", active.Seq, err)
+		}
+		active = ds.segments[len(ds.segments)-1]
+	}
+	if active.Entries == 0 {
+		// An idle empty segment belongs to the partition of its first entry
+		active.Created = now
+	}
+
+	data = active.lines.seal(data)
+	if _, err := ds.writer.Write(data); err != nil {
+		fmt.Printf("⚠️  Failed to write log %s: %v\n", entry.ID, err)
+		return
+	}
+	active.add(entry, active.Bytes)
+	active.Bytes += int64(len(data))
+	ds.count++
+}
+
+// seal finishes the active segment, starts a new one and applies retention. Callers hold mu.
+func (ds *DiskStore) seal() error {
+	active := ds.segments[len(ds.segments)-1]
+	if err := ds.writer.Flush(); err != nil {
+		return err
+	}
+	if err := ds.file.Sync(); err != nil {
+		return err
+	}
+	if err := ds.file.Close(); err != nil {
+		return err
+	}
+
+	active.sealed = true
+	if err := ds.writeIndex(active); err != nil {
+		return err
+	}
+
+	ds.segments = append(ds.segments, newDiskSegment(active.Seq+1))
+	if err := ds.openActive(); err != nil {
+		ds.file = nil
+		return err
+	}
+	ds.applyRetention()
+	return nil
+}
+
+// partitionOf returns the start of the partition a segment was written in
+func (ds *DiskStore) partitionOf(segment diskSegment) time.Time {
+	return segment.Created.Truncate(ds.config.Partition)
+}
+
+// applyRetention deletes the oldest partitions, all of their segments and
+// indexes at once, while they are past the retention period or the total is
+// beyond the size limit. The partition being written is kept. Callers hold mu.
+func (ds *DiskStore) applyRetention() {
+	var total int64
+	for _, segment := range ds.segments {
+		total += segment.Bytes
+	}
+
+	for {
+		// The oldest partition's segments, unless they include the active one
+		partition := ds.partitionOf(*ds.segments[0])
+		end := 1
+		for end < len(ds.segments) && ds.partitionOf(*ds.segments[end]).Equal(partition) {
+			end++
+		}
+		if end == len(ds.segments) {
+			return
+		}
+
+		var bytes int64
+		var maxTime time.Time
+		for _, segment := range ds.segments[:end] {
+			bytes += segment.Bytes
+			if segment.MaxTime.After(maxTime) {
+				maxTime = segment.MaxTime
+			}
+		}
+		expired := ds.config.Retention > 0 && time.Since(maxTime) > ds.config.Retention
+		oversize := ds.config.MaxBytes > 0 && total > ds.config.MaxBytes
+		if !expired && !oversize {
+			return
+		}
+
+		for _, segment := range ds.segments[:end] {
+			os.Remove(ds.segmentPath(segment.Seq))
+			os.Remove(ds.indexPath(segment.Seq))
+			ds.count -= segment.Entries
+		}
+		total -= bytes
+		ds.segments = ds.segments[end:]
+	}
+}
+
+// Start begins flushing writes every second and enforcing retention every minute
+func (ds *DiskStore) Start() {
+	go ds.maintain()
+}
+
+// maintain runs the periodic flush and retention sweep
+func (ds *DiskStore) maintain() {
+	flush := time.NewTicker(time.Second)
+	defer flush.Stop()
+	sweep := time.NewTicker(time.Minute)
+	defer sweep.Stop()
+
+	for {
+		select {
+		case <-flush.C:
+			ds.mu.Lock()
+			if ds.file != nil {
+				if err := ds.writer.Flush(); err != nil {
+					fmt.Printf("⚠️  Failed to flush segment: %v\n", err)
+				}
+			}
+			ds.mu.Unlock()
+		case <-sweep.C:
+			ds.mu.Lock()
+			ds.applyRetention()
+			ds.mu.Unlock()
+		case <-ds.shutdown:
+			return
+		}
+	}
+}
+
+// Stop flushes outstanding writes and closes the active segment
+func (ds *DiskStore) Stop() error {
+	close(ds.shutdown)
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.file == nil {
+		return nil
+	}
+	err := ds.writer.Flush()
+	if err == nil {
+		err = ds.file.Sync()
+	}
+	if closeErr := ds.file.Close(); err == nil {
+		err = closeErr
+	}
+	ds.file = nil
+	return err
+}
+
+// snapshot flushes pending writes and copies the segment list for a query
+func (ds *DiskStore) snapshot() []diskSegment {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.file != nil {
+		ds.writer.Flush()
+	}
+	segments := make([]diskSegment, len(ds.segments))
+	for i, segment := range ds.segments {
+		segments[i] = *segment
+	}
+	return segments
+}
+
+// query scans the segments newest first, skipping those skip rules out, and
+// returns up to MaxResults (or limit, if smaller) matching entries oldest first.
+// from picks where to start reading inside a segment; an entry for which stop
+// returns true ends the scan of that segment.
+func (ds *DiskStore) query(limit int, skip func(diskSegment) bool, from func(diskSegment) int64,
+	match func(models.LogEntry) bool, stop func(diskSegment, models.LogEntry) bool) []models.LogEntry {
+	if limit <= 0 || limit > ds.config.MaxResults {
+		limit = ds.config.MaxResults
+	}
+
+	segments := ds.snapshot()
+	var chunks [][]models.LogEntry // Matches per segment, newest segment first
+	found := 0
+
+	for i := len(segments) - 1; i >= 0 && found < limit; i-- {
+		segment := segments[i]
+		if segment.Entries == 0 || (skip != nil && skip(segment)) {
+			continue
+		}
+
+		var offset int64
+		if from != nil {
+			offset = from(segment)
+		}
+
+		matches := make([]models.LogEntry, 0)
+		err := ds.readSegment(segment, offset, func(entry models.LogEntry) bool {
+			if stop != nil && stop(segment, entry) {
+				return false
+			}
+			if match == nil || match(entry) {
+				matches = append(matches, entry)
+			}
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("⚠️  Failed to read segment %d: %v\n", segment.Seq, err)
+		}
+
+		// Keep the newest matches of this segment within the limit
+		if len(matches) > limit-found {
+			matches = matches[len(matches)-(limit-found):]
+		}
+		chunks = append(chunks, matches)
+		found += len(matches)
+	}
+
+	result := make([]models.LogEntry, 0, found)
+	for i := len(chunks) - 1; i >= 0; i-- {
+		result = append(result, chunks[i]...)
+	}
+	return result
+}
+
+// readSegment decodes the entries of a segment from offset, calling fn until it returns false.
+// Only the bytes the snapshot knows about are read, so a concurrent write is never half-read.
+func (ds *DiskStore) readSegment(segment diskSegment, offset int64, fn func(models.LogEntry) bool) error {
+	file, err := os.Open(ds.segmentPath(segment.Seq))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	lines, headerBytes, err := ds.config.Keyring.readHeader(bufio.NewReader(io.NewSectionReader(file, 0, segment.Bytes)))
+	if err != nil {
+		return err
+	}
+	offset = max(offset, headerBytes)
+
+	var reader io.Reader = io.NewSectionReader(file, offset, segment.Bytes-offset)
+	if ds.config.Mmap && segment.sealed {
+		if data, err := mmapFile(file, segment.Bytes); err == nil {
+			defer munmapFile(data)
+			reader = bytes.NewReader(data[offset:segment.Bytes])
+		}
+	}
+
+	buffered := bufio.NewReaderSize(reader, 64*1024)
+	for {
+		line, err := buffered.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var entry models.LogEntry
+		if lines.decode(line, &entry) != nil {
+			continue
+		}
+		if !fn(entry) {
+			return nil
+		}
+	}
+}
+
+// GetByLevel returns the newest logs of a level, using per-segment level counts to skip segments
+func (ds *DiskStore) GetByLevel(level string) []models.LogEntry {
+	return ds.query(0,
+		func(segment diskSegment) bool { return segment.Levels[level] == 0 },
+		nil,
+		func(entry models.LogEntry) bool { return entry.Level == level },
+		nil)
+}
+
+// GetByNode returns the newest logs ingested by a node
+func (ds *DiskStore) GetByNode(node string) []models.LogEntry {
+	return ds.query(0,
+		func(segment diskSegment) bool { return segment.Nodes[node] == 0 },
+		nil,
+		func(entry models.LogEntry) bool { return entry.Node == node },
+		nil)
+}
+
+// GetByService returns the newest logs of a service
+func (ds *DiskStore) GetByService(service string) []models.LogEntry {
+	return ds.query(0,
+		func(segment diskSegment) bool { return segment.Services != nil && segment.Services[service] == 0 },
+		nil,
+		func(entry models.LogEntry) bool { return entry.Service == service },
+		nil)
+}
+
+// GetByID returns the newest log with an ID, scanning segments newest first.
+// Sealed segments whose ID filter rules the ID out aren't read.
+func (ds *DiskStore) GetByID(id string) (models.LogEntry, bool) {
+	logs := ds.query(1,
+		func(segment diskSegment) bool { return segment.IDs != nil && !segment.IDs.mayContain(id) },
+		nil,
+		func(entry models.LogEntry) bool { return entry.ID == id },
+		nil)
+	if len(logs) == 0 {
+		return models.LogEntry{}, false
+	}
+	return logs[0], true
+}
+
+// GetByTimeRange returns the newest logs within a time range. Segments outside
+// the range are skipped; in time-ordered segments the sparse index finds where
+// to start reading and the scan stops past end.
+func (ds *DiskStore) GetByTimeRange(start, end time.Time) []models.LogEntry {
+	return ds.Find(Filter{Start: start, End: end})
+}
+
+// Find returns the newest logs every set field of the filter matches. The
+// segment indexes rule out segments by ID, level, service, node and time
+// range, and the sparse index skips to the range's start as in GetByTimeRange.
+func (ds *DiskStore) Find(filter Filter) []models.LogEntry {
+	return ds.FindNewest(filter, ds.config.MaxResults)
+}
+
+// FindContext is Find returning the first limit matches (0 is unlimited)
+// instead of the newest MaxResults, reading segments oldest first and giving
+// up once ctx is done; partial reports whether matches were left out
+func (ds *DiskStore) FindContext(ctx context.Context, filter Filter, limit int) (logs []models.LogEntry, partial bool) {
+	logs = make([]models.LogEntry, 0)
+	for _, segment := range ds.snapshot() {
+		if partial {
+			break
+		}
+		if !segment.mayMatch(filter) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return logs, true
+		}
+		read := 0
+		err := ds.readSegment(segment, segment.offsetBefore(filter.Start), func(entry models.LogEntry) bool {
+			if read++; read%1024 == 0 && ctx.Err() != nil {
+				partial = true
+				return false
+			}
+			if segment.Ordered && !filter.End.IsZero() && entry.Timestamp.After(filter.End) {
+				return false
+			}
+			if !filter.Matches(entry) {
+				return true
+			}
+			if limit > 0 && len(logs) == limit {
+				partial = true
+				return false
+			}
+			logs = append(logs, entry)
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("⚠️  Failed to read segment %d: %v\n", segment.Seq, err)
+		}
+	}
+	return logs, partial
+}
+
+// Iterate calls fn with every log the filter matches, oldest first, until fn
+// returns false, reading one segment at a time
+func (ds *DiskStore) Iterate(filter Filter, fn func(models.LogEntry) bool) {
+	done := false
+	for _, segment := range ds.snapshot() {
+		if done {
+			return
+		}
+		if !segment.mayMatch(filter) {
+			continue
+		}
+		err := ds.readSegment(segment, segment.offsetBefore(filter.Start), func(entry models.LogEntry) bool {
+			if segment.Ordered && !filter.End.IsZero() && entry.Timestamp.After(filter.End) {
+				return false
+			}
+			if filter.Matches(entry) && !fn(entry) {
+				done = true
+				return false
+			}
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("⚠️  Failed to read segment %d: %v\n", segment.Seq, err)
+		}
+	}
+}
+
+// Histogram counts the logs the filter matches per interval and group. A
+// sealed segment lying within one interval is counted from its index where
+// it can be (see diskSegment.histogram); the others are read.
+func (ds *DiskStore) Histogram(filter Filter, groupBy string, interval time.Duration) []HistogramBucket {
+	h := newHistogram(groupBy, interval)
+	for _, segment := range ds.snapshot() {
+		if !segment.mayMatch(filter) || segment.histogram(filter, groupBy, h) {
+			continue
+		}
+		err := ds.readSegment(segment, segment.offsetBefore(filter.Start), func(entry models.LogEntry) bool {
+			if segment.Ordered && !filter.End.IsZero() && entry.Timestamp.After(filter.End) {
+				return false
+			}
+			if filter.Matches(entry) {
+				h.add(entry.Timestamp, groupValue(entry, groupBy), 1)
+			}
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("⚠️  Failed to read segment %d: %v\n", segment.Seq, err)
+		}
+	}
+	return h.result()
+}
+
+// FindNewest is Find returning only the last limit matches
+func (ds *DiskStore) FindNewest(filter Filter, limit int) []models.LogEntry {
+	if limit <= 0 {
+		return []models.LogEntry{}
+	}
+	return ds.query(limit,
+		func(segment diskSegment) bool { return !segment.mayMatch(filter) },
+		func(segment diskSegment) int64 { return segment.offsetBefore(filter.Start) },
+		filter.Matches,
+		func(segment diskSegment, entry models.LogEntry) bool {
+			return segment.Ordered && !filter.End.IsZero() && entry.Timestamp.After(filter.End)
+		})
+}
+
+// CountContext counts the logs the filter matches. A sealed segment wholly inside
+// the filter's time range is counted from its index when the filter sets at
+// most one of level, min_level, service and node; the others are read,
+// without keeping their entries, until ctx is done.
+func (ds *DiskStore) CountContext(ctx context.Context, filter Filter) (count int, partial bool) {
+	for _, segment := range ds.snapshot() {
+		if !segment.mayMatch(filter) {
+			continue
+		}
+		if n, ok := segment.countMatching(filter); ok {
+			count += n
+			continue
+		}
+		if ctx.Err() != nil {
+			return count, true
+		}
+		read := 0
+		err := ds.readSegment(segment, segment.offsetBefore(filter.Start), func(entry models.LogEntry) bool {
+			if read++; read%1024 == 0 && ctx.Err() != nil {
+				partial = true
+				return false
+			}
+			if segment.Ordered && !filter.End.IsZero() && entry.Timestamp.After(filter.End) {
+				return false
+			}
+			if filter.Matches(entry) {
+				count++
+			}
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("⚠️  Failed to read segment %d: %v\n", segment.Seq, err)
+		}
+		if partial {
+			return count, true
+		}
+	}
+	return count, false
+}
+
+// countMatching counts the sealed segment's logs the filter matches from its
+// index; ok is false when the index can't tell, or is still being written
+func (seg *diskSegment) countMatching(filter Filter) (int, bool) {
+	if !seg.sealed || filter.ID != "" || filter.Message != "" || filter.MessageRegex != nil || len(filter.Metadata) > 0 || filter.Namespace != "" ||
+		!filter.Start.IsZero() && filter.Start.After(seg.MinTime) ||
+		!filter.End.IsZero() && filter.End.Before(seg.MaxTime) {
+		return 0, false
+	}
+	set := 0
+	for _, field := range []string{filter.Level, filter.MinLevel, filter.Service, filter.Node} {
+		if field != "" {
+			set++
+		}
+	}
+	switch {
+	case set > 1:
+		return 0, false
+	case filter.Level != "":
+		return seg.Levels[filter.Level], true
+	case filter.MinLevel != "":
+		count := 0
+		for _, level := range models.LevelsAtLeast(filter.MinLevel) {
+			count += seg.Levels[level]
+		}
+		return count, true
+	case filter.Service != "":
+		count, ok := seg.Services[filter.Service]
+		return count, ok || seg.Services != nil
+	case filter.Node != "":
+		return seg.Nodes[filter.Node], true
+	}
+	return seg.Entries, true
+}
+
+// histogram adds the logs the filter matches to h from the segment's index,
+// when the segment lies within one of h's intervals and countMatching can
+// count them. Grouped counts need a filter on none of level, service and
+// node. ok is false when the segment has to be read.
+func (seg *diskSegment) histogram(filter Filter, groupBy string, h *histogram) bool {
+	if h.bucketOf(seg.MinTime) != h.bucketOf(seg.MaxTime) {
+		return false
+	}
+	count, ok := seg.countMatching(filter)
+	if !ok {
+		return false
+	}
+	if groupBy == "" {
+		if count > 0 {
+			h.add(seg.MinTime, "", count)
+		}
+		return true
+	}
+	if count != seg.Entries {
+		return false
+	}
+	groups := map[string]map[string]int{"level": seg.Levels, "service": seg.Services, "node": seg.Nodes}[groupBy]
+	if groups == nil {
+		return false
+	}
+	for group, n := range groups {
+		if n > 0 {
+			h.add(seg.MinTime, group, n)
+		}
+	}
+	return true
+}
+
+// mayMatch reports whether the segment's index allows it to hold logs the filter matches
+func (seg *diskSegment) mayMatch(filter Filter) bool {
+	return !(seg.Entries == 0 ||
+		filter.ID != "" && seg.IDs != nil && !seg.IDs.mayContain(filter.ID) ||
+		filter.Level != "" && seg.Levels[filter.Level] == 0 ||
+		filter.MinLevel != "" && !slices.ContainsFunc(models.LevelsAtLeast(filter.MinLevel), func(level string) bool { return seg.Levels[level] > 0 }) ||
+		filter.Service != "" && seg.Services != nil && seg.Services[filter.Service] == 0 ||
+		filter.Node != "" && seg.Nodes[filter.Node] == 0 ||
+		!filter.Start.IsZero() && seg.MaxTime.Before(filter.Start) ||
+		!filter.End.IsZero() && seg.MinTime.After(filter.End))
+}
+
+// offsetBefore returns where to start reading for entries from start on: in
+// a time-ordered segment, the last sparse mark before start, since everything
+// before it is too old
+func (seg *diskSegment) offsetBefore(start time.Time) int64 {
+	if !seg.Ordered || start.IsZero() {
+		return 0
+	}
+	i := sort.Search(len(seg.Sparse), func(i int) bool {
+		return !seg.Sparse[i].Timestamp.Before(start)
+	})
+	if i == 0 {
+		return 0
+	}
+	return seg.Sparse[i-1].Offset
+}
+
+// GetRecent returns the N most recent logs
+func (ds *DiskStore) GetRecent(n int) []models.LogEntry {
+	return ds.query(n, nil, nil, nil, nil)
+}
+
+// Delete rewrites the segments holding logs the filter matches without them,
+// along with their indexes, and returns how many were removed. Segments whose
+// index rules out a match aren't read. Ingestion waits while it runs.
+func (ds *DiskStore) Delete(filter Filter) (int, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.file == nil {
+		return 0, fmt.Errorf("disk store is closed")
+	}
+	if err := ds.writer.Flush(); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for i, segment := range ds.segments {
+		if !segment.mayMatch(filter) {
+			continue
+		}
+
+		rebuilt := newDiskSegment(segment.Seq)
+		rebuilt.Created = segment.Created
+		rebuilt.lines = segment.lines
+		n, err := rewriteLines(ds.segmentPath(segment.Seq), filter, ds.config.Keyring, func(entry models.LogEntry, offset int64) {
+			rebuilt.add(entry, offset)
+		})
+		if err != nil {
+			return removed, fmt.Errorf("segment %d: %w", segment.Seq, err)
+		}
+		if n == 0 {
+			continue
+		}
+
+		info, err := os.Stat(ds.segmentPath(segment.Seq))
+		if err != nil {
+			return removed, err
+		}
+		rebuilt.Bytes = info.Size()
+		rebuilt.sealed = segment.sealed
+		ds.segments[i] = rebuilt
+		ds.count -= n
+		removed += n
+
+		if rebuilt.sealed {
+			if err := ds.writeIndex(rebuilt); err != nil {
+				return removed, err
+			}
+		} else {
+			// The active segment's file was replaced; append to the new one
+			ds.file.Close()
+			if err := ds.openActive(); err != nil {
+				ds.file = nil
+				return removed, err
+			}
+		}
+	}
+	return removed, nil
+}
+
+// Count returns the number of logs on disk
+func (ds *DiskStore) Count() int {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.count
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"logstream/pkg/models"
+	"strings"
+)
+
+// encryptionHeader starts the first line of an encrypted file, followed by
+// the key ID and the file's wrapped data key
+const encryptionHeader = "#logstream-aes-gcm "
+
+// Keyring holds the AES-256 keys segments are encrypted with. Every new
+// segment gets a random data key, wrapped with the current key in the
+// segment's header, so rotating the current key applies to new segments
+// while older ones stay readable as long as their key is kept.
+type Keyring struct {
+	keys    map[string]cipher.AEAD
+	current string
+}
+
+// ParseKeyring parses "id=key" pairs separated by commas, each key 32 bytes
+// in hex or base64. The first key encrypts new segments; the rest only
+// decrypt older ones.
+func ParseKeyring(spec string) (*Keyring, error) {
+	keyring := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for _, pair := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(pair, "=")
+		if !ok || id == "" || strings.ContainsAny(id, " \t") {
+			return nil, fmt.Errorf("expected id=key, got %q", pair)
+		}
+		if _, dup := keyring.keys[id]; dup {
+			return nil, fmt.Errorf("key %q is listed twice", id)
+		}
+
+		encoded = strings.TrimSpace(encoded)
+		key, err := hex.DecodeString(encoded)
+		if err != nil {
+			if key, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+				return nil, fmt.Errorf("key %q is neither hex nor base64", id)
+			}
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q is %d bytes, expected 32", id, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		keyring.keys[id] = aead
+		if keyring.current == "" {
+			keyring.current = id
+		}
+	}
+	if keyring.current == "" {
+		return nil, fmt.Errorf("no keys")
+	}
+	return keyring, nil
+}
+
+// newAEAD returns AES-GCM for a key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Current returns the ID of the key new segments are encrypted with
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// Len returns how many keys the keyring holds
+func (k *Keyring) Len() int {
+	return len(k.keys)
+}
+
+// newHeader creates a data key for a new file, returning the header line
+// that carries it wrapped with the current key
+func (k *Keyring) newHeader() ([]byte, *lineCipher, error) {
+	dataKey := make([]byte, 32)
+	rand.Read(dataKey)
+	lines, err := newLineCipher(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped := seal(k.keys[k.current], dataKey, []byte(k.current))
+	header := fmt.Sprintf("%s%s %s\n", encryptionHeader, k.current, base64.StdEncoding.EncodeToString(wrapped))
+	return []byte(header), lines, nil
+}
+
+// openHeader unwraps the data key of a header line
+func (k *Keyring) openHeader(line []byte) (*lineCipher, error) {
+	fields := strings.Fields(strings.TrimPrefix(string(line), encryptionHeader))
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("malformed encryption header")
+	}
+	if k == nil {
+		return nil, fmt.Errorf("file is encrypted with key %q but no encryption keys are configured", fields[0])
+	}
+	aead, ok := k.keys[fields[0]]
+	if !ok {
+		return nil, fmt.Errorf("file is encrypted with key %q, which isn't configured", fields[0])
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed encryption header: %w", err)
+	}
+	dataKey, err := open(aead, wrapped, []byte(fields[0]))
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping the data key with key %q: %w", fields[0], err)
+	}
+	return newLineCipher(dataKey)
+}
+
+// readHeader reads the encryption header a file starts with, returning the
+// cipher for its lines and the header's length. A file without one is
+// plaintext, for which the cipher is nil. A header cut short by a crash
+// returns io.EOF.
+func (k *Keyring) readHeader(reader *bufio.Reader) (*lineCipher, int64, error) {
+	if prefix, _ := reader.Peek(len(encryptionHeader)); string(prefix) != encryptionHeader {
+		return nil, 0, nil
+	}
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, 0, err
+	}
+	lines, err := k.openHeader(line)
+	return lines, int64(len(line)), err
+}
+
+// sealFile encrypts a whole file's contents under a fresh header. A nil
+// keyring leaves them as they are.
+func (k *Keyring) sealFile(data []byte) ([]byte, error) {
+	if k == nil {
+		return data, nil
+	}
+	header, lines, err := k.newHeader()
+	if err != nil {
+		return nil, err
+	}
+	// seal drops one trailing newline, so one is added for it to drop
+	line := append(data[:len(data):len(data)], '\n')
+	return append(header, lines.seal(line)...), nil
+}
+
+// openFile decrypts what sealFile wrote; plaintext is returned as it is
+func (k *Keyring) openFile(data []byte) ([]byte, error) {
+	reader := bufio.NewReader(bytes.NewReader(data))
+	lines, n, err := k.readHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	if lines == nil {
+		return data, nil
+	}
+	return lines.open(data[n:])
+}
+
+// lineCipher encrypts the lines of one file with its data key
+type lineCipher struct {
+	aead cipher.AEAD
+}
+
+// newLineCipher returns the line cipher for a data key
+func newLineCipher(dataKey []byte) (*lineCipher, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &lineCipher{aead: aead}, nil
+}
+
+// seal encrypts a line, returning it base64-encoded and newline-terminated so
+// files stay line-oriented. A nil cipher returns the line as it is.
+func (c *lineCipher) seal(line []byte) []byte {
+	if c == nil {
+		return line
+	}
+	sealed := seal(c.aead, bytes.TrimSuffix(line, []byte("\n")), nil)
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(sealed))+1)
+	base64.StdEncoding.Encode(encoded, sealed)
+	encoded[len(encoded)-1] = '\n'
+	return encoded
+}
+
+// open decrypts a line from seal. A nil cipher returns the line as it is.
+func (c *lineCipher) open(line []byte) ([]byte, error) {
+	if c == nil {
+		return line, nil
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(sealed, line)
+	if err != nil {
+		return nil, err
+	}
+	return open(c.aead, sealed[:n], nil)
+}
+
+// decode decrypts a line and decodes the entry in it
+func (c *lineCipher) decode(line []byte, entry *models.LogEntry) error {
+	plain, err := c.open(line)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, entry)
+}
+
+// seal encrypts data with a random nonce, which it is prefixed with
+func seal(aead cipher.AEAD, data, additional []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, data, additional)
+}
+
+// open decrypts what seal returned
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"logstream/pkg/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testKeyA = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	testKeyB = "ffeeddccbbaa99887766554433221100ffeeddccbbaa99887766554433221100"
+)
+
+func mustKeyring(t *testing.T, spec string) *Keyring {
+	t.Helper()
+	keyring, err := ParseKeyring(spec)
+	if err != nil {
+		t.Fatalf("ParseKeyring(%q): %v", spec, err)
+	}
+	return keyring
+}
+
+func TestParseKeyring(t *testing.T) {
+	base64Key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	tests := []struct {
+		spec    string
+		current string
+		keys    int
+		text    string // Error text, when parsing fails
+	}{
+		{spec: "a=" + testKeyA, current: "a", keys: 1},
+		{spec: "b64=" + base64Key, current: "b64", keys: 1},
+		{spec: " new=" + testKeyB + " ,\nold=" + testKeyA + ",", current: "new", keys: 2},
+		{spec: "", text: "no keys"},
+		{spec: " , ", text: "no keys"},
+		{spec: testKeyA, text: "expected id=key"},
+		{spec: "=" + testKeyA, text: "expected id=key"},
+		{spec: "my key=" + testKeyA, text: "expected id=key"},
+		{spec: "a =" + testKeyA, text: "expected id=key"},
+		{spec: "a=" + testKeyA + ",a=" + testKeyB, text: "listed twice"},
+		{spec: "a=not-a-key!", text: "neither hex nor base64"},
+		{spec: "a=" + testKeyA[:62], text: "is 31 bytes"},
+	}
+	for _, test := range tests {
+		keyring, err := ParseKeyring(test.spec)
+		if test.text != "" {
+			if err == nil || !strings.Contains(err.Error(), test.text) {
+				t.Errorf("ParseKeyring(%q) = %v, want an error containing %q", test.spec, err, test.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseKeyring(%q): %v", test.spec, err)
+			continue
+		}
+		if keyring.Current() != test.current || keyring.Len() != test.keys {
+			t.Errorf("ParseKeyring(%q) = current %q with %d keys, want %q with %d", test.spec, keyring.Current(), keyring.Len(), test.current, test.keys)
+		}
+	}
+}
+
+func TestSealFileRoundTrip(t *testing.T) {
+	keyring := mustKeyring(t, "a="+testKeyA)
+	for _, data := range [][]byte{nil, []byte("one line\n"), []byte("line 1\nline 2\n"), bytes.Repeat([]byte{0, 0xff, '\n'}, 1000)} {
+		sealed, err := keyring.sealFile(data)
+		if err != nil {
+			t.Fatalf("sealFile: %v", err)
+		}
+		if !bytes.HasPrefix(sealed, []byte(encryptionHeader+"a ")) {
+			t.Errorf("sealed file starts %q, want the header for key a", truncate(sealed))
+		}
+		if len(data) > 8 && bytes.Contains(sealed, data[:8]) {
+			t.Errorf("sealed file contains the plaintext %q", data[:8])
+		}
+		opened, err := keyring.openFile(sealed)
+		if err != nil {
+			t.Fatalf("openFile: %v", err)
+		}
+		if !bytes.Equal(opened, data) && !(len(opened) == 0 && len(data) == 0) {
+			t.Errorf("openFile = %q, want %q", truncate(opened), truncate(data))
+		}
+	}
+}
+
+func TestSealFileWithoutKeyring(t *testing.T) {
+	var keyring *Keyring
+	data := []byte(`{"message":"plain"}` + "\n")
+	sealed, err := keyring.sealFile(data)
+	if err != nil || !bytes.Equal(sealed, data) {
+		t.Fatalf("nil keyring sealFile = %q, %v, want the data unchanged", sealed, err)
+	}
+	// Plaintext written before encryption was turned on still reads
+	opened, err := mustKeyring(t, "a="+testKeyA).openFile(data)
+	if err != nil || !bytes.Equal(opened, data) {
+		t.Errorf("openFile of plaintext = %q, %v, want it unchanged", opened, err)
+	}
+}
+
+func TestOpenFileAfterRotation(t *testing.T) {
+	old := mustKeyring(t, "old="+testKeyA)
+	sealed, err := old.sealFile([]byte("written before rotation\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := mustKeyring(t, "new="+testKeyB+",old="+testKeyA)
+	if opened, err := rotated.openFile(sealed); err != nil || string(opened) != "written before rotation\n" {
+		t.Errorf("openFile with the old key kept = %q, %v", opened, err)
+	}
+	resealed, err := rotated.sealFile([]byte("after\n"))
+	if err != nil || !bytes.HasPrefix(resealed, []byte(encryptionHeader+"new ")) {
+		t.Errorf("new files after rotation start %q, %v, want the header for key new", truncate(resealed), err)
+	}
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		text    string
+	}{
+		{"old key dropped", mustKeyring(t, "new="+testKeyB), `key "old", which isn't configured`},
+		{"no keyring", nil, "no encryption keys are configured"},
+		{"same ID, different key", mustKeyring(t, "old="+testKeyB), "unwrapping the data key"},
+	}
+	for _, test := range tests {
+		if _, err := test.keyring.openFile(sealed); err == nil || !strings.Contains(err.Error(), test.text) {
+			t.Errorf("%s: openFile = %v, want an error containing %q", test.name, err, test.text)
+		}
+	}
+}
+
+func TestOpenFileDetectsTampering(t *testing.T) {
+	keyring := mustKeyring(t, "a="+testKeyA+",b="+testKeyB)
+	sealed, err := keyring.sealFile([]byte("the original\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerEnd := bytes.IndexByte(sealed, '\n') + 1
+
+	// Flip one bit in the body's ciphertext
+	body := append([]byte(nil), sealed...)
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(string(body[headerEnd:])))
+	raw[len(raw)-1] ^= 1
+	body = append(body[:headerEnd], base64.StdEncoding.EncodeToString(raw)+"\n"...)
+
+	// Claim the data key was wrapped with the other key
+	relabelled := bytes.Replace(sealed, []byte(encryptionHeader+"a "), []byte(encryptionHeader+"b "), 1)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"body", body},
+		{"key ID", relabelled},
+		{"malformed header", []byte(encryptionHeader + "a\n")},
+		{"header not base64", []byte(encryptionHeader + "a !!!\n")},
+		{"body not base64", append(sealed[:headerEnd:headerEnd], "!!!\n"...)},
+	}
+	for _, test := range tests {
+		if opened, err := keyring.openFile(test.data); err == nil {
+			t.Errorf("%s: openFile = %q, want an error", test.name, opened)
+		}
+	}
+}
+
+func TestLineCipher(t *testing.T) {
+	_, lines, err := mustKeyring(t, "a="+testKeyA).newHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := models.LogEntry{ID: "1", Level: "ERROR", Message: "multi\nline", Timestamp: time.Unix(1700000000, 0).UTC()}
+	sealed := lines.seal([]byte(`{"id":"1","level":"ERROR","message":"multi\nline","timestamp":"2023-11-14T22:13:20Z"}` + "\n"))
+	if bytes.Count(sealed, []byte("\n")) != 1 || sealed[len(sealed)-1] != '\n' {
+		t.Fatalf("sealed line %q should hold exactly one, trailing, newline", sealed)
+	}
+
+	var decoded models.LogEntry
+	if err := lines.decode(sealed, &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.ID != entry.ID || decoded.Message != entry.Message || !decoded.Timestamp.Equal(entry.Timestamp) {
+		t.Errorf("decode = %+v, want %+v", decoded, entry)
+	}
+	if again := lines.seal([]byte("same\n")); bytes.Equal(again, lines.seal([]byte("same\n"))) {
+		t.Error("sealing the same line twice gave the same ciphertext, want a fresh nonce each time")
+	}
+	if _, err := lines.open([]byte("c2hvcnQ=\n")); err == nil {
+		t.Error("open of a too-short ciphertext succeeded, want an error")
+	}
+
+	var plain *lineCipher
+	if got := plain.seal([]byte("as is\n")); string(got) != "as is\n" {
+		t.Errorf("nil cipher seal = %q, want the line unchanged", got)
+	}
+	if got, err := plain.open([]byte("as is\n")); err != nil || string(got) != "as is\n" {
+		t.Errorf("nil cipher open = %q, %v, want the line unchanged", got, err)
+	}
+}
+
+func TestEncryptedWALReplays(t *testing.T) {
+	dir := t.TempDir()
+	keyring := mustKeyring(t, "a="+testKeyA)
+	wal, _, err := OpenWAL(WALConfig{Dir: dir, Keyring: keyring}, func(models.LogEntry) {})
+	if err != nil {
+		t.Fatalf("OpenWAL: %v", err)
+	}
+	if err := wal.AppendBatch([]models.LogEntry{{ID: "1", Message: "secret one"}, {ID: "2", Message: "secret two"}}); err != nil {
+		t.Fatalf("AppendBatch: %v", err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	for _, path := range paths {
+		data, _ := os.ReadFile(path)
+		if bytes.Contains(data, []byte("secret")) {
+			t.Errorf("%s holds plaintext", path)
+		}
+	}
+
+	var replayed []string
+	wal, n, err := OpenWAL(WALConfig{Dir: dir, Keyring: keyring}, func(entry models.LogEntry) {
+		replayed = append(replayed, entry.Message)
+	})
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	wal.Close()
+	if n != 2 || strings.Join(replayed, ",") != "secret one,secret two" {
+		t.Errorf("replayed %d: %v, want both entries", n, replayed)
+	}
+
+	if _, _, err := OpenWAL(WALConfig{Dir: dir}, func(models.LogEntry) {}); err == nil {
+		t.Error("reopening without the keyring succeeded, want an error")
+	}
+}
+
+// truncate shortens long data in failure messages
+func truncate(data []byte) []byte {
+	if len(data) > 40 {
+		return data[:40]
+	}
+	return data
+}
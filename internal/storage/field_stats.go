@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// FieldQuery asks for statistics of a numeric metadata field
+type FieldQuery struct {
+	Field       string        // Metadata key; a dotted key also reaches into nested objects
+	GroupBy     string        // "", "level", "service" or "node"
+	Interval    time.Duration // Aligned to the Unix epoch; 0 makes the whole range one bucket
+	Percentiles []float64     // From 0 to 100
+}
+
+// FieldStats summarizes a field's values in one interval and group
+type FieldStats struct {
+	Start       time.Time // Zero without an interval
+	Group       string
+	Count       int
+	Sum         float64
+	Min         float64
+	Max         float64
+	Percentiles []float64 // Interpolated linearly, in the order asked for
+}
+
+// FieldSummarizer is implemented by stores that compute a field's statistics
+// without reading the logs back. Values are numbers or numeric strings;
+// skipped counts the matching logs without one. ok is false when the filter
+// needs the logs read after all, and partial that the query failed or ctx
+// was done.
+type FieldSummarizer interface {
+	SummarizeField(ctx context.Context, filter Filter, query FieldQuery) (stats []FieldStats, skipped int, partial, ok bool)
+}
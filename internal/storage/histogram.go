@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"logstream/pkg/models"
+	"sort"
+	"time"
+)
+
+// HistogramBucket counts the logs of one interval, in total and by group
+type HistogramBucket struct {
+	Start  time.Time      `json:"start"`
+	Total  int            `json:"total"`
+	Counts map[string]int `json:"counts,omitempty"` // By group value; nil without a group
+}
+
+// Histogrammer is implemented by stores that count logs per interval without
+// reading them all back. groupBy is "", "level", "service" or "node", and
+// filter sets Start and End.
+type Histogrammer interface {
+	Histogram(filter Filter, groupBy string, interval time.Duration) []HistogramBucket
+}
+
+// histogram accumulates counts into interval buckets aligned to the Unix epoch
+type histogram struct {
+	interval time.Duration
+	grouped  bool
+	buckets  map[int64]*HistogramBucket
+}
+
+// newHistogram creates an empty histogram
+func newHistogram(groupBy string, interval time.Duration) *histogram {
+	return &histogram{interval: interval, grouped: groupBy != "", buckets: make(map[int64]*HistogramBucket)}
+}
+
+// bucketOf returns the start of the interval holding t, in Unix nanoseconds
+func (h *histogram) bucketOf(t time.Time) int64 {
+	nanos := t.UnixNano()
+	start := nanos - nanos%int64(h.interval)
+	if start > nanos {
+		start -= int64(h.interval)
+	}
+	return start
+}
+
+// add counts n logs of a group at a time
+func (h *histogram) add(t time.Time, group string, n int) {
+	start := h.bucketOf(t)
+	bucket, ok := h.buckets[start]
+	if !ok {
+		bucket = &HistogramBucket{Start: time.Unix(0, start).UTC()}
+		if h.grouped {
+			bucket.Counts = make(map[string]int)
+		}
+		h.buckets[start] = bucket
+	}
+	bucket.Total += n
+	if h.grouped {
+		bucket.Counts[group] += n
+	}
+}
+
+// result returns the buckets holding any logs, oldest first
+func (h *histogram) result() []HistogramBucket {
+	result := make([]HistogramBucket, 0, len(h.buckets))
+	for _, bucket := range h.buckets {
+		result = append(result, *bucket)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+	return result
+}
+
+// groupValue returns the field of an entry a histogram is grouped by
+func groupValue(entry models.LogEntry, groupBy string) string {
+	switch groupBy {
+	case "level":
+		return entry.Level
+	case "service":
+		return entry.Service
+	case "node":
+		return entry.Node
+	}
+	return ""
+}
+
+// MergeHistograms adds up the buckets of histograms with the same grouping
+// and interval, oldest first
+func MergeHistograms(groupBy string, interval time.Duration, histograms ...[]HistogramBucket) []HistogramBucket {
+	h := newHistogram(groupBy, interval)
+	for _, buckets := range histograms {
+		for _, bucket := range buckets {
+			if bucket.Counts == nil {
+				h.add(bucket.Start, "", bucket.Total)
+				continue
+			}
+			for group, count := range bucket.Counts {
+				h.add(bucket.Start, group, count)
+			}
+		}
+	}
+	return h.result()
+}
+
+// HistogramOf counts logs per interval and group, for stores that aren't a
+// Histogrammer
+func HistogramOf(logs []models.LogEntry, groupBy string, interval time.Duration) []HistogramBucket {
+	h := newHistogram(groupBy, interval)
+	for _, entry := range logs {
+		h.add(entry.Timestamp, groupValue(entry, groupBy), 1)
+	}
+	return h.result()
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"logstream/pkg/models"
+)
+
+// ContextFinder is implemented by stores whose Find can stop early, at a
+// number of matches or when a context is done
+type ContextFinder interface {
+	FindContext(ctx context.Context, filter Filter, limit int) (logs []models.LogEntry, partial bool)
+}
+
+// FindLimited returns at most the first limit logs the filter matches (0 is
+// unlimited), giving up once ctx is done where the store supports it; other
+// stores run Find to the end and the result is cut to limit. partial reports
+// whether matches were left out.
+func FindLimited(ctx context.Context, store Store, filter Filter, limit int) ([]models.LogEntry, bool) {
+	if finder, ok := store.(ContextFinder); ok {
+		return finder.FindContext(ctx, filter, limit)
+	}
+	logs := store.Find(filter)
+	if limit > 0 && len(logs) > limit {
+		return logs[:limit], true
+	}
+	return logs, false
+}
+
+// Iterator is implemented by stores that can hand out every log a filter
+// matches, oldest first, without building the whole result
+type Iterator interface {
+	Iterate(filter Filter, fn func(models.LogEntry) bool)
+}
+
+// NewestFinder is implemented by stores that can return the newest logs a
+// filter matches without reading the older ones
+type NewestFinder interface {
+	FindNewest(filter Filter, limit int) []models.LogEntry
+}
+
+// FindNewest returns the last limit logs the filter matches, oldest first.
+// Other stores run Find, which holds the newest matches where it is capped.
+func FindNewest(store Store, filter Filter, limit int) []models.LogEntry {
+	if finder, ok := store.(NewestFinder); ok {
+		return finder.FindNewest(filter, limit)
+	}
+	logs := store.Find(filter)
+	return logs[max(0, len(logs)-limit):]
+}
+
+// MatchCounter is implemented by stores that can count the logs a filter
+// matches without reading them back; ok is false when the filter needs them
+// read after all
+type MatchCounter interface {
+	CountMatching(filter Filter) (count int, ok bool)
+}
+
+// ContextCounter is implemented by stores that count the logs a filter
+// matches partly from their indexes and partly by reading them, giving up
+// once a context is done
+type ContextCounter interface {
+	CountContext(ctx context.Context, filter Filter) (count int, partial bool)
+}
+
+// CountMatches returns how many logs the filter matches, from the store's
+// indexes where it can and otherwise by reading them with FindLimited and no
+// limit. partial reports whether ctx was done before all were counted.
+func CountMatches(ctx context.Context, store Store, filter Filter) (int, bool) {
+	if counter, ok := store.(ContextCounter); ok {
+		return counter.CountContext(ctx, filter)
+	}
+	if counter, ok := store.(MatchCounter); ok {
+		if count, ok := counter.CountMatching(filter); ok {
+			return count, false
+		}
+	}
+	logs, partial := FindLimited(ctx, store, filter, 0)
+	return len(logs), partial
+}
@@ -0,0 +1,942 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"logstream/internal/query"
+	"logstream/pkg/models"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Shared zstd codec for compressed blocks; EncodeAll and DecodeAll are safe for concurrent use
+var (
+	blockEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	blockDecoder, _ = zstd.NewReader(nil)
+)
+
+// seqList is an ascending list of sequence numbers, trimmed from the front as
+// the entries they point at are evicted
+type seqList struct {
+	seqs []uint64
+	head int
+}
+
+// items returns the live sequence numbers
+func (l *seqList) items() []uint64 {
+	return l.seqs[l.head:]
+}
+
+// popFront drops sequence numbers up to seq from the front, reclaiming the
+// trimmed prefix once it is the larger half
+func (l *seqList) popFront(seq uint64) {
+	for l.head < len(l.seqs) && l.seqs[l.head] <= seq {
+		l.head++
+	}
+	if l.head > 1024 && l.head*2 > len(l.seqs) {
+		l.seqs = append([]uint64(nil), l.seqs[l.head:]...)
+		l.head = 0
+	}
+}
+
+// trim drops sequence numbers below first and releases the trimmed prefix
+func (l *seqList) trim(first uint64) {
+	for l.head < len(l.seqs) && l.seqs[l.head] < first {
+		l.head++
+	}
+	if l.head > 0 {
+		l.seqs = append([]uint64(nil), l.seqs[l.head:]...)
+		l.head = 0
+	}
+}
+
+// seqIndex maps a key to the sequence numbers of the entries holding it
+type seqIndex[K comparable] map[K]*seqList
+
+// add appends seq under key
+func (idx seqIndex[K]) add(key K, seq uint64) {
+	list, ok := idx[key]
+	if !ok {
+		list = &seqList{}
+		idx[key] = list
+	}
+	list.seqs = append(list.seqs, seq)
+}
+
+// remove drops seq, which must be the oldest entry under key
+func (idx seqIndex[K]) remove(key K, seq uint64) {
+	list, ok := idx[key]
+	if !ok {
+		return
+	}
+	list.popFront(seq)
+	if len(list.items()) == 0 {
+		delete(idx, key)
+	}
+}
+
+// get returns the sequence numbers under key, oldest first
+func (idx seqIndex[K]) get(key K) []uint64 {
+	if list, ok := idx[key]; ok {
+		return list.items()
+	}
+	return nil
+}
+
+// metadataIndexValue returns the index key of a metadata field: numbers and
+// numeric strings by value, so 42, 42.0 and "42" share a key, and strings and
+// booleans as they are. Dotted keys reach into nested objects.
+func metadataIndexValue(metadata map[string]interface{}, key string) (string, bool) {
+	value, ok := metadata[key]
+	if !ok {
+		value, ok = nestedMetadata(metadata, key)
+		if !ok {
+			return "", false
+		}
+	}
+
+	if f, ok := query.ToFloat(value, true); ok {
+		return strconv.FormatFloat(f, 'g', -1, 64), true
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case nil:
+		return "null", true
+	}
+	return "", false
+}
+
+// nestedMetadata follows a dotted key through nested objects
+func nestedMetadata(metadata map[string]interface{}, key string) (interface{}, bool) {
+	if !strings.Contains(key, ".") {
+		return nil, false
+	}
+
+	var value interface{} = metadata
+	for _, part := range strings.Split(key, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// slot is a stored entry with the store-wide sequence number used to merge lanes
+type slot struct {
+	Seq uint64 `json:"_seq"`
+	models.LogEntry
+}
+
+// logBlock is a run of BlockSize entries encoded as zstd-compressed JSON lines
+type logBlock struct {
+	first   uint64 // Lane sequence number of the first entry
+	lastSeq uint64 // Store-wide sequence number of the last entry
+	data    []byte
+	count   int
+	rawSize int
+}
+
+// decode decompresses a block's entries
+func (b *logBlock) decode() ([]slot, error) {
+	raw, err := blockDecoder.DecodeAll(b.data, make([]byte, 0, b.rawSize))
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make([]slot, 0, b.count)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var s slot
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			return nil, err
+		}
+		slots = append(slots, s)
+	}
+	return slots, scanner.Err()
+}
+
+// lane holds the logs of one retention class. Each entry gets a lane sequence
+// number that never changes, so the indices stay valid as old entries leave:
+// evicting pops the oldest entry off the ring (or the oldest compressed block)
+// and off the front of its index lists, without touching anything else.
+type lane struct {
+	retention   time.Duration      // Age limit of the lane's levels (0 is none)
+	capacity    int                // Most uncompressed entries in the ring
+	preallocate bool               // Allocate the whole ring on first use instead of growing it
+	timeBucket  int64              // Seconds per byTime bucket
+	compression *CompressionConfig // Shared with the store; BlockSize 0 disables it
+	compressErr error              // Set when an entry couldn't be encoded; stops further sealing
+
+	ring  []slot // Uncompressed entries, oldest at start
+	start int
+	size  int
+
+	blocks []*logBlock // Compressed entries older than the ring, oldest first
+	front  []slot      // Decoded copy of blocks[0] while eviction walks through it
+
+	first uint64 // Sequence number of the oldest entry
+	next  uint64 // Sequence number of the next entry
+	bytes int64  // Estimated memory held by the entries, see entrySize
+
+	byLevel   seqIndex[string]
+	byNode    seqIndex[string]
+	byService seqIndex[string]
+	byTime    seqIndex[int64] // Timestamp bucket, of timeBucket seconds
+	byID      seqIndex[string]
+
+	byMetadata map[string]seqIndex[string] // Indexed metadata key -> value
+	byToken    seqIndex[string]            // Message word -> entries; nil unless full-text search is on
+}
+
+// newLane creates an empty lane holding at most capacity uncompressed entries
+// and indexing the given metadata keys
+func newLane(retention time.Duration, capacity int, compression *CompressionConfig, metadataKeys []string) *lane {
+	byMetadata := make(map[string]seqIndex[string], len(metadataKeys))
+	for _, key := range metadataKeys {
+		byMetadata[key] = make(seqIndex[string])
+	}
+
+	return &lane{
+		retention:   retention,
+		capacity:    capacity,
+		compression: compression,
+		byLevel:     make(seqIndex[string]),
+		byNode:      make(seqIndex[string]),
+		byService:   make(seqIndex[string]),
+		byTime:      make(seqIndex[int64]),
+		timeBucket:  60,
+		byID:        make(seqIndex[string]),
+		byMetadata:  byMetadata,
+	}
+}
+
+// count returns the entries in the lane
+func (l *lane) count() int {
+	return int(l.next - l.first)
+}
+
+// add appends and indexes an entry, compressing the oldest uncompressed
+// entries once the ring is full
+func (l *lane) add(seq uint64, entry models.LogEntry) {
+	if l.size == len(l.ring) {
+		if l.compressing() && l.size >= l.compression.HotSize+l.compression.BlockSize {
+			l.seal()
+		}
+		if l.size == len(l.ring) {
+			l.grow()
+		}
+	}
+
+	l.ring[(l.start+l.size)%len(l.ring)] = slot{Seq: seq, LogEntry: entry}
+	l.size++
+	l.bytes += entrySize(entry)
+
+	pos := l.next
+	l.next++
+	l.byLevel.add(entry.Level, pos)
+	l.byNode.add(entry.Node, pos)
+	l.byService.add(entry.Service, pos)
+	l.byTime.add(l.bucketOf(entry.Timestamp), pos)
+	l.byID.add(entry.ID, pos)
+	for key, idx := range l.byMetadata {
+		if value, ok := metadataIndexValue(entry.Metadata, key); ok {
+			idx.add(value, pos)
+		}
+	}
+	if l.byToken != nil {
+		for _, token := range query.Tokenize(entry.Message) {
+			l.byToken.add(token, pos)
+		}
+	}
+}
+
+// compressing reports whether older entries go into compressed blocks
+func (l *lane) compressing() bool {
+	return l.compression.BlockSize > 0 && l.compressErr == nil
+}
+
+// grow doubles the ring, up to its capacity (HotSize+BlockSize when compressing)
+func (l *lane) grow() {
+	limit := l.capacity
+	if l.compressing() {
+		limit = l.compression.HotSize + l.compression.BlockSize
+	}
+
+	size := len(l.ring) * 2
+	if size < 1024 {
+		size = 1024
+	}
+	if l.preallocate {
+		size = limit
+	}
+	if size > limit && limit > len(l.ring) {
+		size = limit
+	}
+
+	ring := make([]slot, size)
+	for i := 0; i < l.size; i++ {
+		ring[i] = l.ring[(l.start+i)%len(l.ring)]
+	}
+	l.ring = ring
+	l.start = 0
+}
+
+// seal moves the oldest BlockSize uncompressed entries into a compressed block
+func (l *lane) seal() {
+	size := l.compression.BlockSize
+
+	var raw bytes.Buffer
+	encoder := json.NewEncoder(&raw)
+	for i := 0; i < size; i++ {
+		if err := encoder.Encode(&l.ring[(l.start+i)%len(l.ring)]); err != nil {
+			// Keep everything uncompressed rather than lose an entry
+			fmt.Printf("⚠️  Disabling memory compression, entry can't be encoded: %v\n", err)
+			l.compressErr = err
+			return
+		}
+	}
+
+	l.blocks = append(l.blocks, &logBlock{
+		first:   l.next - uint64(l.size),
+		lastSeq: l.ring[(l.start+size-1)%len(l.ring)].Seq,
+		data:    blockEncoder.EncodeAll(raw.Bytes(), nil),
+		count:   size,
+		rawSize: raw.Len(),
+	})
+
+	// Release the sealed entries' memory
+	for i := 0; i < size; i++ {
+		l.ring[(l.start+i)%len(l.ring)] = slot{}
+	}
+	l.start = (l.start + size) % len(l.ring)
+	l.size -= size
+}
+
+// oldest returns the oldest entry without removing it
+func (l *lane) oldest() (slot, bool) {
+	if l.first == l.next {
+		return slot{}, false
+	}
+	if len(l.blocks) == 0 {
+		return l.ring[l.start], true
+	}
+
+	if l.front == nil {
+		front, err := l.blocks[0].decode()
+		if err != nil {
+			// Unreadable block: evict its entries as blanks
+			fmt.Printf("⚠️  Failed to decompress log block: %v\n", err)
+			front = make([]slot, l.blocks[0].count)
+		}
+		l.front = front
+	}
+	return l.front[l.first-l.blocks[0].first], true
+}
+
+// popOldest evicts the oldest entry in O(1), removing it from the index lists
+func (l *lane) popOldest() (slot, bool) {
+	s, ok := l.oldest()
+	if !ok {
+		return slot{}, false
+	}
+
+	seq := l.first
+	l.byLevel.remove(s.Level, seq)
+	l.byNode.remove(s.Node, seq)
+	l.byService.remove(s.Service, seq)
+	l.byTime.remove(l.bucketOf(s.Timestamp), seq)
+	l.byID.remove(s.ID, seq)
+	for key, idx := range l.byMetadata {
+		if value, ok := metadataIndexValue(s.Metadata, key); ok {
+			idx.remove(value, seq)
+		}
+	}
+	if l.byToken != nil {
+		for _, token := range query.Tokenize(s.Message) {
+			l.byToken.remove(token, seq)
+		}
+	}
+	l.first++
+	l.bytes -= entrySize(s.LogEntry)
+	if l.first == l.next {
+		l.bytes = 0 // Blank entries from unreadable blocks don't give back their size
+	}
+
+	if len(l.blocks) > 0 {
+		block := l.blocks[0]
+		if l.first == block.first+uint64(block.count) {
+			l.blocks[0] = nil
+			l.blocks = l.blocks[1:]
+			l.front = nil
+		}
+		return s, true
+	}
+
+	l.ring[l.start] = slot{}
+	l.start = (l.start + 1) % len(l.ring)
+	l.size--
+	return s, true
+}
+
+// bucketOf returns the time index bucket of a timestamp
+func (l *lane) bucketOf(t time.Time) int64 {
+	return t.Unix() / l.timeBucket
+}
+
+// bucketSpan returns the first and last instant of a time index bucket
+func (l *lane) bucketSpan(bucket int64) (time.Time, time.Time) {
+	from := time.Unix(bucket*l.timeBucket, 0)
+	return from, from.Add(time.Duration(l.timeBucket)*time.Second - time.Nanosecond)
+}
+
+// timeBuckets calls fn with the live entries of each time bucket from start
+// to end that has any, in bucket order. When the lane holds fewer buckets
+// than the range spans it walks those instead of every bucket in the range,
+// so wide ranges stay cheap.
+func (l *lane) timeBuckets(startTime, endTime time.Time, fn func(bucket int64, seqs []uint64)) {
+	start, end := l.bucketOf(startTime), l.bucketOf(endTime)
+	if end < start {
+		return
+	}
+
+	visit := func(bucket int64) {
+		seqs := l.byTime.get(bucket)
+		// Skip entries evicted without being removed from the bucket
+		live := sort.Search(len(seqs), func(i int) bool { return seqs[i] >= l.first })
+		if live < len(seqs) {
+			fn(bucket, seqs[live:])
+		}
+	}
+
+	if end-start < int64(len(l.byTime)) {
+		for bucket := start; bucket <= end; bucket++ {
+			visit(bucket)
+		}
+		return
+	}
+	buckets := make([]int64, 0)
+	for bucket := range l.byTime {
+		if bucket >= start && bucket <= end {
+			buckets = append(buckets, bucket)
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	for _, bucket := range buckets {
+		visit(bucket)
+	}
+}
+
+// pruneTime drops the time buckets left holding only evicted entries, such
+// as those of unreadable compressed blocks whose timestamps were lost, and
+// releases the space trimmed bucket lists still hold
+func (l *lane) pruneTime() {
+	for bucket, list := range l.byTime {
+		list.trim(l.first)
+		if len(list.items()) == 0 {
+			delete(l.byTime, bucket)
+		}
+	}
+}
+
+// delete removes the entries the filter matches by rebuilding the lane from
+// the rest, so their data leaves the ring, compressed blocks and indexes
+func (l *lane) delete(filter Filter) int {
+	if filter.ID != "" && len(l.byID.get(filter.ID)) == 0 ||
+		filter.Level != "" && len(l.byLevel.get(filter.Level)) == 0 ||
+		filter.Service != "" && len(l.byService.get(filter.Service)) == 0 ||
+		filter.Node != "" && len(l.byNode.get(filter.Node)) == 0 {
+		return 0
+	}
+
+	remaining := l.newest(l.count())
+	kept := remaining[:0]
+	for _, s := range remaining {
+		if !filter.Matches(s.LogEntry) {
+			kept = append(kept, s)
+		}
+	}
+	removed := len(remaining) - len(kept)
+	if removed == 0 {
+		return 0
+	}
+
+	metadataKeys := make([]string, 0, len(l.byMetadata))
+	for key := range l.byMetadata {
+		metadataKeys = append(metadataKeys, key)
+	}
+	rebuilt := newLane(l.retention, l.capacity, l.compression, metadataKeys)
+	rebuilt.preallocate = l.preallocate
+	rebuilt.timeBucket = l.timeBucket
+	if l.byToken != nil {
+		rebuilt.byToken = make(seqIndex[string])
+	}
+	for _, s := range kept {
+		rebuilt.add(s.Seq, s.LogEntry)
+	}
+	*l = *rebuilt
+	return removed
+}
+
+// laneReader resolves lane sequence numbers to entries, decompressing each
+// block at most once while a query walks ascending sequence numbers
+type laneReader struct {
+	lane  *lane
+	block int
+	slots []slot
+}
+
+// reader returns a laneReader; the caller must hold the store's lock
+func (l *lane) reader() *laneReader {
+	return &laneReader{lane: l, block: -1}
+}
+
+// at returns the entry with a lane sequence number
+func (r *laneReader) at(seq uint64) (slot, bool) {
+	l := r.lane
+	if seq < l.first || seq >= l.next {
+		return slot{}, false
+	}
+
+	hotFirst := l.next - uint64(l.size)
+	if seq >= hotFirst {
+		return l.ring[(l.start+int(seq-hotFirst))%len(l.ring)], true
+	}
+
+	block := int((seq - l.blocks[0].first) / uint64(l.compression.BlockSize))
+	if block != r.block {
+		slots, err := l.blocks[block].decode()
+		if err != nil {
+			fmt.Printf("⚠️  Failed to decompress log block: %v\n", err)
+			slots = nil
+		}
+		r.block = block
+		r.slots = slots
+	}
+
+	offset := int(seq - l.blocks[block].first)
+	if offset < len(r.slots) {
+		return r.slots[offset], true
+	}
+	return slot{}, false
+}
+
+// collect returns the entries with the given lane sequence numbers
+func (l *lane) collect(seqs []uint64) []slot {
+	reader := l.reader()
+	result := make([]slot, 0, len(seqs))
+	for _, seq := range seqs {
+		if s, ok := reader.at(seq); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// search returns the entries whose message holds every token, intersecting
+// the token lists from the shortest up
+func (l *lane) search(tokens []string) []slot {
+	lists := make([][]uint64, len(tokens))
+	for i, token := range tokens {
+		lists[i] = l.byToken.get(token)
+		if len(lists[i]) == 0 {
+			return nil
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	matches := lists[0]
+	for _, list := range lists[1:] {
+		matches = intersect(matches, list)
+		if len(matches) == 0 {
+			return nil
+		}
+	}
+	return l.collect(matches)
+}
+
+// find returns the entries the filter matches. The index lists of its ID,
+// level, service, node and time range are intersected from the shortest up,
+// so only entries in all of them are read and checked against the rest.
+func (l *lane) find(filter Filter) []slot {
+	matches, _ := l.findLimited(context.Background(), filter, 0)
+	return matches
+}
+
+// findLimited is find stopping at the first limit matches (0 is unlimited)
+// or once ctx is done, reporting whether it stopped early
+func (l *lane) findLimited(ctx context.Context, filter Filter, limit int) ([]slot, bool) {
+	return l.scan(ctx, filter, limit, false)
+}
+
+// findNewest is find returning only the last limit matches
+func (l *lane) findNewest(filter Filter, limit int) []slot {
+	matches, _ := l.scan(context.Background(), filter, limit, true)
+	return matches
+}
+
+// scan reads the matches of find oldest first, or newest first when newest
+// is set, up to limit of them or until ctx is done; they are returned oldest
+// first either way
+func (l *lane) scan(ctx context.Context, filter Filter, limit int, newest bool) ([]slot, bool) {
+	var lists [][]uint64
+	for _, list := range []struct {
+		set bool
+		idx seqIndex[string]
+		key string
+	}{
+		{filter.ID != "", l.byID, filter.ID},
+		{filter.Level != "", l.byLevel, filter.Level},
+		{filter.Service != "", l.byService, filter.Service},
+		{filter.Node != "", l.byNode, filter.Node},
+	} {
+		if !list.set {
+			continue
+		}
+		seqs := l.byIndex(list.idx, list.key)
+		if len(seqs) == 0 {
+			return nil, false
+		}
+		lists = append(lists, seqs)
+	}
+	if filter.MinLevel != "" {
+		seqs := l.minLevelList(filter.MinLevel)
+		if len(seqs) == 0 {
+			return nil, false
+		}
+		lists = append(lists, seqs)
+	}
+	for _, seqs := range l.metadataLists(filter) {
+		if len(seqs) == 0 {
+			return nil, false
+		}
+		lists = append(lists, seqs)
+	}
+
+	if !filter.Start.IsZero() || !filter.End.IsZero() {
+		end := filter.End
+		if end.IsZero() {
+			end = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+		}
+		// Skip gathering a range wider than a list we already have; those entries are checked anyway
+		shortest := math.MaxInt
+		for _, list := range lists {
+			shortest = min(shortest, len(list))
+		}
+		var inRange [][]uint64
+		total := 0
+		l.timeBuckets(filter.Start, end, func(bucket int64, seqs []uint64) {
+			inRange = append(inRange, seqs)
+			total += len(seqs)
+		})
+		if total == 0 {
+			return nil, false
+		}
+		if total < shortest {
+			seqs := make([]uint64, 0, total)
+			for _, bucket := range inRange {
+				seqs = append(seqs, bucket...)
+			}
+			// Buckets are in time order, which isn't sequence order for late entries
+			sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+			lists = append(lists, seqs)
+		}
+	}
+
+	var seqs []uint64
+	if len(lists) > 0 {
+		sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+		seqs = lists[0]
+		for _, list := range lists[1:] {
+			if seqs = intersect(seqs, list); len(seqs) == 0 {
+				return nil, false
+			}
+		}
+	}
+
+	// Entries are read one at a time so a limited or cancelled query stops
+	// without copying the rest
+	reader := l.reader()
+	var result []slot
+	visited := 0
+	visit := func(seq uint64) bool {
+		if visited++; visited%1024 == 0 && ctx.Err() != nil {
+			return false
+		}
+		if s, ok := reader.at(seq); ok && filter.Matches(s.LogEntry) {
+			if limit > 0 && len(result) == limit {
+				return false
+			}
+			result = append(result, s)
+		}
+		return true
+	}
+	stopped := false
+	switch {
+	case len(lists) == 0 && newest:
+		for seq := l.next; seq > l.first && !stopped; seq-- {
+			stopped = !visit(seq - 1)
+		}
+	case len(lists) == 0:
+		for seq := l.first; seq < l.next && !stopped; seq++ {
+			stopped = !visit(seq)
+		}
+	case newest:
+		for i := len(seqs) - 1; i >= 0 && !stopped; i-- {
+			stopped = !visit(seqs[i])
+		}
+	default:
+		for _, seq := range seqs {
+			if stopped = !visit(seq); stopped {
+				break
+			}
+		}
+	}
+	if newest {
+		slices.Reverse(result)
+	}
+	return result, stopped
+}
+
+// minLevelList returns the positions of the entries as severe as min or
+// more, from the level index, in order
+func (l *lane) minLevelList(min string) []uint64 {
+	var seqs []uint64
+	for _, level := range models.LevelsAtLeast(min) {
+		seqs = append(seqs, l.byIndex(l.byLevel, level)...)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+// histogram adds the lane's logs the filter's level, service, node and time
+// range select to h, grouped by the field groupBy names. A time bucket within
+// one interval is counted by intersecting index lists; the entries of the
+// others are looked at.
+func (l *lane) histogram(filter Filter, groupBy string, h *histogram) {
+	var lists [][]uint64
+	for _, list := range []struct {
+		set bool
+		idx seqIndex[string]
+		key string
+	}{
+		{filter.Level != "", l.byLevel, filter.Level},
+		{filter.Service != "", l.byService, filter.Service},
+		{filter.Node != "", l.byNode, filter.Node},
+	} {
+		if !list.set {
+			continue
+		}
+		seqs := l.byIndex(list.idx, list.key)
+		if len(seqs) == 0 {
+			return
+		}
+		lists = append(lists, seqs)
+	}
+	if filter.MinLevel != "" {
+		seqs := l.minLevelList(filter.MinLevel)
+		if len(seqs) == 0 {
+			return
+		}
+		lists = append(lists, seqs)
+	}
+	groups := map[string]seqIndex[string]{"level": l.byLevel, "service": l.byService, "node": l.byNode}[groupBy]
+
+	reader := l.reader()
+	l.timeBuckets(filter.Start, filter.End, func(bucket int64, seqs []uint64) {
+		for _, list := range lists {
+			if seqs = intersect(seqs, list); len(seqs) == 0 {
+				return
+			}
+		}
+
+		from, to := l.bucketSpan(bucket)
+		if from.Before(filter.Start) || to.After(filter.End) || h.bucketOf(from) != h.bucketOf(to) {
+			for _, seq := range seqs {
+				if s, ok := reader.at(seq); ok && filter.Matches(s.LogEntry) {
+					h.add(s.Timestamp, groupValue(s.LogEntry, groupBy), 1)
+				}
+			}
+			return
+		}
+		if groups == nil {
+			h.add(from, "", len(seqs))
+			return
+		}
+		for value, list := range groups {
+			if n := len(intersect(seqs, list.items())); n > 0 {
+				h.add(from, value, n)
+			}
+		}
+	})
+}
+
+// metadataLists returns the index lists of the filter's metadata fields whose
+// keys are indexed. They may hold entries the field doesn't match exactly,
+// e.g. "42" for 42 without coercion, which Matches then drops.
+func (l *lane) metadataLists(filter Filter) [][]uint64 {
+	var lists [][]uint64
+	for _, field := range filter.Metadata {
+		idx, ok := l.byMetadata[field.Key]
+		if !ok {
+			continue
+		}
+		value, _ := metadataIndexValue(map[string]interface{}{field.Key: field.Value}, field.Key)
+		lists = append(lists, l.byIndex(idx, value))
+	}
+	return lists
+}
+
+// byIndex returns an index list without the evicted entries at its front
+func (l *lane) byIndex(idx seqIndex[string], key string) []uint64 {
+	seqs := idx.get(key)
+	live := sort.Search(len(seqs), func(i int) bool { return seqs[i] >= l.first })
+	return seqs[live:]
+}
+
+// intersect returns the sequence numbers in both ascending lists. When b is
+// much longer than a, each of a's numbers is looked up in b instead of
+// walking both.
+func intersect(a, b []uint64) []uint64 {
+	result := make([]uint64, 0, len(a))
+	if len(b) > 16*len(a) {
+		for _, seq := range a {
+			i := sort.Search(len(b), func(i int) bool { return b[i] >= seq })
+			if i < len(b) && b[i] == seq {
+				result = append(result, seq)
+			}
+			b = b[i:]
+		}
+		return result
+	}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// posAfter returns the lane sequence number of the oldest entry whose
+// store-wide sequence number is at least from
+func (l *lane) posAfter(from uint64, reader *laneReader) uint64 {
+	hotFirst := l.next - uint64(l.size)
+	if l.size > 0 && l.ring[l.start].Seq < from {
+		i := sort.Search(l.size, func(i int) bool { return l.ring[(l.start+i)%len(l.ring)].Seq >= from })
+		return hotFirst + uint64(i)
+	}
+
+	b := sort.Search(len(l.blocks), func(b int) bool { return l.blocks[b].lastSeq >= from })
+	if b == len(l.blocks) {
+		return hotFirst
+	}
+	block := l.blocks[b]
+	lo := block.first
+	if lo < l.first {
+		lo = l.first
+	}
+	i := sort.Search(int(block.first+uint64(block.count)-lo), func(i int) bool {
+		s, ok := reader.at(lo + uint64(i))
+		return !ok || s.Seq >= from
+	})
+	return lo + uint64(i)
+}
+
+// iterate returns up to limit entries the filter matches, oldest first,
+// starting at store-wide sequence number from and stopping before until.
+// An ID, level, service, node or indexed metadata field in the filter
+// narrows the entries read through its index.
+func (l *lane) iterate(from, until uint64, filter Filter, limit int) []slot {
+	reader := l.reader()
+	pos := l.posAfter(from, reader)
+
+	var candidates []uint64
+	indexed := true
+	switch {
+	case filter.ID != "":
+		candidates = l.byID.get(filter.ID)
+	case filter.Level != "":
+		candidates = l.byLevel.get(filter.Level)
+	case filter.Service != "":
+		candidates = l.byService.get(filter.Service)
+	case filter.Node != "":
+		candidates = l.byNode.get(filter.Node)
+	default:
+		if lists := l.metadataLists(filter); len(lists) > 0 {
+			candidates = lists[0]
+		} else {
+			indexed = false
+		}
+	}
+
+	result := make([]slot, 0)
+	visit := func(p uint64) bool {
+		s, ok := reader.at(p)
+		if !ok {
+			return true
+		}
+		if s.Seq >= until {
+			return false
+		}
+		if filter.Matches(s.LogEntry) {
+			result = append(result, s)
+		}
+		return len(result) < limit
+	}
+
+	if indexed {
+		i := sort.Search(len(candidates), func(i int) bool { return candidates[i] >= pos })
+		for _, p := range candidates[i:] {
+			if !visit(p) {
+				break
+			}
+		}
+		return result
+	}
+	for p := pos; p < l.next; p++ {
+		if !visit(p) {
+			break
+		}
+	}
+	return result
+}
+
+// newest returns the lane's n newest entries, oldest first
+func (l *lane) newest(n int) []slot {
+	from := l.first
+	if l.count() > n {
+		from = l.next - uint64(n)
+	}
+
+	reader := l.reader()
+	result := make([]slot, 0, l.next-from)
+	for seq := from; seq < l.next; seq++ {
+		if s, ok := reader.at(seq); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+package storage
+
+import "logstream/pkg/models"
+
+// entryOverhead approximates the fixed cost of a stored entry: its slot, the
+// string and map headers, and a sequence number in each index list
+const entryOverhead = 320
+
+// entrySize estimates the memory an entry takes in the store, counting its
+// strings and metadata. It is an estimate of the uncompressed size, so
+// compressed blocks are charged as if they weren't.
+func entrySize(entry models.LogEntry) int64 {
+	size := int64(entryOverhead + len(entry.ID) + len(entry.Level) + len(entry.Message) +
+		len(entry.Service) + len(entry.Node) + len(entry.Source) + len(entry.Namespace) + len(entry.PrevHash) + len(entry.Hash))
+	if entry.Metadata != nil {
+		size += valueSize(entry.Metadata)
+	}
+	return size
+}
+
+// valueSize estimates the memory of a decoded JSON value
+func valueSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case string:
+		return int64(16 + len(v))
+	case map[string]interface{}:
+		size := int64(48)
+		for key, item := range v {
+			size += int64(16+len(key)) + valueSize(item)
+		}
+		return size
+	case []interface{}:
+		size := int64(24)
+		for _, item := range v {
+			size += valueSize(item)
+		}
+		return size
+	default:
+		return 16 // Numbers, bools and nil, boxed in an interface
+	}
+}
+
+// MemoryUsage reports how much the memory store holds against its limits
+type MemoryUsage struct {
+	Logs     int   `json:"logs"`
+	MaxLogs  int   `json:"max_logs"`
+	Bytes    int64 `json:"estimated_bytes"`
+	MaxBytes int64 `json:"max_bytes,omitempty"` // 0 when only the log count is capped
+
+	TimeBuckets int `json:"time_buckets"` // Buckets in the time index, across shards and lanes
+}
+
+// SetMaxBytes caps the store by the estimated size of its logs as well as by
+// count, split evenly across the shards: once a shard holds more than its
+// share, its oldest logs are evicted until it fits. Sizes are estimated from
+// each log's message, metadata and fields plus a fixed per-entry overhead,
+// so this bounds the store's memory far better than a count when log sizes
+// vary. 0 turns it off. Call before Store.
+func (ms *MemoryStore) SetMaxBytes(maxBytes int64) {
+	ms.maxBytes = maxBytes
+	ms.buildShards()
+}
+
+// MemoryUsage returns the store's estimated size and limits
+func (ms *MemoryStore) MemoryUsage() MemoryUsage {
+	usage := MemoryUsage{MaxLogs: ms.maxLogs, MaxBytes: ms.maxBytes}
+	for _, shard := range ms.shards {
+		shard.mu.RLock()
+		usage.Logs += shard.count
+		usage.Bytes += shard.bytes()
+		for _, l := range shard.lanes {
+			usage.TimeBuckets += len(l.byTime)
+		}
+		shard.mu.RUnlock()
+	}
+	return usage
+}
+
+// bytes returns the estimated size of the shard's logs. Callers hold mu.
+func (shard *memoryShard) bytes() int64 {
+	var total int64
+	for _, l := range shard.lanes {
+		total += l.bytes
+	}
+	return total
+}
+
+// overBudget reports whether the shard must evict: it holds more than maxLogs
+// logs, or more than maxBytes while holding more than the one log it must
+// keep. Callers hold mu.
+func (shard *memoryShard) overBudget() bool {
+	if shard.count > shard.maxLogs {
+		return true
+	}
+	return shard.maxBytes > 0 && shard.count > 1 && shard.bytes() > shard.maxBytes
+}
@@ -1,146 +1,979 @@
 package storage
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"logstream/internal/query"
 	"logstream/pkg/models"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// MemoryStore provides fast in-memory log storage with custom indexing
+// MemoryStore provides fast in-memory log storage with custom indexing.
+// Logs are spread over shards, each with its own lock, so ingest workers and
+// readers don't all serialize on one mutex. Within a shard, logs live in one
+// lane per retention class (a single lane unless per-level retention is set).
+// Every entry gets a store-wide sequence number so results from several shards
+// and lanes are merged back into storage order.
 type MemoryStore struct {
-	logs          []models.LogEntry
-	indexByLevel  map[string][]int // level -> array of log indices
-	indexByTime   *TimeIndex
-	mu            sync.RWMutex
-	maxLogs       int
+	shards          []*memoryShard
+	shardCount      int
+	nextSeq         uint64
+	maxLogs         int
+	maxBytes        int64 // Most estimated bytes of logs; 0 caps by count only
+	compression     CompressionConfig
+	laneCompression CompressionConfig // Compression with the hot window split across the shards
+	retention       RetentionPolicy
+	metadataKeys    []string      // Metadata fields with an index
+	fullText        bool          // Index message words for Search
+	timeBucket      time.Duration // Span of a time index bucket; 0 is a minute
+	summaries       *summaryTable // Counts of logs compacted by age; nil unless enabled
+	onEvict         func([]models.LogEntry)
+	evictBatch      int // Evicted logs collected before onEvict is called
+	evictMu         sync.Mutex
+	pending         []models.LogEntry // Evicted logs waiting to be handed over as one batch
+	shutdown        chan struct{}
 }
 
-// TimeIndex provides fast time-range queries
-type TimeIndex struct {
-	buckets map[int64][]int // timestamp bucket (minute) -> log indices
-	mu      sync.RWMutex
+// memoryShard is one partition of the store, holding every Nth log
+type memoryShard struct {
+	mu          sync.RWMutex
+	lanes       []*lane          // Eviction order: shortest retention first
+	laneOf      map[string]*lane // Level -> lane, for levels with their own retention
+	defaultLane *lane
+	count       int
+	maxLogs     int
+	maxBytes    int64
 }
 
-// NewMemoryStore creates a new in-memory store
+// CompressionConfig controls block compression in the memory store
+type CompressionConfig struct {
+	BlockSize int // Entries per compressed block
+	HotSize   int // Newest entries kept uncompressed for fast recent queries
+}
+
+// CompressionStats reports how much the compressed blocks save
+type CompressionStats struct {
+	Blocks          int     `json:"blocks"`
+	Entries         int     `json:"entries"`
+	RawBytes        int     `json:"raw_bytes"`
+	CompressedBytes int     `json:"compressed_bytes"`
+	Ratio           float64 `json:"ratio"`
+}
+
+// NewMemoryStore creates a new in-memory store with a single shard
 func NewMemoryStore(maxLogs int) *MemoryStore {
-	return &MemoryStore{
-		logs:         make([]models.LogEntry, 0, maxLogs),
-		indexByLevel: make(map[string][]int),
-		indexByTime: &TimeIndex{
-			buckets: make(map[int64][]int),
-		},
-		maxLogs: maxLogs,
+	ms := &MemoryStore{
+		shardCount: 1,
+		maxLogs:    maxLogs,
+		evictBatch: maxLogs / 5,
+		shutdown:   make(chan struct{}),
+	}
+	ms.buildShards()
+	return ms
+}
+
+// buildShards lays out empty shards for the current configuration
+func (ms *MemoryStore) buildShards() {
+	perShard := (ms.maxLogs + ms.shardCount - 1) / ms.shardCount
+
+	ms.laneCompression = ms.compression
+	if ms.compression.HotSize > 0 {
+		ms.laneCompression.HotSize = (ms.compression.HotSize + ms.shardCount - 1) / ms.shardCount
+	}
+
+	ms.shards = make([]*memoryShard, ms.shardCount)
+	for i := range ms.shards {
+		ms.shards[i] = newMemoryShard(perShard, ms.retention, &ms.laneCompression, ms.metadataKeys)
+		if ms.maxBytes > 0 {
+			// The byte budget usually binds well before maxLogs, so grow the ring as needed
+			ms.shards[i].maxBytes = (ms.maxBytes + int64(ms.shardCount) - 1) / int64(ms.shardCount)
+			ms.shards[i].defaultLane.preallocate = false
+		}
+		for _, l := range ms.shards[i].lanes {
+			if ms.fullText {
+				l.byToken = make(seqIndex[string])
+			}
+			if ms.timeBucket > 0 {
+				l.timeBucket = int64(ms.timeBucket / time.Second)
+			}
+		}
+	}
+}
+
+// newMemoryShard sets up one lane per distinct retention, shortest first and
+// lanes without an age limit last
+func newMemoryShard(maxLogs int, retention RetentionPolicy, compression *CompressionConfig, metadataKeys []string) *memoryShard {
+	capacity := maxLogs + 1
+	shard := &memoryShard{
+		defaultLane: newLane(retention.Default, capacity, compression, metadataKeys),
+		laneOf:      make(map[string]*lane),
+		maxLogs:     maxLogs,
+	}
+	shard.defaultLane.preallocate = true
+	shard.lanes = []*lane{shard.defaultLane}
+
+	byRetention := map[time.Duration]*lane{retention.Default: shard.defaultLane}
+	for level, levelRetention := range retention.ByLevel {
+		l, ok := byRetention[levelRetention]
+		if !ok {
+			l = newLane(levelRetention, capacity, compression, metadataKeys)
+			byRetention[levelRetention] = l
+			shard.lanes = append(shard.lanes, l)
+		}
+		shard.laneOf[level] = l
+	}
+
+	sort.SliceStable(shard.lanes, func(i, j int) bool {
+		a, b := shard.lanes[i].retention, shard.lanes[j].retention
+		if a == 0 || b == 0 {
+			return b == 0 && a != 0
+		}
+		return a < b
+	})
+	return shard
+}
+
+// laneFor returns the lane holding a level
+func (shard *memoryShard) laneFor(level string) *lane {
+	if l, ok := shard.laneOf[level]; ok {
+		return l
+	}
+	return shard.defaultLane
+}
+
+// SetShards splits the store into n shards, each holding maxLogs/n logs. Call before Store.
+func (ms *MemoryStore) SetShards(n int) {
+	if n < 1 {
+		n = 1
+	}
+	ms.shardCount = n
+	ms.buildShards()
+}
+
+// EnableCompression keeps all but the newest HotSize entries in compressed
+// blocks, so maxLogs can be several times larger in the same memory. Call before Store.
+func (ms *MemoryStore) EnableCompression(config CompressionConfig) {
+	if config.BlockSize <= 0 {
+		config.BlockSize = 4096
+	}
+	if config.HotSize <= 0 {
+		config.HotSize = 10000
+	}
+	ms.compression = config
+	ms.buildShards()
+}
+
+// IndexMetadata indexes the given metadata keys (dotted keys reach into
+// nested objects) for GetByMetadata and the metadata fields of Find and
+// IterateFrom filters. Call before Store.
+func (ms *MemoryStore) IndexMetadata(keys []string) {
+	ms.metadataKeys = keys
+	ms.buildShards()
+}
+
+// SetTimeBucket sets the span of the time index buckets, in whole seconds
+// from a second to a day. Finer buckets make range queries look at fewer
+// entries outside the range; coarser ones keep fewer buckets. Call before Store.
+func (ms *MemoryStore) SetTimeBucket(span time.Duration) {
+	span = span.Truncate(time.Second)
+	if span < time.Second {
+		span = time.Second
+	}
+	if span > 24*time.Hour {
+		span = 24 * time.Hour
+	}
+	ms.timeBucket = span
+	ms.buildShards()
+}
+
+// EnableFullText indexes the words of every message for Search. Call before Store.
+func (ms *MemoryStore) EnableFullText() {
+	ms.fullText = true
+	ms.buildShards()
+}
+
+// FullText reports whether messages are indexed for Search
+func (ms *MemoryStore) FullText() bool {
+	return ms.fullText
+}
+
+// EnableCompaction replaces logs that expire by age (see SetRetention) or
+// are evicted by the count cap with per-minute counts by service and level, kept for keep (0 keeps them
+// forever). The counts are included in CountByLevel, CountByService and
+// CountByTimeRange, and listed by Summaries. Call before Store.
+func (ms *MemoryStore) EnableCompaction(keep time.Duration) {
+	ms.summaries = newSummaryTable(keep)
+}
+
+// Summaries returns the per-minute counts of compacted logs the filter
+// selects, oldest first; nil unless compaction is enabled
+func (ms *MemoryStore) Summaries(filter Filter) []Summary {
+	if ms.summaries == nil {
+		return nil
+	}
+	return ms.summaries.list(filter)
+}
+
+// IndexesMetadata reports whether a metadata key is indexed
+func (ms *MemoryStore) IndexesMetadata(key string) bool {
+	for _, indexed := range ms.metadataKeys {
+		if indexed == key {
+			return true
+		}
+	}
+	return false
+}
+
+// SetEvictionHandler registers a function called with evicted logs. The caps
+// evict one log at a time, the oldest as each new one arrives; evicted logs are
+// collected and handed over once SetEvictionBatch of them (20% of maxLogs by
+// default) have built up, and each sweep's expired logs in one call. Calls are
+// serialized and hold up eviction, so it must hand the batch off rather than block.
+func (ms *MemoryStore) SetEvictionHandler(handler func([]models.LogEntry)) {
+	ms.evictMu.Lock()
+	defer ms.evictMu.Unlock()
+	ms.onEvict = handler
+}
+
+// SetEvictionBatch changes how many evicted logs are handed over at once;
+// smaller batches leave fewer logs in limbo between eviction and the handler
+func (ms *MemoryStore) SetEvictionBatch(size int) {
+	ms.evictMu.Lock()
+	defer ms.evictMu.Unlock()
+	if size > 0 {
+		ms.evictBatch = size
+	}
+}
+
+// SetRetention evicts logs whose timestamp is older than their level's
+// retention, independent of the count cap; age limits are enforced by the
+// sweeper started with Start. Levels with their own retention are kept apart,
+// and the count cap evicts the levels with the shortest retention first.
+// Call before Store.
+func (ms *MemoryStore) SetRetention(policy RetentionPolicy) {
+	ms.retention = policy
+	ms.buildShards()
+}
+
+// timeIndexPruneInterval is how often the sweeper prunes the minute buckets
+// of the time index
+const timeIndexPruneInterval = time.Minute
+
+// Start begins the sweeper, which prunes the time index every minute and,
+// with a retention set, evicts expired logs every minute, or every tenth of
+// the shortest retention when that is shorter
+func (ms *MemoryStore) Start() {
+	interval := timeIndexPruneInterval
+	if retention := ms.retention.shortest(); retention > 0 {
+		interval = retention / 10
+		if interval > time.Minute {
+			interval = time.Minute
+		}
+		if interval < time.Second {
+			interval = time.Second
+		}
+	}
+	go ms.sweep(interval)
+}
+
+// sweep evicts expired logs and prunes the time index until Stop
+func (ms *MemoryStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		select {
+		case now := <-ticker.C:
+			if ms.retention.shortest() > 0 {
+				ms.expire(now)
+			}
+			if now.Sub(lastPrune) >= timeIndexPruneInterval {
+				ms.pruneTimeIndex()
+				lastPrune = now
+			}
+		case <-ms.shutdown:
+			return
+		}
+	}
+}
+
+// pruneTimeIndex drops time buckets that only reference evicted logs, one
+// shard at a time
+func (ms *MemoryStore) pruneTimeIndex() {
+	for _, shard := range ms.shards {
+		shard.mu.Lock()
+		for _, l := range shard.lanes {
+			l.pruneTime()
+		}
+		shard.mu.Unlock()
 	}
 }
 
+// Stop ends the retention sweeper and hands over the last evicted logs
+func (ms *MemoryStore) Stop() error {
+	close(ms.shutdown)
+
+	ms.evictMu.Lock()
+	defer ms.evictMu.Unlock()
+	ms.flushEvicted()
+	return nil
+}
+
 // Store adds a log entry with automatic indexing
 func (ms *MemoryStore) Store(entry models.LogEntry) {
-	ms.mu.Lock()
-	defer ms.mu.Unlock()
+	seq := atomic.AddUint64(&ms.nextSeq, 1) - 1
+	shard := ms.shards[seq%uint64(len(ms.shards))]
 
-	// Add to main storage
-	idx := len(ms.logs)
-	ms.logs = append(ms.logs, entry)
+	shard.mu.Lock()
+	shard.laneFor(entry.Level).add(seq, entry)
+	shard.count++
 
-	// Index by level
-	ms.indexByLevel[entry.Level] = append(ms.indexByLevel[entry.Level], idx)
+	// Make room by evicting the shard's oldest logs; a large log may push out several
+	var one [1]slot
+	evicted := one[:0]
+	for shard.overBudget() {
+		s, ok := shard.evictOldest()
+		if !ok {
+			break
+		}
+		evicted = append(evicted, s)
+	}
+	shard.mu.Unlock()
 
-	// Index by time (bucket by minute for fast range queries)
-	timeBucket := entry.Timestamp.Unix() / 60
-	ms.indexByTime.mu.Lock()
-	ms.indexByTime.buckets[timeBucket] = append(ms.indexByTime.buckets[timeBucket], idx)
-	ms.indexByTime.mu.Unlock()
+	ms.evictedByCount(evicted)
+}
 
-	// Evict old logs if we exceed max capacity
-	if len(ms.logs) > ms.maxLogs {
-		ms.evictOldest()
+// StoreBatch adds log entries in order, taking each shard's lock once for
+// the whole batch rather than once per entry
+func (ms *MemoryStore) StoreBatch(entries []models.LogEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	shards := uint64(len(ms.shards))
+	first := atomic.AddUint64(&ms.nextSeq, uint64(len(entries))) - uint64(len(entries))
+
+	var evicted []slot
+	for offset := uint64(0); offset < shards && offset < uint64(len(entries)); offset++ {
+		// Entry i goes to shard (first+i) % shards, so each shard takes every shards-th entry
+		shard := ms.shards[(first+offset)%shards]
+		shard.mu.Lock()
+		for i := offset; i < uint64(len(entries)); i += shards {
+			shard.laneFor(entries[i].Level).add(first+i, entries[i])
+			shard.count++
+			// Evict as each entry goes in, like Store: a full ring has no room for a second
+			for shard.overBudget() {
+				s, ok := shard.evictOldest()
+				if !ok {
+					break
+				}
+				evicted = append(evicted, s)
+			}
+		}
+		shard.mu.Unlock()
+	}
+
+	ms.evictedByCount(evicted)
+}
+
+// evictedByCount summarizes logs the count cap evicted, when compaction is
+// on, and collects them for the eviction handler
+func (ms *MemoryStore) evictedByCount(evicted []slot) {
+	if ms.summaries != nil && len(evicted) > 0 {
+		logs := make([]models.LogEntry, len(evicted))
+		for i, s := range evicted {
+			logs[i] = s.LogEntry
+		}
+		ms.summaries.add(logs, time.Now())
+	}
+	for _, s := range evicted {
+		ms.addEvicted(s.LogEntry)
 	}
 }
 
 // GetByLevel returns all logs of a specific level (fast indexed lookup)
 func (ms *MemoryStore) GetByLevel(level string) []models.LogEntry {
-	ms.mu.RLock()
-	defer ms.mu.RUnlock()
+	return ms.query(func(shard *memoryShard) []slot {
+		l := shard.laneFor(level)
+		return l.collect(l.byLevel.get(level))
+	})
+}
 
-	indices := ms.indexByLevel[level]
-	result := make([]models.LogEntry, 0, len(indices))
-	for _, idx := range indices {
-		if idx < len(ms.logs) {
-			result = append(result, ms.logs[idx])
+// GetByNode returns all logs ingested by a specific node (fast indexed lookup)
+func (ms *MemoryStore) GetByNode(node string) []models.LogEntry {
+	return ms.query(func(shard *memoryShard) []slot {
+		var matches []slot
+		for _, l := range shard.lanes {
+			matches = append(matches, l.collect(l.byNode.get(node))...)
 		}
+		return matches
+	})
+}
+
+// GetByService returns all logs of a specific service (fast indexed lookup)
+func (ms *MemoryStore) GetByService(service string) []models.LogEntry {
+	return ms.query(func(shard *memoryShard) []slot {
+		var matches []slot
+		for _, l := range shard.lanes {
+			matches = append(matches, l.collect(l.byService.get(service))...)
+		}
+		return matches
+	})
+}
+
+// GetByMetadata returns all logs whose indexed metadata key holds value (fast
+// indexed lookup). Numbers and numeric strings match by value, so callers
+// wanting exact types filter the result. Keys without an index match nothing.
+func (ms *MemoryStore) GetByMetadata(key, value string) []models.LogEntry {
+	if !ms.IndexesMetadata(key) {
+		return []models.LogEntry{}
 	}
-	return result
+	value, _ = metadataIndexValue(map[string]interface{}{key: value}, key)
+
+	return ms.query(func(shard *memoryShard) []slot {
+		var matches []slot
+		for _, l := range shard.lanes {
+			matches = append(matches, l.collect(l.byMetadata[key].get(value))...)
+		}
+		return matches
+	})
+}
+
+// Search returns all logs whose message contains every word of text, ignoring
+// case and punctuation (fast indexed lookup). Empty without EnableFullText.
+func (ms *MemoryStore) Search(text string) []models.LogEntry {
+	tokens := query.Tokenize(text)
+	if !ms.fullText || len(tokens) == 0 {
+		return []models.LogEntry{}
+	}
+
+	return ms.query(func(shard *memoryShard) []slot {
+		var matches []slot
+		for _, l := range shard.lanes {
+			matches = append(matches, l.search(tokens)...)
+		}
+		return matches
+	})
+}
+
+// GetByID returns the log with an ID, the newest one if it was stored more than once (fast indexed lookup)
+func (ms *MemoryStore) GetByID(id string) (models.LogEntry, bool) {
+	matches := ms.query(func(shard *memoryShard) []slot {
+		var matches []slot
+		for _, l := range shard.lanes {
+			matches = append(matches, l.collect(l.byID.get(id))...)
+		}
+		return matches
+	})
+	if len(matches) == 0 {
+		return models.LogEntry{}, false
+	}
+	return matches[len(matches)-1], true
 }
 
 // GetByTimeRange returns logs within a time range (fast indexed lookup)
 func (ms *MemoryStore) GetByTimeRange(start, end time.Time) []models.LogEntry {
-	ms.mu.RLock()
-	defer ms.mu.RUnlock()
-
-	startBucket := start.Unix() / 60
-	endBucket := end.Unix() / 60
-
-	result := make([]models.LogEntry, 0)
-	ms.indexByTime.mu.RLock()
-	defer ms.indexByTime.mu.RUnlock()
-
-	// Iterate through relevant time buckets
-	for bucket := startBucket; bucket <= endBucket; bucket++ {
-		if indices, exists := ms.indexByTime.buckets[bucket]; exists {
-			for _, idx := range indices {
-				if idx < len(ms.logs) {
-					log := ms.logs[idx]
-					if !log.Timestamp.Before(start) && !log.Timestamp.After(end) {
-						result = append(result, log)
+	return ms.query(func(shard *memoryShard) []slot {
+		matches := make([]slot, 0)
+		for _, l := range shard.lanes {
+			reader := l.reader()
+
+			// Iterate through relevant time buckets
+			l.timeBuckets(start, end, func(bucket int64, seqs []uint64) {
+				for _, seq := range seqs {
+					if s, ok := reader.at(seq); ok {
+						if !s.Timestamp.Before(start) && !s.Timestamp.After(end) {
+							matches = append(matches, s)
+						}
 					}
 				}
+			})
+		}
+		return matches
+	})
+}
+
+// Find returns the logs every set field of the filter matches, intersecting
+// the indexes of those fields
+func (ms *MemoryStore) Find(filter Filter) []models.LogEntry {
+	return ms.query(func(shard *memoryShard) []slot {
+		if filter.Level != "" {
+			return shard.laneFor(filter.Level).find(filter)
+		}
+		var matches []slot
+		for _, l := range shard.lanes {
+			matches = append(matches, l.find(filter)...)
+		}
+		return matches
+	})
+}
+
+// FindContext is Find returning at most the first limit matches (0 is
+// unlimited) and giving up once ctx is done, so a huge query neither copies
+// every log nor holds a shard's lock for long; partial reports whether
+// matches were left out
+func (ms *MemoryStore) FindContext(ctx context.Context, filter Filter, limit int) (logs []models.LogEntry, partial bool) {
+	logs = ms.query(func(shard *memoryShard) []slot {
+		if ctx.Err() != nil {
+			partial = true
+			return nil
+		}
+		lanes := shard.lanes
+		if filter.Level != "" {
+			lanes = []*lane{shard.laneFor(filter.Level)}
+		}
+		var matches []slot
+		for _, l := range lanes {
+			// The first limit of every lane hold the first limit overall
+			found, stopped := l.findLimited(ctx, filter, limit)
+			matches = append(matches, found...)
+			partial = partial || stopped
+		}
+		return matches
+	})
+	if limit > 0 && len(logs) > limit {
+		logs, partial = logs[:limit], true
+	}
+	return logs, partial
+}
+
+// FindNewest is Find returning only the last limit matches
+func (ms *MemoryStore) FindNewest(filter Filter, limit int) []models.LogEntry {
+	if limit <= 0 {
+		return []models.LogEntry{}
+	}
+	logs := ms.query(func(shard *memoryShard) []slot {
+		lanes := shard.lanes
+		if filter.Level != "" {
+			lanes = []*lane{shard.laneFor(filter.Level)}
+		}
+		// The last limit of every lane hold the last limit overall
+		var matches []slot
+		for _, l := range lanes {
+			matches = append(matches, l.findNewest(filter, limit)...)
+		}
+		return matches
+	})
+	return logs[max(0, len(logs)-limit):]
+}
+
+// GetRecent returns a copy of the N most recent logs
+func (ms *MemoryStore) GetRecent(n int) []models.LogEntry {
+	if n <= 0 {
+		return []models.LogEntry{}
+	}
+
+	recent := ms.query(func(shard *memoryShard) []slot {
+		var newest []slot
+		for _, l := range shard.lanes {
+			newest = append(newest, l.newest(n)...)
+		}
+		return newest
+	})
+	if len(recent) > n {
+		recent = recent[len(recent)-n:]
+	}
+	// Entries still in the ring share their metadata with it
+	for i := range recent {
+		recent[i].Metadata = copyMetadata(recent[i].Metadata)
+	}
+	return recent
+}
+
+// copyMetadata returns a deep copy of metadata, so changing it leaves the stored entry alone
+func copyMetadata(metadata map[string]interface{}) map[string]interface{} {
+	if metadata == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		copied[key] = copyMetadataValue(value)
+	}
+	return copied
+}
+
+// copyMetadataValue deep copies the objects and arrays of a metadata value
+func copyMetadataValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return copyMetadata(v)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyMetadataValue(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// iterateChunk is how many entries Iterate copies per shard while holding its lock
+const iterateChunk = 1000
+
+// ErrInvalidCursor is returned for a cursor that IterateFrom didn't issue
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Iterate calls fn with every log the filter matches, oldest first, until fn
+// returns false. See IterateFrom.
+func (ms *MemoryStore) Iterate(filter Filter, fn func(models.LogEntry) bool) {
+	ms.IterateFrom("", filter, fn)
+}
+
+// IterateFrom is Iterate resuming at a cursor from an earlier call ("" starts
+// at the oldest log). Entries are copied a chunk at a time, so shard locks are
+// only held briefly and never while fn runs. Logs stored after the call began
+// aren't visited. The returned cursor points just past the last entry fn saw;
+// passing it later continues from there, including logs stored since.
+func (ms *MemoryStore) IterateFrom(cursor string, filter Filter, fn func(models.LogEntry) bool) (string, error) {
+	from, err := decodeCursor(cursor)
+	if err != nil {
+		return cursor, err
+	}
+	until := atomic.LoadUint64(&ms.nextSeq)
+
+	for from < until {
+		var chunk []slot
+		for _, shard := range ms.shards {
+			shard.mu.RLock()
+			for _, l := range shard.lanes {
+				chunk = append(chunk, l.iterate(from, until, filter, iterateChunk)...)
+			}
+			shard.mu.RUnlock()
+		}
+		if len(chunk) == 0 {
+			break
+		}
+
+		// Each shard's and lane's part is in order, but anything past the
+		// first iterateChunk may skip entries not yet copied from elsewhere
+		sort.Slice(chunk, func(i, j int) bool { return chunk[i].Seq < chunk[j].Seq })
+		if len(chunk) > iterateChunk {
+			chunk = chunk[:iterateChunk]
+		}
+		for _, s := range chunk {
+			from = s.Seq + 1
+			if !fn(s.LogEntry) {
+				return encodeCursor(from), nil
 			}
 		}
 	}
+	if from < until {
+		from = until
+	}
+	return encodeCursor(from), nil
+}
+
+// ValidCursor reports whether a cursor can be passed to IterateFrom
+func ValidCursor(cursor string) bool {
+	_, err := decodeCursor(cursor)
+	return err == nil
+}
+
+// encodeCursor turns the sequence number to resume at into an opaque token
+func encodeCursor(seq uint64) string {
+	return base64.RawURLEncoding.EncodeToString(binary.BigEndian.AppendUint64(nil, seq))
+}
+
+// decodeCursor reads a token from encodeCursor; "" is the start of the store
+func decodeCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(data) != 8 {
+		return 0, ErrInvalidCursor
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// query runs match on every shard under its read lock and merges the results into storage order
+func (ms *MemoryStore) query(match func(shard *memoryShard) []slot) []models.LogEntry {
+	var merged []slot
+	sorted := true
+	for _, shard := range ms.shards {
+		shard.mu.RLock()
+		matches := match(shard)
+		if len(shard.lanes) > 1 {
+			sorted = false
+		}
+		shard.mu.RUnlock()
+
+		if merged != nil {
+			sorted = false
+		}
+		merged = append(merged, matches...)
+	}
+
+	if !sorted {
+		sort.Slice(merged, func(i, j int) bool {
+			return merged[i].Seq < merged[j].Seq
+		})
+	}
+
+	result := make([]models.LogEntry, len(merged))
+	for i, s := range merged {
+		result[i] = s.LogEntry
+	}
 	return result
 }
 
-// GetRecent returns the N most recent logs
-func (ms *MemoryStore) GetRecent(n int) []models.LogEntry {
-	ms.mu.RLock()
-	defer ms.mu.RUnlock()
+// CountByLevel returns how many logs of a level are stored, and compacted,
+// from the indexes alone
+func (ms *MemoryStore) CountByLevel(level string) int {
+	return ms.compacted(func(key summaryKey) bool { return key.level == level }) +
+		ms.count(func(shard *memoryShard) int {
+			return len(shard.laneFor(level).byLevel.get(level))
+		})
+}
 
-	start := len(ms.logs) - n
-	if start < 0 {
-		start = 0
+// CountByService returns how many logs of a service are stored, and
+// compacted, from the indexes alone
+func (ms *MemoryStore) CountByService(service string) int {
+	return ms.compacted(func(key summaryKey) bool { return key.service == service }) +
+		ms.count(func(shard *memoryShard) int {
+			count := 0
+			for _, l := range shard.lanes {
+				count += len(l.byService.get(service))
+			}
+			return count
+		})
+}
+
+// CountByTimeRange returns how many logs fall within a time range, compacted
+// ones to the minute. Time buckets inside the range are counted from the
+// index; only the entries of the two edge buckets are looked at.
+func (ms *MemoryStore) CountByTimeRange(start, end time.Time) int {
+	startMinute := start.Unix() / 60
+	endMinute := end.Unix() / 60
+
+	compacted := ms.compacted(func(key summaryKey) bool {
+		return key.minute >= startMinute && key.minute <= endMinute
+	})
+	return compacted + ms.count(func(shard *memoryShard) int {
+		count := 0
+		for _, l := range shard.lanes {
+			reader := l.reader()
+			l.timeBuckets(start, end, func(bucket int64, seqs []uint64) {
+				from, to := l.bucketSpan(bucket)
+				if !from.Before(start) && !to.After(end) {
+					count += len(seqs)
+					return
+				}
+				for _, seq := range seqs {
+					if s, ok := reader.at(seq); ok && !s.Timestamp.Before(start) && !s.Timestamp.After(end) {
+						count++
+					}
+				}
+			})
+		}
+		return count
+	})
+}
+
+// Histogram counts the logs the filter selects per interval, grouped by
+// level, service or node (or not at all), mostly from the indexes; see
+// lane.histogram. Compacted logs are counted from their summaries unless the
+// grouping or filter needs their node, or the interval isn't whole minutes.
+// Filters on fields other than level, service, node and time count the
+// matching entries instead.
+func (ms *MemoryStore) Histogram(filter Filter, groupBy string, interval time.Duration) []HistogramBucket {
+	h := newHistogram(groupBy, interval)
+	if filter.ID != "" || filter.Message != "" || filter.MessageRegex != nil || len(filter.Metadata) > 0 || filter.Namespace != "" {
+		for _, entry := range ms.Find(filter) {
+			h.add(entry.Timestamp, groupValue(entry, groupBy), 1)
+		}
+		return h.result()
+	}
+
+	for _, shard := range ms.shards {
+		shard.mu.RLock()
+		if filter.Level != "" {
+			shard.laneFor(filter.Level).histogram(filter, groupBy, h)
+		} else {
+			for _, l := range shard.lanes {
+				l.histogram(filter, groupBy, h)
+			}
+		}
+		shard.mu.RUnlock()
+	}
+
+	if ms.summaries != nil && filter.Node == "" && groupBy != "node" && interval%time.Minute == 0 {
+		first := filter.Start.Truncate(time.Minute)
+		ms.summaries.each(func(key summaryKey, count int) {
+			minute := time.Unix(key.minute*60, 0)
+			if !filter.levelMatches(key.level) ||
+				filter.Service != "" && key.service != filter.Service ||
+				minute.Before(first) || minute.After(filter.End) {
+				return
+			}
+			h.add(minute, groupValue(models.LogEntry{Level: key.level, Service: key.service}, groupBy), count)
+		})
+	}
+	return h.result()
+}
+
+// countInterval is the Histogram interval CountMatching counts in: whole
+// minutes, so compacted logs count too, and wide enough to be one bucket
+const countInterval = 100 * 365 * 24 * time.Hour
+
+// CountMatching counts the logs the filter matches from the indexes, like
+// Histogram, when it sets nothing but level, service, node and time
+func (ms *MemoryStore) CountMatching(filter Filter) (int, bool) {
+	if filter.ID != "" || filter.Message != "" || filter.MessageRegex != nil || len(filter.Metadata) > 0 || filter.Namespace != "" {
+		return 0, false
+	}
+	if filter.End.IsZero() {
+		filter.End = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	}
+	count := 0
+	for _, bucket := range ms.Histogram(filter, "", countInterval) {
+		count += bucket.Total
+	}
+	return count, true
+}
+
+// compacted sums the summary counts match selects
+func (ms *MemoryStore) compacted(match func(key summaryKey) bool) int {
+	if ms.summaries == nil {
+		return 0
+	}
+	return ms.summaries.sum(match)
+}
+
+// count sums fn over the shards, each under its read lock
+func (ms *MemoryStore) count(fn func(shard *memoryShard) int) int {
+	total := 0
+	for _, shard := range ms.shards {
+		shard.mu.RLock()
+		total += fn(shard)
+		shard.mu.RUnlock()
+	}
+	return total
+}
+
+// Delete removes the logs the filter matches and returns how many there were.
+// Affected lanes are rebuilt, which takes a while on a large store.
+func (ms *MemoryStore) Delete(filter Filter) (int, error) {
+	removed := 0
+	for _, shard := range ms.shards {
+		shard.mu.Lock()
+		for _, l := range shard.lanes {
+			n := l.delete(filter)
+			shard.count -= n
+			removed += n
+		}
+		shard.mu.Unlock()
 	}
-	return ms.logs[start:]
+	return removed, nil
 }
 
 // Count returns total number of logs stored
 func (ms *MemoryStore) Count() int {
-	ms.mu.RLock()
-	defer ms.mu.RUnlock()
-	return len(ms.logs)
+	return ms.count(func(shard *memoryShard) int {
+		return shard.count
+	})
 }
 
-// evictOldest removes the oldest 20% of logs when capacity is exceeded
-func (ms *MemoryStore) evictOldest() {
-	evictCount := ms.maxLogs / 5 // Remove 20%
-	ms.logs = ms.logs[evictCount:]
+// CompressionStats returns the size of the compressed blocks
+func (ms *MemoryStore) CompressionStats() CompressionStats {
+	var stats CompressionStats
+	for _, shard := range ms.shards {
+		shard.mu.RLock()
+		for _, l := range shard.lanes {
+			stats.Blocks += len(l.blocks)
+			for _, block := range l.blocks {
+				stats.Entries += block.count
+				stats.RawBytes += block.rawSize
+				stats.CompressedBytes += len(block.data)
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	if stats.CompressedBytes > 0 {
+		stats.Ratio = float64(stats.RawBytes) / float64(stats.CompressedBytes)
+	}
+	return stats
+}
 
-	// Rebuild indices after eviction
-	ms.rebuildIndices()
+// evictOldest evicts one log in O(1), taking it from the lane with the
+// shortest retention first so high-volume levels don't push out rare ones.
+// Callers hold mu.
+func (shard *memoryShard) evictOldest() (slot, bool) {
+	for _, l := range shard.lanes {
+		if s, ok := l.popOldest(); ok {
+			shard.count--
+			return s, true
+		}
+	}
+	return slot{}, false
 }
 
-// rebuildIndices reconstructs all indices after eviction
-func (ms *MemoryStore) rebuildIndices() {
-	ms.indexByLevel = make(map[string][]int)
-	ms.indexByTime.mu.Lock()
-	ms.indexByTime.buckets = make(map[int64][]int)
-	ms.indexByTime.mu.Unlock()
+// addEvicted collects an evicted log, handing over a batch once it is full
+func (ms *MemoryStore) addEvicted(log models.LogEntry) {
+	ms.evictMu.Lock()
+	defer ms.evictMu.Unlock()
 
-	for idx, log := range ms.logs {
-		ms.indexByLevel[log.Level] = append(ms.indexByLevel[log.Level], idx)
-		
-		timeBucket := log.Timestamp.Unix() / 60
-		ms.indexByTime.mu.Lock()
-		ms.indexByTime.buckets[timeBucket] = append(ms.indexByTime.buckets[timeBucket], idx)
-		ms.indexByTime.mu.Unlock()
+	if ms.onEvict == nil {
+		return
 	}
-}
\ No newline at end of file
+	if ms.pending == nil {
+		ms.pending = make([]models.LogEntry, 0, ms.evictBatch+1)
+	}
+	ms.pending = append(ms.pending, log)
+	if len(ms.pending) >= ms.evictBatch {
+		ms.flushEvicted()
+	}
+}
+
+// flushEvicted hands the pending evicted logs to the eviction handler. Callers hold evictMu.
+func (ms *MemoryStore) flushEvicted() {
+	if len(ms.pending) == 0 || ms.onEvict == nil {
+		return
+	}
+	ms.onEvict(ms.pending)
+	ms.pending = nil
+}
+
+// expire evicts each lane's oldest logs while they are older than the lane's
+// retention, stopping at the first newer entry
+func (ms *MemoryStore) expire(now time.Time) {
+	evicted := make([]models.LogEntry, 0)
+	for _, shard := range ms.shards {
+		shard.mu.Lock()
+		for _, l := range shard.lanes {
+			if l.retention <= 0 {
+				continue
+			}
+			cutoff := now.Add(-l.retention)
+			expired := len(evicted)
+			for {
+				s, ok := l.oldest()
+				if !ok || !s.Timestamp.Before(cutoff) {
+					break
+				}
+				l.popOldest()
+				shard.count--
+				evicted = append(evicted, s.LogEntry)
+			}
+			if len(evicted) > expired {
+				l.pruneTime()
+			}
+		}
+		shard.mu.Unlock()
+	}
+	if ms.summaries != nil {
+		ms.summaries.add(evicted, now)
+	}
+
+	ms.evictMu.Lock()
+	defer ms.evictMu.Unlock()
+	if ms.onEvict != nil && len(evicted) > 0 {
+		ms.onEvict(evicted)
+	}
+}
@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"logstream/pkg/models"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// numbered returns entries m0, m1, ... with the given level, a second apart
+func numbered(from, to int, level string) []models.LogEntry {
+	base := time.Now().Add(-time.Hour)
+	var entries []models.LogEntry
+	for i := from; i < to; i++ {
+		entries = append(entries, models.LogEntry{
+			ID:        fmt.Sprintf("m%d", i),
+			Message:   fmt.Sprintf("m%d", i),
+			Level:     level,
+			Service:   "api",
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+		})
+	}
+	return entries
+}
+
+func names(from, to int) []string {
+	result := []string{}
+	for i := from; i < to; i++ {
+		result = append(result, fmt.Sprintf("m%d", i))
+	}
+	return result
+}
+
+func TestMemoryStoreEvictsOldestAcrossShards(t *testing.T) {
+	tests := []struct {
+		shards      int
+		batch       bool
+		wantKept    []string
+		wantEvicted []string
+	}{
+		// maxLogs 6 split evenly, entry i going to shard i % shards
+		{shards: 1, wantKept: names(4, 10), wantEvicted: names(0, 4)},
+		{shards: 2, wantKept: names(4, 10), wantEvicted: names(0, 4)},
+		{shards: 3, wantKept: names(4, 10), wantEvicted: names(0, 4)},
+		{shards: 3, batch: true, wantKept: names(4, 10), wantEvicted: names(0, 4)},
+		// Two logs per shard hold eight, so only the two oldest go
+		{shards: 4, wantKept: names(2, 10), wantEvicted: names(0, 2)},
+		{shards: 4, batch: true, wantKept: names(2, 10), wantEvicted: names(0, 2)},
+	}
+	for _, test := range tests {
+		ms := NewMemoryStore(6)
+		ms.SetShards(test.shards)
+		ms.SetEvictionBatch(1)
+		var evicted []models.LogEntry
+		ms.SetEvictionHandler(func(logs []models.LogEntry) { evicted = append(evicted, logs...) })
+
+		if test.batch {
+			ms.StoreBatch(numbered(0, 10, models.LevelInfo))
+		} else {
+			for _, entry := range numbered(0, 10, models.LevelInfo) {
+				ms.Store(entry)
+			}
+		}
+
+		if got := messages(ms.GetRecent(100)); !reflect.DeepEqual(got, test.wantKept) {
+			t.Errorf("%d shards, batch %v: kept %v, want %v", test.shards, test.batch, got, test.wantKept)
+		}
+		// A batch hands over each shard's evictions in turn
+		got := messages(evicted)
+		if test.batch {
+			sort.Strings(got)
+		}
+		if !reflect.DeepEqual(got, test.wantEvicted) {
+			t.Errorf("%d shards, batch %v: evicted %v, want %v", test.shards, test.batch, got, test.wantEvicted)
+		}
+		if got := ms.Count(); got != len(test.wantKept) {
+			t.Errorf("%d shards, batch %v: Count() = %d, want %d", test.shards, test.batch, got, len(test.wantKept))
+		}
+	}
+}
+
+func TestMemoryStoreEvictsShortestRetentionFirst(t *testing.T) {
+	for _, shards := range []int{1, 2} {
+		ms := NewMemoryStore(4)
+		ms.SetShards(shards)
+		ms.SetRetention(RetentionPolicy{ByLevel: map[string]time.Duration{models.LevelWarning: time.Hour}})
+		ms.StoreBatch(numbered(0, 2, models.LevelError))
+		ms.StoreBatch(numbered(2, 4, models.LevelWarning))
+		ms.StoreBatch(numbered(4, 6, models.LevelError))
+
+		// The WARNING logs go before the older ERROR logs
+		if got, want := messages(ms.GetRecent(10)), []string{"m0", "m1", "m4", "m5"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%d shards: kept %v, want %v", shards, got, want)
+		}
+	}
+}
+
+func TestMemoryStoreGetRecent(t *testing.T) {
+	ms := NewMemoryStore(100)
+	ms.SetShards(3)
+	ms.SetRetention(RetentionPolicy{ByLevel: map[string]time.Duration{models.LevelWarning: time.Hour}})
+	var entries []models.LogEntry
+	for i, entry := range numbered(0, 12, models.LevelInfo) {
+		if i%4 == 1 {
+			entry.Level = models.LevelWarning // Kept in a lane of its own
+		}
+		// Timestamps out of order must not reorder the result
+		entry.Timestamp = entry.Timestamp.Add(-time.Duration(i%3) * time.Minute)
+		entries = append(entries, entry)
+	}
+	ms.StoreBatch(entries[:5])
+	for _, entry := range entries[5:] {
+		ms.Store(entry)
+	}
+
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{-1, []string{}},
+		{0, []string{}},
+		{1, names(11, 12)},
+		{5, names(7, 12)},
+		{12, names(0, 12)},
+		{50, names(0, 12)},
+	}
+	for _, test := range tests {
+		if got := messages(ms.GetRecent(test.n)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("GetRecent(%d) = %v, want %v", test.n, got, test.want)
+		}
+	}
+}
+
+func TestMemoryStoreGetRecentCopiesMetadata(t *testing.T) {
+	ms := NewMemoryStore(10)
+	ms.Store(models.LogEntry{Message: "a", Metadata: map[string]interface{}{"user": map[string]interface{}{"id": "42"}}})
+
+	recent := ms.GetRecent(1)
+	recent[0].Metadata["user"].(map[string]interface{})["id"] = "changed"
+	if got := ms.GetRecent(1)[0].Metadata["user"].(map[string]interface{})["id"]; got != "42" {
+		t.Errorf("stored metadata = %v after changing a copy, want 42", got)
+	}
+}
+
+func TestIterateFromAcrossEviction(t *testing.T) {
+	for _, shards := range []int{1, 2} {
+		ms := NewMemoryStore(10)
+		ms.SetShards(shards)
+		ms.StoreBatch(numbered(0, 10, models.LevelInfo))
+
+		var seen []models.LogEntry
+		cursor, err := ms.IterateFrom("", Filter{}, func(entry models.LogEntry) bool {
+			seen = append(seen, entry)
+			return len(seen) < 3
+		})
+		if err != nil {
+			t.Fatalf("IterateFrom: %v", err)
+		}
+		if got, want := messages(seen), names(0, 3); !reflect.DeepEqual(got, want) {
+			t.Errorf("%d shards: first page = %v, want %v", shards, got, want)
+		}
+
+		// m3 and m4 are evicted before the cursor is used: they're skipped,
+		// and nothing already seen comes back
+		ms.StoreBatch(numbered(10, 15, models.LevelInfo))
+		seen = nil
+		cursor, err = ms.IterateFrom(cursor, Filter{}, func(entry models.LogEntry) bool {
+			seen = append(seen, entry)
+			return true
+		})
+		if err != nil {
+			t.Fatalf("IterateFrom: %v", err)
+		}
+		if got, want := messages(seen), names(5, 15); !reflect.DeepEqual(got, want) {
+			t.Errorf("%d shards: after eviction = %v, want %v", shards, got, want)
+		}
+
+		// A cursor past the end picks up only what is stored later
+		ms.Store(numbered(15, 16, models.LevelInfo)[0])
+		seen = nil
+		if _, err := ms.IterateFrom(cursor, Filter{}, func(entry models.LogEntry) bool {
+			seen = append(seen, entry)
+			return true
+		}); err != nil {
+			t.Fatalf("IterateFrom: %v", err)
+		}
+		if got, want := messages(seen), names(15, 16); !reflect.DeepEqual(got, want) {
+			t.Errorf("%d shards: after the end = %v, want %v", shards, got, want)
+		}
+	}
+
+	ms := NewMemoryStore(10)
+	if _, err := ms.IterateFrom("not a cursor!", Filter{}, func(models.LogEntry) bool { return true }); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("IterateFrom with a bad cursor = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestMemoryStoreCountsAfterRemoval(t *testing.T) {
+	now := time.Now()
+	entry := func(level, service string, age time.Duration) models.LogEntry {
+		return models.LogEntry{Level: level, Service: service, Message: level + " " + service, Timestamp: now.Add(-age)}
+	}
+
+	type counts struct {
+		total, errors, warnings, api, web, lastHour int
+	}
+	countsOf := func(ms *MemoryStore) counts {
+		return counts{
+			total:    ms.Count(),
+			errors:   ms.CountByLevel(models.LevelError),
+			warnings: ms.CountByLevel(models.LevelWarning),
+			api:      ms.CountByService("api"),
+			web:      ms.CountByService("web"),
+			lastHour: ms.CountByTimeRange(now.Add(-time.Hour), now),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		remove func(ms *MemoryStore)
+		want   counts
+	}{
+		{
+			name:   "nothing removed",
+			remove: func(ms *MemoryStore) {},
+			want:   counts{total: 5, errors: 2, warnings: 2, api: 3, web: 2, lastHour: 3},
+		},
+		{
+			name: "evicted by the count cap",
+			remove: func(ms *MemoryStore) {
+				// Pushes out the oldest WARNING log, then the next oldest
+				ms.Store(entry(models.LevelInfo, "web", 0))
+				ms.Store(entry(models.LevelInfo, "web", 0))
+			},
+			want: counts{total: 5, errors: 2, warnings: 0, api: 2, web: 3, lastHour: 5},
+		},
+		{
+			name:   "expired",
+			remove: func(ms *MemoryStore) { ms.expire(now) },
+			want:   counts{total: 3, errors: 2, warnings: 0, api: 2, web: 1, lastHour: 3},
+		},
+		{
+			name: "deleted",
+			remove: func(ms *MemoryStore) {
+				if n, err := ms.Delete(Filter{Service: "api"}); n != 3 || err != nil {
+					t.Errorf("Delete = %d, %v, want 3", n, err)
+				}
+			},
+			want: counts{total: 2, errors: 1, warnings: 1, api: 0, web: 2, lastHour: 1},
+		},
+	}
+	for _, test := range tests {
+		ms := NewMemoryStore(5)
+		ms.SetRetention(RetentionPolicy{ByLevel: map[string]time.Duration{models.LevelWarning: time.Hour}})
+		for _, e := range []models.LogEntry{
+			entry(models.LevelWarning, "api", 3*time.Hour),
+			entry(models.LevelWarning, "web", 2*time.Hour),
+			entry(models.LevelError, "api", 30*time.Minute),
+			entry(models.LevelError, "web", 20*time.Minute),
+			entry(models.LevelInfo, "api", 10*time.Minute),
+		} {
+			ms.Store(e)
+		}
+		test.remove(ms)
+		if got := countsOf(ms); got != test.want {
+			t.Errorf("%s: counts = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMemoryStoreMaxBytes(t *testing.T) {
+	small := models.LogEntry{Message: "x"}
+	size := entrySize(small)
+	large := models.LogEntry{Message: strings.Repeat("x", int(4*size))}
+
+	tests := []struct {
+		name      string
+		shards    int
+		maxBytes  int64
+		entries   []models.LogEntry
+		wantCount int
+	}{
+		{"under budget", 1, 10 * size, []models.LogEntry{small, small, small}, 3},
+		{"evicts down to the budget", 1, 3 * size, []models.LogEntry{small, small, small, small, small}, 3},
+		{"a large log pushes out several", 1, 5 * size, []models.LogEntry{small, small, small, small, large}, 1},
+		{"keeps one log larger than the budget", 1, size, []models.LogEntry{small, large}, 1},
+		{"budget split across shards", 2, 4 * size, []models.LogEntry{small, small, small, small, small, small}, 4},
+		{"count cap still applies", 1, 100 * size, []models.LogEntry{small, small, small, small, small, small, small, small, small}, 8},
+	}
+	for _, test := range tests {
+		ms := NewMemoryStore(8)
+		ms.SetShards(test.shards)
+		ms.SetMaxBytes(test.maxBytes)
+		for _, entry := range test.entries {
+			ms.Store(entry)
+		}
+
+		usage := ms.MemoryUsage()
+		if usage.Logs != test.wantCount {
+			t.Errorf("%s: holds %d logs, want %d", test.name, usage.Logs, test.wantCount)
+		}
+		if usage.Logs > 1 && usage.Bytes > test.maxBytes {
+			t.Errorf("%s: holds %d bytes, over the %d budget", test.name, usage.Bytes, test.maxBytes)
+		}
+		for _, shard := range ms.shards {
+			if shard.overBudget() {
+				t.Errorf("%s: a shard is still over budget with %d logs, %d bytes", test.name, shard.count, shard.bytes())
+			}
+		}
+	}
+}
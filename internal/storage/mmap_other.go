@@ -0,0 +1,18 @@
+//go:build !unix
+
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is unsupported here; callers fall back to regular reads
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("mmap not supported on this platform")
+}
+
+// munmapFile is a no-op where mmap is unsupported
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the first size bytes of file read-only
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	if size == 0 {
+		return nil, syscall.EINVAL
+	}
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmapFile releases a mapping from mmapFile
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
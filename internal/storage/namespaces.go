@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"logstream/pkg/models"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultNamespace holds the logs that name no namespace
+const DefaultNamespace = "default"
+
+// ErrUnknownNamespace is returned for a namespace that wasn't configured
+var ErrUnknownNamespace = errors.New("unknown namespace")
+
+// NamespacedStore keeps each namespace's logs in a store of its own, so a
+// query in one namespace never sees another's logs and a busy namespace
+// can't evict a quiet one's. Logs are routed by their Namespace field. The
+// Store methods read across every namespace, for replication, exports and
+// totals; requests scoped to one namespace go through Namespace.
+type NamespacedStore struct {
+	stores  map[string]Store
+	names   []string // Sorted
+	unknown uint64   // Logs dropped for naming an unconfigured namespace
+
+	// Arrival order across namespaces, so GetRecent merges in storage order
+	arrivalMu sync.Mutex
+	arrivals  []arrivalRun // Oldest first
+	journaled int          // Logs the runs cover
+	sinceTrim int          // Logs journaled since the last trim
+}
+
+// arrivalRun is a run of consecutively stored logs of one namespace
+type arrivalRun struct {
+	namespace string
+	n         int
+}
+
+// arrivalTrimEvery is how many stored logs go by between trims of the
+// arrival journal to what the stores still hold
+const arrivalTrimEvery = 1 << 16
+
+// NewNamespacedStore opens a store for the default namespace and each of names
+func NewNamespacedStore(names []string, open func(namespace string) (Store, error)) (*NamespacedStore, error) {
+	ns := &NamespacedStore{stores: make(map[string]Store)}
+	for _, name := range append([]string{DefaultNamespace}, names...) {
+		if !models.ValidNamespace(name) {
+			return nil, fmt.Errorf("invalid namespace %q", name)
+		}
+		if _, ok := ns.stores[name]; ok {
+			continue
+		}
+		store, err := open(name)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", name, err)
+		}
+		ns.stores[name] = store
+		ns.names = append(ns.names, name)
+	}
+	sort.Strings(ns.names)
+	return ns, nil
+}
+
+// ParseNamespaceQuotas parses "prod=500000,staging=20000" into per-namespace log limits
+func ParseNamespaceQuotas(spec string) (map[string]int, error) {
+	quotas := make(map[string]int)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not namespace=logs", part)
+		}
+		quota, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || quota <= 0 {
+			return nil, fmt.Errorf("invalid quota %q for namespace %s", value, name)
+		}
+		quotas[strings.TrimSpace(name)] = quota
+	}
+	return quotas, nil
+}
+
+// Namespace returns the store of a namespace; "" is the default namespace
+func (ns *NamespacedStore) Namespace(name string) (Store, error) {
+	if name == "" {
+		name = DefaultNamespace
+	}
+	store, ok := ns.stores[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownNamespace, name)
+	}
+	return store, nil
+}
+
+// Names returns the configured namespaces, sorted
+func (ns *NamespacedStore) Names() []string {
+	return ns.names
+}
+
+// Counts returns the number of logs in each namespace
+func (ns *NamespacedStore) Counts() map[string]int {
+	counts := make(map[string]int, len(ns.names))
+	for _, name := range ns.names {
+		counts[name] = ns.stores[name].Count()
+	}
+	return counts
+}
+
+// Unknown returns how many logs were dropped for naming an unconfigured namespace
+func (ns *NamespacedStore) Unknown() uint64 {
+	return atomic.LoadUint64(&ns.unknown)
+}
+
+// Store adds a log to its namespace's store. Logs naming an unconfigured
+// namespace are dropped and counted rather than mixed into another one.
+func (ns *NamespacedStore) Store(entry models.LogEntry) {
+	store, err := ns.Namespace(entry.Namespace)
+	if err != nil {
+		if dropped := atomic.AddUint64(&ns.unknown, 1); dropped%1000 == 1 {
+			fmt.Printf("⚠️  Dropped a log for namespace %q, which isn't configured (%d so far)\n", entry.Namespace, dropped)
+		}
+		return
+	}
+	store.Store(entry)
+	ns.arrived(entry.Namespace, 1)
+}
+
+// StoreBatch adds logs to their namespaces' stores, one batch per namespace.
+// A batch rarely spans namespaces, so the common case passes it through whole.
+func (ns *NamespacedStore) StoreBatch(entries []models.LogEntry) {
+	for len(entries) > 0 {
+		// Hand over the run of entries sharing the first entry's namespace
+		run := 1
+		for run < len(entries) && entries[run].Namespace == entries[0].Namespace {
+			run++
+		}
+		if store, err := ns.Namespace(entries[0].Namespace); err == nil {
+			store.StoreBatch(entries[:run])
+			ns.arrived(entries[0].Namespace, run)
+		} else {
+			for _, entry := range entries[:run] {
+				ns.Store(entry) // Counts the drop
+			}
+		}
+		entries = entries[run:]
+	}
+}
+
+// GetByLevel returns logs of a level from every namespace
+func (ns *NamespacedStore) GetByLevel(level string) []models.LogEntry {
+	return ns.collect(func(store Store) []models.LogEntry { return store.GetByLevel(level) })
+}
+
+// GetByNode returns logs ingested by a node from every namespace
+func (ns *NamespacedStore) GetByNode(node string) []models.LogEntry {
+	return ns.collect(func(store Store) []models.LogEntry { return store.GetByNode(node) })
+}
+
+// GetByService returns logs of a service from every namespace
+func (ns *NamespacedStore) GetByService(service string) []models.LogEntry {
+	return ns.collect(func(store Store) []models.LogEntry { return store.GetByService(service) })
+}
+
+// GetByID returns a log by ID from whichever namespace holds it
+func (ns *NamespacedStore) GetByID(id string) (models.LogEntry, bool) {
+	for _, name := range ns.names {
+		if entry, ok := ns.stores[name].GetByID(id); ok {
+			return entry, true
+		}
+	}
+	return models.LogEntry{}, false
+}
+
+// GetByTimeRange returns logs within a time range from every namespace
+func (ns *NamespacedStore) GetByTimeRange(start, end time.Time) []models.LogEntry {
+	return ns.collect(func(store Store) []models.LogEntry { return store.GetByTimeRange(start, end) })
+}
+
+// GetRecent returns the N most recent logs across the namespaces in storage
+// order, like the stores themselves, so backfilled logs page the same way.
+// Logs stored before the arrival journal begins, such as those a disk store
+// reopened with, come first, one namespace after another.
+func (ns *NamespacedStore) GetRecent(n int) []models.LogEntry {
+	if n <= 0 {
+		return []models.LogEntry{}
+	}
+	remaining := make(map[string][]models.LogEntry, len(ns.names))
+	for _, name := range ns.names {
+		remaining[name] = ns.stores[name].GetRecent(n)
+	}
+
+	// Fill from the newest end, taking each run's logs from the end of its
+	// namespace's own storage order
+	result := make([]models.LogEntry, n)
+	next := n
+	take := func(name string, count int) {
+		logs := remaining[name]
+		count = min(count, len(logs), next)
+		copy(result[next-count:next], logs[len(logs)-count:])
+		remaining[name] = logs[:len(logs)-count]
+		next -= count
+	}
+	ns.arrivalMu.Lock()
+	for i := len(ns.arrivals) - 1; i >= 0 && next > 0; i-- {
+		take(ns.arrivals[i].namespace, ns.arrivals[i].n)
+	}
+	ns.arrivalMu.Unlock()
+	for i := len(ns.names) - 1; i >= 0 && next > 0; i-- {
+		take(ns.names[i], n)
+	}
+	return result[next:]
+}
+
+// Find returns the logs the filter matches from every namespace
+func (ns *NamespacedStore) Find(filter Filter) []models.LogEntry {
+	return ns.collect(func(store Store) []models.LogEntry { return store.Find(filter) })
+}
+
+// Delete removes the logs the filter matches from every namespace
+func (ns *NamespacedStore) Delete(filter Filter) (int, error) {
+	total := 0
+	for _, name := range ns.names {
+		deleted, err := ns.stores[name].Delete(filter)
+		total += deleted
+		if err != nil {
+			return total, fmt.Errorf("namespace %s: %w", name, err)
+		}
+	}
+	return total, nil
+}
+
+// Count returns the number of logs in every namespace
+func (ns *NamespacedStore) Count() int {
+	total := 0
+	for _, name := range ns.names {
+		total += ns.stores[name].Count()
+	}
+	return total
+}
+
+// arrived journals that count logs were just stored in a namespace, and
+// every arrivalTrimEvery logs trims the journal
+func (ns *NamespacedStore) arrived(namespace string, count int) {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	ns.arrivalMu.Lock()
+	if last := len(ns.arrivals) - 1; last >= 0 && ns.arrivals[last].namespace == namespace {
+		ns.arrivals[last].n += count
+	} else {
+		ns.arrivals = append(ns.arrivals, arrivalRun{namespace: namespace, n: count})
+	}
+	ns.journaled += count
+	ns.sinceTrim += count
+	trim := ns.sinceTrim >= arrivalTrimEvery
+	if trim {
+		ns.sinceTrim = 0
+	}
+	ns.arrivalMu.Unlock()
+
+	if trim {
+		ns.trimArrivals()
+	}
+}
+
+// trimArrivals drops the oldest runs while the rest still cover as many logs
+// as the stores hold. Logs still stored from dropped runs are older than
+// every journaled one, so GetRecent puts them first.
+func (ns *NamespacedStore) trimArrivals() {
+	held := ns.Count()
+
+	ns.arrivalMu.Lock()
+	defer ns.arrivalMu.Unlock()
+	drop := 0
+	for drop < len(ns.arrivals) && ns.journaled-ns.arrivals[drop].n >= held {
+		ns.journaled -= ns.arrivals[drop].n
+		drop++
+	}
+	ns.arrivals = append(ns.arrivals[:0], ns.arrivals[drop:]...)
+}
+
+// collect concatenates a query's results from each namespace, in name order
+func (ns *NamespacedStore) collect(query func(store Store) []models.LogEntry) []models.LogEntry {
+	result := make([]models.LogEntry, 0)
+	for _, name := range ns.names {
+		result = append(result, query(ns.stores[name])...)
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"logstream/pkg/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestNamespacedStore(t *testing.T, maxLogs int) *NamespacedStore {
+	t.Helper()
+	ns, err := NewNamespacedStore([]string{"prod", "staging"}, func(string) (Store, error) {
+		return NewMemoryStore(maxLogs), nil
+	})
+	if err != nil {
+		t.Fatalf("NewNamespacedStore: %v", err)
+	}
+	return ns
+}
+
+func messages(logs []models.LogEntry) []string {
+	result := make([]string, len(logs))
+	for i, log := range logs {
+		result[i] = log.Message
+	}
+	return result
+}
+
+func TestNamespacedGetRecentKeepsStorageOrder(t *testing.T) {
+	ns := newTestNamespacedStore(t, 100)
+	now := time.Now()
+	// Backfilled and clock-skewed timestamps mustn't reorder the result
+	ns.Store(models.LogEntry{Message: "a", Namespace: "prod", Timestamp: now})
+	ns.StoreBatch([]models.LogEntry{
+		{Message: "b", Namespace: "staging", Timestamp: now.Add(-time.Hour)},
+		{Message: "c", Namespace: "staging", Timestamp: now.Add(time.Hour)},
+		{Message: "d", Timestamp: now.Add(-24 * time.Hour)},
+		{Message: "e", Namespace: "prod", Timestamp: now.Add(-time.Minute)},
+	})
+	ns.Store(models.LogEntry{Message: "dropped", Namespace: "unknown", Timestamp: now})
+	ns.Store(models.LogEntry{Message: "f", Namespace: "staging", Timestamp: now.Add(-2 * time.Hour)})
+
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{0, []string{}},
+		{1, []string{"f"}},
+		{3, []string{"d", "e", "f"}},
+		{6, []string{"a", "b", "c", "d", "e", "f"}},
+		{50, []string{"a", "b", "c", "d", "e", "f"}},
+	}
+	for _, test := range tests {
+		if got := messages(ns.GetRecent(test.n)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("GetRecent(%d) = %v, want %v", test.n, got, test.want)
+		}
+	}
+}
+
+func TestNamespacedGetRecentAfterTrim(t *testing.T) {
+	ns := newTestNamespacedStore(t, 2)
+	for _, entry := range []models.LogEntry{
+		{Message: "a", Namespace: "prod"},
+		{Message: "b", Namespace: "staging"},
+		{Message: "c", Namespace: "prod"},
+		{Message: "d", Namespace: "prod"},
+		{Message: "e", Namespace: "staging"},
+	} {
+		ns.Store(entry)
+	}
+	ns.trimArrivals()
+
+	// prod evicted a; the journal still covers the four logs stored
+	if ns.journaled < ns.Count() {
+		t.Fatalf("journal covers %d logs, fewer than the %d stored", ns.journaled, ns.Count())
+	}
+	if got, want := messages(ns.GetRecent(10)), []string{"b", "c", "d", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetRecent after trimming = %v, want %v", got, want)
+	}
+}
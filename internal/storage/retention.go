@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy sets how long logs are kept, by age of their timestamp
+type RetentionPolicy struct {
+	Default time.Duration            // Retention for levels without an override (0 keeps them until the count cap)
+	ByLevel map[string]time.Duration // Per-level overrides, e.g. ERROR=168h, INFO=1h
+}
+
+// retentionFor returns the retention of a level; 0 means no age limit
+func (rp RetentionPolicy) retentionFor(level string) time.Duration {
+	if retention, ok := rp.ByLevel[level]; ok {
+		return retention
+	}
+	return rp.Default
+}
+
+// shortest returns the shortest age limit set
+func (rp RetentionPolicy) shortest() time.Duration {
+	shortest := rp.Default
+	for _, retention := range rp.ByLevel {
+		if retention > 0 && (shortest == 0 || retention < shortest) {
+			shortest = retention
+		}
+	}
+	return shortest
+}
+
+// ParseLevelRetention parses "ERROR=168h,INFO=1h" into per-level retentions
+func ParseLevelRetention(spec string) (map[string]time.Duration, error) {
+	result := make(map[string]time.Duration)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid level retention %q (expected LEVEL=duration)", item)
+		}
+		retention, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || retention < 0 {
+			return nil, fmt.Errorf("invalid retention %q for %s", parts[1], parts[0])
+		}
+		result[strings.ToUpper(strings.TrimSpace(parts[0]))] = retention
+	}
+	return result, nil
+}
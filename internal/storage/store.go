@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"logstream/internal/query"
+	"logstream/pkg/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Store is a log storage backend. Queries return entries oldest first.
+type Store interface {
+	Store(entry models.LogEntry)
+	StoreBatch(entries []models.LogEntry)
+	GetByLevel(level string) []models.LogEntry
+	GetByNode(node string) []models.LogEntry
+	GetByService(service string) []models.LogEntry
+	GetByID(id string) (models.LogEntry, bool)
+	GetByTimeRange(start, end time.Time) []models.LogEntry
+	GetRecent(n int) []models.LogEntry
+	Find(filter Filter) []models.LogEntry
+	Delete(filter Filter) (int, error)
+	Count() int
+}
+
+// Filter selects logs by their fields; set fields must all match
+type Filter struct {
+	ID    string
+	Level string
+	// Least severe level matched, e.g. ERROR for ERROR and CRITICAL
+	MinLevel string
+	Service  string
+	Node     string
+	Start    time.Time // Inclusive; zero is unbounded
+	End      time.Time // Inclusive; zero is unbounded
+	Message  string    // Substring of the message, ignoring case
+	// Pattern the message matches, from query.CompileRegex
+	MessageRegex *regexp.Regexp
+	// Metadata fields that must all match, e.g. from ?metadata.user_id=42
+	Metadata        []query.MetadataFilter
+	MetadataOptions query.MetadataOptions
+
+	Namespace string // Limits the other fields to one namespace; DefaultNamespace matches entries without one
+}
+
+// Empty reports whether the filter sets nothing but a namespace, which would
+// match every log in it
+func (f Filter) Empty() bool {
+	return f.ID == "" && f.Level == "" && f.MinLevel == "" && f.Service == "" && f.Node == "" && f.Start.IsZero() && f.End.IsZero() && f.Message == "" && f.MessageRegex == nil && len(f.Metadata) == 0
+}
+
+// levelMatches reports whether Level and MinLevel select a level
+func (f Filter) levelMatches(level string) bool {
+	if f.Level != "" && level != f.Level {
+		return false
+	}
+	if f.MinLevel != "" {
+		severity, ok := models.LevelSeverity(level)
+		min, _ := models.LevelSeverity(f.MinLevel)
+		return ok && severity >= min
+	}
+	return true
+}
+
+// Matches reports whether an entry is selected by the filter
+func (f Filter) Matches(entry models.LogEntry) bool {
+	if f.ID != "" && entry.ID != f.ID {
+		return false
+	}
+	if f.Namespace != "" && entry.Namespace != f.Namespace && !(f.Namespace == DefaultNamespace && entry.Namespace == "") {
+		return false
+	}
+	if !f.levelMatches(entry.Level) {
+		return false
+	}
+	if f.Service != "" && entry.Service != f.Service {
+		return false
+	}
+	if f.Node != "" && entry.Node != f.Node {
+		return false
+	}
+	if !f.Start.IsZero() && entry.Timestamp.Before(f.Start) {
+		return false
+	}
+	if !f.End.IsZero() && entry.Timestamp.After(f.End) {
+		return false
+	}
+	if f.Message != "" && !containsFold(entry.Message, f.Message) {
+		return false
+	}
+	if f.MessageRegex != nil && !query.MatchesRegex(f.MessageRegex, entry.Message) {
+		return false
+	}
+	if len(f.Metadata) > 0 && !query.MatchesMetadata(entry.Metadata, f.Metadata, f.MetadataOptions) {
+		return false
+	}
+	return true
+}
+
+// keep returns the logs the filter matches, reusing their array
+func (f Filter) keep(logs []models.LogEntry) []models.LogEntry {
+	kept := logs[:0]
+	for _, entry := range logs {
+		if f.Matches(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// containsFold reports whether substr is within s, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
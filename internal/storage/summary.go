@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"logstream/pkg/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Summary counts the logs of one service and level in one minute that were
+// compacted away
+type Summary struct {
+	Minute  time.Time `json:"minute"`
+	Service string    `json:"service"`
+	Level   string    `json:"level"`
+	Count   int       `json:"count"`
+}
+
+// summaryKey identifies a Summary
+type summaryKey struct {
+	minute  int64 // Unix minute
+	service string
+	level   string
+}
+
+// summaryTable holds the counts of compacted logs
+type summaryTable struct {
+	mu     sync.RWMutex
+	keep   time.Duration // How long summaries are kept
+	counts map[summaryKey]int
+	pruned int64 // Unix minute summaries were last dropped before
+}
+
+// newSummaryTable creates an empty table keeping summaries for keep
+func newSummaryTable(keep time.Duration) *summaryTable {
+	return &summaryTable{keep: keep, counts: make(map[summaryKey]int)}
+}
+
+// add counts logs and, once a minute, drops summaries older than keep
+func (t *summaryTable) add(logs []models.LogEntry, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, log := range logs {
+		t.counts[summaryKey{minute: log.Timestamp.Unix() / 60, service: log.Service, level: log.Level}]++
+	}
+	if t.keep > 0 {
+		oldest := now.Add(-t.keep).Unix() / 60
+		if oldest <= t.pruned {
+			return
+		}
+		t.pruned = oldest
+		for key := range t.counts {
+			if key.minute < oldest {
+				delete(t.counts, key)
+			}
+		}
+	}
+}
+
+// sum adds up the counts match selects
+func (t *summaryTable) sum(match func(key summaryKey) bool) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	total := 0
+	for key, count := range t.counts {
+		if match(key) {
+			total += count
+		}
+	}
+	return total
+}
+
+// each calls fn with every summary count
+func (t *summaryTable) each(fn func(key summaryKey, count int)) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for key, count := range t.counts {
+		fn(key, count)
+	}
+}
+
+// list returns the summaries filter selects (ID and Node are ignored), oldest minute first
+func (t *summaryTable) list(filter Filter) []Summary {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	result := make([]Summary, 0)
+	for key, count := range t.counts {
+		minute := time.Unix(key.minute*60, 0).UTC()
+		if !filter.levelMatches(key.level) ||
+			filter.Service != "" && key.service != filter.Service ||
+			!filter.Start.IsZero() && minute.Before(filter.Start.Truncate(time.Minute)) ||
+			!filter.End.IsZero() && minute.After(filter.End) {
+			continue
+		}
+		result = append(result, Summary{Minute: minute, Service: key.service, Level: key.level, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.Minute.Equal(b.Minute) {
+			return a.Minute.Before(b.Minute)
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		return a.Level < b.Level
+	})
+	return result
+}
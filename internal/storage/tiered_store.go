@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"logstream/pkg/models"
+	"time"
+)
+
+// TieredStore keeps the newest logs in a memory store and moves the ones it
+// evicts to a disk store, so recent queries run at RAM speed while older logs
+// stay queryable. Queries read both tiers and return cold results first.
+type TieredStore struct {
+	hot  *MemoryStore
+	cold *DiskStore
+	wal  *WAL // Emptied by Stop once the memory tier is on disk (nil without one)
+}
+
+// NewTieredStore moves logs evicted from hot into cold as they leave
+func NewTieredStore(hot *MemoryStore, cold *DiskStore) *TieredStore {
+	hot.SetEvictionBatch(1)
+	hot.SetEvictionHandler(cold.StoreBatch)
+	return &TieredStore{hot: hot, cold: cold}
+}
+
+// Hot returns the memory tier
+func (ts *TieredStore) Hot() *MemoryStore {
+	return ts.hot
+}
+
+// SetWAL makes Stop empty the WAL once it has moved the memory tier to disk,
+// so a restart doesn't replay logs the disk tier already holds
+func (ts *TieredStore) SetWAL(wal *WAL) {
+	ts.wal = wal
+}
+
+// Replay stores the WAL's entries in the memory tier, skipping those moved to
+// the disk tier before a crash, and returns how many it stored
+func (ts *TieredStore) Replay(entries []models.LogEntry) int {
+	if len(entries) == 0 {
+		return 0
+	}
+	earliest := entries[0].Timestamp
+	for _, entry := range entries[1:] {
+		if entry.Timestamp.Before(earliest) {
+			earliest = entry.Timestamp
+		}
+	}
+	demoted := make(map[string]bool)
+	ts.cold.Iterate(Filter{Start: earliest}, func(entry models.LogEntry) bool {
+		demoted[entry.ID] = true
+		return true
+	})
+
+	kept := make([]models.LogEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !demoted[entry.ID] {
+			kept = append(kept, entry)
+		}
+	}
+	ts.hot.StoreBatch(kept)
+	return len(kept)
+}
+
+// Start starts both tiers' background work
+func (ts *TieredStore) Start() {
+	ts.hot.Start()
+	ts.cold.Start()
+}
+
+// Stop moves the memory tier's logs to the disk tier, so a restart loses
+// nothing, closes the disk tier and then empties the WAL
+func (ts *TieredStore) Stop() error {
+	ts.hot.Stop()
+	ts.cold.StoreBatch(ts.hot.GetRecent(ts.hot.Count()))
+	if err := ts.cold.Stop(); err != nil {
+		return err
+	}
+	if ts.wal != nil {
+		return ts.wal.Discard()
+	}
+	return nil
+}
+
+// Store adds a log to the memory tier
+func (ts *TieredStore) Store(entry models.LogEntry) {
+	ts.hot.Store(entry)
+}
+
+// StoreBatch adds logs to the memory tier
+func (ts *TieredStore) StoreBatch(entries []models.LogEntry) {
+	ts.hot.StoreBatch(entries)
+}
+
+// GetByLevel returns logs of a level from both tiers
+func (ts *TieredStore) GetByLevel(level string) []models.LogEntry {
+	return append(ts.cold.GetByLevel(level), ts.hot.GetByLevel(level)...)
+}
+
+// GetByNode returns logs ingested by a node from both tiers
+func (ts *TieredStore) GetByNode(node string) []models.LogEntry {
+	return append(ts.cold.GetByNode(node), ts.hot.GetByNode(node)...)
+}
+
+// GetByService returns logs of a service from both tiers
+func (ts *TieredStore) GetByService(service string) []models.LogEntry {
+	return append(ts.cold.GetByService(service), ts.hot.GetByService(service)...)
+}
+
+// GetByID returns a log by ID, looking in the memory tier first
+func (ts *TieredStore) GetByID(id string) (models.LogEntry, bool) {
+	if entry, ok := ts.hot.GetByID(id); ok {
+		return entry, true
+	}
+	return ts.cold.GetByID(id)
+}
+
+// GetByTimeRange returns logs within a time range from both tiers
+func (ts *TieredStore) GetByTimeRange(start, end time.Time) []models.LogEntry {
+	return append(ts.cold.GetByTimeRange(start, end), ts.hot.GetByTimeRange(start, end)...)
+}
+
+// GetRecent returns the N most recent logs, reading the disk tier only when the memory tier holds fewer
+func (ts *TieredStore) GetRecent(n int) []models.LogEntry {
+	recent := ts.hot.GetRecent(n)
+	if len(recent) >= n {
+		return recent
+	}
+	return append(ts.cold.GetRecent(n-len(recent)), recent...)
+}
+
+// Find returns the logs the filter matches from both tiers
+func (ts *TieredStore) Find(filter Filter) []models.LogEntry {
+	return append(ts.cold.Find(filter), ts.hot.Find(filter)...)
+}
+
+// FindContext is Find bounded like MemoryStore.FindContext, reading the cold
+// tier first
+func (ts *TieredStore) FindContext(ctx context.Context, filter Filter, limit int) ([]models.LogEntry, bool) {
+	cold, partial := FindLimited(ctx, ts.cold, filter, limit)
+	if partial {
+		return cold, true
+	}
+	if limit > 0 && len(cold) == limit {
+		// Full already; the result is partial if the hot tier has any match
+		hot, _ := ts.hot.FindContext(ctx, filter, 1)
+		return cold, len(hot) > 0
+	}
+	remaining := 0
+	if limit > 0 {
+		remaining = limit - len(cold)
+	}
+	hot, partial := ts.hot.FindContext(ctx, filter, remaining)
+	return append(cold, hot...), partial
+}
+
+// Histogram adds up both tiers' counts per interval and group
+func (ts *TieredStore) Histogram(filter Filter, groupBy string, interval time.Duration) []HistogramBucket {
+	return MergeHistograms(groupBy, interval, ts.cold.Histogram(filter, groupBy, interval), ts.hot.Histogram(filter, groupBy, interval))
+}
+
+// Iterate calls fn with every log the filter matches in the cold tier, then
+// in the hot one, until fn returns false
+func (ts *TieredStore) Iterate(filter Filter, fn func(models.LogEntry) bool) {
+	done := false
+	ts.cold.Iterate(filter, func(entry models.LogEntry) bool {
+		done = !fn(entry)
+		return !done
+	})
+	if !done {
+		ts.hot.Iterate(filter, fn)
+	}
+}
+
+// FindNewest returns the last limit matches, from the hot tier and, if it
+// holds fewer, the newest of the cold tier's before them
+func (ts *TieredStore) FindNewest(filter Filter, limit int) []models.LogEntry {
+	hot := ts.hot.FindNewest(filter, limit)
+	if len(hot) >= limit {
+		return hot
+	}
+	return append(FindNewest(ts.cold, filter, limit-len(hot)), hot...)
+}
+
+// Delete removes the logs the filter matches from both tiers
+func (ts *TieredStore) Delete(filter Filter) (int, error) {
+	hot, err := ts.hot.Delete(filter)
+	if err != nil {
+		return hot, err
+	}
+	cold, err := ts.cold.Delete(filter)
+	return hot + cold, err
+}
+
+// Count returns the number of logs in both tiers
+func (ts *TieredStore) Count() int {
+	return ts.hot.Count() + ts.cold.Count()
+}
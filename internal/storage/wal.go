@@ -0,0 +1,426 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"logstream/pkg/models"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// walSegmentPattern names segment files so they sort in write order
+const walSegmentPattern = "wal-%020d.log"
+
+// WALConfig controls where and how the write-ahead log is kept
+type WALConfig struct {
+	Dir          string
+	SyncInterval time.Duration // How often appends are fsynced; 0 syncs every append
+	SegmentSize  int           // Entries per segment file before rotating
+	Retain       int           // Entries kept across segments; older segments are deleted
+	Keyring      *Keyring      // Encrypts new segments (nil writes plaintext)
+}
+
+// WAL is an append-only log of ingested entries, split into segment files.
+// Replaying it on startup rebuilds the in-memory store after a restart.
+type WAL struct {
+	config   WALConfig
+	segments []walSegment // Oldest first; the last one is being appended to
+	file     *os.File
+	writer   *bufio.Writer
+	lines    *lineCipher // Encrypts appends to the current segment; nil writes plaintext
+	dirty    bool
+	waiters  []chan error // Told the outcome of the next sync
+	mu       sync.Mutex
+	shutdown chan struct{}
+}
+
+// walSegment is one segment file and how many entries it holds
+type walSegment struct {
+	seq     uint64
+	entries int
+}
+
+// OpenWAL replays every segment in config.Dir into replay, oldest first, and
+// opens the log for appending. A torn entry at the end of the last segment
+// (from a crash mid-write) is truncated away.
+func OpenWAL(config WALConfig, replay func(models.LogEntry)) (*WAL, int, error) {
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = 10000
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, 0, err
+	}
+
+	wal := &WAL{
+		config:   config,
+		shutdown: make(chan struct{}),
+	}
+
+	paths, err := filepath.Glob(filepath.Join(config.Dir, "wal-*.log"))
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Strings(paths)
+
+	replayed := 0
+	for i, path := range paths {
+		var seq uint64
+		if _, err := fmt.Sscanf(filepath.Base(path), walSegmentPattern, &seq); err != nil {
+			continue
+		}
+
+		entries, lines, err := replaySegment(path, i == len(paths)-1, config.Keyring, replay)
+		if err != nil {
+			return nil, replayed, fmt.Errorf("replaying %s: %w", path, err)
+		}
+		wal.segments = append(wal.segments, walSegment{seq: seq, entries: entries})
+		wal.lines = lines
+		replayed += entries
+	}
+
+	// Continue the last segment, or start the first one. A segment written in
+	// plaintext before encryption was turned on is left for a new one.
+	if len(wal.segments) == 0 {
+		wal.segments = append(wal.segments, walSegment{seq: 1})
+	} else if last := wal.segments[len(wal.segments)-1]; config.Keyring != nil && wal.lines == nil {
+		if info, err := os.Stat(filepath.Join(config.Dir, fmt.Sprintf(walSegmentPattern, last.seq))); err == nil && info.Size() > 0 {
+			wal.segments = append(wal.segments, walSegment{seq: last.seq + 1})
+		}
+	}
+	if err := wal.openSegment(); err != nil {
+		return nil, replayed, err
+	}
+	return wal, replayed, nil
+}
+
+// replaySegment reads one segment, skipping undecodable lines, and returns
+// the cipher its lines are encrypted with. An unterminated line at the end of
+// the last segment is a torn write and gets truncated.
+func replaySegment(path string, last bool, keyring *Keyring, replay func(models.LogEntry)) (int, *lineCipher, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	lines, offset, err := keyring.readHeader(reader)
+	if err == io.EOF {
+		if last {
+			fmt.Printf("⚠️  Truncating torn WAL write at the end of %s\n", path)
+			return 0, nil, os.Truncate(path, 0)
+		}
+		return 0, nil, nil
+	} else if err != nil {
+		return 0, nil, err
+	}
+
+	entries := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 && last {
+				fmt.Printf("⚠️  Truncating torn WAL write at the end of %s\n", path)
+				return entries, lines, os.Truncate(path, offset)
+			}
+			return entries, lines, nil
+		}
+		if err != nil {
+			return entries, lines, err
+		}
+		offset += int64(len(line))
+
+		var entry models.LogEntry
+		if err := lines.decode(line, &entry); err != nil {
+			fmt.Printf("⚠️  Skipping corrupt WAL entry in %s: %v\n", path, err)
+			continue
+		}
+		replay(entry)
+		entries++
+	}
+}
+
+// openSegment opens the newest segment for appending, starting it with an
+// encryption header when it is new and a keyring is set. Callers hold mu (or
+// own the WAL exclusively).
+func (w *WAL) openSegment() error {
+	current := w.segments[len(w.segments)-1]
+	path := filepath.Join(w.config.Dir, fmt.Sprintf(walSegmentPattern, current.seq))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.writer = bufio.NewWriterSize(file, 64*1024)
+
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		w.lines = nil
+		if w.config.Keyring != nil {
+			header, lines, err := w.config.Keyring.newHeader()
+			if err != nil {
+				return err
+			}
+			if _, err := w.writer.Write(header); err != nil {
+				return err
+			}
+			w.lines = lines
+			w.dirty = true
+		}
+	}
+	return nil
+}
+
+// Append writes an entry to the log. With a zero SyncInterval it returns only
+// once the entry is fsynced; otherwise the background syncer makes it durable.
+func (w *WAL) Append(entry models.LogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return fmt.Errorf("wal is closed")
+	}
+	if _, err := w.writer.Write(w.lines.seal(append(data, '\n'))); err != nil {
+		return err
+	}
+	w.dirty = true
+	w.segments[len(w.segments)-1].entries++
+
+	if w.config.SyncInterval == 0 {
+		if err := w.sync(); err != nil {
+			return err
+		}
+	}
+	if w.segments[len(w.segments)-1].entries >= w.config.SegmentSize {
+		return w.rotate()
+	}
+	return nil
+}
+
+// AppendBatch writes entries to the log under one lock, syncing once for the
+// batch when every append is synced
+func (w *WAL) AppendBatch(entries []models.LogEntry) error {
+	encoded := make([][]byte, len(entries))
+	for i, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		encoded[i] = append(data, '\n')
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return fmt.Errorf("wal is closed")
+	}
+	for _, data := range encoded {
+		if _, err := w.writer.Write(w.lines.seal(data)); err != nil {
+			return err
+		}
+		w.dirty = true
+		w.segments[len(w.segments)-1].entries++
+		if w.segments[len(w.segments)-1].entries >= w.config.SegmentSize {
+			if err := w.rotate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if w.config.SyncInterval == 0 {
+		return w.sync()
+	}
+	return nil
+}
+
+// sync flushes buffered entries and fsyncs the current segment, telling the
+// waiters how it went. Callers hold mu.
+func (w *WAL) sync() error {
+	if !w.dirty {
+		return nil
+	}
+	err := w.writer.Flush()
+	if err == nil {
+		w.dirty = false
+		err = w.file.Sync()
+	}
+	for _, waiter := range w.waiters {
+		waiter <- err
+	}
+	w.waiters = nil
+	return err
+}
+
+// Synced returns a channel that receives nil once everything appended so far
+// is fsynced, or the error of the sync that failed, for callers that promise
+// durability without syncing every append
+func (w *WAL) Synced() <-chan error {
+	done := make(chan error, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.dirty {
+		done <- nil
+		return done
+	}
+	if w.file == nil {
+		done <- fmt.Errorf("wal is closed")
+		return done
+	}
+	w.waiters = append(w.waiters, done)
+	return done
+}
+
+// rotate closes the full segment, starts a new one and deletes segments whose
+// entries the store would have evicted anyway. Callers hold mu.
+func (w *WAL) rotate() error {
+	if err := w.sync(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	next := w.segments[len(w.segments)-1].seq + 1
+	w.segments = append(w.segments, walSegment{seq: next})
+	if err := w.openSegment(); err != nil {
+		w.file = nil
+		return err
+	}
+
+	if w.config.Retain <= 0 {
+		return nil
+	}
+	// Drop the oldest segment while the newer ones still hold Retain entries
+	for len(w.segments) > 1 {
+		newer := 0
+		for _, segment := range w.segments[1:] {
+			newer += segment.entries
+		}
+		if newer < w.config.Retain {
+			break
+		}
+		path := filepath.Join(w.config.Dir, fmt.Sprintf(walSegmentPattern, w.segments[0].seq))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		w.segments = w.segments[1:]
+	}
+	return nil
+}
+
+// Delete rewrites the segments without the entries the filter matches, so
+// deleted logs don't come back on replay, and returns how many were removed
+func (w *WAL) Delete(filter Filter) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, fmt.Errorf("wal is closed")
+	}
+	if err := w.sync(); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for i, segment := range w.segments {
+		path := filepath.Join(w.config.Dir, fmt.Sprintf(walSegmentPattern, segment.seq))
+		n, err := rewriteLines(path, filter, w.config.Keyring, nil)
+		if err != nil {
+			return removed, fmt.Errorf("rewriting %s: %w", path, err)
+		}
+		w.segments[i].entries -= n
+		removed += n
+
+		if n > 0 && i == len(w.segments)-1 {
+			// The current segment's file was replaced; append to the new one
+			w.file.Close()
+			if err := w.openSegment(); err != nil {
+				w.file = nil
+				return removed, err
+			}
+		}
+	}
+	return removed, nil
+}
+
+// Start begins the background syncer when appends aren't synced individually
+func (w *WAL) Start() {
+	if w.config.SyncInterval > 0 {
+		go w.syncLoop()
+	}
+}
+
+// syncLoop fsyncs pending appends every SyncInterval
+func (w *WAL) syncLoop() {
+	ticker := time.NewTicker(w.config.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.file != nil {
+				if err := w.sync(); err != nil {
+					fmt.Printf("⚠️  Failed to sync WAL: %v\n", err)
+				}
+			}
+			w.mu.Unlock()
+		case <-w.shutdown:
+			return
+		}
+	}
+}
+
+// Discard closes the log and deletes its segments, once everything in it is
+// stored elsewhere. Close is still safe to call after it.
+func (w *WAL) Discard() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	// What they wait on is stored elsewhere now
+	for _, waiter := range w.waiters {
+		waiter <- nil
+	}
+	w.waiters = nil
+	for _, segment := range w.segments {
+		path := filepath.Join(w.config.Dir, fmt.Sprintf(walSegmentPattern, segment.seq))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	w.segments = nil
+	return nil
+}
+
+// Close syncs outstanding appends and closes the current segment
+func (w *WAL) Close() error {
+	close(w.shutdown)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.sync()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	return err
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"logstream/pkg/models"
+	"testing"
+	"time"
+)
+
+func openTestWAL(t *testing.T) *WAL {
+	t.Helper()
+	wal, _, err := OpenWAL(WALConfig{Dir: t.TempDir(), SyncInterval: time.Hour}, func(models.LogEntry) {})
+	if err != nil {
+		t.Fatalf("OpenWAL: %v", err)
+	}
+	return wal
+}
+
+func TestWALSyncedWaitsForSync(t *testing.T) {
+	wal := openTestWAL(t)
+	defer wal.Close()
+
+	select {
+	case err := <-wal.Synced():
+		if err != nil {
+			t.Fatalf("Synced with nothing appended = %v, want nil", err)
+		}
+	default:
+		t.Fatal("Synced with nothing appended should be ready at once")
+	}
+
+	if err := wal.AppendBatch([]models.LogEntry{{ID: "1", Message: "a"}}); err != nil {
+		t.Fatalf("AppendBatch: %v", err)
+	}
+	synced := wal.Synced()
+	select {
+	case <-synced:
+		t.Fatal("Synced was ready before the append was fsynced")
+	default:
+	}
+
+	wal.mu.Lock()
+	err := wal.sync()
+	wal.mu.Unlock()
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if err := <-synced; err != nil {
+		t.Fatalf("Synced after sync = %v, want nil", err)
+	}
+}
+
+func TestWALSyncedReportsFailedSync(t *testing.T) {
+	wal := openTestWAL(t)
+
+	if err := wal.AppendBatch([]models.LogEntry{{ID: "1", Message: "a"}}); err != nil {
+		t.Fatalf("AppendBatch: %v", err)
+	}
+	synced := wal.Synced()
+
+	// A closed file fails the flush, as a full or failing disk would
+	wal.file.Close()
+	wal.mu.Lock()
+	wal.sync()
+	wal.mu.Unlock()
+	if err := <-synced; err == nil {
+		t.Fatal("Synced after a failed sync = nil, want the error")
+	}
+}
+
+func TestWALSyncedReleasedByDiscard(t *testing.T) {
+	wal := openTestWAL(t)
+
+	if err := wal.AppendBatch([]models.LogEntry{{ID: "1", Message: "a"}}); err != nil {
+		t.Fatalf("AppendBatch: %v", err)
+	}
+	synced := wal.Synced()
+	if err := wal.Discard(); err != nil {
+		t.Fatalf("Discard: %v", err)
+	}
+	if err := <-synced; err != nil {
+		t.Fatalf("Synced after Discard = %v, want nil", err)
+	}
+}
@@ -0,0 +1,182 @@
+package tail
+
+import (
+	"errors"
+	"fmt"
+	"logstream/pkg/models"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Errors returned by Subscribe
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrTooManyTails  = errors.New("too many live tails")
+)
+
+// Event is a stored entry with the cursor a tail resumes after it from
+type Event struct {
+	Cursor string
+	Entry  models.LogEntry
+}
+
+// Hub fans stored entries out to live tails. It keeps the most recent ones
+// so a tail that reconnects with the cursor of the last event it got
+// replays what it missed, as long as that is still held.
+type Hub struct {
+	mu      sync.Mutex
+	epoch   string // Distinguishes this process's cursors from a previous one's
+	next    uint64 // Sequence number of the next entry
+	recent  []models.LogEntry
+	start   int // Index in recent of the oldest entry
+	size    int
+	subs    map[*Subscription]struct{}
+	maxSubs int
+}
+
+// Subscription is one live tail. Events delivers its matching entries; it is
+// closed when the tail falls too far behind, so the client reconnects and
+// replays from its last cursor. A subscription from Watch drops the entries
+// it has no room for instead, counting them.
+type Subscription struct {
+	Events  <-chan Event
+	events  chan Event
+	match   func(models.LogEntry) bool
+	lossy   bool
+	dropped atomic.Uint64
+}
+
+// Dropped returns how many matching entries a Watch subscription has dropped
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// subscriptionBuffer is how many undelivered events a tail may fall behind by
+const subscriptionBuffer = 1024
+
+// NewHub creates a hub replaying up to keep entries and serving at most maxSubs tails
+func NewHub(keep, maxSubs int) *Hub {
+	return &Hub{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		recent:  make([]models.LogEntry, max(1, keep)),
+		subs:    make(map[*Subscription]struct{}),
+		maxSubs: maxSubs,
+	}
+}
+
+// Publish hands a stored entry to the tails it matches. It never blocks: a
+// tail whose queue is full is closed instead, or for Watch drops the entry.
+func (h *Hub) Publish(entry models.LogEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	seq := h.next
+	h.next++
+	if h.size == len(h.recent) {
+		h.start = (h.start + 1) % len(h.recent)
+		h.size--
+	}
+	h.recent[(h.start+h.size)%len(h.recent)] = entry
+	h.size++
+
+	if len(h.subs) == 0 {
+		return
+	}
+	event := Event{Cursor: h.cursor(seq), Entry: entry}
+	for sub := range h.subs {
+		if !sub.match(entry) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			if sub.lossy {
+				sub.dropped.Add(1)
+				continue
+			}
+			delete(h.subs, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe starts a tail of the entries match selects. With the cursor of
+// an event from this process, the held entries after it are returned for
+// replay; gap reports that some of them are no longer held, or that the
+// cursor is from before a restart.
+func (h *Hub) Subscribe(cursor string, match func(models.LogEntry) bool) (sub *Subscription, replay []Event, gap bool, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subs) >= h.maxSubs {
+		return nil, nil, false, ErrTooManyTails
+	}
+	if cursor != "" {
+		epoch, seqText, ok := strings.Cut(cursor, "-")
+		seq, parseErr := strconv.ParseUint(seqText, 10, 64)
+		if !ok || parseErr != nil {
+			return nil, nil, false, ErrInvalidCursor
+		}
+		if epoch != h.epoch || seq >= h.next {
+			gap = true
+		} else {
+			oldest := h.next - uint64(h.size)
+			from := seq + 1
+			if from < oldest {
+				gap, from = true, oldest
+			}
+			for s := from; s < h.next; s++ {
+				entry := h.recent[(h.start+int(s-oldest))%len(h.recent)]
+				if match(entry) {
+					replay = append(replay, Event{Cursor: h.cursor(s), Entry: entry})
+				}
+			}
+		}
+	}
+
+	events := make(chan Event, subscriptionBuffer)
+	sub = &Subscription{Events: events, events: events, match: match}
+	h.subs[sub] = struct{}{}
+	return sub, replay, gap, nil
+}
+
+// Watch starts a tail of the entries match selects that keeps going when it
+// falls behind, dropping what doesn't fit its queue rather than ending.
+func (h *Hub) Watch(match func(models.LogEntry) bool) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subs) >= h.maxSubs {
+		return nil, ErrTooManyTails
+	}
+	events := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{Events: events, events: events, match: match, lossy: true}
+	h.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Unsubscribe ends a tail
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Tails returns the number of live tails
+func (h *Hub) Tails() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// cursor returns the cursor of the entry with a sequence number
+func (h *Hub) cursor(seq uint64) string {
+	return fmt.Sprintf("%s-%d", h.epoch, seq)
+}
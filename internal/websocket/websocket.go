@@ -0,0 +1,264 @@
+// Package websocket is a small server side of the WebSocket protocol (RFC
+// 6455): the upgrade handshake and unfragmented writes of text messages,
+// with reads reassembling fragments and answering pings and closes.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opcodes of the frames a Conn handles
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// Close codes
+const (
+	CloseNormal        = 1000
+	CloseProtocolError = 1002
+	CloseTooBig        = 1009
+)
+
+// acceptGUID is appended to the client's key to derive Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// writeTimeout bounds how long a write may wait on a slow client
+const writeTimeout = 10 * time.Second
+
+// ErrClosed is returned by ReadMessage once the client closed the connection
+var ErrClosed = errors.New("websocket closed")
+
+// Conn is an upgraded WebSocket connection. Reads must come from one
+// goroutine; writes may come from several.
+type Conn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMu    sync.Mutex
+	maxMessage int
+	idle       time.Duration
+}
+
+// Upgrade completes the handshake of a WebSocket request and takes over its
+// connection. Messages larger than maxMessage bytes are refused. On failure
+// it has already responded with an error.
+func Upgrade(w http.ResponseWriter, r *http.Request, maxMessage int) (*Conn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "Expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("not a websocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing websocket key")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSockets are not supported", http.StatusInternalServerError)
+		return nil, errors.New("connection can't be hijacked")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha1.Sum([]byte(key + acceptGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(digest[:]) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, reader: buffered.Reader, maxMessage: maxMessage}, nil
+}
+
+// headerContains reports whether a comma-separated header lists token, ignoring case
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetIdleTimeout makes reads fail once the client has sent no frame, pongs
+// included, for d
+func (c *Conn) SetIdleTimeout(d time.Duration) {
+	c.idle = d
+}
+
+// ReadMessage returns the next text or binary message, answering pings and
+// skipping pongs on the way. It returns ErrClosed after a close frame, which
+// it answers.
+func (c *Conn) ReadMessage() (opcode int, data []byte, err error) {
+	var message []byte
+	messageOp := -1
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case OpPing:
+			if err := c.write(OpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.CloseWith(code, "")
+			return 0, nil, ErrClosed
+		case OpText, OpBinary:
+			if messageOp != -1 {
+				c.CloseWith(CloseProtocolError, "expected a continuation frame")
+				return 0, nil, fmt.Errorf("websocket: new message before the last one finished")
+			}
+			messageOp = op
+		case OpContinuation:
+			if messageOp == -1 {
+				c.CloseWith(CloseProtocolError, "unexpected continuation frame")
+				return 0, nil, fmt.Errorf("websocket: continuation without a message")
+			}
+		default:
+			c.CloseWith(CloseProtocolError, "unknown opcode")
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %d", op)
+		}
+
+		if len(message)+len(payload) > c.maxMessage {
+			c.CloseWith(CloseTooBig, "message too big")
+			return 0, nil, fmt.Errorf("websocket: message larger than %d bytes", c.maxMessage)
+		}
+		message = append(message, payload...)
+		if fin {
+			return messageOp, message, nil
+		}
+	}
+}
+
+// readFrame reads one frame and unmasks its payload
+func (c *Conn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	if c.idle > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.idle))
+	}
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if !masked {
+		c.CloseWith(CloseProtocolError, "client frames must be masked")
+		return false, 0, nil, fmt.Errorf("websocket: unmasked client frame")
+	}
+	if length > uint64(c.maxMessage) {
+		c.CloseWith(CloseTooBig, "message too big")
+		return false, 0, nil, fmt.Errorf("websocket: frame larger than %d bytes", c.maxMessage)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteText sends a text message
+func (c *Conn) WriteText(data []byte) error {
+	return c.write(OpText, data)
+}
+
+// Ping sends a ping, which the client answers with a pong
+func (c *Conn) Ping() error {
+	return c.write(OpPing, nil)
+}
+
+// CloseWith sends a close frame with a code and reason and closes the connection
+func (c *Conn) CloseWith(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	c.write(OpClose, append(payload, reason...))
+	return c.conn.Close()
+}
+
+// Close closes the connection without a close frame
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// write sends one unmasked, final frame
+func (c *Conn) write(opcode int, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | byte(opcode)
+	switch {
+	case len(payload) < 126:
+		header[1] = byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(len(payload)))
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clientFrame encodes a frame as a client sends it, masked unless told not to
+func clientFrame(fin bool, opcode int, payload []byte, masked bool) []byte {
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first, 0}
+	switch {
+	case len(payload) < 126:
+		frame[1] = byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if !masked {
+		return append(frame, payload...)
+	}
+	frame[1] |= 0x80
+	mask := []byte{0x37, 0xfa, 0x21, 0x3d}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// readServerFrame decodes one unmasked frame sent by the server
+func readServerFrame(r io.Reader) (fin bool, opcode int, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	if header[1]&0x80 != 0 {
+		return false, 0, nil, errors.New("server frame is masked")
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	payload = make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	return header[0]&0x80 != 0, int(header[0] & 0x0F), payload, err
+}
+
+// pipe returns a server Conn and the client end of its connection
+func pipe(t *testing.T, maxMessage int) (*Conn, net.Conn) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	return &Conn{conn: server, reader: bufio.NewReader(server), maxMessage: maxMessage}, client
+}
+
+// send writes frames from the client in the background, since pipes are unbuffered
+func send(client net.Conn, frames ...[]byte) {
+	go func() {
+		for _, frame := range frames {
+			if _, err := client.Write(frame); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func TestReadMessage(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), 200)
+	huge := bytes.Repeat([]byte("y"), 70000)
+	tests := []struct {
+		name   string
+		frames [][]byte
+		opcode int
+		data   []byte
+	}{
+		{"text", [][]byte{clientFrame(true, OpText, []byte(`{"subscribe":"a"}`), true)}, OpText, []byte(`{"subscribe":"a"}`)},
+		{"binary", [][]byte{clientFrame(true, OpBinary, []byte{0, 1, 2}, true)}, OpBinary, []byte{0, 1, 2}},
+		{"empty", [][]byte{clientFrame(true, OpText, nil, true)}, OpText, []byte{}},
+		{"16-bit length", [][]byte{clientFrame(true, OpText, long, true)}, OpText, long},
+		{"64-bit length", [][]byte{clientFrame(true, OpText, huge, true)}, OpText, huge},
+		{"fragmented", [][]byte{
+			clientFrame(false, OpText, []byte("hel"), true),
+			clientFrame(false, OpContinuation, []byte("lo "), true),
+			clientFrame(true, OpContinuation, []byte("world"), true),
+		}, OpText, []byte("hello world")},
+		{"pong skipped", [][]byte{
+			clientFrame(true, OpPong, nil, true),
+			clientFrame(true, OpText, []byte("after pong"), true),
+		}, OpText, []byte("after pong")},
+	}
+	for _, test := range tests {
+		conn, client := pipe(t, 100000)
+		send(client, test.frames...)
+		opcode, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("%s: ReadMessage: %v", test.name, err)
+		}
+		if opcode != test.opcode || !bytes.Equal(data, test.data) {
+			t.Errorf("%s: ReadMessage = %d %q, want %d %q", test.name, opcode, truncate(data), test.opcode, truncate(test.data))
+		}
+	}
+}
+
+func TestReadMessageAnswersPing(t *testing.T) {
+	conn, client := pipe(t, 1024)
+	send(client, clientFrame(true, OpPing, []byte("are you there"), true), clientFrame(true, OpText, []byte("hi"), true))
+
+	result := make(chan string, 1)
+	go func() {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		result <- string(data)
+	}()
+
+	fin, opcode, payload, err := readServerFrame(client)
+	if err != nil || !fin || opcode != OpPong || string(payload) != "are you there" {
+		t.Fatalf("reply to ping = %v %d %q %v, want a pong echoing the payload", fin, opcode, payload, err)
+	}
+	if got := <-result; got != "hi" {
+		t.Errorf("ReadMessage after the ping = %q, want hi", got)
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		frames    [][]byte
+		text      string // In the returned error
+		closeCode int    // Close frame the server answers with
+	}{
+		{
+			name:      "unmasked frame",
+			frames:    [][]byte{clientFrame(true, OpText, []byte("hi"), false)},
+			text:      "unmasked",
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "frame too big",
+			frames:    [][]byte{clientFrame(true, OpText, bytes.Repeat([]byte("x"), 17), true)},
+			text:      "frame larger than 16 bytes",
+			closeCode: CloseTooBig,
+		},
+		{
+			name: "fragments too big",
+			frames: [][]byte{
+				clientFrame(false, OpText, bytes.Repeat([]byte("x"), 10), true),
+				clientFrame(true, OpContinuation, bytes.Repeat([]byte("x"), 10), true),
+			},
+			text:      "message larger than 16 bytes",
+			closeCode: CloseTooBig,
+		},
+		{
+			name:      "continuation without a message",
+			frames:    [][]byte{clientFrame(true, OpContinuation, []byte("hi"), true)},
+			text:      "continuation without a message",
+			closeCode: CloseProtocolError,
+		},
+		{
+			name: "new message before the last finished",
+			frames: [][]byte{
+				clientFrame(false, OpText, []byte("a"), true),
+				clientFrame(true, OpText, []byte("b"), true),
+			},
+			text:      "new message",
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "unknown opcode",
+			frames:    [][]byte{clientFrame(true, 0x3, []byte("hi"), true)},
+			text:      "unknown opcode 3",
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "client close",
+			frames:    [][]byte{clientFrame(true, OpClose, binary.BigEndian.AppendUint16(nil, 1001), true)},
+			closeCode: 1001,
+		},
+		{
+			name:      "client close without a code",
+			frames:    [][]byte{clientFrame(true, OpClose, nil, true)},
+			closeCode: CloseNormal,
+		},
+	}
+	for _, test := range tests {
+		conn, client := pipe(t, 16)
+		send(client, test.frames...)
+
+		result := make(chan error, 1)
+		go func() {
+			_, _, err := conn.ReadMessage()
+			result <- err
+		}()
+
+		_, opcode, payload, err := readServerFrame(client)
+		if err != nil || opcode != OpClose || len(payload) < 2 {
+			t.Errorf("%s: server replied %d %x %v, want a close frame", test.name, opcode, payload, err)
+		} else if code := int(binary.BigEndian.Uint16(payload)); code != test.closeCode {
+			t.Errorf("%s: close code %d, want %d", test.name, code, test.closeCode)
+		}
+
+		err = <-result
+		switch {
+		case test.text == "" && !errors.Is(err, ErrClosed):
+			t.Errorf("%s: ReadMessage = %v, want ErrClosed", test.name, err)
+		case test.text != "" && (err == nil || !strings.Contains(err.Error(), test.text)):
+			t.Errorf("%s: ReadMessage = %v, want an error containing %q", test.name, err, test.text)
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	for _, size := range []int{0, 5, 125, 126, 200, 0xFFFF, 0x10000} {
+		conn, client := pipe(t, 16)
+		data := bytes.Repeat([]byte("z"), size)
+		go conn.WriteText(data)
+
+		fin, opcode, payload, err := readServerFrame(client)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if !fin || opcode != OpText || !bytes.Equal(payload, data) {
+			t.Errorf("%d bytes: read fin=%v opcode=%d with %d bytes", size, fin, opcode, len(payload))
+		}
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	upgraded := make(chan *Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, 1024)
+		if err != nil {
+			return
+		}
+		upgraded <- conn
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"not an upgrade", http.Header{"Sec-Websocket-Version": {"13"}, "Sec-Websocket-Key": {"a2V5"}}, http.StatusBadRequest},
+		{"old version", http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"8"}, "Sec-Websocket-Key": {"a2V5"}}, http.StatusUpgradeRequired},
+		{"no key", http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"13"}}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header = test.header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, resp.StatusCode, test.status)
+		}
+	}
+
+	// The handshake from RFC 6455 section 1.3
+	client, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(client, "GET /ws HTTP/1.1\r\nHost: localhost\r\nConnection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	reader := bufio.NewReader(client)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("reading the handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake = %s with accept %q, want 101 with s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Status, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	conn := <-upgraded
+	defer conn.Close()
+	client.Write(clientFrame(true, OpText, []byte("ping me"), true))
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "ping me" {
+		t.Fatalf("ReadMessage over the upgraded connection = %q, %v", data, err)
+	}
+	go conn.WriteText([]byte("pong you"))
+	if _, _, payload, err := readServerFrame(reader); err != nil || string(payload) != "pong you" {
+		t.Errorf("client read %q, %v, want pong you", payload, err)
+	}
+}
+
+// truncate shortens long payloads in failure messages
+func truncate(data []byte) []byte {
+	if len(data) > 40 {
+		return data[:40]
+	}
+	return data
+}
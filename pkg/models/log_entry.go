@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 // LogEntry represents a single log message
 type LogEntry struct {
@@ -9,7 +14,15 @@ type LogEntry struct {
 	Level     string                 `json:"level"` // INFO, WARNING, ERROR, CRITICAL
 	Message   string                 `json:"message"`
 	Service   string                 `json:"service"`
+	Node      string                 `json:"node,omitempty"`   // ID of the LogStream node that ingested the entry
+	Source    string                 `json:"source,omitempty"` // Input the entry arrived through (http, stdin, udp, ...)
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Namespace string                 `json:"namespace,omitempty"` // Tenant or environment the entry belongs to; empty for the default
+
+	// Audit chain, set in audit mode
+	AuditSeq uint64 `json:"audit_seq,omitempty"` // Position in the chain
+	PrevHash string `json:"prev_hash,omitempty"` // Hash of the entry before it
+	Hash     string `json:"hash,omitempty"`      // SHA-256 of the entry, including PrevHash
 }
 
 // LogLevel constants
@@ -18,4 +31,72 @@ const (
 	LevelWarning  = "WARNING"
 	LevelError    = "ERROR"
 	LevelCritical = "CRITICAL"
-)
\ No newline at end of file
+)
+
+// Levels lists the levels from least to most severe
+var Levels = []string{LevelInfo, LevelWarning, LevelError, LevelCritical}
+
+// LevelSeverity returns a level's place in Levels, so levels compare by
+// severity, and whether it is a known level
+func LevelSeverity(level string) (int, bool) {
+	for i, known := range Levels {
+		if level == known {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// LevelsAtLeast returns the levels as severe as min or more, least severe first
+func LevelsAtLeast(min string) []string {
+	severity, ok := LevelSeverity(min)
+	if !ok {
+		return nil
+	}
+	return Levels[severity:]
+}
+
+// Source constants
+const (
+	SourceHTTP     = "http"
+	SourceStdin    = "stdin"
+	SourceUDP      = "udp"
+	SourceAMQP     = "amqp"
+	SourceSimulate = "simulate"
+	SourceBackfill = "backfill"
+	SourceFile     = "file"
+	SourceCSV      = "csv"
+	SourceBulk     = "es_bulk"
+)
+
+// FillDefaults sets a timestamp and ID on entries that arrived without them
+func (e *LogEntry) FillDefaults() {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+}
+
+// Validate checks the fields stores rely on
+func (e *LogEntry) Validate() error {
+	if e.Namespace != "" && !ValidNamespace(e.Namespace) {
+		return fmt.Errorf("invalid namespace %q, expected up to 64 lowercase letters, digits, - or _", e.Namespace)
+	}
+	return nil
+}
+
+// ValidNamespace reports whether name can name a namespace: 1 to 64 lowercase
+// letters, digits, - or _, so it is safe as a directory name
+func ValidNamespace(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
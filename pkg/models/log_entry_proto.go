@@ -0,0 +1,181 @@
+package models
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ContentTypeProtobuf is the media type for protobuf-encoded ingest bodies
+const ContentTypeProtobuf = "application/x-protobuf"
+
+// Field numbers from log_entry.proto
+const (
+	protoFieldID        protowire.Number = 1
+	protoFieldTimestamp protowire.Number = 2
+	protoFieldLevel     protowire.Number = 3
+	protoFieldMessage   protowire.Number = 4
+	protoFieldService   protowire.Number = 5
+	protoFieldMetadata  protowire.Number = 6
+	protoFieldNamespace protowire.Number = 7
+	protoFieldNode      protowire.Number = 8
+	protoFieldSource    protowire.Number = 9
+
+	protoFieldBatchEntries protowire.Number = 1
+)
+
+// UnmarshalProto decodes a logstream.v1.LogEntry message
+func (e *LogEntry) UnmarshalProto(data []byte) error {
+	*e = LogEntry{}
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			// Unknown scalar field from a newer schema, skip it
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch num {
+		case protoFieldID:
+			e.ID = string(value)
+		case protoFieldLevel:
+			e.Level = string(value)
+		case protoFieldMessage:
+			e.Message = string(value)
+		case protoFieldService:
+			e.Service = string(value)
+		case protoFieldNamespace:
+			e.Namespace = string(value)
+		case protoFieldNode:
+			e.Node = string(value)
+		case protoFieldSource:
+			e.Source = string(value)
+		case protoFieldTimestamp:
+			var ts timestamppb.Timestamp
+			if err := proto.Unmarshal(value, &ts); err != nil {
+				return fmt.Errorf("timestamp: %w", err)
+			}
+			e.Timestamp = ts.AsTime()
+		case protoFieldMetadata:
+			var metadata structpb.Struct
+			if err := proto.Unmarshal(value, &metadata); err != nil {
+				return fmt.Errorf("metadata: %w", err)
+			}
+			e.Metadata = metadata.AsMap()
+		}
+	}
+	return nil
+}
+
+// MarshalProto encodes the entry as a logstream.v1.LogEntry message
+func (e *LogEntry) MarshalProto() ([]byte, error) {
+	var buf []byte
+	buf = appendProtoString(buf, protoFieldID, e.ID)
+
+	if !e.Timestamp.IsZero() {
+		ts, err := proto.Marshal(timestamppb.New(e.Timestamp))
+		if err != nil {
+			return nil, err
+		}
+		buf = protowire.AppendTag(buf, protoFieldTimestamp, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+
+	buf = appendProtoString(buf, protoFieldLevel, e.Level)
+	buf = appendProtoString(buf, protoFieldMessage, e.Message)
+	buf = appendProtoString(buf, protoFieldService, e.Service)
+
+	if len(e.Metadata) > 0 {
+		metadata, err := structpb.NewStruct(e.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("metadata: %w", err)
+		}
+		data, err := proto.Marshal(metadata)
+		if err != nil {
+			return nil, err
+		}
+		buf = protowire.AppendTag(buf, protoFieldMetadata, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, data)
+	}
+	buf = appendProtoString(buf, protoFieldNamespace, e.Namespace)
+	buf = appendProtoString(buf, protoFieldNode, e.Node)
+	buf = appendProtoString(buf, protoFieldSource, e.Source)
+	return buf, nil
+}
+
+// UnmarshalProtoBatch decodes a logstream.v1.LogBatch message
+func UnmarshalProtoBatch(data []byte) ([]LogEntry, error) {
+	entries := make([]LogEntry, 0)
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if num != protoFieldBatchEntries || typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var entry LogEntry
+		if err := entry.UnmarshalProto(value); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", len(entries), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// MarshalProtoBatch encodes entries as a logstream.v1.LogBatch message
+func MarshalProtoBatch(entries []LogEntry) ([]byte, error) {
+	var buf []byte
+	for i := range entries {
+		data, err := entries[i].MarshalProto()
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		buf = protowire.AppendTag(buf, protoFieldBatchEntries, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, data)
+	}
+	return buf, nil
+}
+
+// appendProtoString appends a string field, omitting empty values as proto3 does
+func appendProtoString(buf []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return buf
+	}
+	buf = protowire.AppendTag(buf, num, protowire.BytesType)
+	return protowire.AppendString(buf, value)
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"logstream/pkg/models/logpb"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fullEntry sets every field the wire format carries. Metadata numbers are
+// float64, as structpb decodes them.
+func fullEntry() LogEntry {
+	return LogEntry{
+		ID:        "7c9e6679",
+		Timestamp: time.Date(2026, 10, 17, 9, 30, 0, 123456789, time.UTC),
+		Level:     LevelError,
+		Message:   "payment failed: ünïcode ✓",
+		Service:   "payments",
+		Metadata: map[string]interface{}{
+			"user_id": float64(829),
+			"retry":   true,
+			"tags":    []interface{}{"eu", "card"},
+			"nested":  map[string]interface{}{"code": "E42"},
+			"none":    nil,
+		},
+		Namespace: "team-a",
+		Node:      "node-1",
+		Source:    "http",
+	}
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry LogEntry
+	}{
+		{"every field", fullEntry()},
+		{"empty", LogEntry{}},
+		{"message only", LogEntry{Message: "hello"}},
+		{"pre-1970 timestamp", LogEntry{Timestamp: time.Date(1969, 7, 20, 20, 17, 0, 0, time.UTC)}},
+	}
+	for _, test := range tests {
+		data, err := test.entry.MarshalProto()
+		if err != nil {
+			t.Fatalf("%s: MarshalProto: %v", test.name, err)
+		}
+		var decoded LogEntry
+		if err := decoded.UnmarshalProto(data); err != nil {
+			t.Fatalf("%s: UnmarshalProto: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(decoded, test.entry) {
+			t.Errorf("%s: decoded %+v, want %+v", test.name, decoded, test.entry)
+		}
+	}
+}
+
+func TestProtoMatchesGeneratedCode(t *testing.T) {
+	entry := fullEntry()
+	metadata, err := structpb.NewStruct(entry.Metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := &logpb.LogEntry{
+		Id:        entry.ID,
+		Timestamp: timestamppb.New(entry.Timestamp),
+		Level:     entry.Level,
+		Message:   entry.Message,
+		Service:   entry.Service,
+		Metadata:  metadata,
+		Namespace: entry.Namespace,
+		Node:      entry.Node,
+		Source:    entry.Source,
+	}
+
+	// What other clients send decodes to the same entry
+	data, err := proto.Marshal(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded LogEntry
+	if err := decoded.UnmarshalProto(data); err != nil {
+		t.Fatalf("UnmarshalProto: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, entry) {
+		t.Errorf("decoded %+v, want %+v", decoded, entry)
+	}
+
+	// And what we send decodes in theirs
+	data, err = entry.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var theirs logpb.LogEntry
+	if err := proto.Unmarshal(data, &theirs); err != nil {
+		t.Fatalf("proto.Unmarshal: %v", err)
+	}
+	if !proto.Equal(&theirs, generated) {
+		t.Errorf("generated code decoded %v, want %v", &theirs, generated)
+	}
+}
+
+func TestProtoBatchRoundTrip(t *testing.T) {
+	entries := []LogEntry{fullEntry(), {Message: "second"}, {}}
+	data, err := MarshalProtoBatch(entries)
+	if err != nil {
+		t.Fatalf("MarshalProtoBatch: %v", err)
+	}
+
+	decoded, err := UnmarshalProtoBatch(data)
+	if err != nil {
+		t.Fatalf("UnmarshalProtoBatch: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, entries) {
+		t.Errorf("decoded %+v, want %+v", decoded, entries)
+	}
+
+	var theirs logpb.LogBatch
+	if err := proto.Unmarshal(data, &theirs); err != nil || len(theirs.Entries) != 3 || theirs.Entries[1].GetMessage() != "second" {
+		t.Errorf("generated code decoded %v, %v, want 3 entries", &theirs, err)
+	}
+
+	empty, err := UnmarshalProtoBatch(nil)
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Errorf("UnmarshalProtoBatch(nil) = %#v, %v, want an empty batch", empty, err)
+	}
+}
+
+func TestUnmarshalProtoSkipsUnknownFields(t *testing.T) {
+	var data []byte
+	data = protowire.AppendTag(data, 15, protowire.VarintType)
+	data = protowire.AppendVarint(data, 300)
+	data = protowire.AppendTag(data, protoFieldMessage, protowire.BytesType)
+	data = protowire.AppendString(data, "kept")
+	data = protowire.AppendTag(data, 16, protowire.Fixed32Type)
+	data = protowire.AppendFixed32(data, 7)
+	data = protowire.AppendTag(data, 20, protowire.BytesType)
+	data = protowire.AppendString(data, "from a newer schema")
+	data = protowire.AppendTag(data, 21, protowire.Fixed64Type)
+	data = protowire.AppendFixed64(data, 7)
+
+	entry := LogEntry{ID: "left over", Level: LevelInfo}
+	if err := entry.UnmarshalProto(data); err != nil {
+		t.Fatalf("UnmarshalProto: %v", err)
+	}
+	if !reflect.DeepEqual(entry, LogEntry{Message: "kept"}) {
+		t.Errorf("decoded %+v, want only the message, with earlier contents reset", entry)
+	}
+
+	// A batch skips fields other than its entries too
+	var batch []byte
+	batch = protowire.AppendTag(batch, 2, protowire.BytesType)
+	batch = protowire.AppendString(batch, "unknown")
+	batch = protowire.AppendTag(batch, protoFieldBatchEntries, protowire.BytesType)
+	batch = protowire.AppendBytes(batch, data)
+	entries, err := UnmarshalProtoBatch(batch)
+	if err != nil || len(entries) != 1 || entries[0].Message != "kept" {
+		t.Errorf("UnmarshalProtoBatch = %+v, %v, want the one entry", entries, err)
+	}
+}
+
+func TestUnmarshalProtoErrors(t *testing.T) {
+	message := protowire.AppendString(protowire.AppendTag(nil, protoFieldMessage, protowire.BytesType), "hello")
+	field := func(num protowire.Number, value []byte) []byte {
+		return protowire.AppendBytes(protowire.AppendTag(nil, num, protowire.BytesType), value)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		text string
+	}{
+		{"truncated tag", []byte{0x80}, "unexpected EOF"},
+		{"zero field number", []byte{0x00}, "invalid field number"},
+		{"truncated length", message[:1], "unexpected EOF"},
+		{"truncated value", message[:len(message)-1], "unexpected EOF"},
+		{"truncated unknown varint", []byte{15 << 3, 0x80}, "unexpected EOF"},
+		{"bad timestamp", field(protoFieldTimestamp, []byte{0xff}), "timestamp"},
+		{"bad metadata", field(protoFieldMetadata, []byte{0x0a, 0x05, 0x01}), "metadata"},
+	}
+	for _, test := range tests {
+		var entry LogEntry
+		err := entry.UnmarshalProto(test.data)
+		if err == nil || !strings.Contains(err.Error(), test.text) {
+			t.Errorf("%s: UnmarshalProto = %v, want an error containing %q", test.name, err, test.text)
+		}
+
+		batch := append(field(protoFieldBatchEntries, message), field(protoFieldBatchEntries, test.data)...)
+		if _, err := UnmarshalProtoBatch(batch); err == nil || !strings.Contains(err.Error(), "entry 1: ") {
+			t.Errorf("%s: UnmarshalProtoBatch = %v, want an error for entry 1", test.name, err)
+		}
+	}
+
+	if _, err := UnmarshalProtoBatch(message[:3]); err == nil {
+		t.Error("UnmarshalProtoBatch of a truncated batch succeeded, want an error")
+	}
+}
+
+func TestMarshalProtoRejectsUnencodableMetadata(t *testing.T) {
+	entry := LogEntry{Message: "m", Metadata: map[string]interface{}{"at": time.Now()}}
+	if _, err := entry.MarshalProto(); err == nil || !strings.Contains(err.Error(), "metadata") {
+		t.Errorf("MarshalProto = %v, want a metadata error", err)
+	}
+	if _, err := MarshalProtoBatch([]LogEntry{{}, entry}); err == nil || !strings.Contains(err.Error(), "entry 1: ") {
+		t.Errorf("MarshalProtoBatch = %v, want an error for entry 1", err)
+	}
+}
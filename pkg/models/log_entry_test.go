@@ -0,0 +1,29 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		hasError  bool
+	}{
+		{name: "default namespace", namespace: ""},
+		{name: "letters and digits", namespace: "team1"},
+		{name: "dash and underscore", namespace: "team-a_1"},
+		{name: "64 chars", namespace: strings.Repeat("a", 64)},
+		{name: "65 chars", namespace: strings.Repeat("a", 65), hasError: true},
+		{name: "uppercase", namespace: "Team", hasError: true},
+		{name: "space", namespace: "team a", hasError: true},
+		{name: "path", namespace: "../etc", hasError: true},
+	}
+	for _, test := range tests {
+		entry := LogEntry{Level: LevelInfo, Message: "ok", Namespace: test.namespace}
+		if err := entry.Validate(); (err != nil) != test.hasError {
+			t.Errorf("%s: Validate = %v, want error %v", test.name, err, test.hasError)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+// Package logpb holds the Go types and gRPC service stubs generated from the
+// protobuf schemas in this directory
+package logpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative log_entry.proto log_query.proto
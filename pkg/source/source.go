@@ -0,0 +1,108 @@
+// Package source defines the plugin interface for log inputs.
+//
+// An input lives in its own package and registers a Factory from init():
+//
+//	func init() {
+//		source.Register("kinesis", newKinesisSource)
+//	}
+//
+// Linking the package into the binary (a blank import in cmd/logstream/plugins.go)
+// makes it available, and it is enabled at startup with
+// -source kinesis:stream=logs,region=eu-west-1.
+package source
+
+import (
+	"fmt"
+	"logstream/pkg/models"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Source is an input that emits log entries into a channel
+type Source interface {
+	// Start begins emitting entries into out and must return without blocking.
+	// Entries are validated and stamped with the source name (when unset) by the caller.
+	Start(out chan<- models.LogEntry) error
+
+	// Stop ends emission; the source must not send on out afterwards
+	Stop()
+}
+
+// Config holds a source's key=value settings from its -source spec
+type Config map[string]string
+
+// Get returns the value for key, or fallback when it isn't set
+func (c Config) Get(key, fallback string) string {
+	if value, ok := c[key]; ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Factory creates a source from its configuration
+type Factory func(config Config) (Source, error)
+
+var (
+	registry   = make(map[string]Factory)
+	registryMu sync.RWMutex
+)
+
+// Register makes a source available under name. It panics if name is already
+// taken, since that means two plugins were linked in with the same name.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[name]; exists {
+		panic("source: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// New creates the source registered under name
+func New(name string, config Config) (Source, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return factory(config)
+}
+
+// Names returns the registered source names, sorted
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseSpec splits a "name:key=value,key=value" spec into a name and its Config
+func ParseSpec(spec string) (string, Config, error) {
+	name, settings, _ := strings.Cut(spec, ":")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, fmt.Errorf("source spec %q has no name", spec)
+	}
+
+	config := make(Config)
+	for _, setting := range strings.Split(settings, ",") {
+		if setting = strings.TrimSpace(setting); setting == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			return "", nil, fmt.Errorf("source %s: expected key=value, got %q", name, setting)
+		}
+		config[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return name, config, nil
+}